@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml/v2"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
@@ -51,7 +55,22 @@ func DefaultConfig() Config {
 	}
 }
 
-// LoadConfig loads configuration from YAML file and environment variables
+// configFileEnv is the environment variable that sets the path of the config file, instead of looking for configFiles.
+const configFileEnv = "KNPT_CONFIG_FILE"
+
+// configFiles are the config files that are looked for if configFileEnv isn't set, in order of precedence.
+var configFiles = []string{"config/knooppunt.yml", "config/knooppunt.yaml", "config/knooppunt.json", "config/knooppunt.toml"}
+
+// configParsers are the parsers of the supported config file formats, by file extension.
+var configParsers = map[string]koanf.Parser{
+	".yml":  yaml.Parser(),
+	".yaml": yaml.Parser(),
+	".json": json.Parser(),
+	".toml": toml.Parser(),
+}
+
+// LoadConfig loads configuration from a YAML, JSON or TOML file and environment variables.
+// The config file is the one set by KNPT_CONFIG_FILE, or else the first of configFiles that exists.
 func LoadConfig() (Config, error) {
 	// Initialize koanf instance
 	k := koanf.New(".")
@@ -62,20 +81,36 @@ func LoadConfig() (Config, error) {
 		return Config{}, err
 	}
 
-	// Try config files in config directory only
-	configFiles := []string{"config/knooppunt.yml"}
-
-	for _, cf := range configFiles {
-		if _, err := os.Stat(cf); err == nil {
-			if err := k.Load(file.Provider(cf), yaml.Parser()); err != nil {
-				return Config{}, fmt.Errorf("failed to load config file %s: %w", cf, err)
+	configFile := os.Getenv(configFileEnv)
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return Config{}, fmt.Errorf("config file set by %s not found: %w", configFileEnv, err)
+		}
+	} else {
+		// Try config files in config directory only, the first one that exists is loaded
+		for _, cf := range configFiles {
+			if _, err := os.Stat(cf); err == nil {
+				configFile = cf
+				break
 			}
-			break
+		}
+	}
+	if configFile != "" {
+		parser, ok := configParsers[strings.ToLower(filepath.Ext(configFile))]
+		if !ok {
+			return Config{}, fmt.Errorf("unsupported config file format: %s (supported: .yml, .yaml, .json, .toml)", configFile)
+		}
+		if err := k.Load(file.Provider(configFile), parser); err != nil {
+			return Config{}, fmt.Errorf("failed to load config file %s: %w", configFile, err)
 		}
 	}
 
 	// Load environment variables with KNPT_ prefix
 	if err := k.Load(env.Provider("KNPT_", ".", func(s string) string {
+		// The config file path isn't a configuration key
+		if s == configFileEnv {
+			return ""
+		}
 		// Convert KNPT_MCSD_LOCALDIRECTORY_FHIRBASEURL to mcsd.localdirectory.fhirbaseurl
 		// First remove the prefix and convert to lowercase
 		key := strings.TrimPrefix(s, "KNPT_")
@@ -96,6 +131,15 @@ func LoadConfig() (Config, error) {
 	if err := k.Unmarshal("", &config); err != nil {
 		return Config{}, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
 
 	return config, nil
 }
+
+// Validate checks the configuration of the components, so that mistakes are reported at startup.
+// All problems are reported at once, each naming the offending configuration key.
+func (c Config) Validate() error {
+	return errors.Join(c.MCSD.Validate(), c.MCSDAdmin.Validate())
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -69,6 +70,109 @@ nuts:
 	assert.Equal(t, "https://test.example.org/fhir", config.MCSD.AdministrationDirectories["test-org"].FHIRBaseURL)
 }
 
+func TestLoadConfig_FileFormats(t *testing.T) {
+	files := map[string]string{
+		"knooppunt.yml": `
+mcsd:
+  admin:
+    "test-org":
+      fhirbaseurl: "https://test.example.org/fhir"
+  query:
+    fhirbaseurl: "http://localhost:9090/fhir"
+  syncinterval: 5m
+  concurrency: 4
+mcsdadmin:
+  fhirbaseurl: "http://localhost:9090/fhir"
+nuts:
+  enabled: true
+`,
+		"knooppunt.json": `{
+  "mcsd": {
+    "admin": {"test-org": {"fhirbaseurl": "https://test.example.org/fhir"}},
+    "query": {"fhirbaseurl": "http://localhost:9090/fhir"},
+    "syncinterval": "5m",
+    "concurrency": 4
+  },
+  "mcsdadmin": {"fhirbaseurl": "http://localhost:9090/fhir"},
+  "nuts": {"enabled": true}
+}`,
+		"knooppunt.toml": `
+[mcsd]
+syncinterval = "5m"
+concurrency = 4
+
+[mcsd.admin.test-org]
+fhirbaseurl = "https://test.example.org/fhir"
+
+[mcsd.query]
+fhirbaseurl = "http://localhost:9090/fhir"
+
+[mcsdadmin]
+fhirbaseurl = "http://localhost:9090/fhir"
+
+[nuts]
+enabled = true
+`,
+	}
+	files["knooppunt.yaml"] = files["knooppunt.yml"]
+
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+
+	load := func(t *testing.T, name string) Config {
+		tempDir := t.TempDir()
+		configDir := filepath.Join(tempDir, "config")
+		require.NoError(t, os.MkdirAll(configDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(configDir, name), []byte(files[name]), 0644))
+		require.NoError(t, os.Chdir(tempDir))
+
+		config, err := LoadConfig()
+		require.NoError(t, err)
+		return config
+	}
+
+	expected := load(t, "knooppunt.yml")
+	assert.True(t, expected.Nuts.Enabled)
+	assert.Equal(t, 5*time.Minute, expected.MCSD.SyncInterval)
+	assert.Equal(t, 4, expected.MCSD.Concurrency)
+	for _, name := range []string{"knooppunt.yaml", "knooppunt.json", "knooppunt.toml"} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, load(t, name))
+		})
+	}
+}
+
+func TestLoadConfig_ConfigFileFromEnvironmentVariable(t *testing.T) {
+	t.Run("loads the file", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "custom.json")
+		err := os.WriteFile(configFile, []byte(`{"mcsdadmin": {"fhirbaseurl": "http://custom:8080/fhir"}}`), 0644)
+		require.NoError(t, err)
+		t.Setenv("KNPT_CONFIG_FILE", configFile)
+
+		config, err := LoadConfig()
+
+		require.NoError(t, err)
+		assert.Equal(t, "http://custom:8080/fhir", config.MCSDAdmin.FHIRBaseURL)
+	})
+	t.Run("file does not exist", func(t *testing.T) {
+		t.Setenv("KNPT_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yml"))
+
+		_, err := LoadConfig()
+
+		assert.ErrorContains(t, err, "config file set by KNPT_CONFIG_FILE not found")
+	})
+	t.Run("unsupported format", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "knooppunt.ini")
+		require.NoError(t, os.WriteFile(configFile, []byte("strictmode=false"), 0644))
+		t.Setenv("KNPT_CONFIG_FILE", configFile)
+
+		_, err := LoadConfig()
+
+		assert.ErrorContains(t, err, "unsupported config file format")
+	})
+}
+
 func TestLoadConfig_FromEnvironmentVariables(t *testing.T) {
 	// Set environment variables
 
@@ -83,6 +187,18 @@ func TestLoadConfig_FromEnvironmentVariables(t *testing.T) {
 	assert.Equal(t, "http://env-test:8080/fhir", config.MCSDAdmin.FHIRBaseURL)
 }
 
+func TestLoadConfig_Invalid(t *testing.T) {
+	t.Setenv("KNPT_MCSD_ADMIN_ROOT_FHIRBASEURL", "https://example.com/fhir")
+	t.Setenv("KNPT_MCSD_QUERY_FHIRBASEURL", "localhost:8080/fhir")
+	t.Setenv("KNPT_MCSDADMIN_AUTH_CLIENTID", "id")
+
+	_, err := LoadConfig()
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mcsd.query.fhirbaseurl must be an absolute http or https URL")
+	assert.Contains(t, err.Error(), "mcsdadmin.auth: tokenendpoint is required")
+}
+
 func TestLoadConfig_EnvOverridesYAML(t *testing.T) {
 	// Create config directory and file
 	tempDir := t.TempDir()
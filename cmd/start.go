@@ -38,6 +38,7 @@ func Start(ctx context.Context, config Config) error {
 		return errors.Wrap(err, "failed to start tracing component")
 	}
 
+	config.MCSD.StrictMode = config.StrictMode
 	mcsdUpdateClient, err := mcsd.New(config.MCSD)
 	if err != nil {
 		return errors.Wrap(err, "failed to create mCSD Update Client")
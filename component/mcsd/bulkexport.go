@@ -0,0 +1,228 @@
+package mcsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/component/tracing"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// errBulkExportNotStarted is returned when a mCSD Directory doesn't start a bulk data export, e.g. because it doesn't support it.
+var errBulkExportNotStarted = errors.New("bulk data export not started")
+
+// bulkExportTimeout limits how long is waited for a bulk data export to complete.
+const bulkExportTimeout = 30 * time.Minute
+
+// defaultBulkExportPollInterval is the interval at which the status of a bulk data export is polled, if the server doesn't specify one (using Retry-After).
+const defaultBulkExportPollInterval = time.Second
+
+// maxBulkExportLineSize is the maximum size of a single resource in the NDJSON output of a bulk data export.
+const maxBulkExportLineSize = 16 * 1024 * 1024
+
+// bulkExportManifest is the response of a completed bulk data export,
+// see https://hl7.org/fhir/uv/bulkdata/export.html#response---complete-status
+type bulkExportManifest struct {
+	TransactionTime     string             `json:"transactionTime"`
+	RequiresAccessToken bool               `json:"requiresAccessToken"`
+	Output              []bulkExportOutput `json:"output"`
+	Error               []bulkExportOutput `json:"error"`
+}
+
+type bulkExportOutput struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// bulkExport retrieves the current version of all resources of the given types from a mCSD Directory, using the FHIR Bulk Data $export operation.
+// The resources are returned as PUT entries, as if they were returned by a _history query (an export doesn't contain deleted resources).
+// For each resource type, a Bundle is returned with the transaction time of the export as meta.lastUpdated, to be used as time of the last update.
+// If the directory doesn't start the export, errBulkExportNotStarted is returned.
+func (c *Component) bulkExport(ctx context.Context, httpClient *http.Client, baseURL *url.URL, resourceTypes []string) ([]fhir.BundleEntry, map[string]fhir.Bundle, error) {
+	ctx, cancel := context.WithTimeout(ctx, bulkExportTimeout)
+	defer cancel()
+
+	statusURL, err := startBulkExport(ctx, httpClient, baseURL, resourceTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, err := c.awaitBulkExport(ctx, httpClient, statusURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(manifest.Error) > 0 {
+		return nil, nil, fmt.Errorf("bulk data export failed for %d file(s), e.g. %s", len(manifest.Error), manifest.Error[0].URL)
+	}
+	transactionTime, err := normalizeTimestamp(manifest.TransactionTime)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bulk data export has an invalid transactionTime: %w", err)
+	}
+
+	// Output files might be hosted elsewhere (e.g. in blob storage), then they don't require the directory's credentials
+	outputClient := httpClient
+	if !manifest.RequiresAccessToken {
+		outputClient = tracing.NewHTTPClient()
+	}
+	var entries []fhir.BundleEntry
+	for _, output := range manifest.Output {
+		if !slices.Contains(resourceTypes, output.Type) {
+			continue
+		}
+		outputEntries, err := readBulkExportOutput(ctx, outputClient, baseURL, output.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s bulk data export output: %w", output.Type, err)
+		}
+		entries = append(entries, outputEntries...)
+		if len(entries) > maxQueryEntries {
+			return nil, nil, fmt.Errorf("too many entries (%d)", len(entries))
+		}
+	}
+	searchSets := make(map[string]fhir.Bundle, len(resourceTypes))
+	for _, resourceType := range resourceTypes {
+		searchSets[resourceType] = fhir.Bundle{Meta: &fhir.Meta{LastUpdated: &transactionTime}}
+	}
+	return entries, searchSets, nil
+}
+
+// hasSyncedResources returns whether the query directory contains resources of the given types from the mCSD Directory
+// (i.e., with a meta.source below its base URL), e.g. from a synchronization before a restart.
+func (c *Component) hasSyncedResources(ctx context.Context, fhirBaseURL string, resourceTypes []string) (bool, error) {
+	for _, resourceType := range resourceTypes {
+		var searchSet fhir.Bundle
+		params := url.Values{
+			"_source:below": []string{fhirBaseURL},
+			"_count":        []string{"1"},
+		}
+		if err := c.fhirQueryClient.SearchWithContext(ctx, resourceType, params, &searchSet); err != nil {
+			return false, fmt.Errorf("failed to search %s resources of directory in query directory: %w", resourceType, err)
+		}
+		if len(searchSet.Entry) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startBulkExport kicks off a bulk data export of the given resource types, returning the URL to poll its status at.
+func startBulkExport(ctx context.Context, httpClient *http.Client, baseURL *url.URL, resourceTypes []string) (*url.URL, error) {
+	exportURL := baseURL.JoinPath("$export")
+	exportURL.RawQuery = url.Values{"_type": []string{strings.Join(resourceTypes, ",")}}.Encode()
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, exportURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Accept", "application/fhir+json")
+	httpRequest.Header.Set("Prefer", "respond-async")
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBulkExportNotStarted, err)
+	}
+	defer httpResponse.Body.Close()
+	contentLocation := httpResponse.Header.Get("Content-Location")
+	if httpResponse.StatusCode != http.StatusAccepted || contentLocation == "" {
+		return nil, fmt.Errorf("%w: server responded with status %d", errBulkExportNotStarted, httpResponse.StatusCode)
+	}
+	statusURL, err := httpRequest.URL.Parse(contentLocation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid Content-Location: %w", errBulkExportNotStarted, err)
+	}
+	return statusURL, nil
+}
+
+// awaitBulkExport polls the status of a bulk data export until it's complete, returning its manifest.
+func (c *Component) awaitBulkExport(ctx context.Context, httpClient *http.Client, statusURL *url.URL) (*bulkExportManifest, error) {
+	for {
+		httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		httpRequest.Header.Set("Accept", "application/json")
+		httpResponse, err := httpClient.Do(httpRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll bulk data export status: %w", err)
+		}
+		switch httpResponse.StatusCode {
+		case http.StatusOK:
+			var manifest bulkExportManifest
+			err := json.NewDecoder(httpResponse.Body).Decode(&manifest)
+			_ = httpResponse.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode bulk data export manifest: %w", err)
+			}
+			return &manifest, nil
+		case http.StatusAccepted:
+			_ = httpResponse.Body.Close()
+			delay := c.bulkExportPollInterval
+			if seconds, err := strconv.Atoi(httpResponse.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("bulk data export didn't complete: %w", ctx.Err())
+			case <-time.After(delay):
+			}
+		default:
+			_ = httpResponse.Body.Close()
+			return nil, fmt.Errorf("bulk data export failed: status endpoint responded with status %d", httpResponse.StatusCode)
+		}
+	}
+}
+
+// readBulkExportOutput downloads a NDJSON output file of a bulk data export, converting each resource to a PUT entry.
+func readBulkExportOutput(ctx context.Context, httpClient *http.Client, baseURL *url.URL, outputURL string) ([]fhir.BundleEntry, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, outputURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Accept", "application/fhir+ndjson")
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server responded with status %d", httpResponse.StatusCode)
+	}
+
+	var entries []fhir.BundleEntry
+	scanner := bufio.NewScanner(httpResponse.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBulkExportLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var resource struct {
+			ResourceType string `json:"resourceType"`
+			ID           string `json:"id"`
+		}
+		if err := json.Unmarshal(line, &resource); err != nil {
+			return nil, fmt.Errorf("invalid resource on line %d: %w", len(entries)+1, err)
+		}
+		if resource.ResourceType == "" || resource.ID == "" {
+			return nil, fmt.Errorf("resource on line %d has no resourceType or id", len(entries)+1)
+		}
+		fullURL := baseURL.JoinPath(resource.ResourceType, resource.ID).String()
+		entries = append(entries, fhir.BundleEntry{
+			FullUrl:  &fullURL,
+			Resource: slices.Clone(line),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    resource.ResourceType + "/" + resource.ID,
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,168 @@
+package mcsd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestComponent_bulkExport(t *testing.T) {
+	ctx := context.Background()
+	const organizationNDJSON = `{"resourceType":"Organization","id":"org-1","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"1"}],"name":"Example Organization","endpoint":[{"reference":"Endpoint/ep-1"}]}
+`
+	const endpointNDJSON = `{"resourceType":"Endpoint","id":"ep-1","status":"active","connectionType":{"system":"http://terminology.hl7.org/CodeSystem/endpoint-connection-type","code":"hl7-fhir-rest"},"payloadType":[{"text":"any"}],"managingOrganization":{"reference":"Organization/org-1"},"address":"https://example.com/fhir"}
+`
+	historyResponse, err := os.ReadFile("test/prune_dangling_endpoint_refs_history_response.json")
+	require.NoError(t, err)
+	emptyResponse, err := os.ReadFile("test/empty_bundle_response.json")
+	require.NoError(t, err)
+	organizationHistoryResponse := historyResponse
+	endpointHistoryResponse := emptyResponse
+
+	setup := func(t *testing.T, exportHandler http.HandlerFunc) (*Component, *test.StubFHIRClient, string, *atomic.Int32) {
+		var historyQueries atomic.Int32
+		mux := http.NewServeMux()
+		var serverURL string
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(historyResponse)
+		})
+		mux.HandleFunc("/fhir/{resourceType}/_history", func(w http.ResponseWriter, r *http.Request) {
+			historyQueries.Add(1)
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if r.PathValue("resourceType") == "Organization" {
+				_, _ = w.Write(organizationHistoryResponse)
+			} else if r.PathValue("resourceType") == "Endpoint" {
+				_, _ = w.Write(endpointHistoryResponse)
+			} else {
+				_, _ = w.Write(emptyResponse)
+			}
+		})
+		mux.HandleFunc("/fhir/$export", exportHandler)
+		var polls atomic.Int32
+		mux.HandleFunc("/export-status", func(w http.ResponseWriter, r *http.Request) {
+			if polls.Add(1) == 1 {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"transactionTime":"2025-08-14T10:00:00Z","requiresAccessToken":false,"output":[` +
+				`{"type":"Organization","url":"` + serverURL + `/output/Organization.ndjson"},` +
+				`{"type":"Endpoint","url":"` + serverURL + `/output/Endpoint.ndjson"}],"error":[]}`))
+		})
+		mux.HandleFunc("/output/Organization.ndjson", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+ndjson")
+			_, _ = w.Write([]byte(organizationNDJSON))
+		})
+		mux.HandleFunc("/output/Endpoint.ndjson", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+ndjson")
+			_, _ = w.Write([]byte(endpointNDJSON))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		serverURL = server.URL
+
+		directoryURL := server.URL + "/fhir"
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: directoryURL, BulkExportSupport: true},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.bulkExportPollInterval = time.Millisecond
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+		return component, queryDirectory, directoryURL, &historyQueries
+	}
+	startExport := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("_type") != "Organization,Endpoint" || r.Header.Get("Prefer") != "respond-async" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Location", "/export-status")
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	t.Run("initial sync uses $export", func(t *testing.T) {
+		component, queryDirectory, directoryURL, historyQueries := setup(t, startExport)
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		assert.Empty(t, report.Warnings)
+		assert.Zero(t, historyQueries.Load())
+		assert.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		assert.Len(t, queryDirectory.CreatedResources["Endpoint"], 1)
+		assert.Equal(t, map[string]string{"Organization": "2025-08-14T10:00:00Z", "Endpoint": "2025-08-14T10:00:00Z"}, component.lastUpdateTimes[directoryURL])
+	})
+	t.Run("full sync after restart queries history, to delete resources that were deleted in the meantime", func(t *testing.T) {
+		component, queryDirectory, directoryURL, historyQueries := setup(t, startExport)
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+		require.NoError(t, err)
+		require.Zero(t, historyQueries.Load())
+		// Restart (the times of the last update aren't persisted), after which the Endpoint is deleted
+		component, err = New(component.config)
+		require.NoError(t, err)
+		component.fhirQueryClient = queryDirectory
+		organizationHistoryResponse = emptyResponse
+		endpointHistoryResponse = []byte(`{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"` + directoryURL + `/Endpoint/ep-1","request":{"method":"DELETE","url":"Endpoint/ep-1"}}]}`)
+		t.Cleanup(func() {
+			organizationHistoryResponse = historyResponse
+			endpointHistoryResponse = emptyResponse
+		})
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), historyQueries.Load())
+		assert.Equal(t, 1, report.CountDeleted)
+		var searchSet fhir.Bundle
+		require.NoError(t, queryDirectory.SearchWithContext(ctx, "Endpoint", url.Values{"_source": []string{directoryURL + "/Endpoint/ep-1"}}, &searchSet))
+		assert.Empty(t, searchSet.Entry, "deleted Endpoint should be removed from the query directory")
+	})
+	t.Run("incremental sync queries history", func(t *testing.T) {
+		component, _, directoryURL, historyQueries := setup(t, startExport)
+		component.lastUpdateTimes[directoryURL] = map[string]string{"Organization": "2025-08-01T10:00:00Z", "Endpoint": "2025-08-01T10:00:00Z"}
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), historyQueries.Load())
+	})
+	t.Run("export not supported, falls back to history", func(t *testing.T) {
+		component, queryDirectory, directoryURL, historyQueries := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		assert.NotContains(t, strings.Join(report.Warnings, "\n"), "bulk data export", "unsupported $export should not be reported")
+		assert.Equal(t, int32(2), historyQueries.Load())
+		assert.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+	})
+	t.Run("export fails, falls back to history", func(t *testing.T) {
+		component, queryDirectory, directoryURL, historyQueries := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Location", "/unknown-status")
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		assert.Contains(t, report.Warnings, "bulk data export failed, queried history instead: bulk data export failed: status endpoint responded with status 404")
+		assert.Equal(t, int32(2), historyQueries.Load())
+		assert.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+	})
+}
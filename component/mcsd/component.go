@@ -1,10 +1,15 @@
 package mcsd
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
 	"slices"
@@ -20,6 +25,10 @@ import (
 	libfhir "github.com/nuts-foundation/nuts-knooppunt/lib/fhirutil"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/httpauth"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/netutil"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/profile"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/tlsutil"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/caramel/to"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
 )
@@ -32,16 +41,63 @@ var defaultDirectoryResourceTypes = []string{"Organization", "Endpoint", "Locati
 // parentOrganizationMap maps parent organizations (with URA identifier) to their linked child organizations
 type parentOrganizationMap map[*fhir.Organization][]*fhir.Organization
 
-// clockSkewBuffer is subtracted from local time when Bundle meta.lastUpdated is not available
+// defaultClockSkewBuffer is subtracted from local time when Bundle meta.lastUpdated is not available
 // to account for potential clock differences between client and FHIR server
-var clockSkewBuffer = 2 * time.Second
+const defaultClockSkewBuffer = 2 * time.Second
 
-// maxUpdateEntries limits the number of entries processed in a single FHIR transaction to prevent excessive load on the FHIR server
+// errUnknownDirectory is returned when an update is requested for a mCSD Directory that isn't registered.
+var errUnknownDirectory = errors.New("unknown mCSD Directory")
+
+// errResourceTypeNotSupported is returned when a directory responds with 404 Not Found or 410 Gone when querying a resource type.
+var errResourceTypeNotSupported = errors.New("resource type not supported by directory")
+
+// noResponseError wraps an error that occurred before the directory responded, e.g. because it's unreachable.
+type noResponseError struct {
+	error
+}
+
+func (e noResponseError) Unwrap() error {
+	return e.error
+}
+
+// errPaginationIncomplete is returned along with the entries collected so far when pagination failed on a later page,
+// and ApplyPartialOnPaginationError is enabled.
+var errPaginationIncomplete = errors.New("pagination incomplete")
+
+// errSyncCancelled is reported for directories that weren't updated, because the update was cancelled (e.g. on shutdown).
+var errSyncCancelled = errors.New("sync cancelled")
+
+const (
+	// MissingBundleMetaFallbackLocalTime uses local time minus the configured clock skew buffer as next sync time when Bundle meta.lastUpdated is not available.
+	MissingBundleMetaFallbackLocalTime = "localtime"
+	// MissingBundleMetaFallbackFullSync doesn't store a next sync time when Bundle meta.lastUpdated is not available, causing a full sync on the next run.
+	MissingBundleMetaFallbackFullSync = "fullsync"
+)
+
+const (
+	// QueryDirectoryTargetPrimary indicates changes were applied to the (primary) query directory.
+	QueryDirectoryTargetPrimary = "primary"
+	// QueryDirectoryTargetFallback indicates changes were applied to the fallback query directory, since the primary one was unavailable.
+	QueryDirectoryTargetFallback = "fallback"
+)
+
+// maxUpdateEntries limits the number of entries processed in a single FHIR transaction to prevent excessive load on the FHIR server.
+// It's the default for the configured transaction chunk size.
 const maxUpdateEntries = 1000
 
-// searchPageSize is an arbitrary FHIR search result limit (per page), so we have deterministic behavior across FHIR servers,
+// maxQueryEntries limits the number of entries fetched in a single query (across all pages), to prevent excessive memory usage.
+const maxQueryEntries = 100 * maxUpdateEntries
+
+// defaultSearchPageSize is an arbitrary FHIR search result limit (per page), so we have deterministic behavior across FHIR servers,
 // and don't rely on server defaults (which may be very high or very low (Azure FHIR's default is 10)).
-const searchPageSize = 100
+const defaultSearchPageSize = 100
+
+// normalizeBaseURL removes a trailing slash from the FHIR base URL of a mCSD Directory, so that a directory is identified
+// (e.g. in its directory key and the _source of its resources) by the same URL, regardless of whether it's configured
+// or discovered with a trailing slash.
+func normalizeBaseURL(fhirBaseURL string) string {
+	return strings.TrimSuffix(fhirBaseURL, "/")
+}
 
 // makeDirectoryKey creates a composite key from fhirBaseURL and authoritativeUra for tracking sync state per directory.
 // This allows multiple directories with the same FHIR base URL but different authoritative URAs to maintain separate sync states.
@@ -65,64 +121,480 @@ func makeDirectoryKey(fhirBaseURL, authoritativeUra string) string {
 //   - These are mitigating measures to prevent an attacker to spoof another care organization.
 //   - The organization's mcsd-directory-endpoint must be discoverable through the root mCSD Directory.'
 type Component struct {
-	config            Config
-	fhirAdminClientFn func(baseURL *url.URL) fhirclient.Client
+	config Config
+	// fhirAdminClientFn returns the client of the mCSD Directory registered with the given base URL, which queries it at baseURL
+	// (which differs from fhirBaseURL if the directory was rebased after a redirect).
+	fhirAdminClientFn func(fhirBaseURL string, baseURL *url.URL) fhirclient.Client
 	fhirQueryClient   fhirclient.Client
+	// fhirQueryFallbackClient is the client of the query directory that is used when the primary one is unavailable. It's nil if not configured.
+	fhirQueryFallbackClient fhirclient.Client
+	// queryMirrors are the additional query directories the changes are applied to, sorted by key.
+	queryMirrors []queryMirror
+	// pendingMirrorChunks holds the transaction chunks that couldn't be applied to a query mirror yet (by query mirror key and directory key).
+	pendingMirrorChunks map[string]map[string][]fhir.Bundle
+	queryMirrorMux      *sync.Mutex
 
 	administrationDirectories []administrationDirectory
 	directoryResourceTypes    []string
-	lastUpdateTimes           map[string]string
+	lastUpdateTimes           map[string]map[string]string
 	updateMux                 *sync.RWMutex
+	directoryStates           map[string]DirectorySyncState
+	stateMux                  *sync.RWMutex
+	syncLagCollector          prometheus.Collector
+	syncMetrics               *syncMetrics
+	nowFunc                   func() time.Time
+	// unregisteredDirectories holds the time at which discovered directories were unregistered (by directory key),
+	// used to retain their sync state for the configured grace period.
+	unregisteredDirectories map[string]time.Time
+	// organizationCounts holds the number of organizations of each directory (by directory key) seen in the previous run.
+	organizationCounts map[string]int
+	// uraWriters holds the key of the directory that last wrote an organization with a URA to the query directory (by URA),
+	// used to detect directories that claim the same organization.
+	uraWriters map[string]string
+	// proxyTransport is the transport for requests to mCSD Directories without their own HTTP client, if a proxy is configured.
+	// If nil, the default transport (which uses the proxy from the environment) is used.
+	proxyTransport http.RoundTripper
+	// conflictRetryBackoff is the initial delay before retrying a transaction that failed due to a conflict.
+	conflictRetryBackoff time.Duration
+	// webhookRetryBackoff is the initial delay before retrying a failed post-sync webhook call.
+	webhookRetryBackoff time.Duration
+	// missingBundleMetaReported holds the directories (by directory key) for which a missing Bundle meta.lastUpdated has been reported,
+	// so the warning isn't repeated on every run.
+	missingBundleMetaReported map[string]bool
+	// queryWriteSemaphore limits the number of concurrent transactions on the query directory.
+	queryWriteSemaphore chan struct{}
+	// configHash identifies the effective configuration, so synchronization runs can be correlated with the configuration that produced them.
+	configHash string
+	// directoryMux guards the registered directories and their state (e.g. lastUpdateTimes), since directories can be updated concurrently.
+	// updateMux can't be used for this, since it's held for the duration of the whole update.
+	directoryMux *sync.Mutex
+	// idempotentUpdates holds the updates triggered with an idempotency key (by key), so duplicate triggers share a single run.
+	idempotentUpdates   map[string]*idempotentUpdate
+	idempotentUpdateMux *sync.Mutex
+	// fhirVersionChecked holds the directories (by directory key) of which the advertised FHIR version has been checked.
+	fhirVersionChecked map[string]bool
+	// rebasedURLs holds the base URL that is used to query a directory (by directory key), if it redirected to another host.
+	rebasedURLs map[string]*url.URL
+	// resourceValidator validates the contents of resources before they're written to the query directory.
+	resourceValidator ResourceValidator
+	// bulkExportDirectories holds the base URLs of the mCSD Directories that are fully synchronized using $export.
+	bulkExportDirectories map[string]bool
+	// systemHistoryDirectories holds the base URLs of the mCSD Directories of which the history is queried using a system-level _history request.
+	systemHistoryDirectories map[string]bool
+	// bulkExportPollInterval is the interval at which the status of a $export is polled, if the directory doesn't specify one.
+	bulkExportPollInterval time.Duration
+	// directoryHTTPClients holds the HTTP clients of mCSD Directories that require their own authentication (by base URL).
+	directoryHTTPClients map[string]*http.Client
+	// progress distributes progress events of updates to clients of GET /mcsd/progress.
+	progress *progressBroker
+	// schedulerCancel stops the scheduler that periodically updates the directories, if SyncInterval is configured.
+	schedulerCancel context.CancelFunc
+	// schedulerDone is closed when the scheduler has stopped.
+	schedulerDone chan struct{}
+	// reportHistory holds the reports of the most recent updates (oldest first), used to diff runs.
+	reportHistory    []storedReport
+	reportHistoryMux *sync.Mutex
+	// discoveryLog holds the most recent events of discovered directories being registered or unregistered (oldest first).
+	discoveryLog    []DiscoveryEvent
+	discoveryLogMux *sync.Mutex
 }
 
 func DefaultConfig() Config {
 	return Config{
-		DirectoryResourceTypes: defaultDirectoryResourceTypes,
+		DirectoryResourceTypes:        defaultDirectoryResourceTypes,
+		SearchPageSize:                defaultSearchPageSize,
+		ClockSkewBuffer:               defaultClockSkewBuffer,
+		RequireHTTPSForDiscovered:     true,
+		UnregisteredStateRetention:    time.Hour,
+		OrgCountDropThreshold:         50,
+		QueryDirectoryConflictRetries: 3,
+		MaxRetries:                    2,
+		SyncInactiveOrganizations:     true,
+		RetryBaseDelay:                500 * time.Millisecond,
+		MaxRetryAfter:                 time.Minute,
+		MissingBundleMetaFallback:     MissingBundleMetaFallbackLocalTime,
+		CrossHostRedirects:            CrossHostRedirectsFollow,
+		ResourceValidation:            ResourceValidationWarn,
+		MultipleURAs:                  MultipleURAsSkip,
+		DirectoryEndpointCodings:      []DirectoryEndpointCoding{defaultDirectoryEndpointCoding},
+		DiscoveryAllowedSchemes:       []string{"http", "https"},
+		AuthoritativeIdentifierSystem: coding.URANamingSystem,
+		MaxConcurrentQueryWrites:      1,
+		TransactionChunkSize:          maxUpdateEntries,
+		Concurrency:                   1,
+		MaxDiscoveryDepth:             1,
+		RequiredProfiles: map[string]string{
+			"Organization":      profile.NLGenericFunctionOrganization,
+			"Endpoint":          profile.NLGenericFunctionEndpoint,
+			"Location":          profile.NLGenericFunctionLocation,
+			"HealthcareService": profile.NLGenericFunctionHealthcareService,
+		},
 	}
 }
 
 type Config struct {
-	AdministrationDirectories map[string]DirectoryConfig `koanf:"admin"`
-	QueryDirectory            DirectoryConfig            `koanf:"query"`
-	ExcludeAdminDirectories   []string                   `koanf:"adminexclude"`
-	DirectoryResourceTypes    []string                   `koanf:"directoryresourcetypes"`
-	Auth                      httpauth.OAuth2Config      `koanf:"auth"`
+	AdministrationDirectories      map[string]DirectoryConfig   `koanf:"admin"`
+	QueryDirectory                 DirectoryConfig              `koanf:"query"`
+	QueryDirectoryFallback         DirectoryConfig              `koanf:"queryfallback"`
+	QueryMirrors                   map[string]DirectoryConfig   `koanf:"querymirrors"`
+	ExcludeAdminDirectories        []string                     `koanf:"adminexclude"`
+	DirectoryResourceTypes         []string                     `koanf:"directoryresourcetypes"`
+	Auth                           httpauth.OAuth2Config        `koanf:"auth"`
+	DirectoryAuthFallback          bool                         `koanf:"directoryauthfallback"`
+	OrgDiscoveryPageSize           int                          `koanf:"orgdiscoverypagesize"`
+	SkipResourcesWithoutID         bool                         `koanf:"skipresourceswithoutid"`
+	RequireHTTPSForDiscovered      bool                         `koanf:"requirehttpsfordiscovered"`
+	RequiredProfiles               map[string]string            `koanf:"requiredprofiles"`
+	FilterHistoryByProfile         bool                         `koanf:"filterhistorybyprofile"`
+	ResourceTypeRules              map[string]ResourceTypeRules `koanf:"resourcetyperules"`
+	SyncEnteredInError             bool                         `koanf:"syncenteredinerror"`
+	UnregisteredStateRetention     time.Duration                `koanf:"unregisteredstateretention"`
+	OrgCountDropThreshold          int                          `koanf:"orgcountdropthreshold"`
+	BlockDeletesOnOrgCountDrop     bool                         `koanf:"blockdeletesonorgcountdrop"`
+	QueryDirectoryConflictRetries  int                          `koanf:"querydirectoryconflictretries"`
+	MissingBundleMetaFallback      string                       `koanf:"missingbundlemetafallback"`
+	DeduplicationIdentifierSystems map[string]string            `koanf:"deduplicationidentifiersystems"`
+	MaxConcurrentQueryWrites       int                          `koanf:"maxconcurrentquerywrites"`
+	MaxDiscoveryDepth              int                          `koanf:"maxdiscoverydepth"`
+	InferMissingRequest            bool                         `koanf:"infermissingrequest"`
+	PostSyncWebhookURL             string                       `koanf:"postsyncwebhookurl"`
+	PostSyncWebhookAuthorization   string                       `koanf:"postsyncwebhookauthorization"`
+	PruneDanglingEndpointRefs      bool                         `koanf:"prunedanglingendpointrefs"`
+	DiscoveryCacheFile             string                       `koanf:"discoverycachefile"`
+	FHIRVersion                    string                       `koanf:"fhirversion"`
+	TransactionBufferDir           string                       `koanf:"transactionbufferdir"`
+	SyncInterval                   time.Duration                `koanf:"syncinterval"`
+	MaxRetries                     int                          `koanf:"maxretries"`
+	RetryBaseDelay                 time.Duration                `koanf:"retrybasedelay"`
+	SyncInactiveOrganizations      bool                         `koanf:"syncinactiveorganizations"`
+	Concurrency                    int                          `koanf:"concurrency"`
+	TransactionChunkSize           int                          `koanf:"transactionchunksize"`
+	TagWithDirectoryKey            bool                         `koanf:"tagwithdirectorykey"`
+	ApplyPartialOnPaginationError  bool                         `koanf:"applypartialonpaginationerror"`
+	CrossHostRedirects             string                       `koanf:"crosshostredirects"`
+	SearchPageSize                 int                          `koanf:"searchpagesize"`
+	ClockSkewBuffer                time.Duration                `koanf:"clockskewbuffer"`
+	ResourceValidation             string                       `koanf:"resourcevalidation"`
+	AuthoritativeIdentifierSystem  string                       `koanf:"authoritativeidentifiersystem"`
+	MaxRetryAfter                  time.Duration                `koanf:"maxretryafter"`
+	StripMetaLabels                bool                         `koanf:"stripmetalabels"`
+	PreserveSourceLastUpdated      bool                         `koanf:"preservesourcelastupdated"`
+	MultipleURAs                   string                       `koanf:"multipleuras"`
+	DirectoryEndpointCodings       []DirectoryEndpointCoding    `koanf:"directoryendpointcodings"`
+	DiscoveryAllowedSchemes        []string                     `koanf:"discoveryallowedschemes"`
+	RequestTimeout                 time.Duration                `koanf:"requesttimeout"`
+	ProxyURL                       string                       `koanf:"proxyurl"`
+	ExcludeResourceTypes           []string                     `koanf:"excluderesourcetypes"`
+	// QueryTargetConcurrency is the maximum number of query directories (the query directory and query mirrors) a transaction is applied to concurrently.
+	// If not set, it's applied to all of them concurrently.
+	QueryTargetConcurrency int `koanf:"querytargetconcurrency"`
+	// StrictMode is set from the global strict mode configuration.
+	StrictMode bool `koanf:"-"`
 }
 
 type DirectoryConfig struct {
 	FHIRBaseURL string `koanf:"fhirbaseurl"`
+	// Auth configures OAuth2 authentication for requests to this directory, if it requires its own credentials.
+	Auth httpauth.OAuth2Config `koanf:"auth"`
+	// Config configures the client certificate (mTLS) and CA used to connect to this directory, if it requires them.
+	// If both OAuth2 and mTLS are configured, both apply (also to the OAuth2 token endpoint).
+	tlsutil.Config `koanf:",squash"`
+	// BulkExportSupport enables the FHIR Bulk Data $export operation for the initial (full) synchronization of this directory.
+	// If the directory doesn't start the export, or it fails, the directory's history is queried instead.
+	BulkExportSupport bool `koanf:"bulkexport"`
+	// SystemHistorySupport enables querying the history of all resource types (except Organization) in a single
+	// system-level _history request with the _type parameter, instead of one request per resource type.
+	// If the directory rejects the request (4xx), the history is queried per resource type instead.
+	SystemHistorySupport bool `koanf:"systemhistory"`
+	// ExcludeResourceTypes are the resource types that aren't synchronized from this directory.
+	ExcludeResourceTypes []string `koanf:"excluderesourcetypes"`
+}
+
+// DirectoryEndpointCoding is a payloadType coding that identifies an Endpoint as mCSD Directory.
+type DirectoryEndpointCoding struct {
+	System string `koanf:"system"`
+	Code   string `koanf:"code"`
+}
+
+func (c DirectoryEndpointCoding) String() string {
+	return c.System + "|" + c.Code
+}
+
+// defaultDirectoryEndpointCoding is the payloadType coding of mCSD Directory endpoints as specified by the IG.
+var defaultDirectoryEndpointCoding = DirectoryEndpointCoding{
+	System: coding.MCSDPayloadTypeSystem,
+	Code:   coding.MCSDPayloadTypeDirectoryCode,
+}
+
+// Validate checks the configuration for mistakes that would otherwise only surface during synchronization,
+// returning an error that names the offending keys.
+func (c Config) Validate() error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(c.AdministrationDirectories)) {
+		errs = append(errs, c.AdministrationDirectories[key].validate("mcsd.admin."+key, true))
+	}
+	if len(c.AdministrationDirectories) > 0 && c.QueryDirectory.FHIRBaseURL == "" {
+		errs = append(errs, errors.New("mcsd.query.fhirbaseurl is required when root directories (mcsd.admin) are configured"))
+	}
+	errs = append(errs, c.QueryDirectory.validate("mcsd.query", false))
+	errs = append(errs, c.QueryDirectoryFallback.validate("mcsd.queryfallback", false))
+	for _, key := range slices.Sorted(maps.Keys(c.QueryMirrors)) {
+		errs = append(errs, c.QueryMirrors[key].validate("mcsd.querymirrors."+key, true))
+	}
+	if err := c.Auth.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("mcsd.auth: %w", err))
+	}
+	if c.PostSyncWebhookURL != "" {
+		if err := netutil.ValidateHTTPURL(c.PostSyncWebhookURL); err != nil {
+			errs = append(errs, fmt.Errorf("mcsd.postsyncwebhookurl %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the configuration of the directory, of which the configuration key is given.
+func (c DirectoryConfig) validate(key string, requireURL bool) error {
+	var errs []error
+	if c.FHIRBaseURL == "" {
+		if requireURL {
+			errs = append(errs, fmt.Errorf("%s.fhirbaseurl is required", key))
+		}
+	} else if err := netutil.ValidateHTTPURL(c.FHIRBaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("%s.fhirbaseurl %w", key, err))
+	}
+	if err := c.Auth.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%s.auth: %w", key, err))
+	}
+	return errors.Join(errs...)
+}
+
+// withoutSecrets returns the configuration with its secrets (OAuth2 client secret, private key and TLS key password) removed.
+func (c DirectoryConfig) withoutSecrets() DirectoryConfig {
+	c.Auth.ClientSecret = ""
+	c.Auth.PrivateKeyPEM = ""
+	c.TLSKeyPassword = ""
+	return c
+}
+
+// hasOwnClient returns whether the directory requires an HTTP client with its own credentials.
+func (c DirectoryConfig) hasOwnClient() bool {
+	return c.Auth.IsConfigured() || c.TLSCertFile != ""
 }
 
 type UpdateReport map[string]DirectoryUpdateReport
 
 type administrationDirectory struct {
-	fhirBaseURL      string
-	resourceTypes    []string
-	discover         bool
+	fhirBaseURL   string
+	resourceTypes []string
+	discover      bool
+	// depth is the number of discovery steps between this directory and a root directory (0 for root directories).
+	depth            int
 	sourceURL        string // The fullUrl from the Bundle entry that created this Endpoint, used for unregistration on DELETE
 	authoritativeUra string // URA of the organization that is authoritative for this directory
 }
 
+// DirectorySyncState describes the synchronization state of a mCSD Directory.
+type DirectorySyncState struct {
+	LastAttempt time.Time  `json:"last_attempt"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// LagSeconds is the time in seconds since the last successful synchronization.
+	LagSeconds *float64 `json:"lag_seconds,omitempty"`
+	// SupportedResourceTypes contains the resource types that were successfully queried from the directory.
+	SupportedResourceTypes []string `json:"supported_resource_types,omitempty"`
+	// UnsupportedResourceTypes contains the resource types for which the directory responded with 404 Not Found or 410 Gone.
+	UnsupportedResourceTypes []string `json:"unsupported_resource_types,omitempty"`
+	// ConfigHash identifies the configuration that was active during the last synchronization attempt.
+	ConfigHash string `json:"config_hash,omitempty"`
+}
+
+// Status is a snapshot of the registered mCSD Directories and the times of their last update, returned by GET /mcsd/status.
+type Status struct {
+	// LastUpdateTimes contains the time of the last update (used for incremental sync) by directory key and resource type.
+	LastUpdateTimes map[string]map[string]string `json:"last_update_times"`
+	Directories     []DirectoryStatus            `json:"directories"`
+}
+
+// DirectoryStatus describes a registered mCSD Directory.
+type DirectoryStatus struct {
+	FHIRBaseURL      string   `json:"fhir_base_url"`
+	AuthoritativeUra string   `json:"authoritative_ura,omitempty"`
+	Discover         bool     `json:"discover"`
+	ResourceTypes    []string `json:"resource_types"`
+}
+
 type DirectoryUpdateReport struct {
 	CountCreated int      `json:"created"`
 	CountUpdated int      `json:"updated"`
 	CountDeleted int      `json:"deleted"`
 	Warnings     []string `json:"warnings"`
 	Errors       []string `json:"errors"`
+	// CountPlanned is the number of operations that would have been applied to the query directory, when doing a dry run.
+	CountPlanned int `json:"planned,omitempty"`
+	// CountPlannedPut and CountPlannedDelete break CountPlanned down into resources that would have been created/updated and deleted.
+	CountPlannedPut    int `json:"planned_put,omitempty"`
+	CountPlannedDelete int `json:"planned_delete,omitempty"`
+	// ConfigHash identifies the configuration that produced the update.
+	ConfigHash string `json:"config_hash,omitempty"`
+	// ResourceTypes lists the resource types the directory was queried for.
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// QueryDirectory is the query directory the changes were applied to (primary or fallback), if a fallback query directory is configured.
+	QueryDirectory string `json:"query_directory,omitempty"`
+	// DurationMillis is how long the update of the directory took, in milliseconds.
+	DurationMillis int64 `json:"duration_ms"`
+	// PerResourceType breaks the counts down by resource type, to find out which resource type is slow or failing.
+	PerResourceType map[string]*ResourceTypeReport `json:"per_resource_type,omitempty"`
+	// QueryMirrors contains the outcome of applying the changes to each query mirror (by key), if configured.
+	QueryMirrors map[string]*QueryMirrorReport `json:"query_mirrors,omitempty"`
+	// Discovered lists the keys of the mCSD Directories that were discovered from this directory (registered before or in this update).
+	Discovered []string `json:"discovered,omitempty"`
+}
+
+// ResourceTypeReport contains the outcome of an update for a single resource type.
+type ResourceTypeReport struct {
+	CountCreated int `json:"created"`
+	CountUpdated int `json:"updated"`
+	CountDeleted int `json:"deleted"`
+	// CountErrors is the number of resources that couldn't be synchronized, or 1 if the resource type couldn't be queried.
+	CountErrors int `json:"errors"`
+}
+
+// resourceType returns the report of the given resource type, adding it if it doesn't exist yet.
+func (r *DirectoryUpdateReport) resourceType(resourceType string) *ResourceTypeReport {
+	if r.PerResourceType == nil {
+		r.PerResourceType = make(map[string]*ResourceTypeReport)
+	}
+	result, ok := r.PerResourceType[resourceType]
+	if !ok {
+		result = &ResourceTypeReport{}
+		r.PerResourceType[resourceType] = result
+	}
+	return result
+}
+
+// merge adds the counts of the other report to this report.
+func (r *DirectoryUpdateReport) merge(other DirectoryUpdateReport) {
+	r.CountCreated += other.CountCreated
+	r.CountUpdated += other.CountUpdated
+	r.CountDeleted += other.CountDeleted
+	for resourceType, otherCounts := range other.PerResourceType {
+		counts := r.resourceType(resourceType)
+		counts.CountCreated += otherCounts.CountCreated
+		counts.CountUpdated += otherCounts.CountUpdated
+		counts.CountDeleted += otherCounts.CountDeleted
+		counts.CountErrors += otherCounts.CountErrors
+	}
+}
+
+// syncOptions alters the behavior of a single update run, e.g. when requested through the $sync operation.
+type syncOptions struct {
+	// directory limits the update to the mCSD Directories with the given FHIR base URL. If empty, all directories are updated.
+	directory string
+	// since overrides the time of the last update, used for incremental sync.
+	since string
+	// full ignores the time of the last update, causing a full sync of all directories.
+	// On success, the time of the last update is set to the new value as usual.
+	full bool
+	// resourceTypes limits the update to the given resource types, intersected with the resource types of each directory.
+	// If a directory isn't synchronized for all its resource types, the time of its last update isn't changed.
+	resourceTypes []string
+	// dryRun builds the transaction, but doesn't apply it to the query directory nor changes the synchronization state.
+	dryRun bool
 }
 
 func New(config Config) (*Component, error) {
-	// Create HTTP client with optional OAuth2 authentication
-	var httpClient *http.Client
-	var err error
-	if config.Auth.IsConfigured() {
-		slog.Info("mCSD: OAuth2 authentication configured", slog.String("token_endpoint", config.Auth.TokenEndpoint))
-		httpClient, err = httpauth.NewOAuth2HTTPClient(config.Auth, tracing.WrapTransport(nil))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create OAuth2 HTTP client for mCSD: %w", err)
+	// Requests to mCSD Directories are sent through the configured proxy, otherwise the proxy from the environment (HTTP_PROXY etc.) is used
+	var proxyURL *url.URL
+	if config.ProxyURL != "" {
+		var err error
+		proxyURL, err = url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Host == "" || !slices.Contains([]string{"http", "https", "socks5"}, proxyURL.Scheme) {
+			return nil, fmt.Errorf("invalid proxy URL: %s (must be an absolute http, https or socks5 URL)", config.ProxyURL)
+		}
+	}
+
+	// Create HTTP client for the query directory with optional OAuth2 authentication and mTLS
+	queryDirectoryAuth := config.Auth
+	if config.QueryDirectory.Auth.IsConfigured() {
+		queryDirectoryAuth = config.QueryDirectory.Auth
+	}
+	httpClient, err := newHTTPClient(queryDirectoryAuth, config.QueryDirectory.Config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client for mCSD: %w", err)
+	}
+	if queryDirectoryAuth.IsConfigured() {
+		slog.Info("mCSD: OAuth2 authentication configured", logging.Config("auth", queryDirectoryAuth))
+	}
+
+	switch config.MissingBundleMetaFallback {
+	case "":
+		config.MissingBundleMetaFallback = MissingBundleMetaFallbackLocalTime
+	case MissingBundleMetaFallbackLocalTime, MissingBundleMetaFallbackFullSync:
+	default:
+		return nil, fmt.Errorf("invalid missing Bundle meta fallback: %s (valid options: %s, %s)", config.MissingBundleMetaFallback, MissingBundleMetaFallbackLocalTime, MissingBundleMetaFallbackFullSync)
+	}
+
+	if config.SearchPageSize <= 0 {
+		return nil, fmt.Errorf("invalid search page size: %d (must be positive)", config.SearchPageSize)
+	}
+
+	if err := validateFHIRVersion(config.FHIRVersion); err != nil {
+		return nil, err
+	}
+
+	if config.AuthoritativeIdentifierSystem == "" {
+		config.AuthoritativeIdentifierSystem = coding.URANamingSystem
+	}
+
+	switch config.ResourceValidation {
+	case "":
+		config.ResourceValidation = ResourceValidationWarn
+	case ResourceValidationOff, ResourceValidationWarn, ResourceValidationStrict:
+	default:
+		return nil, fmt.Errorf("invalid resource validation: %s (valid options: %s, %s, %s)", config.ResourceValidation, ResourceValidationOff, ResourceValidationWarn, ResourceValidationStrict)
+	}
+
+	if len(config.DirectoryEndpointCodings) == 0 {
+		config.DirectoryEndpointCodings = []DirectoryEndpointCoding{defaultDirectoryEndpointCoding}
+	}
+	for _, directoryCoding := range config.DirectoryEndpointCodings {
+		if directoryCoding.System == "" || directoryCoding.Code == "" {
+			return nil, fmt.Errorf("invalid directory endpoint coding: %s (system and code are required)", directoryCoding)
+		}
+	}
+
+	if len(config.DiscoveryAllowedSchemes) == 0 {
+		config.DiscoveryAllowedSchemes = []string{"http", "https"}
+	}
+	config.DiscoveryAllowedSchemes = slices.Clone(config.DiscoveryAllowedSchemes)
+	for i, scheme := range config.DiscoveryAllowedSchemes {
+		config.DiscoveryAllowedSchemes[i] = strings.ToLower(scheme)
+		switch config.DiscoveryAllowedSchemes[i] {
+		case "http", "https":
+		default:
+			return nil, fmt.Errorf("invalid discovery allowed scheme: %s (valid options: http, https)", scheme)
+		}
+	}
+
+	if len(config.ExcludeResourceTypes) > 0 {
+		if config.ExcludeResourceTypes, err = parseResourceTypes(strings.Join(config.ExcludeResourceTypes, ",")); err != nil {
+			return nil, fmt.Errorf("invalid excluded resource types: %w", err)
 		}
-	} else {
-		httpClient = tracing.NewHTTPClient()
+	}
+
+	switch config.MultipleURAs {
+	case "":
+		config.MultipleURAs = MultipleURAsSkip
+	case MultipleURAsSkip, MultipleURAsLowest:
+	default:
+		return nil, fmt.Errorf("invalid multiple URAs handling: %s (valid options: %s, %s)", config.MultipleURAs, MultipleURAsSkip, MultipleURAsLowest)
+	}
+
+	switch config.CrossHostRedirects {
+	case "":
+		config.CrossHostRedirects = CrossHostRedirectsFollow
+	case CrossHostRedirectsFollow, CrossHostRedirectsReject, CrossHostRedirectsRebase:
+	default:
+		return nil, fmt.Errorf("invalid cross-host redirects behavior: %s (valid options: %s, %s, %s)", config.CrossHostRedirects, CrossHostRedirectsFollow, CrossHostRedirectsReject, CrossHostRedirectsRebase)
 	}
 
 	queryDirectoryFHIRBaseURL, err := url.Parse(config.QueryDirectory.FHIRBaseURL)
@@ -131,54 +603,352 @@ func New(config Config) (*Component, error) {
 	}
 
 	result := &Component{
-		config: config,
-		fhirAdminClientFn: func(baseURL *url.URL) fhirclient.Client {
-			return fhirclient.New(baseURL, tracing.NewHTTPClient(), &fhirclient.Config{
-				UsePostSearch: false,
-			})
-		},
-		fhirQueryClient: fhirclient.New(queryDirectoryFHIRBaseURL, httpClient, &fhirclient.Config{
-			UsePostSearch: false,
-		}),
-		directoryResourceTypes: config.DirectoryResourceTypes,
-		lastUpdateTimes:        make(map[string]string),
-		updateMux:              &sync.RWMutex{},
+		config:                    config,
+		fhirQueryClient:           fhirclient.New(queryDirectoryFHIRBaseURL, httpClient, fhirClientConfig(config.FHIRVersion)),
+		directoryResourceTypes:    config.DirectoryResourceTypes,
+		lastUpdateTimes:           make(map[string]map[string]string),
+		updateMux:                 &sync.RWMutex{},
+		directoryStates:           make(map[string]DirectorySyncState),
+		stateMux:                  &sync.RWMutex{},
+		directoryMux:              &sync.Mutex{},
+		nowFunc:                   time.Now,
+		unregisteredDirectories:   make(map[string]time.Time),
+		organizationCounts:        make(map[string]int),
+		uraWriters:                make(map[string]string),
+		conflictRetryBackoff:      500 * time.Millisecond,
+		webhookRetryBackoff:       time.Second,
+		missingBundleMetaReported: make(map[string]bool),
+		idempotentUpdates:         make(map[string]*idempotentUpdate),
+		idempotentUpdateMux:       &sync.Mutex{},
+		fhirVersionChecked:        make(map[string]bool),
+		rebasedURLs:               make(map[string]*url.URL),
+		directoryHTTPClients:      make(map[string]*http.Client),
+		resourceValidator:         NewRequiredElementsValidator(),
+		bulkExportDirectories:     make(map[string]bool),
+		systemHistoryDirectories:  make(map[string]bool),
+		bulkExportPollInterval:    defaultBulkExportPollInterval,
+		progress:                  newProgressBroker(),
+		reportHistoryMux:          &sync.Mutex{},
+		discoveryLogMux:           &sync.Mutex{},
+		pendingMirrorChunks:       make(map[string]map[string][]fhir.Bundle),
+		queryMirrorMux:            &sync.Mutex{},
+	}
+	if config.QueryDirectoryFallback.FHIRBaseURL != "" {
+		fallbackFHIRBaseURL, err := url.Parse(config.QueryDirectoryFallback.FHIRBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback Query Directory FHIR base URL (url=%s): %w", config.QueryDirectoryFallback.FHIRBaseURL, err)
+		}
+		fallbackHTTPClient := httpClient
+		if config.QueryDirectoryFallback.hasOwnClient() {
+			if fallbackHTTPClient, err = newHTTPClient(config.QueryDirectoryFallback.Auth, config.QueryDirectoryFallback.Config, nil); err != nil {
+				return nil, fmt.Errorf("failed to create HTTP client for fallback Query Directory: %w", err)
+			}
+		}
+		result.fhirQueryFallbackClient = fhirclient.New(fallbackFHIRBaseURL, fallbackHTTPClient, fhirClientConfig(config.FHIRVersion))
+	}
+	for _, key := range slices.Sorted(maps.Keys(config.QueryMirrors)) {
+		mirror := config.QueryMirrors[key]
+		mirrorFHIRBaseURL, err := url.Parse(mirror.FHIRBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query mirror FHIR base URL (key=%s, url=%s): %w", key, mirror.FHIRBaseURL, err)
+		}
+		mirrorHTTPClient := httpClient
+		if mirror.hasOwnClient() {
+			if mirrorHTTPClient, err = newHTTPClient(mirror.Auth, mirror.Config, nil); err != nil {
+				return nil, fmt.Errorf("failed to create HTTP client for query mirror %s: %w", key, err)
+			}
+		}
+		result.queryMirrors = append(result.queryMirrors, newQueryMirror(key, fhirclient.New(mirrorFHIRBaseURL, mirrorHTTPClient, fhirClientConfig(config.FHIRVersion)), config.MaxConcurrentQueryWrites))
 	}
+	result.fhirAdminClientFn = func(fhirBaseURL string, baseURL *url.URL) fhirclient.Client {
+		return fhirclient.New(baseURL, result.directoryHTTPClient(fhirBaseURL), fhirClientConfig(config.FHIRVersion))
+	}
+	if proxyURL != nil {
+		result.proxyTransport = newProxyTransport(proxyURL)
+	}
+	result.syncLagCollector = syncLagCollector{component: result}
+	result.syncMetrics = newSyncMetrics()
 	for _, rootDirectory := range config.AdministrationDirectories {
-		if err := result.registerAdministrationDirectory(context.Background(), rootDirectory.FHIRBaseURL, rootDirectoryResourceTypes, true, "", ""); err != nil {
+		// The credentials of the query directory (Config.Auth) are only used for root directories without their own credentials
+		// if explicitly enabled, since they're sent to a remote party then.
+		if config.DirectoryAuthFallback && !rootDirectory.Auth.IsConfigured() {
+			rootDirectory.Auth = config.Auth
+		}
+		fhirBaseURL := normalizeBaseURL(rootDirectory.FHIRBaseURL)
+		if rootDirectory.hasOwnClient() {
+			directoryHTTPClient, err := newHTTPClient(rootDirectory.Auth, rootDirectory.Config, proxyURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create HTTP client for root administration directory (url=%s): %w", rootDirectory.FHIRBaseURL, err)
+			}
+			directoryHTTPClient.CheckRedirect = result.checkRedirect
+			result.directoryHTTPClients[fhirBaseURL] = directoryHTTPClient
+		}
+		if rootDirectory.BulkExportSupport {
+			result.bulkExportDirectories[fhirBaseURL] = true
+		}
+		if rootDirectory.SystemHistorySupport {
+			result.systemHistoryDirectories[fhirBaseURL] = true
+		}
+		resourceTypes := rootDirectoryResourceTypes
+		if len(rootDirectory.ExcludeResourceTypes) > 0 {
+			excludedTypes, err := parseResourceTypes(strings.Join(rootDirectory.ExcludeResourceTypes, ","))
+			if err != nil {
+				return nil, fmt.Errorf("invalid excluded resource types of root administration directory (url=%s): %w", rootDirectory.FHIRBaseURL, err)
+			}
+			resourceTypes = withoutResourceTypes(resourceTypes, excludedTypes)
+		}
+		if err := result.registerAdministrationDirectory(context.Background(), fhirBaseURL, resourceTypes, 0, "", ""); err != nil {
 			return nil, fmt.Errorf("register root administration directory (url=%s): %w", rootDirectory.FHIRBaseURL, err)
 		}
 	}
 	if result.config.DirectoryResourceTypes == nil || len(result.config.DirectoryResourceTypes) == 0 {
 		result.config.DirectoryResourceTypes = append([]string(nil), defaultDirectoryResourceTypes...)
 	}
+	if result.config.OrgDiscoveryPageSize <= 0 {
+		result.config.OrgDiscoveryPageSize = result.config.SearchPageSize
+	}
+	if result.config.MaxDiscoveryDepth <= 0 {
+		result.config.MaxDiscoveryDepth = 1
+	}
+	if result.config.Concurrency <= 0 {
+		result.config.Concurrency = 1
+	}
+	if result.config.TransactionChunkSize <= 0 {
+		result.config.TransactionChunkSize = maxUpdateEntries
+	}
+	if result.config.MaxConcurrentQueryWrites <= 0 {
+		result.config.MaxConcurrentQueryWrites = 1
+	}
+	result.queryWriteSemaphore = make(chan struct{}, result.config.MaxConcurrentQueryWrites)
+	if err := result.loadDiscoveryCache(context.Background()); err != nil {
+		// The cache only speeds up startup, directories are discovered again anyway
+		slog.Warn("Failed to load mCSD discovery cache", logging.Error(err))
+	}
+	result.configHash, err = configHash(result.config)
+	if err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
 func (c *Component) Start() error {
+	if err := prometheus.Register(c.syncLagCollector); err != nil {
+		return fmt.Errorf("failed to register mCSD metrics: %w", err)
+	}
+	if err := prometheus.Register(c.syncMetrics); err != nil {
+		prometheus.Unregister(c.syncLagCollector)
+		return fmt.Errorf("failed to register mCSD metrics: %w", err)
+	}
+	if c.config.SyncInterval > 0 {
+		c.startScheduler()
+		slog.Info("Scheduled mCSD updates", slog.Duration("interval", c.config.SyncInterval))
+	}
+	slog.Info("Started mCSD Update Client", slog.String("config_hash", c.configHash))
 	return nil
 }
 
+// configHash returns a stable hash of the given configuration, excluding secrets.
+func configHash(config Config) (string, error) {
+	config.Auth.ClientSecret = ""
+	config.Auth.PrivateKeyPEM = ""
+	config.PostSyncWebhookAuthorization = ""
+	config.QueryDirectory = config.QueryDirectory.withoutSecrets()
+	config.QueryDirectoryFallback = config.QueryDirectoryFallback.withoutSecrets()
+	// The maps are cloned, since they're shared with the caller
+	config.AdministrationDirectories = maps.Clone(config.AdministrationDirectories)
+	for key, directory := range config.AdministrationDirectories {
+		config.AdministrationDirectories[key] = directory.withoutSecrets()
+	}
+	config.QueryMirrors = maps.Clone(config.QueryMirrors)
+	for key, mirror := range config.QueryMirrors {
+		config.QueryMirrors[key] = mirror.withoutSecrets()
+	}
+	// encoding/json sorts map keys, so the result is stable
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate config hash: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8]), nil
+}
+
 func (c *Component) Stop(ctx context.Context) error {
-	return nil
+	prometheus.Unregister(c.syncLagCollector)
+	prometheus.Unregister(c.syncMetrics)
+	c.progress.close()
+	return c.stopScheduler(ctx)
 }
 
 func (c *Component) RegisterHttpHandlers(publicMux, internalMux *http.ServeMux) {
 	internalMux.HandleFunc("POST /mcsd/update", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		result, err := c.update(ctx)
+		options := syncOptions{
+			full: r.URL.Query().Get("full") == "true",
+		}
+		if dryRun := r.URL.Query().Get("dryRun"); dryRun != "" {
+			var err error
+			if options.dryRun, err = strconv.ParseBool(dryRun); err != nil {
+				http.Error(w, "invalid dryRun parameter: "+dryRun, http.StatusBadRequest)
+				return
+			}
+		}
+		if types := r.URL.Query().Get("types"); types != "" {
+			var err error
+			if options.resourceTypes, err = parseResourceTypes(types); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var result UpdateReport
+		var err error
+		if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+			result, err = c.updateIdempotent(ctx, idempotencyKey, options)
+		} else {
+			result, err = c.updateWithOptions(ctx, options)
+		}
 		if err != nil {
 			slog.ErrorContext(ctx, "mCSD update failed", logging.Error(err))
 			http.Error(w, "Failed to update mCSD: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		var responseData []byte
+		if r.URL.Query().Get("pretty") == "true" {
+			responseData, err = json.MarshalIndent(result, "", "  ")
+		} else {
+			responseData, err = json.Marshal(result)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to marshal mCSD update report", logging.Error(err))
+			http.Error(w, "Failed to marshal mCSD update report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(result)
+		_, _ = w.Write(responseData)
 	})
+	internalMux.HandleFunc("POST /mcsd/$sync", c.handleSyncOperation)
+	internalMux.HandleFunc("GET /mcsd/progress", c.handleProgress)
+	internalMux.HandleFunc("GET /mcsd/state", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(c.syncStates())
+	})
+	internalMux.HandleFunc("GET /mcsd/reports/diff", c.handleReportDiff)
+	internalMux.HandleFunc("GET /mcsd/discovery", c.handleDiscoveryLog)
+	internalMux.HandleFunc("GET /mcsd/healthcheck", c.handleHealthCheck)
+	internalMux.HandleFunc("POST /mcsd/directories", c.handleRegisterDirectory)
+	internalMux.HandleFunc("DELETE /mcsd/directories", c.handleUnregisterDirectory)
+	internalMux.HandleFunc("GET /mcsd/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(c.status())
+	})
+}
+
+// status returns a snapshot of the registered mCSD Directories and the times of their last update.
+func (c *Component) status() Status {
+	c.updateMux.RLock()
+	defer c.updateMux.RUnlock()
+	result := Status{
+		LastUpdateTimes: make(map[string]map[string]string, len(c.lastUpdateTimes)),
+		Directories:     c.directoryStatuses(),
+	}
+	for directoryKey, lastUpdateTimes := range c.lastUpdateTimes {
+		result.LastUpdateTimes[directoryKey] = maps.Clone(lastUpdateTimes)
+	}
+	return result
+}
+
+// directoryStatuses returns the registered mCSD Directories. The caller must hold updateMux.
+func (c *Component) directoryStatuses() []DirectoryStatus {
+	result := make([]DirectoryStatus, 0, len(c.administrationDirectories))
+	for _, directory := range c.administrationDirectories {
+		result = append(result, DirectoryStatus{
+			FHIRBaseURL:      directory.fhirBaseURL,
+			AuthoritativeUra: directory.authoritativeUra,
+			Discover:         directory.discover,
+			ResourceTypes:    slices.Clone(directory.resourceTypes),
+		})
+	}
+	return result
+}
+
+// syncStates returns the synchronization state of all mCSD Directories that have been synchronized,
+// with the sync lag calculated relative to the current time.
+func (c *Component) syncStates() map[string]DirectorySyncState {
+	c.stateMux.RLock()
+	defer c.stateMux.RUnlock()
+	now := c.nowFunc()
+	result := make(map[string]DirectorySyncState, len(c.directoryStates))
+	for directoryKey, state := range c.directoryStates {
+		if state.LastSuccess != nil {
+			lag := now.Sub(*state.LastSuccess).Seconds()
+			state.LagSeconds = &lag
+		}
+		result[directoryKey] = state
+	}
+	return result
 }
 
-func (c *Component) registerAdministrationDirectory(ctx context.Context, fhirBaseURL string, resourceTypes []string, discover bool, sourceURL string, authoritativeUra string) error {
+// recordSyncResult updates the synchronization state of a mCSD Directory after an update attempt.
+func (c *Component) recordSyncResult(directoryKey string, attemptTime time.Time, success bool) {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+	state := c.directoryStates[directoryKey]
+	state.LastAttempt = attemptTime
+	state.ConfigHash = c.configHash
+	if success {
+		state.LastSuccess = &attemptTime
+	}
+	c.directoryStates[directoryKey] = state
+}
+
+// recordResourceTypeSupport records whether the directory supports the given resource type.
+func (c *Component) recordResourceTypeSupport(directoryKey string, resourceType string, supported bool) {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+	state := c.directoryStates[directoryKey]
+	state.SupportedResourceTypes = setResourceType(state.SupportedResourceTypes, resourceType, supported)
+	state.UnsupportedResourceTypes = setResourceType(state.UnsupportedResourceTypes, resourceType, !supported)
+	c.directoryStates[directoryKey] = state
+}
+
+// setResourceType returns a sorted copy of resourceTypes, with the given resource type added or removed.
+// It returns a copy, so slices handed out by syncStates are never modified.
+func setResourceType(resourceTypes []string, resourceType string, present bool) []string {
+	result := slices.DeleteFunc(slices.Clone(resourceTypes), func(curr string) bool {
+		return curr == resourceType
+	})
+	if present {
+		result = append(result, resourceType)
+		slices.Sort(result)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func (c *Component) updateOptions(directoryKey string) updateOptions {
+	result := updateOptions{
+		skipResourcesWithoutID:    c.config.SkipResourcesWithoutID,
+		syncEnteredInError:        c.config.SyncEnteredInError,
+		skipInactive:              !c.config.SyncInactiveOrganizations,
+		stripMetaLabels:           c.config.StripMetaLabels,
+		preserveSourceLastUpdated: c.config.PreserveSourceLastUpdated,
+		directoryEndpointCodings:  c.config.DirectoryEndpointCodings,
+	}
+	if c.config.TagWithDirectoryKey {
+		result.directoryTag = directoryKey
+	}
+	return result
+}
+
+// registerAdministrationDirectory registers a mCSD Directory to synchronize from. The depth is 0 for root directories,
+// and the number of discovery steps from a root directory for discovered directories. Directories discover other directories
+// as long as their depth is less than the configured maximum discovery depth.
+func (c *Component) registerAdministrationDirectory(ctx context.Context, fhirBaseURL string, resourceTypes []string, depth int, sourceURL string, authoritativeUra string) error {
+	fhirBaseURL = normalizeBaseURL(fhirBaseURL)
 	// Must be a valid http or https URL
 	parsedFHIRBaseURL, err := url.Parse(fhirBaseURL)
 	if err != nil {
@@ -188,6 +958,11 @@ func (c *Component) registerAdministrationDirectory(ctx context.Context, fhirBas
 	if (parsedFHIRBaseURL.Scheme != "https" && parsedFHIRBaseURL.Scheme != "http") || parsedFHIRBaseURL.Host == "" {
 		return fmt.Errorf("invalid FHIR base URL (url=%s)", fhirBaseURL)
 	}
+	// Discovered directories (as opposed to explicitly configured root directories) must use HTTPS in strict mode
+	if depth > 0 && c.config.StrictMode && c.config.RequireHTTPSForDiscovered && parsedFHIRBaseURL.Scheme != "https" {
+		slog.WarnContext(ctx, "Rejecting discovered mCSD Directory: HTTPS is required in strict mode", logging.FHIRServer(fhirBaseURL))
+		return fmt.Errorf("discovered FHIR base URL must use https in strict mode (url=%s)", fhirBaseURL)
+	}
 
 	// Check if the URL is in the exclusion list (also trim exclusion list entries for consistent matching)
 	trimmedFHIRBaseURL := strings.TrimRight(fhirBaseURL, "/")
@@ -198,36 +973,118 @@ func (c *Component) registerAdministrationDirectory(ctx context.Context, fhirBas
 		}
 	}
 
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
 	exists := slices.ContainsFunc(c.administrationDirectories, func(directory administrationDirectory) bool {
 		return directory.fhirBaseURL == fhirBaseURL && directory.authoritativeUra == authoritativeUra
 	})
 	if exists {
 		return nil
 	}
+	directoryKey := makeDirectoryKey(fhirBaseURL, authoritativeUra)
+	c.restoreOrPurgeDirectoryState(ctx, directoryKey)
+	if depth > 0 {
+		// Also applies to directories restored from the discovery cache, which might have been discovered before the exclusion was configured
+		resourceTypes = withoutResourceTypes(resourceTypes, c.config.ExcludeResourceTypes)
+	}
+	discover := depth < c.config.MaxDiscoveryDepth
 	c.administrationDirectories = append(c.administrationDirectories, administrationDirectory{
 		resourceTypes:    resourceTypes,
 		fhirBaseURL:      fhirBaseURL,
 		discover:         discover,
+		depth:            depth,
 		sourceURL:        sourceURL,
 		authoritativeUra: authoritativeUra,
 	})
-	slog.InfoContext(ctx, "Registered mCSD Directory", logging.FHIRServer(fhirBaseURL), slog.Bool("discover", discover))
+	slog.InfoContext(ctx, "Registered mCSD Directory", logging.FHIRServer(fhirBaseURL), slog.String("directory", directoryKey), slog.Bool("discover", discover), slog.Int("depth", depth))
+	if sourceURL != "" {
+		c.recordDiscoveryEvent(DiscoveryActionRegistered, sourceURL, directoryKey)
+	}
 	return nil
 }
 
+// isDirectoryRegistered returns whether a directory with the given key is registered.
+func (c *Component) isDirectoryRegistered(directoryKey string) bool {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	return slices.ContainsFunc(c.administrationDirectories, func(directory administrationDirectory) bool {
+		return makeDirectoryKey(directory.fhirBaseURL, directory.authoritativeUra) == directoryKey
+	})
+}
+
+// directoryDepth returns the discovery depth of the registered directory with the given key, or 0 if it isn't registered.
+func (c *Component) directoryDepth(directoryKey string) int {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	for _, directory := range c.administrationDirectories {
+		if makeDirectoryKey(directory.fhirBaseURL, directory.authoritativeUra) == directoryKey {
+			return directory.depth
+		}
+	}
+	return 0
+}
+
 // unregisterAdministrationDirectory removes an administration directory from the list by its fullUrl.
 // This is called when an Endpoint is deleted to prevent it from being fetched in future updates.
 // The fullUrl parameter is the Bundle entry fullUrl that was used when the Endpoint was registered.
+// The directory's sync state is retained for the configured grace period, so a quick re-discovery resumes incremental sync.
 func (c *Component) unregisterAdministrationDirectory(ctx context.Context, fullUrl string) {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
 	initialCount := len(c.administrationDirectories)
 	c.administrationDirectories = slices.DeleteFunc(c.administrationDirectories, func(dir administrationDirectory) bool {
-		return dir.sourceURL == fullUrl
+		if dir.sourceURL != fullUrl {
+			return false
+		}
+		directoryKey := makeDirectoryKey(dir.fhirBaseURL, dir.authoritativeUra)
+		c.unregisteredDirectories[directoryKey] = c.nowFunc()
+		c.recordDiscoveryEvent(DiscoveryActionUnregistered, fullUrl, directoryKey)
+		return true
 	})
 	if len(c.administrationDirectories) < initialCount {
 		slog.InfoContext(ctx, "Unregistered mCSD Directory after Endpoint deletion", slog.String("full_url", fullUrl))
 	}
 }
 
+// restoreOrPurgeDirectoryState is called when a directory is (re-)registered.
+// If the directory was unregistered within the grace period, its sync state is kept so incremental sync resumes.
+// Otherwise, its sync state is purged, causing a full sync.
+func (c *Component) restoreOrPurgeDirectoryState(ctx context.Context, directoryKey string) {
+	unregisteredAt, wasUnregistered := c.unregisteredDirectories[directoryKey]
+	if !wasUnregistered {
+		return
+	}
+	delete(c.unregisteredDirectories, directoryKey)
+	if c.nowFunc().Sub(unregisteredAt) <= c.config.UnregisteredStateRetention {
+		slog.InfoContext(ctx, "mCSD Directory re-registered within grace period, resuming incremental sync", slog.String("directory", directoryKey))
+		return
+	}
+	c.purgeDirectoryState(directoryKey)
+}
+
+// purgeExpiredDirectoryState removes the sync state of unregistered directories of which the grace period has expired.
+func (c *Component) purgeExpiredDirectoryState() {
+	for directoryKey, unregisteredAt := range c.unregisteredDirectories {
+		if c.nowFunc().Sub(unregisteredAt) > c.config.UnregisteredStateRetention {
+			delete(c.unregisteredDirectories, directoryKey)
+			c.purgeDirectoryState(directoryKey)
+		}
+	}
+}
+
+func (c *Component) purgeDirectoryState(directoryKey string) {
+	delete(c.lastUpdateTimes, directoryKey)
+	delete(c.rebasedURLs, directoryKey)
+	delete(c.organizationCounts, directoryKey)
+	c.removePendingMirrorChunks(directoryKey)
+	maps.DeleteFunc(c.uraWriters, func(_ string, writer string) bool {
+		return writer == directoryKey
+	})
+	c.stateMux.Lock()
+	delete(c.directoryStates, directoryKey)
+	c.stateMux.Unlock()
+}
+
 // processEndpointDeletes processes DELETE operations for Endpoints and unregisters them from administrationDirectories.
 // This prevents deleted Endpoints from being fetched in future updates, fixing issue #241.
 func (c *Component) processEndpointDeletes(ctx context.Context, entries []fhir.BundleEntry) {
@@ -244,39 +1101,148 @@ func (c *Component) processEndpointDeletes(ctx context.Context, entries []fhir.B
 }
 
 func (c *Component) update(ctx context.Context) (UpdateReport, error) {
+	return c.updateWithOptions(ctx, syncOptions{})
+}
+
+func (c *Component) updateWithOptions(ctx context.Context, options syncOptions) (UpdateReport, error) {
 	c.updateMux.Lock()
 	defer c.updateMux.Unlock()
 
+	if options.directory != "" && !slices.ContainsFunc(c.administrationDirectories, func(directory administrationDirectory) bool {
+		return directory.fhirBaseURL == options.directory
+	}) {
+		return nil, fmt.Errorf("%w: %s", errUnknownDirectory, options.directory)
+	}
+
+	c.purgeExpiredDirectoryState()
 	result := make(UpdateReport)
-	for i := 0; i < len(c.administrationDirectories); i++ {
-		adminDirectory := c.administrationDirectories[i]
-		report, err := c.updateFromDirectory(ctx, adminDirectory.fhirBaseURL, adminDirectory.resourceTypes, adminDirectory.discover, adminDirectory.authoritativeUra)
-		if err != nil {
-			slog.ErrorContext(ctx, "mCSD Directory update failed", logging.FHIRServer(adminDirectory.fhirBaseURL), logging.Error(err))
-			report.Errors = append(report.Errors, err.Error())
+	if c.config.Concurrency > 1 {
+		c.updateDirectoriesConcurrently(ctx, options, result)
+	} else {
+		// Directories discovered during the update are appended, and updated in the same run
+		for i := 0; i < len(c.administrationDirectories); i++ {
+			adminDirectory := c.administrationDirectories[i]
+			if options.directory != "" && adminDirectory.fhirBaseURL != options.directory {
+				continue
+			}
+			if ctx.Err() != nil {
+				result[makeDirectoryKey(adminDirectory.fhirBaseURL, adminDirectory.authoritativeUra)] = cancelledReport(ctx)
+				continue
+			}
+			directoryKey, report := c.updateAdministrationDirectory(ctx, adminDirectory, options)
+			result[directoryKey] = report
 		}
-		// Return empty slices instead of null ones, makes a nicer REST API
-		if report.Warnings == nil {
-			report.Warnings = []string{}
+	}
+	if ctx.Err() != nil {
+		slog.WarnContext(ctx, "mCSD update was cancelled, not all directories were updated", logging.Error(ctx.Err()))
+	}
+	if !options.dryRun {
+		if err := c.saveDiscoveryCache(); err != nil {
+			slog.ErrorContext(ctx, "Failed to save mCSD discovery cache", logging.Error(err))
 		}
-		if report.Errors == nil {
-			report.Errors = []string{}
+		c.recordReport(result)
+		if ctx.Err() == nil {
+			c.callPostSyncWebhook(ctx, result)
 		}
-		directoryKey := makeDirectoryKey(adminDirectory.fhirBaseURL, adminDirectory.authoritativeUra)
-		result[directoryKey] = report
 	}
 	return result, nil
 }
 
+// cancelledReport returns the report of a directory that wasn't updated, because the update was cancelled.
+func cancelledReport(ctx context.Context) DirectoryUpdateReport {
+	return DirectoryUpdateReport{Errors: []string{fmt.Sprintf("%s: %s", errSyncCancelled, ctx.Err())}}
+}
+
+// updateDirectoriesConcurrently updates the registered directories using a pool of (at most) the configured number of workers.
+// The directories are snapshotted at the start: directories discovered during the update are updated in the next run.
+func (c *Component) updateDirectoriesConcurrently(ctx context.Context, options syncOptions, result UpdateReport) {
+	c.directoryMux.Lock()
+	directories := slices.Clone(c.administrationDirectories)
+	c.directoryMux.Unlock()
+
+	workers := make(chan struct{}, c.config.Concurrency)
+	resultMux := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for _, adminDirectory := range directories {
+		if options.directory != "" && adminDirectory.fhirBaseURL != options.directory {
+			continue
+		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			if ctx.Err() != nil {
+				resultMux.Lock()
+				result[makeDirectoryKey(adminDirectory.fhirBaseURL, adminDirectory.authoritativeUra)] = cancelledReport(ctx)
+				resultMux.Unlock()
+				return
+			}
+			directoryKey, report := c.updateAdministrationDirectory(ctx, adminDirectory, options)
+			resultMux.Lock()
+			result[directoryKey] = report
+			resultMux.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// updateAdministrationDirectory updates from a single registered directory, and returns its key and update report.
+func (c *Component) updateAdministrationDirectory(ctx context.Context, adminDirectory administrationDirectory, options syncOptions) (string, DirectoryUpdateReport) {
+	attemptTime := c.nowFunc()
+	directoryKey := makeDirectoryKey(adminDirectory.fhirBaseURL, adminDirectory.authoritativeUra)
+	c.progress.publish(ProgressEvent{Type: progressDirectoryStarted, Directory: directoryKey})
+	// Apply the transaction that couldn't be applied in a previous update first, which might advance the time of the last update
+	var replayReport DirectoryUpdateReport
+	var err error
+	if !options.dryRun {
+		replayReport, err = c.replayBufferedTransaction(ctx, directoryKey, adminDirectory.fhirBaseURL)
+	}
+	var report DirectoryUpdateReport
+	if err == nil {
+		report, err = c.updateFromDirectoryWithOptions(ctx, adminDirectory.fhirBaseURL, adminDirectory.resourceTypes, adminDirectory.discover, adminDirectory.authoritativeUra, options)
+	}
+	report.merge(replayReport)
+	report.Warnings = append(replayReport.Warnings, report.Warnings...)
+	if !options.dryRun {
+		c.recordSyncResult(directoryKey, attemptTime, err == nil)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "mCSD Directory update failed", logging.FHIRServer(adminDirectory.fhirBaseURL), slog.String("directory", directoryKey), logging.Error(err))
+		report.Errors = append(report.Errors, err.Error())
+	}
+	duration := c.nowFunc().Sub(attemptTime)
+	report.DurationMillis = duration.Milliseconds()
+	slog.InfoContext(ctx, "Finished updating from mCSD Directory", logging.FHIRServer(adminDirectory.fhirBaseURL), slog.String("directory", directoryKey),
+		slog.Int("created", report.CountCreated), slog.Int("updated", report.CountUpdated), slog.Int("deleted", report.CountDeleted),
+		slog.Int("warnings", len(report.Warnings)), slog.Int("errors", len(report.Errors)), slog.Duration("duration", duration))
+	if !options.dryRun {
+		c.syncMetrics.record(directoryKey, report, duration)
+	}
+	report.ConfigHash = c.configHash
+	// Return empty slices instead of null ones, makes a nicer REST API
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	if report.Errors == nil {
+		report.Errors = []string{}
+	}
+	c.progress.publish(ProgressEvent{Type: progressDirectoryFinished, Directory: directoryKey, Report: &report})
+	return directoryKey, report
+}
+
 // discoverAndRegisterEndpoints processes endpoint discovery and registration for the given parent organizations.
-// It finds endpoints from the entries that match parent organization endpoint references and registers them.
-func (c *Component) discoverAndRegisterEndpoints(ctx context.Context, entries []fhir.BundleEntry, parentOrganizationsMap parentOrganizationMap, report DirectoryUpdateReport) DirectoryUpdateReport {
+// It finds endpoints from the entries that match parent organization endpoint references and registers them at the given discovery depth.
+func (c *Component) discoverAndRegisterEndpoints(ctx context.Context, entries []fhir.BundleEntry, parentOrganizationsMap parentOrganizationMap, report DirectoryUpdateReport, depth int) DirectoryUpdateReport {
 	if parentOrganizationsMap == nil {
 		return report
 	}
 
+	// Organizations and endpoints are iterated in random order, so sort the warnings and discovered directories to keep the report deterministic
+	var warnings []string
+	var discovered []string
 	for parentOrg := range parentOrganizationsMap {
-		uraIdentifiers := libfhir.FilterIdentifiersBySystem(parentOrg.Identifier, coding.URANamingSystem)
+		uraIdentifiers := libfhir.FilterIdentifiersBySystem(parentOrg.Identifier, c.config.AuthoritativeIdentifierSystem)
 		if len(uraIdentifiers) == 0 || uraIdentifiers[0].Value == nil {
 			continue
 		}
@@ -288,6 +1254,7 @@ func (c *Component) discoverAndRegisterEndpoints(ctx context.Context, entries []
 
 		// find endpoint in entries
 		endpoints := make(map[string]*fhir.Endpoint)
+		endpointResources := make(map[string]json.RawMessage)
 		for _, entry := range entries {
 			if entry.Resource == nil {
 				continue
@@ -305,6 +1272,7 @@ func (c *Component) discoverAndRegisterEndpoints(ctx context.Context, entries []
 						if endpointID == refID {
 							if entry.FullUrl != nil {
 								endpoints[*entry.FullUrl] = &endpoint
+								endpointResources[*entry.FullUrl] = entry.Resource
 							}
 							break // Found a match, move to next entry
 						}
@@ -313,68 +1281,270 @@ func (c *Component) discoverAndRegisterEndpoints(ctx context.Context, entries []
 			}
 		}
 
-		payloadCoding := fhir.Coding{
-			System: to.Ptr(coding.MCSDPayloadTypeSystem),
-			Code:   to.Ptr(coding.MCSDPayloadTypeDirectoryCode),
-		}
-
 		for fullUrl, endpoint := range endpoints {
-			if coding.CodablesIncludesCode(endpoint.PayloadType, payloadCoding) {
-				slog.DebugContext(ctx, "Discovered mCSD Directory", slog.String("address", endpoint.Address))
+			if isDirectoryEndpoint(*endpoint, c.config.DirectoryEndpointCodings) {
+				// Only addresses with an allowed scheme (e.g. not file://) may be registered, others are skipped before reaching registration
+				if scheme := addressScheme(endpoint.Address); !slices.Contains(c.config.DiscoveryAllowedSchemes, scheme) {
+					msg := fmt.Sprintf("skipping discovered mCSD Directory endpoint %s: address scheme '%s' is not allowed (address=%s, allowed: %s)", fullUrl, scheme, endpoint.Address, strings.Join(c.config.DiscoveryAllowedSchemes, ", "))
+					slog.WarnContext(ctx, msg, slog.String("authoritative_ura", authoritativeUra))
+					warnings = append(warnings, msg)
+					continue
+				}
+				slog.DebugContext(ctx, "Discovered mCSD Directory", slog.String("address", endpoint.Address), slog.String("authoritative_ura", authoritativeUra))
 
-				err := c.registerAdministrationDirectory(ctx, endpoint.Address, c.directoryResourceTypes, false, fullUrl, authoritativeUra)
+				err := c.registerAdministrationDirectory(ctx, endpoint.Address, c.directoryResourceTypes, depth, fullUrl, authoritativeUra)
 				if err != nil {
-					report.Warnings = append(report.Warnings, fmt.Sprintf("failed to register discovered mCSD Directory at %s: %s", endpoint.Address, err.Error()))
+					warnings = append(warnings, fmt.Sprintf("failed to register discovered mCSD Directory at %s: %s", endpoint.Address, err.Error()))
+				} else if directoryKey := makeDirectoryKey(normalizeBaseURL(endpoint.Address), authoritativeUra); c.isDirectoryRegistered(directoryKey) {
+					// Excluded directories aren't registered, so they're not reported as discovered
+					discovered = append(discovered, directoryKey)
 				}
+			} else if mentionsDirectoryPayloadType(endpointResources[fullUrl], c.config.DirectoryEndpointCodings) {
+				// Likely a directory endpoint with malformed payloadType (e.g. wrong casing of system or code), which would otherwise be ignored silently
+				msg := fmt.Sprintf("Endpoint %s seems to be a mCSD Directory endpoint, but its payloadType doesn't match any of the directory endpoint codings (%s), ignoring it", fullUrl, directoryEndpointCodingsString(c.config.DirectoryEndpointCodings))
+				slog.WarnContext(ctx, msg, slog.String("address", endpoint.Address), slog.String("authoritative_ura", authoritativeUra))
+				warnings = append(warnings, msg)
 			}
 		}
 	}
-
+	slices.Sort(warnings)
+	report.Warnings = append(report.Warnings, warnings...)
+	slices.Sort(discovered)
+	report.Discovered = slices.Compact(discovered)
 	return report
 }
 
+// addressScheme returns the (lower-case) scheme of the given address, or an empty string if it can't be parsed.
+func addressScheme(address string) string {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme)
+}
+
+// isDirectoryEndpoint returns true if the payloadType of the Endpoint contains one of the given mCSD Directory codings.
+func isDirectoryEndpoint(endpoint fhir.Endpoint, directoryCodings []DirectoryEndpointCoding) bool {
+	for _, directoryCoding := range directoryCodings {
+		payloadCoding := fhir.Coding{
+			System: to.Ptr(directoryCoding.System),
+			Code:   to.Ptr(directoryCoding.Code),
+		}
+		if coding.CodablesIncludesCode(endpoint.PayloadType, payloadCoding) {
+			return true
+		}
+	}
+	return false
+}
+
+func directoryEndpointCodingsString(directoryCodings []DirectoryEndpointCoding) string {
+	var result []string
+	for _, directoryCoding := range directoryCodings {
+		result = append(result, directoryCoding.String())
+	}
+	return strings.Join(result, ", ")
+}
+
+// containsDirectoryEndpoint returns true if the entries contain an Endpoint with one of the mCSD Directory payload types.
+func containsDirectoryEndpoint(entries []fhir.BundleEntry, directoryCodings []DirectoryEndpointCoding) bool {
+	for _, entry := range entries {
+		var endpoint fhir.Endpoint
+		if entry.Resource == nil || json.Unmarshal(entry.Resource, &endpoint) != nil {
+			continue
+		}
+		if isDirectoryEndpoint(endpoint, directoryCodings) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionsDirectoryPayloadType returns true if the payloadType of the given Endpoint resource mentions one of the mCSD Directory codes,
+// ignoring casing and structure.
+func mentionsDirectoryPayloadType(endpointResource json.RawMessage, directoryCodings []DirectoryEndpointCoding) bool {
+	var endpoint struct {
+		PayloadType json.RawMessage `json:"payloadType"`
+	}
+	if err := json.Unmarshal(endpointResource, &endpoint); err != nil {
+		return false
+	}
+	payloadType := strings.ToLower(string(endpoint.PayloadType))
+	for _, directoryCoding := range directoryCodings {
+		if strings.Contains(payloadType, strings.ToLower(directoryCoding.Code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validationRules returns the rules to validate resources from a mCSD Directory with.
+func (c *Component) validationRules(allowedResourceTypes []string) ValidationRules {
+	result := ValidationRules{
+		AllowedResourceTypes:          allowedResourceTypes,
+		ResourceTypeRules:             c.config.ResourceTypeRules,
+		AuthoritativeIdentifierSystem: c.config.AuthoritativeIdentifierSystem,
+		LowestURA:                     c.config.MultipleURAs == MultipleURAsLowest,
+	}
+	if c.config.ResourceValidation != ResourceValidationOff {
+		result.Validator = c.resourceValidator
+		result.ValidatorWarnOnly = c.config.ResourceValidation == ResourceValidationWarn
+	}
+	return result
+}
+
+// directoryHTTPClient returns the HTTP client for requests to the mCSD Directory registered with the given base URL,
+// which also applies when the directory is queried at another base URL after a redirect.
+// Requests that are rate-limited by the directory are retried. If configured, requests (including their retries)
+// time out after Config.RequestTimeout, so a hanging directory fails its own update instead of blocking the others.
+func (c *Component) directoryHTTPClient(fhirBaseURL string) *http.Client {
+	c.directoryMux.Lock()
+	httpClient, ok := c.directoryHTTPClients[normalizeBaseURL(fhirBaseURL)]
+	c.directoryMux.Unlock()
+	if !ok {
+		if c.proxyTransport != nil {
+			httpClient = &http.Client{Transport: tracing.WrapTransport(c.proxyTransport)}
+		} else {
+			httpClient = tracing.NewHTTPClient()
+		}
+		httpClient.CheckRedirect = c.checkRedirect
+	}
+	throttledClient := *httpClient
+	if c.config.RequestTimeout > 0 {
+		throttledClient.Timeout = c.config.RequestTimeout
+	}
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	throttledClient.Transport = &throttlingTransport{
+		next:       transport,
+		maxRetries: c.config.MaxRetries,
+		baseDelay:  c.config.RetryBaseDelay,
+		maxWait:    c.config.MaxRetryAfter,
+		nowFunc:    c.nowFunc,
+	}
+	return &throttledClient
+}
+
+// newHTTPClient creates an HTTP client that authenticates using OAuth2 client credentials and/or a TLS client certificate, if configured.
+// If proxyURL is set, requests (including those to the OAuth2 token endpoint) are sent through that proxy.
+func newHTTPClient(auth httpauth.OAuth2Config, tlsConfig tlsutil.Config, proxyURL *url.URL) (*http.Client, error) {
+	var transport http.RoundTripper
+	if tlsConfig.TLSCertFile != "" || proxyURL != nil {
+		customTransport := newProxyTransport(proxyURL)
+		if tlsConfig.TLSCertFile != "" {
+			clientTLSConfig, err := tlsutil.CreateTLSConfig(tlsConfig)
+			if err != nil {
+				return nil, fmt.Errorf("TLS is configured but failed to load: %w", err)
+			}
+			customTransport.TLSClientConfig = clientTLSConfig
+		}
+		transport = customTransport
+	}
+	if !auth.IsConfigured() {
+		return &http.Client{Transport: tracing.WrapTransport(transport)}, nil
+	}
+	return httpauth.NewOAuth2HTTPClient(auth, tracing.WrapTransport(transport))
+}
+
+// newProxyTransport creates an HTTP transport that sends requests through the given proxy.
+// If proxyURL is nil, the proxy is taken from the environment (like http.DefaultTransport).
+func newProxyTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport
+}
+
 func (c *Component) updateFromDirectory(ctx context.Context, fhirBaseURLRaw string, allowedResourceTypes []string, allowDiscovery bool, authoritativeUra string) (DirectoryUpdateReport, error) {
-	slog.InfoContext(ctx, "Updating from mCSD Directory", logging.FHIRServer(fhirBaseURLRaw), slog.Bool("discover", allowDiscovery), slog.Any("resourceTypes", allowedResourceTypes))
+	return c.updateFromDirectoryWithOptions(ctx, fhirBaseURLRaw, allowedResourceTypes, allowDiscovery, authoritativeUra, syncOptions{})
+}
+
+func (c *Component) updateFromDirectoryWithOptions(ctx context.Context, fhirBaseURLRaw string, allowedResourceTypes []string, allowDiscovery bool, authoritativeUra string, options syncOptions) (DirectoryUpdateReport, error) {
+	// The base URL is used as source base URL of the resources, which must be the same as when the directory was registered
+	fhirBaseURLRaw = normalizeBaseURL(fhirBaseURLRaw)
+	// The same base URL might serve multiple URAs, so the directory key is logged to tell them apart
+	directoryKey := makeDirectoryKey(fhirBaseURLRaw, authoritativeUra)
+	slog.InfoContext(ctx, "Updating from mCSD Directory", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), slog.Bool("discover", allowDiscovery), slog.Any("resourceTypes", allowedResourceTypes))
 	remoteAdminDirectoryFHIRBaseURL, err := url.Parse(fhirBaseURLRaw)
 	if err != nil {
 		return DirectoryUpdateReport{}, err
 	}
-	remoteAdminDirectoryFHIRClient := c.fhirAdminClientFn(remoteAdminDirectoryFHIRBaseURL)
+	// Only the time of the last update of the selected resource types is advanced, so the other resource types are unaffected.
+	if options.resourceTypes != nil {
+		allowedResourceTypes = slices.DeleteFunc(slices.Clone(allowedResourceTypes), func(resourceType string) bool {
+			return !slices.Contains(options.resourceTypes, resourceType)
+		})
+		if len(allowedResourceTypes) == 0 {
+			slog.DebugContext(ctx, "None of the requested resource types are synchronized from mCSD Directory, skipping", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
+			return DirectoryUpdateReport{}, nil
+		}
+	}
+	// The base URL identifies the directory (e.g. in meta.source), even if it's queried at the host it redirected to
+	c.directoryMux.Lock()
+	if rebasedURL, ok := c.rebasedURLs[directoryKey]; ok {
+		remoteAdminDirectoryFHIRBaseURL = rebasedURL
+	}
+	c.directoryMux.Unlock()
+	ctx, redirects := withRedirectLog(ctx, remoteAdminDirectoryFHIRBaseURL)
+	remoteAdminDirectoryFHIRClient := c.fhirAdminClientFn(fhirBaseURLRaw, remoteAdminDirectoryFHIRBaseURL)
 
-	queryDirectoryFHIRClient := c.fhirQueryClient
-
-	// Get last update time for incremental sync
-	directoryKey := makeDirectoryKey(fhirBaseURLRaw, authoritativeUra)
-	lastUpdate, hasLastUpdate := c.lastUpdateTimes[directoryKey]
+	ctx = withProgressDirectory(ctx, directoryKey)
+	ctx, retries := withRetryLog(ctx)
+	ctx, throttling := withThrottleLog(ctx)
+	sinceTimes := c.sinceTimes(directoryKey, allowedResourceTypes, options)
 
 	// Capture query start time as fallback for servers that don't provide Bundle meta.lastUpdated.
-	queryStartTime := time.Now()
+	queryStartTime := c.nowFunc()
 
 	searchParams := url.Values{
-		"_count": []string{strconv.Itoa(searchPageSize)},
+		"_count": []string{strconv.Itoa(c.config.SearchPageSize)},
 	}
-	if hasLastUpdate {
-		searchParams.Set("_since", lastUpdate)
-		slog.DebugContext(ctx, "Using _since parameter for incremental sync from FHIR server", logging.FHIRServer(fhirBaseURLRaw), slog.String("_since", lastUpdate))
+	if len(sinceTimes) > 0 {
+		slog.DebugContext(ctx, "Using _since parameter for incremental sync from FHIR server", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), slog.Any("_since", sinceTimes))
 	} else {
-		slog.InfoContext(ctx, "No last update time, doing full sync from FHIR server", logging.FHIRServer(fhirBaseURLRaw))
+		slog.InfoContext(ctx, "No last update time, doing full sync from FHIR server", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
 	}
 
 	// Initial query
-	entries, firstSearchSet, err := c.queryAllResourceTypes(ctx, remoteAdminDirectoryFHIRClient, allowedResourceTypes, searchParams)
-	if err != nil {
-		return DirectoryUpdateReport{}, err
+	var entries []fhir.BundleEntry
+	var searchSets map[string]fhir.Bundle
+	var bulkExportErr error
+	if len(sinceTimes) == 0 && c.bulkExportDirectories[fhirBaseURLRaw] {
+		// An export doesn't contain deleted resources, so it's only used if nothing was synchronized from the directory yet:
+		// resources that were synchronized before (e.g. before a restart, since the times of the last update aren't persisted)
+		// and deleted since then, are only deleted from the query directory when querying the history.
+		if synced, err := c.hasSyncedResources(ctx, fhirBaseURLRaw, allowedResourceTypes); err != nil {
+			slog.WarnContext(ctx, "Failed to check for resources synchronized from FHIR server before, querying history instead of using $export", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), logging.Error(err))
+		} else if synced {
+			slog.InfoContext(ctx, "Query directory contains resources synchronized from FHIR server before, querying history instead of using $export", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
+		} else {
+			slog.InfoContext(ctx, "Doing full sync from FHIR server using $export", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
+			entries, searchSets, bulkExportErr = c.bulkExport(ctx, c.directoryHTTPClient(fhirBaseURLRaw), remoteAdminDirectoryFHIRBaseURL, allowedResourceTypes)
+			if bulkExportErr != nil {
+				slog.WarnContext(ctx, "Bulk data export failed, querying history instead", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), logging.Error(bulkExportErr))
+			}
+		}
+	}
+	var failedTypes failedResourceTypes
+	if searchSets == nil {
+		entries, searchSets, err = c.queryAllResourceTypes(ctx, directoryKey, remoteAdminDirectoryFHIRClient, c.systemHistoryDirectories[fhirBaseURLRaw], allowedResourceTypes, searchParams, sinceTimes)
+		if err != nil && !errors.As(err, &failedTypes) {
+			return DirectoryUpdateReport{}, err
+		}
 	}
 
 	// Check if any Organization's URA identifier has changed between history versions
-	uraIdentifierChanged := checkForURAIdentifierChanges(entries)
+	uraIdentifierChanged := checkForURAIdentifierChanges(entries, c.config.AuthoritativeIdentifierSystem)
 	if uraIdentifierChanged {
-		slog.WarnContext(ctx, "Detected URA identifier change in organization history. Rerunning history query without _since parameter.", logging.FHIRServer(fhirBaseURLRaw))
+		slog.WarnContext(ctx, "Detected URA identifier change in organization history. Rerunning history query without _since parameter.", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
 
 		// Remove _since parameter and rerun the query
-		searchParams.Del("_since")
-		entries, firstSearchSet, err = c.queryAllResourceTypes(ctx, remoteAdminDirectoryFHIRClient, allowedResourceTypes, searchParams)
-		if err != nil {
+		sinceTimes = nil
+		failedTypes = nil
+		entries, searchSets, err = c.queryAllResourceTypes(ctx, directoryKey, remoteAdminDirectoryFHIRClient, c.systemHistoryDirectories[fhirBaseURLRaw], allowedResourceTypes, searchParams, sinceTimes)
+		if err != nil && !errors.As(err, &failedTypes) {
 			return DirectoryUpdateReport{}, err
 		}
 	}
@@ -382,6 +1552,10 @@ func (c *Component) updateFromDirectory(ctx context.Context, fhirBaseURLRaw stri
 	// Deduplicate resources from _history query - keep only the most recent version
 	// _history can return multiple versions of the same resource, but transaction bundles must have unique resources
 	deduplicatedEntries := deduplicateHistoryEntries(entries)
+	if len(c.config.DeduplicationIdentifierSystems) > 0 {
+		// Some servers reassign IDs, resulting in multiple entries for the same logical resource
+		deduplicatedEntries = deduplicateByIdentifier(deduplicatedEntries, c.config.DeduplicationIdentifierSystems)
+	}
 
 	// Filter to only include HealthcareService resources
 	var allHealthcareServices []fhir.HealthcareService
@@ -396,11 +1570,6 @@ func (c *Component) updateFromDirectory(ctx context.Context, fhirBaseURLRaw stri
 		}
 	}
 
-	// Pre-process Endpoint DELETEs to unregister administration directories
-	if allowDiscovery {
-		c.processEndpointDeletes(ctx, deduplicatedEntries)
-	}
-
 	// Find parent organizations with URA identifier and all organizations linked to them
 	// This is used when validating organizations that don't have their own URA identifier
 	parentOrganizationsMap, err := c.ensureParentOrganizationsMap(ctx, fhirBaseURLRaw, remoteAdminDirectoryFHIRClient, authoritativeUra)
@@ -409,85 +1578,416 @@ func (c *Component) updateFromDirectory(ctx context.Context, fhirBaseURLRaw stri
 		return DirectoryUpdateReport{}, fmt.Errorf("failed to build parent organization map: %w", err)
 	}
 
+	// Organizations with multiple URAs are ambiguous: they're skipped or their lowest URA is used, before validating them
+	multipleURAWarnings := c.handleMultipleURAs(ctx, parentOrganizationsMap)
+
 	// Validate all parent organizations once before processing resources
-	if err := ValidateParentOrganizations(parentOrganizationsMap); err != nil {
+	if err := ValidateParentOrganizations(parentOrganizationsMap, c.config.AuthoritativeIdentifierSystem); err != nil {
 		return DirectoryUpdateReport{}, fmt.Errorf("parent organization (one that supposedly has ura identifier - and only only) validation failed: %w", err)
 	}
 
+	report := DirectoryUpdateReport{
+		ResourceTypes: slices.Clone(allowedResourceTypes),
+		Warnings:      multipleURAWarnings,
+	}
+	if warning := throttling.warning(); warning != "" {
+		report.Warnings = append(report.Warnings, warning)
+	}
+	if bulkExportErr != nil && !errors.Is(bulkExportErr, errBulkExportNotStarted) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("bulk data export failed, queried history instead: %s", bulkExportErr))
+	}
+	report.Warnings = append(report.Warnings, retries.take()...)
+	// Resource types that couldn't be queried don't prevent the others from being synchronized,
+	// since the time of their last update isn't advanced. Their failure is reported after applying the others.
+	var queryErrs []error
+	for _, resourceType := range slices.Sorted(maps.Keys(failedTypes)) {
+		queryErr := failedTypes[resourceType]
+		report.resourceType(resourceType).CountErrors++
+		if !errors.Is(queryErr, errPaginationIncomplete) {
+			queryErrs = append(queryErrs, queryErr)
+			continue
+		}
+		// The remaining pages are fetched again in the next update, since the time of the last update isn't changed.
+		slog.WarnContext(ctx, "Pagination failed, applying partial results from mCSD Directory", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), logging.Error(queryErr))
+		report.Warnings = append(report.Warnings, fmt.Sprintf("applied partial results, time of last update not advanced: %s", queryErr))
+	}
+	queryErr := errors.Join(queryErrs...)
+	if redirects.redirectURL != nil {
+		c.rebaseDirectory(ctx, directoryKey, fhirBaseURLRaw, redirects, &report)
+	}
+	c.checkFHIRVersion(ctx, directoryKey, fhirBaseURLRaw, remoteAdminDirectoryFHIRClient, &report)
+	// A sharp drop in the number of organizations often signals a problem at the source (e.g. partial outage), rather than legitimate deletions.
+	organizationCount := countOrganizations(parentOrganizationsMap)
+	if c.detectOrganizationCountDrop(ctx, directoryKey, organizationCount, &report) && c.config.BlockDeletesOnOrgCountDrop {
+		countBefore := len(deduplicatedEntries)
+		deduplicatedEntries = slices.DeleteFunc(slices.Clone(deduplicatedEntries), func(entry fhir.BundleEntry) bool {
+			return entry.Request != nil && entry.Request.Method == fhir.HTTPVerbDELETE
+		})
+		if blocked := countBefore - len(deduplicatedEntries); blocked > 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("blocked %d DELETE operation(s) due to organization count drop", blocked))
+		}
+	}
+
+	if !options.dryRun {
+		c.directoryMux.Lock()
+		c.organizationCounts[directoryKey] = organizationCount
+		c.directoryMux.Unlock()
+	}
+
+	// Pre-process Endpoint DELETEs to unregister administration directories
+	if allowDiscovery && !options.dryRun {
+		c.processEndpointDeletes(ctx, deduplicatedEntries)
+	}
+
 	// Build transaction with deterministic conditional references
 	tx := fhir.Bundle{
 		Type:  fhir.BundleTypeTransaction,
 		Entry: make([]fhir.BundleEntry, 0, len(deduplicatedEntries)),
 	}
 
-	var report DirectoryUpdateReport
+	// unsyncedEndpointReferences holds the (converted) references to Endpoints that are skipped, used to prune dangling references
+	unsyncedEndpointReferences := make(map[string]bool)
 	for i, entry := range deduplicatedEntries {
+		if entry.Request == nil && c.config.InferMissingRequest {
+			entry.Request = inferEntryRequest(entry)
+		}
 		if entry.Request == nil {
 			msg := fmt.Sprintf("Skipping entry with no request: #%d", i)
 			report.Warnings = append(report.Warnings, msg)
 			continue
 		}
 		slog.DebugContext(ctx, "Processing entry", logging.FHIRServer(fhirBaseURLRaw), slog.String("url", entry.Request.Url))
-		_, err := buildUpdateTransaction(ctx, &tx, entry, ValidationRules{AllowedResourceTypes: allowedResourceTypes}, parentOrganizationsMap, allHealthcareServices, allowDiscovery, fhirBaseURLRaw)
+		_, err := buildUpdateTransaction(ctx, &tx, entry, c.validationRules(allowedResourceTypes), parentOrganizationsMap, allHealthcareServices, allowDiscovery, fhirBaseURLRaw, c.updateOptions(directoryKey))
 		if err != nil {
 			report.Warnings = append(report.Warnings, fmt.Sprintf("entry #%d: %s", i, err.Error()))
+			report.resourceType(requestResourceType(entry)).CountErrors++
+			if reference := endpointConditionalReference(entry, fhirBaseURLRaw); reference != "" {
+				unsyncedEndpointReferences[reference] = true
+			}
 			continue
 		}
 	}
+	if c.config.PruneDanglingEndpointRefs {
+		endpointsSynced := slices.Contains(allowedResourceTypes, "Endpoint")
+		report.Warnings = append(report.Warnings, pruneDanglingEndpointReferences(&tx, func(reference string) bool {
+			if !strings.HasPrefix(reference, "Endpoint?") {
+				return false
+			}
+			return !endpointsSynced || unsyncedEndpointReferences[reference]
+		})...)
+	}
 
 	// Handle Endpoint discovery and registration
-	if allowDiscovery {
-		report = c.discoverAndRegisterEndpoints(ctx, entries, parentOrganizationsMap, report)
+	if allowDiscovery && !options.dryRun {
+		report = c.discoverAndRegisterEndpoints(ctx, entries, parentOrganizationsMap, report, c.directoryDepth(directoryKey)+1)
+	}
+	// A root directory with care organizations, but without mCSD Directory endpoints is probably misconfigured: nothing can be discovered from it.
+	// Only checked on full sync, since incremental syncs only contain the Endpoints that changed.
+	if allowDiscovery && c.directoryDepth(directoryKey) == 0 && sinceTimes["Endpoint"] == "" && len(parentOrganizationsMap) > 0 && !containsDirectoryEndpoint(entries, c.config.DirectoryEndpointCodings) {
+		msg := fmt.Sprintf("root mCSD Directory contains %d organization(s) with a URA identifier, but no mCSD Directory endpoints: no directories can be discovered", len(parentOrganizationsMap))
+		slog.WarnContext(ctx, msg, logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
+		report.Warnings = append(report.Warnings, msg)
 	}
 
-	slog.DebugContext(ctx, "Got mCSD entries", logging.FHIRServer(fhirBaseURLRaw), slog.Int("count", len(tx.Entry)))
+	slog.DebugContext(ctx, "Got mCSD entries", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), slog.Int("count", len(tx.Entry)))
+	writtenURAs := organizationURAs(tx, c.config.AuthoritativeIdentifierSystem)
+	c.detectURAConflicts(ctx, directoryKey, writtenURAs, &report)
+	if options.dryRun {
+		report.CountPlanned = len(tx.Entry)
+		for _, entry := range tx.Entry {
+			if entry.Request == nil {
+				continue
+			}
+			switch entry.Request.Method {
+			case fhir.HTTPVerbPUT:
+				report.CountPlannedPut++
+			case fhir.HTTPVerbDELETE:
+				report.CountPlannedDelete++
+			}
+		}
+		return report, queryErr
+	}
 	if len(tx.Entry) == 0 {
-		return report, nil
+		// Changes of previous updates that couldn't be applied to query mirrors yet are still applied
+		_, _ = c.submitToQueryDirectories(ctx, directoryKey, tx, &report)
+		return report, queryErr
+	}
+
+	// The time of the last update is only advanced for resource types that were queried completely.
+	nextSyncTimes := make(map[string]string, len(searchSets))
+	for resourceType, searchSet := range searchSets {
+		nextSyncTimes[resourceType] = c.nextSyncTime(ctx, directoryKey, fhirBaseURLRaw, searchSet, queryStartTime)
+	}
+
+	// Query mirrors receive the changes even if the query directory failed, the failed chunks are buffered for the query directory only
+	failedTx, err := c.submitToQueryDirectories(ctx, directoryKey, tx, &report)
+	report.Warnings = append(report.Warnings, retries.take()...)
+	if err != nil {
+		// Only the failed chunks need to be applied again
+		if c.config.TransactionBufferDir != "" {
+			if bufferErr := c.bufferTransaction(directoryKey, nextSyncTimes, failedTx); bufferErr != nil {
+				slog.ErrorContext(ctx, "Failed to buffer mCSD update transaction", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey), logging.Error(bufferErr))
+			} else {
+				slog.InfoContext(ctx, "Buffered mCSD update transaction, it will be applied on the next update", logging.FHIRServer(fhirBaseURLRaw), slog.String("directory", directoryKey))
+			}
+		}
+		// The time of the last update isn't changed, so the changes are fetched again in the next update
+		return report, fmt.Errorf("failed to apply mCSD update to query directory: %w", err)
+	}
+	c.setLastUpdateTimes(directoryKey, nextSyncTimes)
+	c.setURAWriters(directoryKey, writtenURAs)
+	return report, queryErr
+}
+
+// sinceTimes returns the _since parameter to use per resource type: the time of the last update of the resource type,
+// unless a full sync is requested or the since option is set. Resource types without a time of the last update are fully synchronized.
+func (c *Component) sinceTimes(directoryKey string, resourceTypes []string, options syncOptions) map[string]string {
+	if options.full {
+		return nil
+	}
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	result := make(map[string]string)
+	for _, resourceType := range resourceTypes {
+		if options.since != "" {
+			result[resourceType] = options.since
+		} else if lastUpdate := c.lastUpdateTimes[directoryKey][resourceType]; lastUpdate != "" {
+			result[resourceType] = lastUpdate
+		}
+	}
+	return result
+}
+
+// setLastUpdateTimes stores the times of the last update of the given resource types of a directory.
+// An empty time removes the time of the last update, so the resource type is fully synchronized in the next update.
+func (c *Component) setLastUpdateTimes(directoryKey string, lastUpdateTimes map[string]string) {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	current := maps.Clone(c.lastUpdateTimes[directoryKey])
+	if current == nil {
+		current = make(map[string]string, len(lastUpdateTimes))
+	}
+	for resourceType, lastUpdate := range lastUpdateTimes {
+		if lastUpdate == "" {
+			delete(current, resourceType)
+		} else {
+			current[resourceType] = lastUpdate
+		}
+	}
+	if len(current) == 0 {
+		delete(c.lastUpdateTimes, directoryKey)
+	} else {
+		c.lastUpdateTimes[directoryKey] = current
 	}
+}
 
-	var txResult fhir.Bundle
-	if err := queryDirectoryFHIRClient.CreateWithContext(ctx, tx, &txResult, fhirclient.AtPath("/")); err != nil {
-		return DirectoryUpdateReport{}, fmt.Errorf("failed to apply mCSD update to query directory: %w", err)
+// nextSyncTime determines the time of the last update to store after a successful update.
+// Use the search result Bundle's meta.lastUpdated if available, otherwise fall back to query start time.
+// This uses the FHIR server's own timestamp, eliminating clock skew issues.
+// It's normalized to UTC, so the watermark is stable even if the server changes the time zone it reports in.
+// It returns an empty string if the next update should be a full sync.
+func (c *Component) nextSyncTime(ctx context.Context, directoryKey string, fhirBaseURLRaw string, searchSet fhir.Bundle, queryStartTime time.Time) string {
+	if searchSet.Meta != nil && searchSet.Meta.LastUpdated != nil {
+		nextSyncTime, err := normalizeTimestamp(*searchSet.Meta.LastUpdated)
+		if err != nil {
+			slog.WarnContext(ctx, "Bundle meta.lastUpdated is not a valid timestamp, using local time with buffer", logging.FHIRServer(fhirBaseURLRaw), logging.Error(err))
+			return queryStartTime.Add(-c.config.ClockSkewBuffer).UTC().Format(time.RFC3339Nano)
+		}
+		return nextSyncTime
+	}
+	c.reportMissingBundleMeta(ctx, directoryKey, fhirBaseURLRaw)
+	if c.config.MissingBundleMetaFallback == MissingBundleMetaFallbackFullSync {
+		return ""
 	}
+	// Fallback to local time with buffer to account for potential clock skew
+	return queryStartTime.Add(-c.config.ClockSkewBuffer).UTC().Format(time.RFC3339Nano)
+}
 
-	// Process result
+// countTransactionResult adds the outcome of the entries of the transaction result to the report.
+// The entries of the result correspond to the entries of the transaction, which are used to count them per resource type.
+func countTransactionResult(tx fhir.Bundle, txResult fhir.Bundle, report *DirectoryUpdateReport) {
 	for i, entry := range txResult.Entry {
 		if entry.Response == nil {
 			msg := fmt.Sprintf("Skipping entry with no response: #%d", i)
 			report.Warnings = append(report.Warnings, msg)
 			continue
 		}
+		resourceType := "unknown"
+		if i < len(tx.Entry) {
+			resourceType = requestResourceType(tx.Entry[i])
+		}
+		counts := report.resourceType(resourceType)
 		switch {
 		case strings.HasPrefix(entry.Response.Status, "201"):
 			report.CountCreated++
+			counts.CountCreated++
 		case strings.HasPrefix(entry.Response.Status, "200"):
 			report.CountUpdated++
+			counts.CountUpdated++
 		case strings.HasPrefix(entry.Response.Status, "204"):
 			report.CountDeleted++
+			counts.CountDeleted++
 		default:
 			msg := fmt.Sprintf("Unknown HTTP response status %v (url=%v)", entry.Response.Status, entry.FullUrl)
 			report.Warnings = append(report.Warnings, msg)
+			counts.CountErrors++
 		}
 	}
+}
 
-	// Update last sync timestamp on successful completion.
-	// Use the search result Bundle's meta.lastUpdated if available, otherwise fall back to query start time.
-	// This uses the FHIR server's own timestamp string, eliminating clock skew issues.
-	var nextSyncTime string
-	if firstSearchSet.Meta != nil && firstSearchSet.Meta.LastUpdated != nil {
-		nextSyncTime = *firstSearchSet.Meta.LastUpdated
-	} else {
-		// Fallback to local time with buffer to account for potential clock skew
-		nextSyncTime = queryStartTime.Add(-clockSkewBuffer).Format(time.RFC3339Nano)
-		slog.WarnContext(ctx, "Bundle meta.lastUpdated not available, using local time with buffer - may cause clock skew issues", logging.FHIRServer(fhirBaseURLRaw))
+// requestResourceType returns the resource type an entry's request applies to, e.g. "Organization" for "Organization/123" or "Organization?_source=...".
+// It returns "unknown" if the entry has no request.
+func requestResourceType(entry fhir.BundleEntry) string {
+	if entry.Request == nil || entry.Request.Url == "" {
+		return "unknown"
+	}
+	resourceType, _, _ := strings.Cut(entry.Request.Url, "?")
+	resourceType, _, _ = strings.Cut(resourceType, "/")
+	return resourceType
+}
+
+// withoutResourceTypes returns the resource types, except the excluded ones.
+func withoutResourceTypes(resourceTypes []string, excludedTypes []string) []string {
+	return slices.DeleteFunc(slices.Clone(resourceTypes), func(resourceType string) bool {
+		return slices.Contains(excludedTypes, resourceType)
+	})
+}
+
+// parseResourceTypes parses a comma-separated list of resource types, e.g. "Organization,Endpoint".
+// It returns an error if a resource type isn't supported by mCSD.
+func parseResourceTypes(value string) ([]string, error) {
+	var result []string
+	for _, resourceType := range strings.Split(value, ",") {
+		resourceType = strings.TrimSpace(resourceType)
+		index := slices.IndexFunc(defaultDirectoryResourceTypes, func(curr string) bool {
+			return strings.EqualFold(curr, resourceType)
+		})
+		if index == -1 {
+			return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		}
+		result = append(result, defaultDirectoryResourceTypes[index])
+	}
+	return result, nil
+}
+
+// reportMissingBundleMeta logs that the directory didn't return Bundle meta.lastUpdated.
+// Servers that don't populate it never do, so it's only logged as warning the first time for each directory.
+func (c *Component) reportMissingBundleMeta(ctx context.Context, directoryKey string, fhirBaseURL string) {
+	c.directoryMux.Lock()
+	level := slog.LevelWarn
+	if c.missingBundleMetaReported[directoryKey] {
+		level = slog.LevelDebug
+	}
+	c.missingBundleMetaReported[directoryKey] = true
+	c.directoryMux.Unlock()
+	msg := "Bundle meta.lastUpdated not available, using local time with buffer - may cause clock skew issues"
+	if c.config.MissingBundleMetaFallback == MissingBundleMetaFallbackFullSync {
+		msg = "Bundle meta.lastUpdated not available, next update will be a full sync"
+	}
+	slog.Log(ctx, level, msg, logging.FHIRServer(fhirBaseURL))
+}
+
+// normalizeTimestamp converts a FHIR instant (which may contain any time zone offset) to UTC in RFC3339Nano format.
+func normalizeTimestamp(timestamp string) (string, error) {
+	parsed, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return "", err
+	}
+	return parsed.UTC().Format(time.RFC3339Nano), nil
+}
+
+// submitTransactionInChunks submits the entries of the transaction as sequential transactions of at most the configured chunk size,
+// counting the results in the report. A failing chunk doesn't stop the remaining chunks from being submitted,
+// so a single bad resource doesn't prevent the rest of a large directory from being synchronized.
+// It returns a transaction containing the entries of the failed chunks, and the errors that occurred.
+func (c *Component) submitTransactionInChunks(ctx context.Context, directoryKey string, client fhirclient.Client, tx fhir.Bundle, report *DirectoryUpdateReport) (fhir.Bundle, error) {
+	failedTx := fhir.Bundle{Type: fhir.BundleTypeTransaction}
+	chunkCount := (len(tx.Entry) + c.config.TransactionChunkSize - 1) / c.config.TransactionChunkSize
+	var errs []error
+	chunkNum := 0
+	for chunk := range slices.Chunk(tx.Entry, c.config.TransactionChunkSize) {
+		chunkNum++
+		chunkTx := fhir.Bundle{Type: fhir.BundleTypeTransaction, Entry: chunk}
+		var txResult fhir.Bundle
+		usedFallback, err := c.submitTransactionWithFallback(ctx, client, chunkTx, &txResult, report)
+		if err != nil {
+			if chunkCount > 1 {
+				err = fmt.Errorf("transaction %d of %d: %w", chunkNum, chunkCount, err)
+			}
+			errs = append(errs, err)
+			failedTx.Entry = append(failedTx.Entry, chunk...)
+			for _, entry := range chunk {
+				report.resourceType(requestResourceType(entry)).CountErrors++
+			}
+			continue
+		}
+		countTransactionResult(chunkTx, txResult, report)
+		if usedFallback {
+			report.QueryDirectory = QueryDirectoryTargetFallback
+		} else if c.fhirQueryFallbackClient != nil && report.QueryDirectory == "" {
+			report.QueryDirectory = QueryDirectoryTargetPrimary
+		}
+		c.progress.publish(ProgressEvent{Type: progressTransactionApplied, Directory: directoryKey, Count: len(chunk)})
+	}
+	return failedTx, errors.Join(errs...)
+}
+
+// submitTransactionWithFallback submits the transaction to the query directory. If it's unavailable (connectivity or 5xx errors, after retrying),
+// the transaction is submitted to the fallback query directory instead, if configured. It returns whether the fallback query directory was used.
+func (c *Component) submitTransactionWithFallback(ctx context.Context, client fhirclient.Client, tx fhir.Bundle, result *fhir.Bundle, report *DirectoryUpdateReport) (bool, error) {
+	err := c.submitTransaction(ctx, client, tx, result)
+	if err == nil || c.fhirQueryFallbackClient == nil || !errors.As(err, new(transientError)) {
+		return false, err
 	}
-	c.lastUpdateTimes[directoryKey] = nextSyncTime
+	slog.WarnContext(ctx, "Query directory unavailable, applying transaction to fallback query directory", logging.Error(err))
+	*result = fhir.Bundle{}
+	if fallbackErr := c.submitTransaction(ctx, c.fhirQueryFallbackClient, tx, result); fallbackErr != nil {
+		return false, fmt.Errorf("%w (fallback query directory: %w)", err, fallbackErr)
+	}
+	report.Warnings = append(report.Warnings, fmt.Sprintf("applied transaction to fallback query directory, since the query directory is unavailable: %s", err))
+	return true, nil
+}
+
+// submitTransaction submits the transaction to the query directory. If it fails due to a conflict (409 or 412),
+// e.g. caused by a concurrent write, it is retried with exponential backoff up to the configured number of retries.
+// Transient errors (5xx or network errors) are retried as well, see retryTransient.
+// Since the transaction consists of conditional operations, resubmitting it applies the changes on top of the current state.
+// The number of concurrent transactions across all directories is limited by the configured maximum, to avoid overwhelming the query directory.
+func (c *Component) submitTransaction(ctx context.Context, client fhirclient.Client, tx fhir.Bundle, result *fhir.Bundle) error {
+	return c.submitTransactionWithLimit(ctx, client, c.queryWriteSemaphore, tx, result)
+}
 
-	return report, nil
+// submitTransactionWithLimit submits the transaction like submitTransaction, limiting the number of concurrent transactions using the given semaphore.
+func (c *Component) submitTransactionWithLimit(ctx context.Context, client fhirclient.Client, semaphore chan struct{}, tx fhir.Bundle, result *fhir.Bundle) error {
+	select {
+	case semaphore <- struct{}{}:
+		defer func() { <-semaphore }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	backoff := c.conflictRetryBackoff
+	for attempt := 0; ; attempt++ {
+		var statusCode int
+		err := c.retryTransient(ctx, "transaction on query directory", &statusCode, func() error {
+			return client.CreateWithContext(ctx, tx, result, fhirclient.AtPath("/"), fhirclient.ResponseStatusCode(&statusCode))
+		})
+		if err == nil || (statusCode != http.StatusConflict && statusCode != http.StatusPreconditionFailed) || attempt >= c.config.QueryDirectoryConflictRetries {
+			return err
+		}
+		slog.WarnContext(ctx, "Transaction on query directory failed due to conflict, retrying",
+			slog.Int("status", statusCode), slog.Int("attempt", attempt+1), slog.Duration("backoff", backoff), logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
 }
 
 // queryFHIR performs a FHIR search query with pagination and returns all matching entries.
 // If includeHistory is true, it queries the _history endpoint to get resource versions.
+// The initial search is retried on transient errors, see retryTransient.
 func (c *Component) queryFHIR(ctx context.Context, client fhirclient.Client, resourceType string, searchParams url.Values, includeHistory bool) ([]fhir.BundleEntry, fhir.Bundle, error) {
 	var searchSet fhir.Bundle
 	var path string
@@ -504,19 +2004,35 @@ func (c *Component) queryFHIR(ctx context.Context, client fhirclient.Client, res
 		paginationErrMsg = "pagination of search failed"
 	}
 
-	err := client.SearchWithContext(ctx, "", searchParams, &searchSet, fhirclient.AtPath(path))
+	var statusCode int
+	err := c.retryTransient(ctx, path+" search", &statusCode, func() error {
+		return client.SearchWithContext(ctx, "", searchParams, &searchSet, fhirclient.AtPath(path), fhirclient.ResponseStatusCode(&statusCode))
+	})
 	if err != nil {
+		if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+			return nil, fhir.Bundle{}, fmt.Errorf("%s: %w: %w", searchErrMsg, errResourceTypeNotSupported, err)
+		}
+		if statusCode == 0 {
+			err = noResponseError{err}
+		}
 		return nil, fhir.Bundle{}, fmt.Errorf("%s: %w", searchErrMsg, err)
 	}
 
 	var entries []fhir.BundleEntry
+	tooManyEntries := false
 	err = fhirclient.Paginate(ctx, client, searchSet, func(searchSet *fhir.Bundle) (bool, error) {
 		entries = append(entries, searchSet.Entry...)
-		if len(entries) >= maxUpdateEntries {
+		c.progress.publish(ProgressEvent{Type: progressPageFetched, Directory: progressDirectory(ctx), ResourceType: resourceType, Count: len(searchSet.Entry)})
+		if len(entries) >= maxQueryEntries {
+			tooManyEntries = true
 			return false, fmt.Errorf("too many entries (%d), aborting update to prevent excessive memory usage", len(entries))
 		}
 		return true, nil
 	})
+	// Only _history results can be applied partially: the remaining changes are fetched again in the next update.
+	if err != nil && includeHistory && c.config.ApplyPartialOnPaginationError && !tooManyEntries && len(entries) > 0 {
+		return entries, searchSet, fmt.Errorf("%s: %w: %w", paginationErrMsg, errPaginationIncomplete, err)
+	}
 	if err != nil {
 		return nil, fhir.Bundle{}, fmt.Errorf("%s: %w", paginationErrMsg, err)
 	}
@@ -532,56 +2048,191 @@ func (c *Component) query(ctx context.Context, remoteAdminDirectoryFHIRClient fh
 	return c.queryFHIR(ctx, remoteAdminDirectoryFHIRClient, resourceType, searchParams, false)
 }
 
-// deduplicateHistoryEntries keeps only the most recent version of each resource
+// deduplicateHistoryEntries keeps only the most recent version of each resource.
+// If all entries already refer to distinct resources, the entries are returned as-is, preserving their order.
 func deduplicateHistoryEntries(entries []fhir.BundleEntry) []fhir.BundleEntry {
-	resourceMap := make(map[string]fhir.BundleEntry)
-	var entriesWithoutID []fhir.BundleEntry
-
-	for _, entry := range entries {
-		var resourceID string
-
-		if entry.Resource == nil {
-			if entry.Request != nil && entry.Request.Method == fhir.HTTPVerbDELETE {
-				resourceID = extractResourceIDFromURL(entry)
-			}
-		} else {
-			if info, err := libfhir.ExtractResourceInfo(entry.Resource); err == nil {
-				resourceID = info.ID
-			}
+	resourceIDs := make([]string, len(entries))
+	seen := make(map[string]bool, len(entries))
+	unique := true
+	for i, entry := range entries {
+		resourceIDs[i] = historyEntryResourceID(entry)
+		if resourceIDs[i] == "" {
+			continue
+		}
+		if seen[resourceIDs[i]] {
+			unique = false
 		}
+		seen[resourceIDs[i]] = true
+	}
+	if unique {
+		return entries
+	}
 
+	// mostRecent holds the index of the most recent entry of each resource
+	mostRecent := make(map[string]int)
+	var entriesWithoutID []fhir.BundleEntry
+	newestFirst := isNewestFirst(entries)
+
+	for i, entry := range entries {
+		resourceID := resourceIDs[i]
 		if resourceID != "" {
-			existing, exists := resourceMap[resourceID]
-			if !exists || isMoreRecent(entry, existing) {
-				resourceMap[resourceID] = entry
+			existing, exists := mostRecent[resourceID]
+			if !exists || supersedes(entry, entries[existing], newestFirst) {
+				mostRecent[resourceID] = i
 			}
 		} else {
 			entriesWithoutID = append(entriesWithoutID, entry)
 		}
 	}
 
+	// Keep the order of the history, so the result is deterministic
 	var result []fhir.BundleEntry
-	for _, entry := range resourceMap {
-		result = append(result, entry)
+	for i, entry := range entries {
+		if resourceIDs[i] != "" && mostRecent[resourceIDs[i]] == i {
+			result = append(result, entry)
+		}
 	}
 	result = append(result, entriesWithoutID...)
 	return result
 }
 
+// deduplicateByIdentifier keeps only the most recent entry of resources that share the same business identifier,
+// for resource types that have an identifier system configured in identifierSystems (resource type -> identifier system).
+// Entries without such identifier (e.g. DELETEs) are kept as-is. The order of the remaining entries is preserved.
+func deduplicateByIdentifier(entries []fhir.BundleEntry, identifierSystems map[string]string) []fhir.BundleEntry {
+	keys := make([]string, len(entries))
+	mostRecent := make(map[string]int)
+	for i, entry := range entries {
+		keys[i] = businessIdentifierKey(entry, identifierSystems)
+		if keys[i] == "" {
+			continue
+		}
+		if current, exists := mostRecent[keys[i]]; !exists || isMoreRecent(entry, entries[current]) {
+			mostRecent[keys[i]] = i
+		}
+	}
+	if len(mostRecent) == 0 {
+		return entries
+	}
+	var result []fhir.BundleEntry
+	for i, entry := range entries {
+		if keys[i] == "" || mostRecent[keys[i]] == i {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// businessIdentifierKey returns a key identifying the logical resource of an entry by its business identifier,
+// or an empty string if its resource type has no identifier system configured or the resource has no such identifier.
+func businessIdentifierKey(entry fhir.BundleEntry, identifierSystems map[string]string) string {
+	if entry.Resource == nil {
+		return ""
+	}
+	var resource struct {
+		ResourceType string            `json:"resourceType"`
+		Identifier   []fhir.Identifier `json:"identifier"`
+	}
+	if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+		return ""
+	}
+	for resourceType, system := range identifierSystems {
+		if !strings.EqualFold(resourceType, resource.ResourceType) {
+			continue
+		}
+		for _, identifier := range resource.Identifier {
+			if identifier.System != nil && *identifier.System == system && identifier.Value != nil && *identifier.Value != "" {
+				return resource.ResourceType + "|" + system + "|" + *identifier.Value
+			}
+		}
+	}
+	return ""
+}
+
+// historyEntryResourceID returns the ID of the resource an entry refers to, or an empty string if it can't be determined.
+func historyEntryResourceID(entry fhir.BundleEntry) string {
+	if entry.Resource == nil {
+		if entry.Request != nil && entry.Request.Method == fhir.HTTPVerbDELETE {
+			return extractResourceIDFromURL(entry)
+		}
+		return ""
+	}
+	info, err := libfhir.ExtractResourceInfo(entry.Resource)
+	if err != nil {
+		return ""
+	}
+	if info.ID == "" {
+		return resourceIDFromEntryURL(entry, info.ResourceType)
+	}
+	return info.ID
+}
+
 // isMoreRecent compares two entries, returns true if first is more recent
 func isMoreRecent(entry1, entry2 fhir.BundleEntry) bool {
 	time1 := getLastUpdated(entry1)
 	time2 := getLastUpdated(entry2)
-	if !time1.IsZero() && !time2.IsZero() {
+	if !time1.IsZero() && !time2.IsZero() && !time1.Equal(time2) {
 		return time1.After(time2)
 	}
+	if time1.Equal(time2) {
+		// Timestamps might be truncated (e.g. to seconds), fall back to the version of the resources
+		if comparison, ok := compareVersionIDs(entry1, entry2); ok {
+			return comparison > 0
+		}
+	}
 	// Fallback: cannot determine which is more recent, do not overwrite
 	return false
 }
 
-// getLastUpdated extracts lastUpdated timestamp from an entry
+// supersedes returns true if entry1, which comes after entry2 in the history, is the more recent operation on the resource.
+// If the timestamps are equal (or both missing), the entries' numeric meta.versionId is compared.
+// If that isn't conclusive either, or only one of the entries has a timestamp (e.g. a DELETE without response.lastModified),
+// the order of the history is used: entry1 supersedes entry2 if the history is ordered oldest first.
+func supersedes(entry1, entry2 fhir.BundleEntry, newestFirst bool) bool {
+	time1 := getLastUpdated(entry1)
+	time2 := getLastUpdated(entry2)
+	if time1.Equal(time2) {
+		if comparison, ok := compareVersionIDs(entry1, entry2); ok && comparison != 0 {
+			return comparison > 0
+		}
+	}
+	if time1.IsZero() || time2.IsZero() || time1.Equal(time2) {
+		return !newestFirst
+	}
+	return time1.After(time2)
+}
+
+// isNewestFirst returns whether the history entries are ordered newest first, as prescribed by the FHIR specification.
+// Since not all servers adhere to it, the order is derived from the timestamps of the entries (spanning all pages).
+// If the order can't be determined, newest first is assumed.
+func isNewestFirst(entries []fhir.BundleEntry) bool {
+	var ascending, descending int
+	var previous time.Time
+	for _, entry := range entries {
+		current := getLastUpdated(entry)
+		if current.IsZero() {
+			continue
+		}
+		if !previous.IsZero() {
+			if current.After(previous) {
+				ascending++
+			} else if current.Before(previous) {
+				descending++
+			}
+		}
+		previous = current
+	}
+	return ascending <= descending
+}
+
+// getLastUpdated extracts lastUpdated timestamp from an entry, falling back to response.lastModified for entries without resource (DELETE operations).
 func getLastUpdated(entry fhir.BundleEntry) time.Time {
 	if entry.Resource == nil {
+		if entry.Response != nil && entry.Response.LastModified != nil {
+			if lastModified, err := time.Parse(time.RFC3339Nano, *entry.Response.LastModified); err == nil {
+				return lastModified
+			}
+		}
 		return time.Time{}
 	}
 	info, err := libfhir.ExtractResourceInfo(entry.Resource)
@@ -591,6 +2242,32 @@ func getLastUpdated(entry fhir.BundleEntry) time.Time {
 	return *info.LastUpdated
 }
 
+// compareVersionIDs compares the meta.versionId of the resources of two entries numerically.
+// It returns false if either of the entries has no resource (e.g. DELETE operations) or no numeric versionId.
+func compareVersionIDs(entry1, entry2 fhir.BundleEntry) (int, bool) {
+	version1, ok1 := getVersionID(entry1)
+	version2, ok2 := getVersionID(entry2)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return cmp.Compare(version1, version2), true
+}
+
+func getVersionID(entry fhir.BundleEntry) (int64, bool) {
+	if entry.Resource == nil {
+		return 0, false
+	}
+	info, err := libfhir.ExtractResourceInfo(entry.Resource)
+	if err != nil || info.VersionID == "" {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(info.VersionID, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
 // extractResourceIDFromURL extracts the resource ID from a DELETE operation's URL
 func extractResourceIDFromURL(entry fhir.BundleEntry) string {
 	// First try to extract from Request.Url (e.g., "Organization/123")
@@ -612,38 +2289,207 @@ func extractResourceIDFromURL(entry fhir.BundleEntry) string {
 	return ""
 }
 
-// queryAllResourceTypes queries all specified resource types from the FHIR server and returns combined entries.
-func (c *Component) queryAllResourceTypes(ctx context.Context, fhirClient fhirclient.Client, resourceTypes []string, searchParams url.Values) ([]fhir.BundleEntry, fhir.Bundle, error) {
+// failedResourceTypes holds the errors of the resource types that couldn't be (completely) queried, by resource type.
+type failedResourceTypes map[string]error
+
+func (f failedResourceTypes) Error() string {
+	return errors.Join(f.Unwrap()...).Error()
+}
+
+func (f failedResourceTypes) Unwrap() []error {
+	var result []error
+	for _, resourceType := range slices.Sorted(maps.Keys(f)) {
+		result = append(result, f[resourceType])
+	}
+	return result
+}
+
+// queryAllResourceTypes queries the history of the given resource types, since the time in sinceTimes for each resource type (if any).
+// Resource types the directory doesn't support (404 Not Found or 410 Gone) are recorded as such and skipped, unless none of the resource types are supported.
+// Resource types that fail otherwise don't prevent the others from being queried: their errors are returned as failedResourceTypes,
+// along with the entries of the other resource types. The first page of the result is returned by resource type, for the resource types that were queried completely.
+// If systemHistory is true, the resource types are first queried using a single system-level _history request (see querySystemHistory).
+func (c *Component) queryAllResourceTypes(ctx context.Context, directoryKey string, fhirClient fhirclient.Client, systemHistory bool, resourceTypes []string, searchParams url.Values, sinceTimes map[string]string) ([]fhir.BundleEntry, map[string]fhir.Bundle, error) {
 	var entries []fhir.BundleEntry
-	var firstSearchSet fhir.Bundle
+	searchSets := make(map[string]fhir.Bundle)
+	var unsupportedErrs []error
+	failed := make(failedResourceTypes)
+
+	// Organizations are always queried without _since, so they're queried separately.
+	// The _profile parameter can't be set per resource type in a system-level query, so resource types with a required profile
+	// are queried separately as well when filtering by profile.
+	systemHistoryTypes := slices.DeleteFunc(slices.Clone(resourceTypes), func(resourceType string) bool {
+		return resourceType == "Organization" || (c.config.FilterHistoryByProfile && c.requiredProfile(resourceType) != "")
+	})
+	if systemHistory && len(systemHistoryTypes) > 1 {
+		systemEntries, systemSearchSet, statusCode, err := c.querySystemHistory(ctx, fhirClient, systemHistoryTypes, searchParams, sinceTimes)
+		switch {
+		case err == nil:
+			for _, resourceType := range systemHistoryTypes {
+				searchSets[resourceType] = systemSearchSet
+				c.recordResourceTypeSupport(directoryKey, resourceType, true)
+			}
+			entries = append(entries, systemEntries...)
+			resourceTypes = slices.DeleteFunc(slices.Clone(resourceTypes), func(resourceType string) bool {
+				return slices.Contains(systemHistoryTypes, resourceType)
+			})
+		case statusCode >= 400 && statusCode < 500:
+			slog.WarnContext(ctx, "System-level history query rejected by mCSD Directory, querying history per resource type", slog.String("directory", directoryKey), logging.Error(err))
+		case errors.As(err, new(noResponseError)):
+			return nil, nil, fmt.Errorf("failed to query system history: %w", err)
+		default:
+			for _, resourceType := range systemHistoryTypes {
+				failed[resourceType] = fmt.Errorf("failed to query system history: %w", err)
+			}
+			resourceTypes = slices.DeleteFunc(slices.Clone(resourceTypes), func(resourceType string) bool {
+				return slices.Contains(systemHistoryTypes, resourceType)
+			})
+		}
+	}
 
-	for i, resourceType := range resourceTypes {
+	for _, resourceType := range resourceTypes {
 		// Create a copy of searchParams for this resource type
 		params := make(url.Values)
 		for k, v := range searchParams {
 			params[k] = v
 		}
 
-		// Remove _single parameter for Organization resource type
-		if resourceType == "Organization" {
-			params.Del("_since")
+		// Organizations are always queried without _since
+		if since := sinceTimes[resourceType]; since != "" && resourceType != "Organization" {
+			params.Set("_since", since)
+		}
+
+		if c.config.FilterHistoryByProfile {
+			if requiredProfile := c.requiredProfile(resourceType); requiredProfile != "" {
+				params.Set("_profile", requiredProfile)
+			}
 		}
 
 		currEntries, currSearchSet, err := c.queryHistory(ctx, fhirClient, resourceType, params)
+		if err != nil && params.Has("_profile") {
+			// Not all FHIR servers support _profile on _history, retry without it
+			slog.WarnContext(ctx, "History query with _profile failed, retrying without _profile", slog.String("resource_type", resourceType), logging.Error(err))
+			params.Del("_profile")
+			currEntries, currSearchSet, err = c.queryHistory(ctx, fhirClient, resourceType, params)
+		}
+		if errors.Is(err, errResourceTypeNotSupported) {
+			slog.WarnContext(ctx, "Resource type not supported by mCSD Directory, skipping", slog.String("directory", directoryKey), slog.String("resource_type", resourceType), logging.Error(err))
+			c.recordResourceTypeSupport(directoryKey, resourceType, false)
+			unsupportedErrs = append(unsupportedErrs, fmt.Errorf("failed to query %s history: %w", resourceType, err))
+			continue
+		}
+		if errors.As(err, new(noResponseError)) {
+			// The directory can't be reached, so there's no point in querying the other resource types
+			return nil, nil, fmt.Errorf("failed to query %s history: %w", resourceType, err)
+		}
 		if err != nil {
-			return nil, fhir.Bundle{}, fmt.Errorf("failed to query %s history: %w", resourceType, err)
+			failed[resourceType] = fmt.Errorf("failed to query %s history: %w", resourceType, err)
+			if !errors.Is(err, errPaginationIncomplete) {
+				continue
+			}
+			// Keep the entries that were collected, the caller decides what to do with them
+		} else {
+			searchSets[resourceType] = currSearchSet
 		}
+		c.recordResourceTypeSupport(directoryKey, resourceType, true)
 		entries = append(entries, currEntries...)
-		if i == 0 {
-			firstSearchSet = currSearchSet
+	}
+	if len(failed) > 0 {
+		if len(entries) == 0 && len(searchSets) == 0 {
+			// Nothing to synchronize
+			return nil, nil, errors.Join(failed.Unwrap()...)
+		}
+		return entries, searchSets, failed
+	}
+	if len(searchSets) == 0 && len(unsupportedErrs) > 0 {
+		return nil, nil, errors.Join(unsupportedErrs...)
+	}
+	return entries, searchSets, nil
+}
+
+// querySystemHistory queries the history of the given resource types using a single system-level _history request
+// (GET [base]/_history?_type=...), since the earliest time in sinceTimes of these resource types (if all have one).
+// The entries are returned grouped by resource type, in the order of resourceTypes. The status code of the initial request is returned,
+// so the caller can fall back to querying the history per resource type if the directory doesn't support it.
+func (c *Component) querySystemHistory(ctx context.Context, client fhirclient.Client, resourceTypes []string, searchParams url.Values, sinceTimes map[string]string) ([]fhir.BundleEntry, fhir.Bundle, int, error) {
+	params := make(url.Values)
+	for k, v := range searchParams {
+		params[k] = v
+	}
+	params.Set("_type", strings.Join(resourceTypes, ","))
+	// The times are compared as instants, since their precision and UTC offsets may differ.
+	// If any of them is missing (or invalid), the full history is queried.
+	var since string
+	var earliest time.Time
+	for _, resourceType := range resourceTypes {
+		sinceTime, err := time.Parse(time.RFC3339Nano, sinceTimes[resourceType])
+		if err != nil {
+			since = ""
+			break
+		}
+		if since == "" || sinceTime.Before(earliest) {
+			since = sinceTimes[resourceType]
+			earliest = sinceTime
+		}
+	}
+	if since != "" {
+		params.Set("_since", since)
+	}
+
+	var searchSet fhir.Bundle
+	var statusCode int
+	err := c.retryTransient(ctx, "_history search", &statusCode, func() error {
+		return client.SearchWithContext(ctx, "", params, &searchSet, fhirclient.AtPath("_history"), fhirclient.ResponseStatusCode(&statusCode))
+	})
+	if err != nil {
+		if statusCode == 0 {
+			err = noResponseError{err}
+		}
+		return nil, fhir.Bundle{}, statusCode, fmt.Errorf("system _history search failed: %w", err)
+	}
+	entriesByType := make(map[string][]fhir.BundleEntry)
+	count := 0
+	err = fhirclient.Paginate(ctx, client, searchSet, func(page *fhir.Bundle) (bool, error) {
+		for _, entry := range page.Entry {
+			// Deleted resources have no resource, only a request URL
+			resourceType := requestResourceType(entry)
+			if entry.Resource != nil {
+				if info, err := libfhir.ExtractResourceInfo(entry.Resource); err == nil {
+					resourceType = info.ResourceType
+				}
+			}
+			entriesByType[resourceType] = append(entriesByType[resourceType], entry)
+		}
+		count += len(page.Entry)
+		c.progress.publish(ProgressEvent{Type: progressPageFetched, Directory: progressDirectory(ctx), Count: len(page.Entry)})
+		if count >= maxQueryEntries {
+			return false, fmt.Errorf("too many entries (%d), aborting update to prevent excessive memory usage", count)
 		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fhir.Bundle{}, statusCode, fmt.Errorf("pagination of system _history search failed: %w", err)
+	}
+	var entries []fhir.BundleEntry
+	for _, resourceType := range resourceTypes {
+		entries = append(entries, entriesByType[resourceType]...)
 	}
+	return entries, searchSet, statusCode, nil
+}
 
-	return entries, firstSearchSet, nil
+// requiredProfile returns the configured profile for the given resource type, or an empty string if none is configured.
+// Resource types are matched case-insensitively, since configuration keys might have been lowercased (e.g. when set through environment variables).
+func (c *Component) requiredProfile(resourceType string) string {
+	for configuredType, profileURL := range c.config.RequiredProfiles {
+		if strings.EqualFold(configuredType, resourceType) {
+			return profileURL
+		}
+	}
+	return ""
 }
 
 // checkForURAIdentifierChanges detects if any Organization's URA identifier has changed between history versions
-func checkForURAIdentifierChanges(entries []fhir.BundleEntry) bool {
+func checkForURAIdentifierChanges(entries []fhir.BundleEntry, identifierSystem string) bool {
 	// Map to track URA identifiers per Organization ID
 	// We use empty string "" as a marker for "no URA identifier present"
 	orgURAMap := make(map[string]map[string]bool) // orgID -> set of URA values (or "" for no URA)
@@ -666,7 +2512,7 @@ func checkForURAIdentifierChanges(entries []fhir.BundleEntry) bool {
 		orgID := *org.Id
 
 		// Extract URA identifiers
-		uraIdentifiers := libfhir.FilterIdentifiersBySystem(org.Identifier, coding.URANamingSystem)
+		uraIdentifiers := libfhir.FilterIdentifiersBySystem(org.Identifier, identifierSystem)
 
 		// Initialize map for this org if needed
 		if orgURAMap[orgID] == nil {
@@ -699,14 +2545,20 @@ func checkForURAIdentifierChanges(entries []fhir.BundleEntry) bool {
 func (c *Component) ensureParentOrganizationsMap(ctx context.Context, fhirBaseURLRaw string, remoteAdminDirectoryFHIRClient fhirclient.Client, authoritativeUra string) (parentOrganizationMap, error) {
 	slog.DebugContext(ctx, "Querying organizations for authoritative check (parent organization map build)", logging.FHIRServer(fhirBaseURLRaw))
 	orgEntries, _, err := c.query(ctx, remoteAdminDirectoryFHIRClient, "Organization", url.Values{
-		"_count": []string{strconv.Itoa(searchPageSize)},
+		"_count": []string{strconv.Itoa(c.config.OrgDiscoveryPageSize)},
 	})
+	if errors.Is(err, errResourceTypeNotSupported) {
+		// Directories that only contain e.g. Endpoints don't need to support Organization:
+		// there are no organizations, so resources referring to one will fail validation.
+		slog.DebugContext(ctx, "Organization not supported by mCSD Directory, no parent organizations", logging.FHIRServer(fhirBaseURLRaw))
+		return make(parentOrganizationMap), nil
+	}
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to query all organizations, aborting parent organization map build", logging.FHIRServer(fhirBaseURLRaw), logging.Error(err))
 		return nil, err
 	}
 
-	parentOrganizationsMap, err := createOrganizationTree(orgEntries)
+	parentOrganizationsMap, err := createOrganizationTree(orgEntries, c.config.AuthoritativeIdentifierSystem)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to build parent organization map from all organizations, aborting parent organization map build", logging.FHIRServer(fhirBaseURLRaw), logging.Error(err))
 		return nil, err
@@ -716,7 +2568,7 @@ func (c *Component) ensureParentOrganizationsMap(ctx context.Context, fhirBaseUR
 	if authoritativeUra != "" {
 		filtered := make(parentOrganizationMap)
 		for parentOrg, linkedOrgs := range parentOrganizationsMap {
-			uraIdentifiers := libfhir.FilterIdentifiersBySystem(parentOrg.Identifier, coding.URANamingSystem)
+			uraIdentifiers := libfhir.FilterIdentifiersBySystem(parentOrg.Identifier, c.config.AuthoritativeIdentifierSystem)
 			for _, ura := range uraIdentifiers {
 				if ura.Value != nil && *ura.Value == authoritativeUra {
 					filtered[parentOrg] = linkedOrgs
@@ -726,15 +2578,131 @@ func (c *Component) ensureParentOrganizationsMap(ctx context.Context, fhirBaseUR
 		}
 		parentOrganizationsMap = filtered
 	}
+	// Directories without organizations (e.g. endpoint-only directories) are valid, but organizations without (matching) URA
+	// indicate a problem in the directory, since none of its resources can be validated against an authoritative organization.
+	if len(parentOrganizationsMap) == 0 && len(orgEntries) > 0 {
+		slog.WarnContext(ctx, "mCSD Directory contains organizations, but none with a (matching) URA identifier", logging.FHIRServer(fhirBaseURLRaw),
+			slog.Int("organizations", len(orgEntries)), slog.String("authoritative_ura", authoritativeUra))
+	}
 
 	return parentOrganizationsMap, nil
 }
 
+// countOrganizations returns the number of organizations in the parent organization map, both parent and linked organizations.
+func countOrganizations(parentOrganizationsMap parentOrganizationMap) int {
+	count := 0
+	for _, linkedOrgs := range parentOrganizationsMap {
+		count += 1 + len(linkedOrgs)
+	}
+	return count
+}
+
+// detectOrganizationCountDrop compares the directory's organization count to that of the previous run,
+// and adds a warning to the report if it dropped by more than the configured percentage. It returns true if a drop was detected.
+func (c *Component) detectOrganizationCountDrop(ctx context.Context, directoryKey string, count int, report *DirectoryUpdateReport) bool {
+	c.directoryMux.Lock()
+	previousCount, hasPrevious := c.organizationCounts[directoryKey]
+	c.directoryMux.Unlock()
+	if !hasPrevious || previousCount == 0 || c.config.OrgCountDropThreshold <= 0 || count >= previousCount {
+		return false
+	}
+	dropPercentage := (previousCount - count) * 100 / previousCount
+	if dropPercentage <= c.config.OrgCountDropThreshold {
+		return false
+	}
+	msg := fmt.Sprintf("organization count dropped by %d%% (from %d to %d) since previous run, which might indicate a problem with the directory", dropPercentage, previousCount, count)
+	slog.WarnContext(ctx, "Organization count of mCSD Directory dropped sharply", slog.String("directory", directoryKey), slog.Int("previous_count", previousCount), slog.Int("count", count))
+	report.Warnings = append(report.Warnings, msg)
+	return true
+}
+
+// handleMultipleURAs handles the parent organizations that have multiple identifiers with the authoritative system (URAs),
+// according to the configuration: they're removed from the map (MultipleURAsSkip), or all but the URA with the lowest value
+// are removed from the organization (MultipleURAsLowest). It returns a warning for each of these organizations.
+func (c *Component) handleMultipleURAs(ctx context.Context, parentOrganizationsMap parentOrganizationMap) []string {
+	var warnings []string
+	for parentOrg := range parentOrganizationsMap {
+		var uras []string
+		for _, identifier := range libfhir.FilterIdentifiersBySystem(parentOrg.Identifier, c.config.AuthoritativeIdentifierSystem) {
+			if identifier.Value != nil {
+				uras = append(uras, *identifier.Value)
+			}
+		}
+		if len(uras) <= 1 {
+			continue
+		}
+		slices.Sort(uras)
+		var orgID string
+		if parentOrg.Id != nil {
+			orgID = *parentOrg.Id
+		}
+		slog.WarnContext(ctx, "Organization has multiple URA identifiers", slog.String("organization", orgID), slog.Any("uras", uras), slog.String("handling", c.config.MultipleURAs))
+		if c.config.MultipleURAs == MultipleURAsLowest {
+			keepLowestURA(parentOrg, c.config.AuthoritativeIdentifierSystem)
+			warnings = append(warnings, fmt.Sprintf("organization %s has multiple URA identifiers (%s), using the lowest: %s", orgID, strings.Join(uras, ", "), uras[0]))
+		} else {
+			delete(parentOrganizationsMap, parentOrg)
+			warnings = append(warnings, fmt.Sprintf("organization %s has multiple URA identifiers (%s), skipping it", orgID, strings.Join(uras, ", ")))
+		}
+	}
+	// Organizations are iterated in random order, so sort the warnings to keep the report deterministic
+	slices.Sort(warnings)
+	return warnings
+}
+
+// organizationURAs returns the URAs (identifiers of the given system) of the organizations written by the transaction.
+func organizationURAs(tx fhir.Bundle, identifierSystem string) []string {
+	var result []string
+	for _, entry := range tx.Entry {
+		if entry.Request == nil || entry.Request.Method != fhir.HTTPVerbPUT || entry.Resource == nil {
+			continue
+		}
+		var org struct {
+			ResourceType string            `json:"resourceType"`
+			Identifier   []fhir.Identifier `json:"identifier"`
+		}
+		if err := json.Unmarshal(entry.Resource, &org); err != nil || org.ResourceType != "Organization" {
+			continue
+		}
+		for _, identifier := range org.Identifier {
+			if identifier.System != nil && *identifier.System == identifierSystem && identifier.Value != nil && *identifier.Value != "" {
+				result = append(result, *identifier.Value)
+			}
+		}
+	}
+	return result
+}
+
+// detectURAConflicts adds a warning to the report for each URA that was last written by another directory.
+// Two directories claiming the same organization might indicate spoofing or a misconfiguration. The write isn't blocked.
+func (c *Component) detectURAConflicts(ctx context.Context, directoryKey string, uras []string, report *DirectoryUpdateReport) {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	for _, ura := range uras {
+		writer, exists := c.uraWriters[ura]
+		if !exists || writer == directoryKey {
+			continue
+		}
+		msg := fmt.Sprintf("organization with URA %s was last written by mCSD Directory %s, and is now overwritten by %s", ura, writer, directoryKey)
+		slog.WarnContext(ctx, "Organization URA claimed by multiple mCSD Directories", slog.String("ura", ura), slog.String("previous_directory", writer), slog.String("directory", directoryKey))
+		report.Warnings = append(report.Warnings, msg)
+	}
+}
+
+// setURAWriters records the directory as the one that last wrote the organizations with the given URAs.
+func (c *Component) setURAWriters(directoryKey string, uras []string) {
+	c.directoryMux.Lock()
+	defer c.directoryMux.Unlock()
+	for _, ura := range uras {
+		c.uraWriters[ura] = directoryKey
+	}
+}
+
 // If no organization with URA is found directly, it traverses each organization's partOf chain to find a parent with URA.
 // Returns the parent organization with the most linked organizations and a slice of all organizations whose
 // partOf chain leads to the parent.
 // Returns (nil, nil) if no organization with URA identifier is found (not an error condition).
-func createOrganizationTree(entries []fhir.BundleEntry) (parentOrganizationMap, error) {
+func createOrganizationTree(entries []fhir.BundleEntry, identifierSystem string) (parentOrganizationMap, error) {
 	result := make(parentOrganizationMap)
 
 	// Build a map of all organizations for efficient lookup using ID as key
@@ -754,7 +2722,7 @@ func createOrganizationTree(entries []fhir.BundleEntry) (parentOrganizationMap,
 
 	// Loop through all organizations to find all with URA identifier
 	for _, org := range orgMap {
-		uraIdentifiers := libfhir.FilterIdentifiersBySystem(org.Identifier, coding.URANamingSystem)
+		uraIdentifiers := libfhir.FilterIdentifiersBySystem(org.Identifier, identifierSystem)
 		if len(uraIdentifiers) > 0 {
 			// Found an organization with URA, find all organizations linked to it
 			linkedOrgs := findOrganizationsLinkedToParent(orgMap, org)
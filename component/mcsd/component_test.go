@@ -1,23 +1,39 @@
 package mcsd
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/httpauth"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/profile"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/tlsutil"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
@@ -74,7 +90,7 @@ func TestComponent_update_regression(t *testing.T) {
 	component, err := New(config)
 	require.NoError(t, err)
 	component.fhirQueryClient = localClient
-	component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
+	component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
 		if baseURL.String() == server.URL {
 			return fhirclient.New(baseURL, http.DefaultClient, nil)
 		} else {
@@ -90,11 +106,360 @@ func TestComponent_update_regression(t *testing.T) {
 	// Root directories only query Organization and Endpoint resource types
 	// Location history is provided in test data but should not be queried (and thus no warnings about it)
 	// The test verifies the regression data can be processed without errors
-	assert.Empty(t, report[server.URL].Warnings, "should have no warnings since Location is not queried for root directories")
+	// The only warning is about the absence of mCSD Directory endpoints, which the regression data doesn't contain
+	assert.Equal(t, []string{"root mCSD Directory contains 3 organization(s) with a URA identifier, but no mCSD Directory endpoints: no directories can be discovered"},
+		report[server.URL].Warnings, "should have no warnings about Location, since it is not queried for root directories")
 	assert.Empty(t, report[server.URL].Errors)
 	assert.NotNil(t, report[server.URL].Errors, "expected an empty slice")
 }
 
+func TestComponent_update_cancelled(t *testing.T) {
+	setup := func(t *testing.T, concurrency int, cancel context.CancelFunc) (*Component, string, string) {
+		cancellingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(cancellingServer.Close)
+		otherServer := startMockServer(t, nil)
+		t.Cleanup(otherServer.Close)
+		config := DefaultConfig()
+		config.Concurrency = concurrency
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		require.NoError(t, component.registerAdministrationDirectory(context.Background(), cancellingServer.URL+"/fhir", rootDirectoryResourceTypes, 0, "", ""))
+		require.NoError(t, component.registerAdministrationDirectory(context.Background(), otherServer.URL+"/fhir", rootDirectoryResourceTypes, 0, "", ""))
+		return component, cancellingServer.URL + "/fhir", otherServer.URL + "/fhir"
+	}
+
+	t.Run("remaining directories are not updated", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		component, cancelledURL, remainingURL := setup(t, 1, cancel)
+
+		report, err := component.update(ctx)
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, report[cancelledURL].Errors)
+		assert.Equal(t, []string{"sync cancelled: context canceled"}, report[remainingURL].Errors)
+		assert.Zero(t, component.syncStates()[remainingURL].LastAttempt, "directories that weren't updated should not be recorded as attempted")
+	})
+	t.Run("concurrent update", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		component, cancelledURL, remainingURL := setup(t, 2, cancel)
+
+		report, err := component.update(ctx)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sync cancelled: context canceled"}, report[cancelledURL].Errors)
+		assert.Equal(t, []string{"sync cancelled: context canceled"}, report[remainingURL].Errors)
+	})
+}
+
+func TestComponent_update_requestTimeout(t *testing.T) {
+	hangingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(hangingServer.Close)
+	otherServer := startMockServer(t, nil)
+	t.Cleanup(otherServer.Close)
+	config := DefaultConfig()
+	config.RequestTimeout = 100 * time.Millisecond
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	require.NoError(t, component.registerAdministrationDirectory(context.Background(), hangingServer.URL+"/fhir", rootDirectoryResourceTypes, 0, "", ""))
+	require.NoError(t, component.registerAdministrationDirectory(context.Background(), otherServer.URL+"/fhir", rootDirectoryResourceTypes, 0, "", ""))
+
+	report, err := component.update(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, report[hangingServer.URL+"/fhir"].Errors, 1)
+	assert.Contains(t, report[hangingServer.URL+"/fhir"].Errors[0], "Client.Timeout exceeded")
+	assert.Empty(t, report[otherServer.URL+"/fhir"].Errors, "other directories should still be updated")
+}
+
+func TestComponent_systemHistory(t *testing.T) {
+	const organization = `{"resourceType":"Organization","id":"org-1","name":"Care Org","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"12345678"}],"endpoint":[{"reference":"Endpoint/ep-1"}]}`
+	const endpoint = `{"resourceType":"Endpoint","id":"ep-1","status":"active","address":"https://example.com/fhir",` +
+		`"connectionType":{"system":"http://terminology.hl7.org/CodeSystem/endpoint-connection-type","code":"hl7-fhir-rest"},` +
+		`"payloadType":[{"coding":[{"system":"http://example.com","code":"other"}]}]}`
+	organizationHistory := `{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `,"request":{"method":"PUT","url":"Organization/org-1"}}]}`
+	organizationSearchSet := `{"resourceType":"Bundle","type":"searchset","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `}]}`
+	endpointHistory := `{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Endpoint/ep-1","resource":` + endpoint + `,"request":{"method":"PUT","url":"Endpoint/ep-1"}}]}`
+	emptyHistory := `{"resourceType":"Bundle","type":"history","entry":[]}`
+	startDirectory := func(t *testing.T, systemHistoryStatus int) (string, *[]string) {
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization/_history": &organizationHistory,
+			"/fhir/Organization":          &organizationSearchSet,
+			"/fhir/Endpoint/_history":     &endpointHistory,
+			"/fhir/Location/_history":     &emptyHistory,
+		})
+		mux.HandleFunc("/fhir/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			w.WriteHeader(systemHistoryStatus)
+			if systemHistoryStatus == http.StatusOK {
+				_, _ = w.Write([]byte(endpointHistory))
+			}
+		})
+		var requestsMux sync.Mutex
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestsMux.Lock()
+			request := r.URL.Path + "?" + r.URL.Query().Get("_type")
+			if profile := r.URL.Query().Get("_profile"); profile != "" {
+				request += "&_profile=" + profile
+			}
+			requests = append(requests, request)
+			requestsMux.Unlock()
+			mux.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL + "/fhir", &requests
+	}
+	update := func(t *testing.T, directoryURL string, configure ...func(config *Config)) DirectoryUpdateReport {
+		config := DefaultConfig()
+		for _, fn := range configure {
+			fn(&config)
+		}
+		config.AdministrationDirectories = map[string]DirectoryConfig{"root": {FHIRBaseURL: directoryURL, SystemHistorySupport: true}}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		report, err := component.updateFromDirectory(context.Background(), directoryURL, []string{"Organization", "Endpoint", "Location"}, false, "")
+		require.NoError(t, err)
+		return report
+	}
+
+	t.Run("single request for all resource types except Organization", func(t *testing.T) {
+		directoryURL, requests := startDirectory(t, http.StatusOK)
+
+		report := update(t, directoryURL)
+
+		assert.Equal(t, 2, report.CountCreated)
+		assert.Contains(t, *requests, "/fhir/_history?Endpoint,Location")
+		assert.Contains(t, *requests, "/fhir/Organization/_history?")
+		assert.NotContains(t, *requests, "/fhir/Endpoint/_history?")
+		assert.NotContains(t, *requests, "/fhir/Location/_history?")
+	})
+	t.Run("falls back to history per resource type if rejected", func(t *testing.T) {
+		directoryURL, requests := startDirectory(t, http.StatusBadRequest)
+
+		report := update(t, directoryURL)
+
+		assert.Equal(t, 2, report.CountCreated)
+		assert.Empty(t, report.Errors)
+		assert.Contains(t, *requests, "/fhir/_history?Endpoint,Location")
+		assert.Contains(t, *requests, "/fhir/Endpoint/_history?")
+		assert.Contains(t, *requests, "/fhir/Location/_history?")
+	})
+	t.Run("resource types with a required profile are queried per resource type when filtering by profile", func(t *testing.T) {
+		directoryURL, requests := startDirectory(t, http.StatusOK)
+
+		report := update(t, directoryURL, func(config *Config) {
+			config.FilterHistoryByProfile = true
+			config.RequiredProfiles = map[string]string{"Location": profile.NLGenericFunctionLocation}
+		})
+
+		assert.Equal(t, 2, report.CountCreated)
+		assert.Contains(t, *requests, "/fhir/Location/_history?&_profile="+profile.NLGenericFunctionLocation)
+		assert.Contains(t, *requests, "/fhir/Endpoint/_history?")
+		assert.NotContains(t, *requests, "/fhir/_history?Endpoint,Location")
+	})
+	t.Run("single request if filtering by profile without required profiles", func(t *testing.T) {
+		directoryURL, requests := startDirectory(t, http.StatusOK)
+
+		update(t, directoryURL, func(config *Config) {
+			config.FilterHistoryByProfile = true
+			config.RequiredProfiles = map[string]string{}
+		})
+
+		assert.Contains(t, *requests, "/fhir/_history?Endpoint,Location")
+	})
+	t.Run("_since is the earliest time of the resource types", func(t *testing.T) {
+		testCases := []struct {
+			name       string
+			sinceTimes map[string]string
+			expected   string
+		}{
+			{
+				name:       "same precision",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T10:00:01Z", "Location": "2025-01-01T10:00:00Z"},
+				expected:   "2025-01-01T10:00:00Z",
+			},
+			{
+				name:       "mixed precision",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T10:00:00.5Z", "Location": "2025-01-01T10:00:00Z"},
+				expected:   "2025-01-01T10:00:00Z",
+			},
+			{
+				name:       "mixed offsets",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T09:30:00Z", "Location": "2025-01-01T10:00:00+01:00"},
+				expected:   "2025-01-01T10:00:00+01:00",
+			},
+			{
+				name:       "mixed precision and offsets",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T10:00:00.123+01:00", "Location": "2025-01-01T09:00:00.5Z"},
+				expected:   "2025-01-01T10:00:00.123+01:00",
+			},
+			{
+				name:       "missing time",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T10:00:00Z"},
+				expected:   "",
+			},
+			{
+				name:       "invalid time",
+				sinceTimes: map[string]string{"Endpoint": "2025-01-01T10:00:00Z", "Location": "yesterday"},
+				expected:   "",
+			},
+		}
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				var since *string
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					since = to.Ptr(r.FormValue("_since"))
+					w.Header().Set("Content-Type", "application/fhir+json")
+					_, _ = w.Write([]byte(emptyHistory))
+				}))
+				t.Cleanup(server.Close)
+				baseURL, _ := url.Parse(server.URL + "/fhir")
+				component, err := New(DefaultConfig())
+				require.NoError(t, err)
+
+				_, _, _, err = component.querySystemHistory(context.Background(), fhirclient.New(baseURL, http.DefaultClient, nil), []string{"Endpoint", "Location"}, url.Values{}, testCase.sinceTimes)
+
+				require.NoError(t, err)
+				require.NotNil(t, since)
+				assert.Equal(t, testCase.expected, *since)
+			})
+		}
+	})
+}
+
+func TestComponent_proxy(t *testing.T) {
+	const directoryURL = "http://directory.example.invalid/fhir"
+	// startProxy starts a stub forward proxy that serves the mCSD Directory and OAuth2 token endpoint itself, recording the proxied requests.
+	startProxy := func(t *testing.T) (*httptest.Server, *[]string) {
+		emptyHistory := `{"resourceType":"Bundle","type":"history","entry":[]}`
+		emptySearchSet := `{"resourceType":"Bundle","type":"searchset","entry":[]}`
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization/_history": &emptyHistory,
+			"/fhir/Organization":          &emptySearchSet,
+		})
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3600}`))
+		})
+		var requestsMux sync.Mutex
+		var proxiedRequests []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestsMux.Lock()
+			proxiedRequests = append(proxiedRequests, r.Host+r.URL.Path)
+			requestsMux.Unlock()
+			mux.ServeHTTP(w, r)
+		}))
+		t.Cleanup(proxy.Close)
+		return proxy, &proxiedRequests
+	}
+
+	t.Run("directory without own client", func(t *testing.T) {
+		proxy, proxiedRequests := startProxy(t)
+		config := DefaultConfig()
+		config.ProxyURL = proxy.URL
+		config.AdministrationDirectories = map[string]DirectoryConfig{"root": {FHIRBaseURL: directoryURL}}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+
+		_, err = component.updateFromDirectory(context.Background(), directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.Contains(t, *proxiedRequests, "directory.example.invalid/fhir/Organization/_history")
+	})
+	t.Run("directory with OAuth2", func(t *testing.T) {
+		proxy, proxiedRequests := startProxy(t)
+		config := DefaultConfig()
+		config.ProxyURL = proxy.URL
+		config.AdministrationDirectories = map[string]DirectoryConfig{"root": {
+			FHIRBaseURL: directoryURL,
+			Auth: httpauth.OAuth2Config{
+				TokenEndpoint: "http://auth.example.invalid/token",
+				ClientID:      "client",
+				ClientSecret:  "secret",
+			},
+		}}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+
+		_, err = component.updateFromDirectory(context.Background(), directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.Contains(t, *proxiedRequests, "auth.example.invalid/token")
+		assert.Contains(t, *proxiedRequests, "directory.example.invalid/fhir/Organization/_history")
+	})
+	t.Run("invalid proxy URL", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ProxyURL = "proxy.example.com:3128"
+
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid proxy URL: proxy.example.com:3128 (must be an absolute http, https or socks5 URL)")
+	})
+}
+
+func TestComponent_update_duration(t *testing.T) {
+	server := startMockServer(t, nil)
+	t.Cleanup(server.Close)
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	now := time.Now()
+	component.nowFunc = func() time.Time {
+		// Every call takes a second
+		now = now.Add(time.Second)
+		return now
+	}
+	require.NoError(t, component.registerAdministrationDirectory(context.Background(), server.URL+"/fhir", rootDirectoryResourceTypes, 0, "", ""))
+
+	report, err := component.update(context.Background())
+
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, report[server.URL+"/fhir"].DurationMillis, int64(1000))
+}
+
+func TestComponent_update_logsDirectoryKey(t *testing.T) {
+	server := startMockServer(t, nil)
+	t.Cleanup(server.Close)
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	directoryURL := server.URL + "/fhir"
+	require.NoError(t, component.registerAdministrationDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, 0, "", "1111"))
+	require.NoError(t, component.registerAdministrationDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, 0, "", "2222"))
+	logs := new(bytes.Buffer)
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+
+	_, err = component.update(context.Background())
+
+	require.NoError(t, err)
+	for _, ura := range []string{"1111", "2222"} {
+		directoryAttr := "directory=" + makeDirectoryKey(directoryURL, ura)
+		assert.Contains(t, logs.String(), `msg="Updating from mCSD Directory" fhir_server=`+directoryURL+" "+directoryAttr)
+		assert.Contains(t, logs.String(), `msg="Finished updating from mCSD Directory" fhir_server=`+directoryURL+" "+directoryAttr+" created=")
+	}
+}
+
 func TestComponent_update(t *testing.T) {
 	t.Log("mCSD Component is tested limited here, as it requires running FHIR servers and a lot of data. The main logic is tested in the integration tests.")
 
@@ -183,7 +548,7 @@ func TestComponent_update(t *testing.T) {
 		Error: errors.New("404 Not Found"),
 	}
 	component.fhirQueryClient = localClient
-	component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
+	component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
 		if baseURL.String() == rootDirServer.URL ||
 			baseURL.String() == orgDir1BaseURL {
 			return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{
@@ -210,13 +575,16 @@ func TestComponent_update(t *testing.T) {
 			require.Len(t, thisReport.Warnings, 3)
 			// Check that both expected warnings are present (order may vary due to deduplication)
 			warnings := strings.Join(thisReport.Warnings, " ")
-			require.Contains(t, warnings, "failed to register discovered mCSD Directory at file:///etc/passwd: invalid FHIR base URL (url=file:///etc/passwd)")
+			require.Contains(t, warnings, "address scheme 'file' is not allowed (address=file:///etc/passwd, allowed: http, https)")
 			require.Contains(t, warnings, "resource type Something-else not allowed")
 			require.Contains(t, warnings, "endpoint must be referenced in at least one organization's or valid healthcare service's endpoint field (endpoint ID: non-dir-endpoint)")
 		})
 		require.Equal(t, 4, thisReport.CountCreated) // 4 mCSD directory endpoints should be created
 		require.Equal(t, 0, thisReport.CountUpdated)
 		require.Equal(t, 0, thisReport.CountDeleted)
+		assert.Equal(t, []string{"Organization", "Endpoint"}, thisReport.ResourceTypes)
+		// The invalid entries are counted as the resource type of their request
+		assert.Equal(t, &ResourceTypeReport{CountCreated: 4, CountErrors: 2}, thisReport.PerResourceType["Endpoint"])
 	})
 	t.Run("assert sync report from org1 directory", func(t *testing.T) {
 		thisReport := report[makeDirectoryKey(orgDir1BaseURL, "111")]
@@ -225,6 +593,11 @@ func TestComponent_update(t *testing.T) {
 		require.Equal(t, 3, thisReport.CountCreated) // 3 resources: Organization + 2 Endpoints
 		require.Equal(t, 0, thisReport.CountUpdated)
 		require.Equal(t, 0, thisReport.CountDeleted)
+		assert.Equal(t, map[string]*ResourceTypeReport{
+			"Organization": {CountCreated: 1},
+			"Endpoint":     {CountCreated: 2},
+		}, thisReport.PerResourceType)
+		assert.Equal(t, config.DirectoryResourceTypes, thisReport.ResourceTypes)
 		t.Run("assert meta.source", func(t *testing.T) {
 			var endpoint fhir.Endpoint
 			for _, resource := range localClient.CreatedResources["Endpoint"] {
@@ -261,1227 +634,3387 @@ func TestComponent_update(t *testing.T) {
 	})
 }
 
-func TestComponent_incrementalUpdates(t *testing.T) {
-	testDataJSONOrg, err := os.ReadFile("test/root_dir_organization_history_response.json")
+func TestComponent_handleUpdate(t *testing.T) {
+	server := startMockServer(t, nil)
+	defer server.Close()
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: server.URL + "/fhir"},
+	}
+	component, err := New(config)
 	require.NoError(t, err)
-	testDataJSONEndpoint, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+
+	t.Run("compact JSON by default", func(t *testing.T) {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Equal(t, "application/json", httpResponse.Header().Get("Content-Type"))
+		assert.NotContains(t, httpResponse.Body.String(), "\n")
+		var report UpdateReport
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &report))
+		assert.Contains(t, report, server.URL+"/fhir")
+	})
+	t.Run("pretty-printed JSON", func(t *testing.T) {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?pretty=true", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "{\n  \""+server.URL+"/fhir\": {\n    \"created\": 0,")
+	})
+}
+
+func TestComponent_handleUpdate_fullRefresh(t *testing.T) {
+	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
 	require.NoError(t, err)
-	emptyResponse, err := os.ReadFile("test/regression_lrza_empty_history_response.json")
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
 	require.NoError(t, err)
-
+	organizationHistoryStr := string(organizationHistory)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
 	require.NoError(t, err)
 
 	var sinceParams []string
-	rootDirMux := http.NewServeMux()
-	// For incremental updates test, we need custom handlers to capture _since parameters
-	rootDirMux.HandleFunc("/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
-		// FHIR client configured to use GET, parameters are in query string
-		w.Header().Set("Content-Type", "application/fhir+json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(testDataJSONOrg)
-	})
-	rootDirMux.HandleFunc("/Organization", func(w http.ResponseWriter, r *http.Request) {
-		// FHIR client configured to use GET, parameters are in query string
-		w.Header().Set("Content-Type", "application/fhir+json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(testDataJSONOrg)
+	var mu sync.Mutex
+	startServer := func() *httptest.Server {
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization": &organizationHistoryStr,
+		})
+		mux.HandleFunc("/fhir/{resourceType}/_history", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			sinceParams = append(sinceParams, r.URL.Query().Get("_since"))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/fhir+json")
+			switch r.PathValue("resourceType") {
+			case "Organization":
+				_, _ = w.Write(organizationHistory)
+			case "Endpoint":
+				_, _ = w.Write(endpointHistory)
+			default:
+				_, _ = w.Write(emptyBundleData)
+			}
+		})
+		return httptest.NewServer(mux)
+	}
+	server1 := startServer()
+	defer server1.Close()
+	server2 := startServer()
+	defer server2.Close()
+
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"dir1": {FHIRBaseURL: server1.URL + "/fhir"},
+		"dir2": {FHIRBaseURL: server2.URL + "/fhir"},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	component.lastUpdateTimes[server1.URL+"/fhir"] = map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}
+	component.lastUpdateTimes[server2.URL+"/fhir"] = map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+
+	httpResponse := httptest.NewRecorder()
+	internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?full=true", nil))
+
+	require.Equal(t, http.StatusOK, httpResponse.Code)
+	require.NotEmpty(t, sinceParams)
+	for _, since := range sinceParams {
+		assert.Empty(t, since, "full refresh should not send _since")
+	}
+	// Watermarks are reset to the new values
+	assert.NotEqual(t, "2025-08-01T10:00:00Z", component.lastUpdateTimes[server1.URL+"/fhir"]["Endpoint"])
+	assert.NotEqual(t, "2025-08-01T10:00:00Z", component.lastUpdateTimes[server2.URL+"/fhir"]["Endpoint"])
+}
+
+func TestComponent_handleUpdate_resourceTypes(t *testing.T) {
+	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
+	require.NoError(t, err)
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	organizationHistoryStr := string(organizationHistory)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+
+	var queriedResourceTypes []string
+	mux := http.NewServeMux()
+	mockEndpoints(mux, map[string]*string{
+		"/fhir/Organization": &organizationHistoryStr,
 	})
-	rootDirMux.HandleFunc("/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
-		// FHIR client configured to use GET, parameters are in query string
-		since := r.URL.Query().Get("_since")
-		sinceParams = append(sinceParams, since)
+	mux.HandleFunc("/fhir/{resourceType}/_history", func(w http.ResponseWriter, r *http.Request) {
+		queriedResourceTypes = append(queriedResourceTypes, r.PathValue("resourceType"))
 		w.Header().Set("Content-Type", "application/fhir+json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(testDataJSONEndpoint)
+		if r.PathValue("resourceType") == "Endpoint" {
+			_, _ = w.Write(endpointHistory)
+		} else {
+			_, _ = w.Write(emptyBundleData)
+		}
 	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	// Convert []byte responses to strings for pointer approach
-	emptyResponseStr2 := string(emptyResponse)
-
-	mockEndpoints(rootDirMux, map[string]*string{
-		"/Location/_history":          &emptyResponseStr2,
-		"/HealthcareService/_history": &emptyResponseStr2,
-		"/PractitionerRole/_history":  &emptyResponseStr2,
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: server.URL + "/fhir"},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+
+	t.Run("only requested resource types are queried", func(t *testing.T) {
+		queriedResourceTypes = nil
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?types=endpoint,Practitioner", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Equal(t, []string{"Endpoint"}, queriedResourceTypes)
+		lastUpdateTimes := component.lastUpdateTimes[server.URL+"/fhir"]
+		assert.Len(t, lastUpdateTimes, 1, "only the watermark of the requested resource types should be advanced")
+		assert.Contains(t, lastUpdateTimes, "Endpoint")
 	})
+	t.Run("unsupported resource type", func(t *testing.T) {
+		queriedResourceTypes = nil
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?types=Organization,Patient", nil))
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "unsupported resource type: Patient")
+		assert.Empty(t, queriedResourceTypes)
+	})
+}
 
-	rootDirServer := httptest.NewServer(rootDirMux)
-
-	localClient := &test.StubFHIRClient{}
+func TestComponent_directoryAuth(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-` + r.FormValue("client_id") + `","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+	startDirectory := func(t *testing.T, authorization *string) string {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/fhir/", func(w http.ResponseWriter, r *http.Request) {
+			*authorization = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"history","entry":[]}`))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server.URL + "/fhir"
+	}
+	var authorization1, authorization2 string
+	directory1 := startDirectory(t, &authorization1)
+	directory2 := startDirectory(t, &authorization2)
 	config := DefaultConfig()
+	config.Auth = httpauth.OAuth2Config{TokenEndpoint: tokenServer.URL, ClientID: "query", ClientSecret: "secret"}
 	config.AdministrationDirectories = map[string]DirectoryConfig{
-		"rootDir": {
-			FHIRBaseURL: rootDirServer.URL,
-		},
-	}
-	config.QueryDirectory = DirectoryConfig{
-		FHIRBaseURL: "http://example.com/local/fhir",
+		"dir1": {FHIRBaseURL: directory1, Auth: httpauth.OAuth2Config{TokenEndpoint: tokenServer.URL, ClientID: "dir1", ClientSecret: "secret"}},
+		"dir2": {FHIRBaseURL: directory2},
 	}
 	component, err := New(config)
 	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
 
-	component.fhirQueryClient = localClient
-	component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-		if baseURL.String() == rootDirServer.URL {
-			return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{
-				UsePostSearch: false,
-			})
-		}
-		if baseURL.String() == "http://example.com/local/fhir" {
-			return localClient
-		}
-		return &test.StubFHIRClient{Error: errors.New("unknown URL")}
-	}
-	ctx := context.Background()
+	t.Run("directory with its own credentials", func(t *testing.T) {
+		_, err := component.updateFromDirectory(context.Background(), directory1, []string{"Organization"}, false, "")
 
-	// First update - should have no _since parameter
-	_, err = component.update(ctx)
-	require.NoError(t, err)
-	require.Len(t, sinceParams, 1, "Should have 1 request")
-	require.Empty(t, sinceParams[0], "First update should not have _since parameter")
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-dir1", authorization1)
+	})
+	t.Run("directory without credentials", func(t *testing.T) {
+		_, err := component.updateFromDirectory(context.Background(), directory2, []string{"Organization"}, false, "")
 
-	// Verify timestamp was stored
-	lastUpdate, exists := component.lastUpdateTimes[rootDirServer.URL]
-	require.True(t, exists, "Last update time should be stored")
-	require.NotEmpty(t, lastUpdate, "Last update time should not be empty")
+		require.NoError(t, err)
+		assert.Empty(t, authorization2, "credentials of the query directory should not be sent to remote directories")
+	})
+	t.Run("fall back to credentials of the query directory", func(t *testing.T) {
+		config := config
+		config.DirectoryAuthFallback = true
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
 
-	// Second update - should include _since parameter
-	_, err = component.update(ctx)
-	require.NoError(t, err)
-	require.Len(t, sinceParams, 2, "Should have 2 requests total")
-	require.NotEmpty(t, sinceParams[1], "Second update should include _since parameter")
+		_, err = component.updateFromDirectory(context.Background(), directory1, []string{"Organization"}, false, "")
+		require.NoError(t, err)
+		_, err = component.updateFromDirectory(context.Background(), directory2, []string{"Organization"}, false, "")
+		require.NoError(t, err)
 
-	// Verify _since parameter is a valid RFC3339 timestamp
-	_, err = time.Parse(time.RFC3339, sinceParams[1])
-	require.NoError(t, err, "_since parameter should be valid RFC3339 timestamp")
-	_, err = time.Parse(time.RFC3339Nano, sinceParams[1])
-	require.NoError(t, err, "_since parameter should be valid RFC3339Nano timestamp")
+		assert.Equal(t, "Bearer token-dir1", authorization1, "own credentials take precedence")
+		assert.Equal(t, "Bearer token-query", authorization2)
+	})
+	t.Run("configured URL with trailing slash", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"dir1": {FHIRBaseURL: directory1 + "/", Auth: httpauth.OAuth2Config{TokenEndpoint: tokenServer.URL, ClientID: "dir1", ClientSecret: "secret"}},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		authorization1 = ""
 
-	// Verify _since parameter matches the stored timestamp
-	require.Equal(t, lastUpdate, sinceParams[1], "_since parameter should match the stored lastUpdate timestamp")
-}
+		_, err = component.updateFromDirectory(context.Background(), directory1+"/", []string{"Organization"}, false, "")
 
-func TestComponent_multipleDirsSameFHIRBaseURL(t *testing.T) {
-	t.Log("Test that multiple organizations can share the same fhirBaseURL with different authoritative URAs and sync independently")
-
-	// Setup shared directory server first (so we can reference its URL in test data)
-	sharedDirMux := http.NewServeMux()
-	sharedDirServer := httptest.NewServer(sharedDirMux)
-	defer sharedDirServer.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-dir1", authorization1)
+	})
+	t.Run("incomplete credentials", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"dir1": {FHIRBaseURL: directory1, Auth: httpauth.OAuth2Config{TokenEndpoint: tokenServer.URL}},
+		}
 
-	// Common resource templates - define once, reuse for both shared and root directories
-	orgTemplate := `{
-		"resourceType": "Organization",
-		"id": "%s",
-		"meta": {"lastUpdated": "2025-12-18T09:00:00.000Z"},
-		"identifier": [{"system": "http://fhir.nl/fhir/NamingSystem/ura", "value": "%s"}],
-		"name": "%s"%s
-	}`
+		component, err := New(config)
 
-	endpointTemplate := `{
-		"resourceType": "Endpoint",
-		"id": "shared-endpoint",
-		"meta": {"lastUpdated": "2025-12-18T09:00:00.000Z"},
-		"status": "active",
-		"payloadType": [{
-			"Coding": [{
-				"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
-				"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
-			}]
-		}],
-		"name": "Shared Endpoint",
-		"address": "%s"
-	}`
+		require.NoError(t, err)
+		assert.Empty(t, component.directoryHTTPClients, "incomplete credentials are ignored")
+	})
+}
 
-	endpointRef := `,"endpoint": [{"reference": "Endpoint/shared-endpoint"}]`
-	emptyHistory := `{"resourceType": "Bundle", "type": "history", "entry": []}`
+func TestComponent_directoryMTLS(t *testing.T) {
+	clientCertFile, clientKeyFile, clientCert := createClientCertificate(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"history","entry":[]}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	directoryURL := server.URL + "/fhir"
+
+	t.Run("client certificate is presented", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"dir": {FHIRBaseURL: directoryURL, Config: tlsutil.Config{TLSCertFile: clientCertFile, TLSKeyFile: clientKeyFile, TLSCAFile: caFile}},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
 
-	// Shared directory responses
-	sharedOrgHistory := fmt.Sprintf(`{
-		"resourceType": "Bundle",
-		"type": "history",
-		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
-		"entry": [
-			{
-				"fullUrl": "%s/Organization/org-a",
-				"resource": `+orgTemplate+`,
-				"request": {"method": "POST", "url": "Organization/org-a"},
-				"response": {"status": "201 Created"}
-			},
-			{
-				"fullUrl": "%s/Organization/org-b",
-				"resource": `+orgTemplate+`,
-				"request": {"method": "POST", "url": "Organization/org-b"},
-				"response": {"status": "201 Created"}
-			}
-		]
-	}`, sharedDirServer.URL, "org-a", "111", "Organization A", "",
-		sharedDirServer.URL, "org-b", "222", "Organization B", "")
+		_, err = component.updateFromDirectory(context.Background(), directoryURL, []string{"Organization"}, false, "")
 
-	sharedOrgSearchset := fmt.Sprintf(`{
-		"resourceType": "Bundle",
-		"type": "searchset",
-		"entry": [
-			{
-				"fullUrl": "%s/Organization/org-a",
-				"resource": `+orgTemplate+`
-			},
-			{
-				"fullUrl": "%s/Organization/org-b",
-				"resource": `+orgTemplate+`
-			}
-		]
-	}`, sharedDirServer.URL, "org-a", "111", "Organization A", endpointRef,
-		sharedDirServer.URL, "org-b", "222", "Organization B", endpointRef)
+		require.NoError(t, err)
+	})
+	t.Run("invalid client certificate", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"dir": {FHIRBaseURL: directoryURL, Config: tlsutil.Config{TLSCertFile: clientCertFile}},
+		}
 
-	sharedEndpointHistory := fmt.Sprintf(`{
-		"resourceType": "Bundle",
-		"type": "history",
-		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
-		"entry": [{
-			"fullUrl": "http://test.example.org/fhir/Endpoint/shared-endpoint",
-			"resource": `+endpointTemplate+`,
-			"request": {"method": "POST", "url": "Endpoint/shared-endpoint"},
-			"response": {"status": "201 Created"}
-		}]
-	}`, sharedDirServer.URL)
+		_, err := New(config)
 
-	mockEndpoints(sharedDirMux, map[string]*string{
-		"/Organization/_history":      &sharedOrgHistory,
-		"/Organization":               &sharedOrgSearchset,
-		"/Endpoint/_history":          &sharedEndpointHistory,
-		"/Location/_history":          &emptyHistory,
-		"/HealthcareService/_history": &emptyHistory,
-		"/PractitionerRole/_history":  &emptyHistory,
-		"/Practitioner/_history":      &emptyHistory,
+		require.ErrorContains(t, err, "TLS is configured but failed to load: key file required when using PEM certificate")
 	})
+}
 
-	// Root directory responses - reusing same orgTemplate and endpointTemplate
-	rootOrgHistory := fmt.Sprintf(`{
-		"resourceType": "Bundle",
-		"type": "history",
-		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
-		"entry": [
-			{
-				"fullUrl": "http://test.example.org/fhir/Organization/org-a",
-				"resource": `+orgTemplate+`,
-				"request": {"method": "POST", "url": "Organization/org-a"},
-				"response": {"status": "201 Created"}
-			},
-			{
-				"fullUrl": "http://test.example.org/fhir/Organization/org-b",
-				"resource": `+orgTemplate+`,
-				"request": {"method": "POST", "url": "Organization/org-b"},
-				"response": {"status": "201 Created"}
-			}
-		]
-	}`, "org-a", "111", "Organization A", endpointRef,
-		"org-b", "222", "Organization B", endpointRef)
+// createClientCertificate creates a self-signed TLS client certificate, and returns the paths of its certificate and key file.
+func createClientCertificate(t *testing.T) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certDER)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile, cert
+}
 
-	rootEndpointHistory := fmt.Sprintf(`{
-		"resourceType": "Bundle",
-		"type": "history",
-		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
-		"entry": [{
-			"fullUrl": "http://test.example.org/fhir/Endpoint/shared-endpoint",
-			"resource": `+endpointTemplate+`,
-			"request": {"method": "POST", "url": "Endpoint/shared-endpoint"},
-			"response": {"status": "201 Created"}
-		}]
-	}`, sharedDirServer.URL)
+func TestComponent_handleUpdate_dryRun(t *testing.T) {
+	server := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+		"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+		"/fhir/Endpoint/_history":     "test/root_dir_endpoint_history_response.json",
+	})
+	defer server.Close()
+	directoryURL := server.URL + "/fhir"
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: directoryURL},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+	queryDirectory := &test.StubFHIRClient{}
+	component.fhirQueryClient = queryDirectory
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+
+	t.Run("ok", func(t *testing.T) {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?dryRun=true", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var report UpdateReport
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &report))
+		directoryReport := report[directoryURL]
+		assert.Greater(t, directoryReport.CountPlanned, 0)
+		assert.Equal(t, directoryReport.CountPlanned, directoryReport.CountPlannedPut+directoryReport.CountPlannedDelete)
+		assert.Equal(t, 0, directoryReport.CountCreated)
+		// Nothing should've been applied or changed
+		assert.Empty(t, queryDirectory.CreatedResources)
+		assert.Empty(t, component.lastUpdateTimes)
+	})
+	t.Run("invalid value", func(t *testing.T) {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodPost, "/mcsd/update?dryRun=maybe", nil))
 
-	// Setup root directory server
-	rootDirMux := http.NewServeMux()
-	mockEndpoints(rootDirMux, map[string]*string{
-		"/Organization/_history":      &rootOrgHistory,
-		"/Organization":               &rootOrgHistory,
-		"/Endpoint/_history":          &rootEndpointHistory,
-		"/Endpoint":                   &rootEndpointHistory,
-		"/HealthcareService/_history": &emptyHistory,
-		"/Location/_history":          &emptyHistory,
-		"/PractitionerRole/_history":  &emptyHistory,
-		"/Practitioner/_history":      &emptyHistory,
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "invalid dryRun parameter: maybe")
 	})
-	rootDirServer := httptest.NewServer(rootDirMux)
-	defer rootDirServer.Close()
+}
 
-	// Setup component
-	localClient := &test.StubFHIRClient{}
+func TestComponent_handleStatus(t *testing.T) {
+	server := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+		"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+		"/fhir/Endpoint/_history":     "test/root_dir_endpoint_history_response.json",
+	})
+	defer server.Close()
+	rootDirURL := server.URL + "/fhir"
 	config := DefaultConfig()
 	config.AdministrationDirectories = map[string]DirectoryConfig{
-		"root": {FHIRBaseURL: rootDirServer.URL},
+		"root": {FHIRBaseURL: rootDirURL},
 	}
 	component, err := New(config)
 	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+	getStatus := func(t *testing.T) Status {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsd/status", nil))
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Equal(t, "application/json", httpResponse.Header().Get("Content-Type"))
+		var status Status
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &status))
+		return status
+	}
 
-	component.fhirQueryClient = localClient
-	component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-		urlStr := baseURL.String()
-		if urlStr == rootDirServer.URL || urlStr == sharedDirServer.URL {
-			return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+	t.Run("before first sync", func(t *testing.T) {
+		status := getStatus(t)
+
+		assert.Empty(t, status.LastUpdateTimes)
+		require.Len(t, status.Directories, 1)
+		assert.Equal(t, DirectoryStatus{
+			FHIRBaseURL:   rootDirURL,
+			Discover:      true,
+			ResourceTypes: rootDirectoryResourceTypes,
+		}, status.Directories[0])
+	})
+	t.Run("after sync", func(t *testing.T) {
+		_, err := component.update(context.Background())
+		require.NoError(t, err)
+
+		status := getStatus(t)
+
+		assert.Equal(t, map[string]map[string]string{rootDirURL: {"Organization": "2025-08-14T10:00:00Z", "Endpoint": "2025-08-14T10:00:00Z"}}, status.LastUpdateTimes)
+		require.Greater(t, len(status.Directories), 1, "discovered directories should be listed")
+		for _, directory := range status.Directories[1:] {
+			assert.False(t, directory.Discover)
+			assert.Equal(t, config.DirectoryResourceTypes, directory.ResourceTypes)
 		}
-		return localClient
+	})
+}
+
+func TestComponent_syncLag(t *testing.T) {
+	server := startMockServer(t, nil)
+	defer server.Close()
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: server.URL + "/fhir"},
+	}
+	config.RetryBaseDelay = time.Millisecond
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	now := time.Date(2025, 8, 1, 10, 0, 0, 0, time.UTC)
+	component.nowFunc = func() time.Time {
+		return now
 	}
 
-	// Run update
-	ctx := context.Background()
-	report, err := component.update(ctx)
+	t.Run("no lag before first sync", func(t *testing.T) {
+		assert.Empty(t, component.syncStates())
+		assert.Equal(t, 0, testutil.CollectAndCount(component.syncLagCollector))
+	})
+
+	_, err = component.update(context.Background())
 	require.NoError(t, err)
-	require.NotNil(t, report)
+	now = now.Add(90 * time.Second)
+
+	t.Run("lag reflects time since last successful sync", func(t *testing.T) {
+		state := component.syncStates()[server.URL+"/fhir"]
+		require.NotNil(t, state.LastSuccess)
+		require.NotNil(t, state.LagSeconds)
+		assert.Equal(t, float64(90), *state.LagSeconds)
+		assert.Equal(t, float64(90), testutil.ToFloat64(component.syncLagCollector))
+	})
+	t.Run("lag keeps increasing when sync fails", func(t *testing.T) {
+		server.Close()
+		_, err = component.update(context.Background())
+		require.NoError(t, err)
+		now = now.Add(30 * time.Second)
 
-	// Verify both shared directories were synced with different composite keys
-	sharedKeyOrgA := makeDirectoryKey(sharedDirServer.URL, "111")
-	sharedKeyOrgB := makeDirectoryKey(sharedDirServer.URL, "222")
+		state := component.syncStates()[server.URL+"/fhir"]
+		assert.Equal(t, now.Add(-30*time.Second), state.LastAttempt)
+		assert.Equal(t, float64(120), testutil.ToFloat64(component.syncLagCollector))
+	})
+}
 
-	reportOrgA, existsA := report[sharedKeyOrgA]
-	require.True(t, existsA, "Report for org A should exist with composite key")
-	require.Empty(t, reportOrgA.Errors)
-	require.Equal(t, 2, reportOrgA.CountCreated, "Should have created 2 resource for org A")
+func TestComponent_syncMetrics(t *testing.T) {
+	server := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+		"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+		"/fhir/Endpoint/_history":     "test/root_dir_endpoint_history_response.json",
+	})
+	defer server.Close()
+	directoryKey := server.URL + "/fhir"
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: directoryKey},
+	}
+	config.RetryBaseDelay = time.Millisecond
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
 
-	reportOrgB, existsB := report[sharedKeyOrgB]
-	require.True(t, existsB, "Report for org B should exist with composite key")
-	require.Empty(t, reportOrgB.Errors)
-	require.Equal(t, 2, reportOrgB.CountCreated, "Should have created 2 resource for org B")
+	_, err = component.update(context.Background())
+	require.NoError(t, err)
 
-	// Verify both directories are registered
-	require.Len(t, component.administrationDirectories, 3, "Should have 3 directories: root + 2 shared with different URAs")
+	metrics := component.syncMetrics
+	assert.Equal(t, float64(4), testutil.ToFloat64(metrics.resourcesCreated.WithLabelValues(directoryKey)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.resourcesUpdated.WithLabelValues(directoryKey)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.resourcesDeleted.WithLabelValues(directoryKey)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.syncErrors.WithLabelValues(directoryKey)))
+	// Root directory and the 2 directories discovered from it
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.syncDuration, "mcsd_sync_duration_seconds"))
 
-	// Verify the directories have correct properties
-	var foundOrgA, foundOrgB bool
-	for _, dir := range component.administrationDirectories {
-		if dir.fhirBaseURL == sharedDirServer.URL && dir.authoritativeUra == "111" {
-			foundOrgA = true
-			require.Equal(t, sharedDirServer.URL, dir.fhirBaseURL, "Directory for org A should have shared fhirBaseURL")
-			require.False(t, dir.discover, "Discovered directories should not have discover=true")
-		}
-		if dir.fhirBaseURL == sharedDirServer.URL && dir.authoritativeUra == "222" {
-			foundOrgB = true
-			require.Equal(t, sharedDirServer.URL, dir.fhirBaseURL, "Directory for org B should have shared fhirBaseURL")
-			require.False(t, dir.discover, "Discovered directories should not have discover=true")
-		}
-	}
-	require.True(t, foundOrgA, "Directory for org A (URA 111) should be registered")
-	require.True(t, foundOrgB, "Directory for org B (URA 222) should be registered")
+	t.Run("errors are counted", func(t *testing.T) {
+		server.Close()
 
-	// Verify both directories share the same fhirBaseURL but have different URAs
-	var directoriesWithSharedURL []administrationDirectory
-	for _, dir := range component.administrationDirectories {
-		if dir.fhirBaseURL == sharedDirServer.URL {
-			directoriesWithSharedURL = append(directoriesWithSharedURL, dir)
-		}
-	}
-	require.Len(t, directoriesWithSharedURL, 2, "Should have exactly 2 directories with the shared fhirBaseURL")
-	require.Equal(t, directoriesWithSharedURL[0].fhirBaseURL, directoriesWithSharedURL[1].fhirBaseURL, "Both directories should have the same fhirBaseURL")
-	require.NotEqual(t, directoriesWithSharedURL[0].authoritativeUra, directoriesWithSharedURL[1].authoritativeUra, "Both directories should have different authoritativeUra values")
+		_, err = component.update(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.syncErrors.WithLabelValues(directoryKey)))
+		assert.Equal(t, float64(4), testutil.ToFloat64(metrics.resourcesCreated.WithLabelValues(directoryKey)))
+	})
 }
 
-func TestExtractResourceIDFromURL(t *testing.T) {
-	tests := []struct {
-		name     string
-		entry    fhir.BundleEntry
-		expected string
-	}{
-		{
-			name: "extract from Request.Url with auto increment FHIR ID",
-			entry: fhir.BundleEntry{
-				Request: &fhir.BundleEntryRequest{
-					Url: "Organization/123",
-				},
-			},
-			expected: "123",
-		},
-		{
-			name: "extract from Request.Url with UUID-format ID",
-			entry: fhir.BundleEntry{
-				Request: &fhir.BundleEntryRequest{
-					Url: "Organization/fd3524f9-705e-453c-8130-71cdf51cfcb9",
-				},
-			},
-			expected: "fd3524f9-705e-453c-8130-71cdf51cfcb9",
-		},
-		{
-			name: "extract from fullUrl when Request.Url is empty",
-			entry: fhir.BundleEntry{
-				FullUrl: to.Ptr("http://example.org/fhir/Organization/abc123"),
-				Request: &fhir.BundleEntryRequest{
-					Url: "",
-				},
-			},
-			expected: "abc123",
-		},
-		{
-			name: "extract from fullUrl with UUID-format ID",
-			entry: fhir.BundleEntry{
-				FullUrl: to.Ptr("http://example.org/fhir/Organization/fd3524f9-705e-453c-8130-71cdf51cfcb9"),
-			},
-			expected: "fd3524f9-705e-453c-8130-71cdf51cfcb9",
-		},
-		{
-			name: "return empty string when no ID can be extracted",
-			entry: fhir.BundleEntry{
-				Request: &fhir.BundleEntryRequest{
-					Url: "Organization",
-				},
-			},
-			expected: "",
-		},
-		{
-			name: "return empty string when both Request.Url and fullUrl are empty",
-			entry: fhir.BundleEntry{
-				FullUrl: to.Ptr(""),
-				Request: &fhir.BundleEntryRequest{
-					Url: "",
-				},
-			},
-			expected: "",
+func TestComponent_resourceTypeSupport(t *testing.T) {
+	ctx := context.Background()
+	emptyBundle := `{"resourceType":"Bundle","type":"history","entry":[]}`
+	mux := http.NewServeMux()
+	mockEndpoints(mux, map[string]*string{
+		"/fhir/Organization/_history": &emptyBundle,
+		"/fhir/Organization":          &emptyBundle,
+	})
+	mux.HandleFunc("/fhir/Location/_history", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/fhir/Practitioner/_history", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	directoryURL := server.URL + "/fhir"
+
+	t.Run("unsupported resource types are recorded and skipped", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+
+		_, err = component.updateFromDirectory(ctx, directoryURL, []string{"Organization", "Location", "Practitioner"}, false, "")
+
+		require.NoError(t, err)
+		state := component.syncStates()[makeDirectoryKey(directoryURL, "")]
+		assert.Equal(t, []string{"Organization"}, state.SupportedResourceTypes)
+		assert.Equal(t, []string{"Location", "Practitioner"}, state.UnsupportedResourceTypes)
+	})
+	t.Run("fails if no resource type is supported", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+
+		_, err = component.updateFromDirectory(ctx, directoryURL, []string{"Location"}, false, "")
+
+		require.ErrorIs(t, err, errResourceTypeNotSupported)
+		state := component.syncStates()[makeDirectoryKey(directoryURL, "")]
+		assert.Empty(t, state.SupportedResourceTypes)
+		assert.Equal(t, []string{"Location"}, state.UnsupportedResourceTypes)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("default config is valid", func(t *testing.T) {
+		assert.NoError(t, DefaultConfig().Validate())
+	})
+	t.Run("valid config", func(t *testing.T) {
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = "http://localhost:8080/fhir"
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: "https://example.com/fhir"},
+		}
+
+		assert.NoError(t, config.Validate())
+	})
+	t.Run("reports all problems by configuration key", func(t *testing.T) {
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = "localhost:8080/fhir"
+		config.QueryDirectoryFallback.FHIRBaseURL = "ftp://fallback.example.com"
+		config.QueryMirrors = map[string]DirectoryConfig{"replica": {}}
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"a": {FHIRBaseURL: ""},
+			"b": {FHIRBaseURL: "https://b.example.com/fhir", Auth: httpauth.OAuth2Config{ClientID: "id", ClientSecret: "secret"}},
+		}
+
+		err := config.Validate()
+
+		require.Error(t, err)
+		assert.Equal(t, `mcsd.admin.a.fhirbaseurl is required
+mcsd.admin.b.auth: tokenendpoint is required
+mcsd.query.fhirbaseurl must be an absolute http or https URL (url=localhost:8080/fhir)
+mcsd.queryfallback.fhirbaseurl must be an absolute http or https URL (url=ftp://fallback.example.com)
+mcsd.querymirrors.replica.fhirbaseurl is required`, err.Error())
+	})
+	t.Run("query directory is required when root directories are configured", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: "https://example.com/fhir"},
+		}
+
+		assert.EqualError(t, config.Validate(), "mcsd.query.fhirbaseurl is required when root directories (mcsd.admin) are configured")
+	})
+}
+
+func TestConfigHash(t *testing.T) {
+	newConfig := func() Config {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"a": {FHIRBaseURL: "https://a.example.com/fhir"},
+			"b": {FHIRBaseURL: "https://b.example.com/fhir"},
+		}
+		config.Auth.ClientSecret = "secret"
+		return config
+	}
+	expected, err := configHash(newConfig())
+	require.NoError(t, err)
+
+	t.Run("stable for identical configs", func(t *testing.T) {
+		for range 10 {
+			actual, err := configHash(newConfig())
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		}
+	})
+	t.Run("differs when a value changes", func(t *testing.T) {
+		config := newConfig()
+		config.OrgCountDropThreshold = 10
+
+		actual, err := configHash(config)
+
+		require.NoError(t, err)
+		assert.NotEqual(t, expected, actual)
+	})
+	t.Run("secrets are excluded", func(t *testing.T) {
+		config := newConfig()
+		config.Auth.ClientSecret = "other"
+
+		actual, err := configHash(config)
+
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+	t.Run("secrets of directories are excluded", func(t *testing.T) {
+		withSecrets := func(secret string) DirectoryConfig {
+			var directory DirectoryConfig
+			directory.Auth.ClientSecret = secret
+			directory.Auth.PrivateKeyPEM = secret
+			directory.TLSKeyPassword = secret
+			return directory
+		}
+		hashWithSecrets := func(secret string) string {
+			config := newConfig()
+			config.AdministrationDirectories = map[string]DirectoryConfig{
+				"a": withSecrets(secret),
+			}
+			config.QueryDirectory = withSecrets(secret)
+			config.QueryDirectoryFallback = withSecrets(secret)
+			config.QueryMirrors = map[string]DirectoryConfig{
+				"replica": withSecrets(secret),
+			}
+			actual, err := configHash(config)
+			require.NoError(t, err)
+			return actual
+		}
+		config := newConfig()
+		config.AdministrationDirectories["a"] = withSecrets("secret")
+
+		_, err := configHash(config)
+
+		require.NoError(t, err)
+		assert.Equal(t, hashWithSecrets("secret"), hashWithSecrets("other"))
+		assert.Equal(t, "secret", config.AdministrationDirectories["a"].Auth.ClientSecret, "config of the caller shouldn't be changed")
+	})
+	t.Run("included in update report and state", func(t *testing.T) {
+		server := startMockServer(t, nil)
+		defer server.Close()
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: server.URL + "/fhir"},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		require.NotEmpty(t, component.configHash)
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, component.configHash, report[server.URL+"/fhir"].ConfigHash)
+		assert.Equal(t, component.configHash, component.syncStates()[server.URL+"/fhir"].ConfigHash)
+	})
+}
+
+func TestComponent_incrementalUpdates(t *testing.T) {
+	testDataJSONOrg, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	testDataJSONEndpoint, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	emptyResponse, err := os.ReadFile("test/regression_lrza_empty_history_response.json")
+	require.NoError(t, err)
+
+	require.NoError(t, err)
+
+	var sinceParams []string
+	rootDirMux := http.NewServeMux()
+	// For incremental updates test, we need custom handlers to capture _since parameters
+	rootDirMux.HandleFunc("/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+		// FHIR client configured to use GET, parameters are in query string
+		w.Header().Set("Content-Type", "application/fhir+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testDataJSONOrg)
+	})
+	rootDirMux.HandleFunc("/Organization", func(w http.ResponseWriter, r *http.Request) {
+		// FHIR client configured to use GET, parameters are in query string
+		w.Header().Set("Content-Type", "application/fhir+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testDataJSONOrg)
+	})
+	rootDirMux.HandleFunc("/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+		// FHIR client configured to use GET, parameters are in query string
+		since := r.URL.Query().Get("_since")
+		sinceParams = append(sinceParams, since)
+		w.Header().Set("Content-Type", "application/fhir+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testDataJSONEndpoint)
+	})
+
+	// Convert []byte responses to strings for pointer approach
+	emptyResponseStr2 := string(emptyResponse)
+
+	mockEndpoints(rootDirMux, map[string]*string{
+		"/Location/_history":          &emptyResponseStr2,
+		"/HealthcareService/_history": &emptyResponseStr2,
+		"/PractitionerRole/_history":  &emptyResponseStr2,
+	})
+
+	rootDirServer := httptest.NewServer(rootDirMux)
+
+	localClient := &test.StubFHIRClient{}
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"rootDir": {
+			FHIRBaseURL: rootDirServer.URL,
 		},
 	}
+	config.QueryDirectory = DirectoryConfig{
+		FHIRBaseURL: "http://example.com/local/fhir",
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+
+	component.fhirQueryClient = localClient
+	component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+		if baseURL.String() == rootDirServer.URL {
+			return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{
+				UsePostSearch: false,
+			})
+		}
+		if baseURL.String() == "http://example.com/local/fhir" {
+			return localClient
+		}
+		return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+	}
+	ctx := context.Background()
+
+	// First update - should have no _since parameter
+	_, err = component.update(ctx)
+	require.NoError(t, err)
+	require.Len(t, sinceParams, 1, "Should have 1 request")
+	require.Empty(t, sinceParams[0], "First update should not have _since parameter")
+
+	// Verify timestamp was stored
+	lastUpdate, exists := component.lastUpdateTimes[rootDirServer.URL]["Endpoint"]
+	require.True(t, exists, "Last update time should be stored")
+	require.NotEmpty(t, lastUpdate, "Last update time should not be empty")
+
+	// Second update - should include _since parameter
+	_, err = component.update(ctx)
+	require.NoError(t, err)
+	require.Len(t, sinceParams, 2, "Should have 2 requests total")
+	require.NotEmpty(t, sinceParams[1], "Second update should include _since parameter")
+
+	// Verify _since parameter is a valid RFC3339 timestamp
+	_, err = time.Parse(time.RFC3339, sinceParams[1])
+	require.NoError(t, err, "_since parameter should be valid RFC3339 timestamp")
+	_, err = time.Parse(time.RFC3339Nano, sinceParams[1])
+	require.NoError(t, err, "_since parameter should be valid RFC3339Nano timestamp")
+
+	// Verify _since parameter matches the stored timestamp
+	require.Equal(t, lastUpdate, sinceParams[1], "_since parameter should match the stored lastUpdate timestamp")
+}
+
+func TestComponent_incrementalUpdates_perResourceType(t *testing.T) {
+	organizationHistory, err := os.ReadFile("test/prune_dangling_endpoint_refs_history_response.json")
+	require.NoError(t, err)
+	endpointHistory := []byte(`{"resourceType":"Bundle","type":"history","meta":{"lastUpdated":"2025-08-15T10:00:00Z"},"entry":[]}`)
+
+	var healthcareServiceFails atomic.Bool
+	healthcareServiceFails.Store(true)
+	var mu sync.Mutex
+	sinceParams := make(map[string][]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/{resourceType}/_history", func(w http.ResponseWriter, r *http.Request) {
+		resourceType := r.PathValue("resourceType")
+		mu.Lock()
+		sinceParams[resourceType] = append(sinceParams[resourceType], r.URL.Query().Get("_since"))
+		mu.Unlock()
+		if resourceType == "HealthcareService" && healthcareServiceFails.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/fhir+json")
+		if resourceType == "Organization" {
+			_, _ = w.Write(organizationHistory)
+		} else {
+			_, _ = w.Write(endpointHistory)
+		}
+	})
+	mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(organizationHistory)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	directoryURL := server.URL + "/fhir"
+	resourceTypes := []string{"Organization", "Endpoint", "HealthcareService"}
+
+	config := DefaultConfig()
+	config.MaxRetries = 0
+	component, err := New(config)
+	require.NoError(t, err)
+	queryDirectory := &test.StubFHIRClient{}
+	component.fhirQueryClient = queryDirectory
+	ctx := context.Background()
+	directoryKey := makeDirectoryKey(directoryURL, "1")
+
+	// HealthcareService fails: the other resource types are still synchronized, and their time of last update advances
+	report, err := component.updateFromDirectory(ctx, directoryURL, resourceTypes, false, "1")
+
+	require.ErrorContains(t, err, "failed to query HealthcareService history")
+	assert.Equal(t, 2, report.CountCreated)
+	assert.Equal(t, map[string]string{
+		"Organization": "2025-08-14T10:00:00Z",
+		"Endpoint":     "2025-08-15T10:00:00Z",
+	}, component.lastUpdateTimes[directoryKey])
+
+	// HealthcareService is available again: it's fully synchronized, while Endpoint is synchronized incrementally
+	healthcareServiceFails.Store(false)
+	_, err = component.updateFromDirectory(ctx, directoryURL, resourceTypes, false, "1")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "2025-08-15T10:00:00Z"}, sinceParams["Endpoint"])
+	assert.Equal(t, []string{"", ""}, sinceParams["HealthcareService"])
+	assert.Equal(t, map[string]string{
+		"Organization":      "2025-08-14T10:00:00Z",
+		"Endpoint":          "2025-08-15T10:00:00Z",
+		"HealthcareService": "2025-08-15T10:00:00Z",
+	}, component.lastUpdateTimes[directoryKey])
+}
+
+func TestComponent_incrementalUpdates_normalizesSinceToUTC(t *testing.T) {
+	testDataJSONOrg, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	testDataJSONEndpoint, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	// Server reports its timestamps with a +02:00 offset
+	testDataJSONOrg = []byte(strings.Replace(string(testDataJSONOrg), `"lastUpdated": "2025-08-14T10:00:00.000+00:00"`, `"lastUpdated": "2025-08-14T12:00:00.000+02:00"`, 1))
+
+	var sinceParams []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(testDataJSONOrg)
+	})
+	mux.HandleFunc("/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(testDataJSONOrg)
+	})
+	mux.HandleFunc("/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+		sinceParams = append(sinceParams, r.URL.Query().Get("_since"))
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(testDataJSONEndpoint)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"rootDir": {FHIRBaseURL: server.URL},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	ctx := context.Background()
+
+	_, err = component.update(ctx)
+	require.NoError(t, err)
+	_, err = component.update(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2025-08-14T10:00:00Z", component.lastUpdateTimes[server.URL]["Endpoint"])
+	require.Len(t, sinceParams, 2)
+	assert.Equal(t, "2025-08-14T10:00:00Z", sinceParams[1])
+}
+
+func TestComponent_incrementalUpdates_missingBundleMeta(t *testing.T) {
+	ctx := context.Background()
+	const historyBundle = `{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"http://example.org/fhir/Organization/1","request":{"method":"DELETE","url":"Organization/1"}}]}`
+	setup := func(t *testing.T, fallback string) (*Component, string) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(historyBundle))
+		})
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[]}`))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+
+		config := DefaultConfig()
+		config.MissingBundleMetaFallback = fallback
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		return component, server.URL + "/fhir"
+	}
+	captureLogs := func(t *testing.T) *bytes.Buffer {
+		buf := new(bytes.Buffer)
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		t.Cleanup(func() {
+			slog.SetDefault(previous)
+		})
+		return buf
+	}
+
+	t.Run("warns at most once per directory", func(t *testing.T) {
+		component, directoryURL := setup(t, MissingBundleMetaFallbackLocalTime)
+		logs := captureLogs(t)
+
+		for range 3 {
+			_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 1, strings.Count(logs.String(), `level=WARN msg="Bundle meta.lastUpdated not available`))
+		assert.Equal(t, 2, strings.Count(logs.String(), `level=DEBUG msg="Bundle meta.lastUpdated not available`))
+		assert.NotEmpty(t, component.lastUpdateTimes[makeDirectoryKey(directoryURL, "")])
+	})
+	t.Run("full sync fallback doesn't store next sync time", func(t *testing.T) {
+		component, directoryURL := setup(t, MissingBundleMetaFallbackFullSync)
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.NotContains(t, component.lastUpdateTimes, makeDirectoryKey(directoryURL, ""))
+	})
+	t.Run("local time fallback subtracts configured clock skew buffer", func(t *testing.T) {
+		component, directoryURL := setup(t, MissingBundleMetaFallbackLocalTime)
+		component.config.ClockSkewBuffer = time.Minute
+		component.nowFunc = func() time.Time {
+			return time.Date(2025, 8, 14, 10, 0, 0, 0, time.UTC)
+		}
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, "2025-08-14T09:59:00Z", component.lastUpdateTimes[makeDirectoryKey(directoryURL, "")]["Organization"])
+	})
+	t.Run("invalid fallback", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MissingBundleMetaFallback = "foo"
+
+		_, err := New(config)
+
+		require.EqualError(t, err, "invalid missing Bundle meta fallback: foo (valid options: localtime, fullsync)")
+	})
+}
+
+func TestComponent_searchPageSize(t *testing.T) {
+	t.Run("configured page size is used as _count", func(t *testing.T) {
+		var count string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			count = r.URL.Query().Get("_count")
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"history","entry":[]}`))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		config := DefaultConfig()
+		config.SearchPageSize = 25
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+
+		_, err = component.updateFromDirectory(context.Background(), server.URL+"/fhir", []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, "25", count)
+	})
+	t.Run("invalid page size", func(t *testing.T) {
+		config := DefaultConfig()
+		config.SearchPageSize = 0
+
+		_, err := New(config)
+
+		require.EqualError(t, err, "invalid search page size: 0 (must be positive)")
+	})
+}
+
+func TestComponent_validationRules(t *testing.T) {
+	create := func(t *testing.T, resourceValidation string) *Component {
+		config := DefaultConfig()
+		config.ResourceValidation = resourceValidation
+		component, err := New(config)
+		require.NoError(t, err)
+		return component
+	}
+	t.Run("off", func(t *testing.T) {
+		rules := create(t, ResourceValidationOff).validationRules([]string{"Endpoint"})
+
+		assert.Nil(t, rules.Validator)
+	})
+	t.Run("warn (default)", func(t *testing.T) {
+		rules := create(t, "").validationRules([]string{"Endpoint"})
+
+		assert.NotNil(t, rules.Validator)
+		assert.True(t, rules.ValidatorWarnOnly)
+	})
+	t.Run("strict", func(t *testing.T) {
+		rules := create(t, ResourceValidationStrict).validationRules([]string{"Endpoint"})
+
+		assert.NotNil(t, rules.Validator)
+		assert.False(t, rules.ValidatorWarnOnly)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ResourceValidation = "lenient"
+
+		_, err := New(config)
+
+		require.EqualError(t, err, "invalid resource validation: lenient (valid options: off, warn, strict)")
+	})
+}
+
+func TestNormalizeTimestamp(t *testing.T) {
+	t.Run("converts offset to UTC", func(t *testing.T) {
+		actual, err := normalizeTimestamp("2025-08-14T12:00:00.123+02:00")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-08-14T10:00:00.123Z", actual)
+	})
+	t.Run("UTC is kept", func(t *testing.T) {
+		actual, err := normalizeTimestamp("2025-08-14T10:00:00Z")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-08-14T10:00:00Z", actual)
+	})
+	t.Run("invalid timestamp", func(t *testing.T) {
+		_, err := normalizeTimestamp("yesterday")
+		require.Error(t, err)
+	})
+}
+
+func TestComponent_multipleDirsSameFHIRBaseURL(t *testing.T) {
+	t.Log("Test that multiple organizations can share the same fhirBaseURL with different authoritative URAs and sync independently")
+
+	// Setup shared directory server first (so we can reference its URL in test data)
+	sharedDirMux := http.NewServeMux()
+	sharedDirServer := httptest.NewServer(sharedDirMux)
+	defer sharedDirServer.Close()
+
+	// Common resource templates - define once, reuse for both shared and root directories
+	orgTemplate := `{
+		"resourceType": "Organization",
+		"id": "%s",
+		"meta": {"lastUpdated": "2025-12-18T09:00:00.000Z"},
+		"identifier": [{"system": "http://fhir.nl/fhir/NamingSystem/ura", "value": "%s"}],
+		"name": "%s"%s
+	}`
+
+	endpointTemplate := `{
+		"resourceType": "Endpoint",
+		"id": "shared-endpoint",
+		"meta": {"lastUpdated": "2025-12-18T09:00:00.000Z"},
+		"status": "active",
+		"payloadType": [{
+			"Coding": [{
+				"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
+				"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
+			}]
+		}],
+		"name": "Shared Endpoint",
+		"address": "%s"
+	}`
+
+	endpointRef := `,"endpoint": [{"reference": "Endpoint/shared-endpoint"}]`
+	emptyHistory := `{"resourceType": "Bundle", "type": "history", "entry": []}`
+
+	// Shared directory responses
+	sharedOrgHistory := fmt.Sprintf(`{
+		"resourceType": "Bundle",
+		"type": "history",
+		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
+		"entry": [
+			{
+				"fullUrl": "%s/Organization/org-a",
+				"resource": `+orgTemplate+`,
+				"request": {"method": "POST", "url": "Organization/org-a"},
+				"response": {"status": "201 Created"}
+			},
+			{
+				"fullUrl": "%s/Organization/org-b",
+				"resource": `+orgTemplate+`,
+				"request": {"method": "POST", "url": "Organization/org-b"},
+				"response": {"status": "201 Created"}
+			}
+		]
+	}`, sharedDirServer.URL, "org-a", "111", "Organization A", "",
+		sharedDirServer.URL, "org-b", "222", "Organization B", "")
+
+	sharedOrgSearchset := fmt.Sprintf(`{
+		"resourceType": "Bundle",
+		"type": "searchset",
+		"entry": [
+			{
+				"fullUrl": "%s/Organization/org-a",
+				"resource": `+orgTemplate+`
+			},
+			{
+				"fullUrl": "%s/Organization/org-b",
+				"resource": `+orgTemplate+`
+			}
+		]
+	}`, sharedDirServer.URL, "org-a", "111", "Organization A", endpointRef,
+		sharedDirServer.URL, "org-b", "222", "Organization B", endpointRef)
+
+	sharedEndpointHistory := fmt.Sprintf(`{
+		"resourceType": "Bundle",
+		"type": "history",
+		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
+		"entry": [{
+			"fullUrl": "http://test.example.org/fhir/Endpoint/shared-endpoint",
+			"resource": `+endpointTemplate+`,
+			"request": {"method": "POST", "url": "Endpoint/shared-endpoint"},
+			"response": {"status": "201 Created"}
+		}]
+	}`, sharedDirServer.URL)
+
+	mockEndpoints(sharedDirMux, map[string]*string{
+		"/Organization/_history":      &sharedOrgHistory,
+		"/Organization":               &sharedOrgSearchset,
+		"/Endpoint/_history":          &sharedEndpointHistory,
+		"/Location/_history":          &emptyHistory,
+		"/HealthcareService/_history": &emptyHistory,
+		"/PractitionerRole/_history":  &emptyHistory,
+		"/Practitioner/_history":      &emptyHistory,
+	})
+
+	// Root directory responses - reusing same orgTemplate and endpointTemplate
+	rootOrgHistory := fmt.Sprintf(`{
+		"resourceType": "Bundle",
+		"type": "history",
+		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
+		"entry": [
+			{
+				"fullUrl": "http://test.example.org/fhir/Organization/org-a",
+				"resource": `+orgTemplate+`,
+				"request": {"method": "POST", "url": "Organization/org-a"},
+				"response": {"status": "201 Created"}
+			},
+			{
+				"fullUrl": "http://test.example.org/fhir/Organization/org-b",
+				"resource": `+orgTemplate+`,
+				"request": {"method": "POST", "url": "Organization/org-b"},
+				"response": {"status": "201 Created"}
+			}
+		]
+	}`, "org-a", "111", "Organization A", endpointRef,
+		"org-b", "222", "Organization B", endpointRef)
+
+	rootEndpointHistory := fmt.Sprintf(`{
+		"resourceType": "Bundle",
+		"type": "history",
+		"meta": {"lastUpdated": "2025-12-18T10:00:00.000Z"},
+		"entry": [{
+			"fullUrl": "http://test.example.org/fhir/Endpoint/shared-endpoint",
+			"resource": `+endpointTemplate+`,
+			"request": {"method": "POST", "url": "Endpoint/shared-endpoint"},
+			"response": {"status": "201 Created"}
+		}]
+	}`, sharedDirServer.URL)
+
+	// Setup root directory server
+	rootDirMux := http.NewServeMux()
+	mockEndpoints(rootDirMux, map[string]*string{
+		"/Organization/_history":      &rootOrgHistory,
+		"/Organization":               &rootOrgHistory,
+		"/Endpoint/_history":          &rootEndpointHistory,
+		"/Endpoint":                   &rootEndpointHistory,
+		"/HealthcareService/_history": &emptyHistory,
+		"/Location/_history":          &emptyHistory,
+		"/PractitionerRole/_history":  &emptyHistory,
+		"/Practitioner/_history":      &emptyHistory,
+	})
+	rootDirServer := httptest.NewServer(rootDirMux)
+	defer rootDirServer.Close()
+
+	// Setup component
+	localClient := &test.StubFHIRClient{}
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: rootDirServer.URL},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+
+	component.fhirQueryClient = localClient
+	component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+		urlStr := baseURL.String()
+		if urlStr == rootDirServer.URL || urlStr == sharedDirServer.URL {
+			return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+		}
+		return localClient
+	}
+
+	// Run update
+	ctx := context.Background()
+	report, err := component.update(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+
+	// Verify both shared directories were synced with different composite keys
+	sharedKeyOrgA := makeDirectoryKey(sharedDirServer.URL, "111")
+	sharedKeyOrgB := makeDirectoryKey(sharedDirServer.URL, "222")
+
+	reportOrgA, existsA := report[sharedKeyOrgA]
+	require.True(t, existsA, "Report for org A should exist with composite key")
+	require.Empty(t, reportOrgA.Errors)
+	require.Equal(t, 2, reportOrgA.CountCreated, "Should have created 2 resource for org A")
+
+	reportOrgB, existsB := report[sharedKeyOrgB]
+	require.True(t, existsB, "Report for org B should exist with composite key")
+	require.Empty(t, reportOrgB.Errors)
+	require.Equal(t, 2, reportOrgB.CountCreated, "Should have created 2 resource for org B")
+
+	// Verify both directories are registered
+	require.Len(t, component.administrationDirectories, 3, "Should have 3 directories: root + 2 shared with different URAs")
+
+	// Verify the directories have correct properties
+	var foundOrgA, foundOrgB bool
+	for _, dir := range component.administrationDirectories {
+		if dir.fhirBaseURL == sharedDirServer.URL && dir.authoritativeUra == "111" {
+			foundOrgA = true
+			require.Equal(t, sharedDirServer.URL, dir.fhirBaseURL, "Directory for org A should have shared fhirBaseURL")
+			require.False(t, dir.discover, "Discovered directories should not have discover=true")
+		}
+		if dir.fhirBaseURL == sharedDirServer.URL && dir.authoritativeUra == "222" {
+			foundOrgB = true
+			require.Equal(t, sharedDirServer.URL, dir.fhirBaseURL, "Directory for org B should have shared fhirBaseURL")
+			require.False(t, dir.discover, "Discovered directories should not have discover=true")
+		}
+	}
+	require.True(t, foundOrgA, "Directory for org A (URA 111) should be registered")
+	require.True(t, foundOrgB, "Directory for org B (URA 222) should be registered")
+
+	// Verify both directories share the same fhirBaseURL but have different URAs
+	var directoriesWithSharedURL []administrationDirectory
+	for _, dir := range component.administrationDirectories {
+		if dir.fhirBaseURL == sharedDirServer.URL {
+			directoriesWithSharedURL = append(directoriesWithSharedURL, dir)
+		}
+	}
+	require.Len(t, directoriesWithSharedURL, 2, "Should have exactly 2 directories with the shared fhirBaseURL")
+	require.Equal(t, directoriesWithSharedURL[0].fhirBaseURL, directoriesWithSharedURL[1].fhirBaseURL, "Both directories should have the same fhirBaseURL")
+	require.NotEqual(t, directoriesWithSharedURL[0].authoritativeUra, directoriesWithSharedURL[1].authoritativeUra, "Both directories should have different authoritativeUra values")
+}
+
+func TestExtractResourceIDFromURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    fhir.BundleEntry
+		expected string
+	}{
+		{
+			name: "extract from Request.Url with auto increment FHIR ID",
+			entry: fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{
+					Url: "Organization/123",
+				},
+			},
+			expected: "123",
+		},
+		{
+			name: "extract from Request.Url with UUID-format ID",
+			entry: fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{
+					Url: "Organization/fd3524f9-705e-453c-8130-71cdf51cfcb9",
+				},
+			},
+			expected: "fd3524f9-705e-453c-8130-71cdf51cfcb9",
+		},
+		{
+			name: "extract from fullUrl when Request.Url is empty",
+			entry: fhir.BundleEntry{
+				FullUrl: to.Ptr("http://example.org/fhir/Organization/abc123"),
+				Request: &fhir.BundleEntryRequest{
+					Url: "",
+				},
+			},
+			expected: "abc123",
+		},
+		{
+			name: "extract from fullUrl with UUID-format ID",
+			entry: fhir.BundleEntry{
+				FullUrl: to.Ptr("http://example.org/fhir/Organization/fd3524f9-705e-453c-8130-71cdf51cfcb9"),
+			},
+			expected: "fd3524f9-705e-453c-8130-71cdf51cfcb9",
+		},
+		{
+			name: "return empty string when no ID can be extracted",
+			entry: fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{
+					Url: "Organization",
+				},
+			},
+			expected: "",
+		},
+		{
+			name: "return empty string when both Request.Url and fullUrl are empty",
+			entry: fhir.BundleEntry{
+				FullUrl: to.Ptr(""),
+				Request: &fhir.BundleEntryRequest{
+					Url: "",
+				},
+			},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := extractResourceIDFromURL(tt.entry)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestDeduplicateHistoryEntries(t *testing.T) {
+	t.Run("preserves order when all entries are unique", func(t *testing.T) {
+		entries := []fhir.BundleEntry{
+			{Resource: []byte(`{"resourceType":"Organization","id":"c"}`)},
+			{Resource: []byte(`{"resourceType":"Organization","id":"a"}`)},
+			{Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization/d"}},
+			{Resource: []byte(`{"resourceType":"Organization","id":"b"}`)},
+		}
+
+		result := deduplicateHistoryEntries(entries)
+
+		assert.Equal(t, entries, result)
+	})
+	t.Run("keeps most recent version of duplicate entries", func(t *testing.T) {
+		entries := []fhir.BundleEntry{
+			{Resource: []byte(`{"resourceType":"Organization","id":"a","meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`)},
+			{Resource: []byte(`{"resourceType":"Organization","id":"a","meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`)},
+			{Resource: []byte(`{"resourceType":"Organization","id":"b"}`)},
+		}
+
+		result := deduplicateHistoryEntries(entries)
+
+		require.Len(t, result, 2)
+		assert.Contains(t, result, entries[1])
+		assert.Contains(t, result, entries[2])
+	})
+	t.Run("equal timestamps", func(t *testing.T) {
+		version1 := fhir.BundleEntry{Resource: []byte(`{"resourceType":"Organization","id":"a","name":"v1","meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`)}
+		version2 := fhir.BundleEntry{Resource: []byte(`{"resourceType":"Organization","id":"a","name":"v2","meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`)}
+		other := fhir.BundleEntry{Resource: []byte(`{"resourceType":"Organization","id":"b","meta":{"lastUpdated":"2025-08-01T09:00:00.000+00:00"}}`)}
+		t.Run("earlier entry wins when history is ordered newest first", func(t *testing.T) {
+			for range 10 {
+				result := deduplicateHistoryEntries([]fhir.BundleEntry{version2, version1, other})
+
+				assert.Equal(t, []fhir.BundleEntry{version2, other}, result)
+			}
+		})
+		t.Run("later entry wins when history is ordered oldest first", func(t *testing.T) {
+			for range 10 {
+				result := deduplicateHistoryEntries([]fhir.BundleEntry{other, version1, version2})
+
+				assert.Equal(t, []fhir.BundleEntry{other, version2}, result)
+			}
+		})
+		t.Run("higher versionId wins regardless of order", func(t *testing.T) {
+			version1 := fhir.BundleEntry{Resource: []byte(`{"resourceType":"Organization","id":"a","name":"v1","meta":{"versionId":"1","lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`)}
+			version2 := fhir.BundleEntry{Resource: []byte(`{"resourceType":"Organization","id":"a","name":"v2","meta":{"versionId":"2","lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`)}
+
+			assert.Equal(t, []fhir.BundleEntry{version2, other}, deduplicateHistoryEntries([]fhir.BundleEntry{version1, version2, other}))
+			assert.Equal(t, []fhir.BundleEntry{other, version2}, deduplicateHistoryEntries([]fhir.BundleEntry{other, version2, version1}))
+		})
+	})
+	t.Run("DELETE on later page", func(t *testing.T) {
+		put := fhir.BundleEntry{
+			Resource: []byte(`{"resourceType":"Organization","id":"a","meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Organization/a"},
+		}
+		t.Run("wins with response.lastModified", func(t *testing.T) {
+			deleteEntry := fhir.BundleEntry{
+				Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization/a"},
+				Response: &fhir.BundleEntryResponse{Status: "204", LastModified: to.Ptr("2025-08-01T11:00:00.000+00:00")},
+			}
+			page1 := []fhir.BundleEntry{put}
+			page2 := []fhir.BundleEntry{deleteEntry}
+
+			result := deduplicateHistoryEntries(append(page1, page2...))
+
+			assert.Equal(t, []fhir.BundleEntry{deleteEntry}, result)
+		})
+		t.Run("wins without timestamp, when history is ordered oldest first", func(t *testing.T) {
+			deleteEntry := fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization/a"},
+			}
+			page1 := []fhir.BundleEntry{
+				{Resource: []byte(`{"resourceType":"Organization","id":"b","meta":{"lastUpdated":"2025-08-01T09:00:00.000+00:00"}}`)},
+				put,
+			}
+			page2 := []fhir.BundleEntry{deleteEntry}
+
+			result := deduplicateHistoryEntries(append(page1, page2...))
+
+			require.Len(t, result, 2)
+			assert.Contains(t, result, deleteEntry)
+			assert.NotContains(t, result, put)
+		})
+		t.Run("loses without timestamp, when history is ordered newest first", func(t *testing.T) {
+			deleteEntry := fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization/a"},
+			}
+			page1 := []fhir.BundleEntry{
+				{Resource: []byte(`{"resourceType":"Organization","id":"b","meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`)},
+				put,
+			}
+			page2 := []fhir.BundleEntry{deleteEntry}
+
+			result := deduplicateHistoryEntries(append(page1, page2...))
+
+			require.Len(t, result, 2)
+			assert.Contains(t, result, put)
+			assert.NotContains(t, result, deleteEntry)
+		})
+	})
+}
+
+func TestDeduplicateByIdentifier(t *testing.T) {
+	identifierSystems := map[string]string{"organization": coding.URANamingSystem}
+	t.Run("keeps most recent entry of resources sharing a business identifier", func(t *testing.T) {
+		entries := []fhir.BundleEntry{
+			{Resource: []byte(`{"resourceType":"Organization","id":"a","meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"},"identifier":[{"system":"` + coding.URANamingSystem + `","value":"1234"}]}`)},
+			{Resource: []byte(`{"resourceType":"Organization","id":"b","meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"},"identifier":[{"system":"` + coding.URANamingSystem + `","value":"1234"}]}`)},
+			{Resource: []byte(`{"resourceType":"Organization","id":"c","identifier":[{"system":"` + coding.URANamingSystem + `","value":"5678"}]}`)},
+			{Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization/d"}},
+		}
+
+		result := deduplicateByIdentifier(deduplicateHistoryEntries(entries), identifierSystems)
+
+		assert.Equal(t, []fhir.BundleEntry{entries[1], entries[2], entries[3]}, result)
+	})
+	t.Run("resource types without configured identifier system are not deduplicated", func(t *testing.T) {
+		entries := []fhir.BundleEntry{
+			{Resource: []byte(`{"resourceType":"Location","id":"a","identifier":[{"system":"` + coding.URANamingSystem + `","value":"1234"}]}`)},
+			{Resource: []byte(`{"resourceType":"Location","id":"b","identifier":[{"system":"` + coding.URANamingSystem + `","value":"1234"}]}`)},
+		}
+
+		result := deduplicateByIdentifier(entries, identifierSystems)
+
+		assert.Equal(t, entries, result)
+	})
+}
+
+func TestIsMoreRecent(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry1   fhir.BundleEntry
+		entry2   fhir.BundleEntry
+		expected bool
+	}{
+		{
+			name: "entry1 is more recent with timestamps",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			expected: true,
+		},
+		{
+			name: "entry2 is more recent with timestamps",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "same timestamps",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "entry1 has no timestamp, entry2 has timestamp",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "both entries have no timestamps (fallback)",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{}`),
+			},
+			expected: false,
+		},
+		{
+			name: "DELETE entry (no resource) vs entry with timestamp",
+			entry1: fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE},
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "same timestamps, entry1 has higher version",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"10"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"9"}}`),
+			},
+			expected: true,
+		},
+		{
+			name: "same timestamps, entry2 has higher version",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"1"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"2"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "no timestamps, entry1 has higher version",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"versionId":"3"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"versionId":"2"}}`),
+			},
+			expected: true,
+		},
+		{
+			name: "same timestamps, non-numeric versions",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"b"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"a"}}`),
+			},
+			expected: false,
+		},
+		{
+			name: "older timestamp with higher version",
+			entry1: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T09:00:00Z","versionId":"5"}}`),
+			},
+			entry2: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00Z","versionId":"4"}}`),
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := isMoreRecent(tt.entry1, tt.entry2)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestGetLastUpdated(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    fhir.BundleEntry
+		expected string // Using string for easier comparison, will parse to time.Time
+	}{
+		{
+			name: "valid lastUpdated timestamp",
+			entry: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
+			},
+			expected: "2025-08-01T10:00:00.000+00:00",
+		},
+		{
+			name: "no meta field",
+			entry: fhir.BundleEntry{
+				Resource: []byte(`{"resourceType":"Organization"}`),
+			},
+			expected: "",
+		},
+		{
+			name: "no lastUpdated field in meta",
+			entry: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"versionId":"1"}}`),
+			},
+			expected: "",
+		},
+		{
+			name: "invalid timestamp format",
+			entry: fhir.BundleEntry{
+				Resource: []byte(`{"meta":{"lastUpdated":"invalid-date"}}`),
+			},
+			expected: "",
+		},
+		{
+			name: "no resource (DELETE operation)",
+			entry: fhir.BundleEntry{
+				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE},
+			},
+			expected: "",
+		},
+		{
+			name: "no resource (DELETE operation) with response.lastModified",
+			entry: fhir.BundleEntry{
+				Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE},
+				Response: &fhir.BundleEntryResponse{LastModified: to.Ptr("2025-08-01T10:00:00.000+00:00")},
+			},
+			expected: "2025-08-01T10:00:00.000+00:00",
+		},
+		{
+			name: "invalid JSON resource",
+			entry: fhir.BundleEntry{
+				Resource: []byte(`{invalid json}`),
+			},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := getLastUpdated(tt.entry)
+			if tt.expected == "" {
+				require.True(t, result.IsZero(), "Expected zero time")
+			} else {
+				expectedTime, err := time.Parse(time.RFC3339, tt.expected)
+				require.NoError(t, err, "Test setup error parsing expected time")
+				require.Equal(t, expectedTime, result)
+			}
+		})
+	}
+}
+
+func TestComponent_discoverAndRegisterEndpoints(t *testing.T) {
+	ctx := context.Background()
+	parentOrganizationsMap := parentOrganizationMap{
+		{
+			Id:         to.Ptr("org-1"),
+			Identifier: []fhir.Identifier{{System: to.Ptr(coding.URANamingSystem), Value: to.Ptr("1234")}},
+			Endpoint:   []fhir.Reference{{Reference: to.Ptr("Endpoint/ep-1")}},
+		}: {},
+	}
+	endpointEntry := func(system string) fhir.BundleEntry {
+		return fhir.BundleEntry{
+			FullUrl: to.Ptr("https://example.com/fhir/Endpoint/ep-1"),
+			Resource: []byte(`{"resourceType":"Endpoint","id":"ep-1","address":"https://directory.example.com/fhir",` +
+				`"payloadType":[{"coding":[{"system":"` + system + `","code":"` + coding.MCSDPayloadTypeDirectoryCode + `"}]}]}`),
+		}
+	}
+
+	t.Run("directory endpoint is registered", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{endpointEntry(coding.MCSDPayloadTypeSystem)}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		assert.Empty(t, report.Warnings)
+		assert.Len(t, component.administrationDirectories, 1)
+		assert.Equal(t, []string{"https://directory.example.com/fhir|1234"}, report.Discovered)
+	})
+	t.Run("excluded directory isn't reported as discovered", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{"https://directory.example.com/fhir"}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{endpointEntry(coding.MCSDPayloadTypeSystem)}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		assert.Empty(t, report.Discovered)
+	})
+	t.Run("warns about mis-cased payloadType", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{endpointEntry(strings.ToUpper(coding.MCSDPayloadTypeSystem))}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		require.Len(t, report.Warnings, 1)
+		assert.Contains(t, report.Warnings[0], "Endpoint https://example.com/fhir/Endpoint/ep-1 seems to be a mCSD Directory endpoint, but its payloadType doesn't match")
+		assert.Empty(t, component.administrationDirectories)
+	})
+	t.Run("configured directory endpoint codings", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DirectoryEndpointCodings = []DirectoryEndpointCoding{
+			defaultDirectoryEndpointCoding,
+			{System: "http://example.com/CodeSystem/test", Code: coding.MCSDPayloadTypeDirectoryCode},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{endpointEntry("http://example.com/CodeSystem/test")}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		assert.Empty(t, report.Warnings)
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+	t.Run("default coding not configured", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DirectoryEndpointCodings = []DirectoryEndpointCoding{{System: "http://example.com/CodeSystem/test", Code: "mcsd-directory-v2"}}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{endpointEntry(coding.MCSDPayloadTypeSystem)}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		assert.Empty(t, report.Warnings)
+		assert.Empty(t, component.administrationDirectories)
+	})
+	t.Run("invalid directory endpoint coding", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DirectoryEndpointCodings = []DirectoryEndpointCoding{{System: "http://example.com/CodeSystem/test"}}
+
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid directory endpoint coding: http://example.com/CodeSystem/test| (system and code are required)")
+	})
+	t.Run("address scheme not allowed", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DiscoveryAllowedSchemes = []string{"HTTPS"}
+		component, err := New(config)
+		require.NoError(t, err)
+		entry := endpointEntry(coding.MCSDPayloadTypeSystem)
+		entry.Resource = []byte(strings.Replace(string(entry.Resource), "https://directory.example.com/fhir", "http://directory.example.com/fhir", 1))
+
+		report := component.discoverAndRegisterEndpoints(ctx, []fhir.BundleEntry{entry}, parentOrganizationsMap, DirectoryUpdateReport{}, 1)
+
+		assert.Equal(t, []string{"skipping discovered mCSD Directory endpoint https://example.com/fhir/Endpoint/ep-1: address scheme 'http' is not allowed (address=http://directory.example.com/fhir, allowed: https)"}, report.Warnings)
+		assert.Empty(t, component.administrationDirectories)
+	})
+	t.Run("invalid allowed scheme", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DiscoveryAllowedSchemes = []string{"https", "file"}
+
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid discovery allowed scheme: file (valid options: http, https)")
+	})
+}
+
+func TestComponent_maxDiscoveryDepth(t *testing.T) {
+	// startDirectory starts a mCSD Directory with an organization that has an Endpoint pointing to the next directory (if any).
+	startDirectory := func(t *testing.T, ura string, nextDirectoryURL string) string {
+		emptyHistory := `{"resourceType":"Bundle","type":"history","entry":[]}`
+		organizationHistory := emptyHistory
+		endpointHistory := emptyHistory
+		if nextDirectoryURL != "" {
+			organization := `{"resourceType":"Organization","id":"org","identifier":[{"system":"` + coding.URANamingSystem + `","value":"` + ura + `"}],"endpoint":[{"reference":"Endpoint/ep"}]}`
+			endpoint := `{"resourceType":"Endpoint","id":"ep","status":"active","address":"` + nextDirectoryURL + `",` +
+				`"payloadType":[{"coding":[{"system":"` + coding.MCSDPayloadTypeSystem + `","code":"` + coding.MCSDPayloadTypeDirectoryCode + `"}]}]}`
+			organizationHistory = `{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Organization/org","resource":` + organization + `,"request":{"method":"PUT","url":"Organization/org"}}]}`
+			endpointHistory = `{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Endpoint/ep","resource":` + endpoint + `,"request":{"method":"PUT","url":"Endpoint/ep"}}]}`
+		}
+		mux := http.NewServeMux()
+		responses := map[string]*string{
+			"/fhir/Organization/_history": &organizationHistory,
+			"/fhir/Organization":          &organizationHistory,
+			"/fhir/Endpoint/_history":     &endpointHistory,
+		}
+		for _, resourceType := range []string{"Location", "HealthcareService", "PractitionerRole", "Practitioner"} {
+			responses["/fhir/"+resourceType+"/_history"] = &emptyHistory
+		}
+		mockEndpoints(mux, responses)
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server.URL + "/fhir"
+	}
+	// root -> level 1 -> level 2
+	level2URL := startDirectory(t, "", "")
+	level1URL := startDirectory(t, "1", level2URL)
+	rootURL := startDirectory(t, "1", level1URL)
+
+	registeredDirectories := func(t *testing.T, maxDiscoveryDepth int) map[string]int {
+		config := DefaultConfig()
+		config.MaxDiscoveryDepth = maxDiscoveryDepth
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: rootURL},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		for range 2 {
+			_, err = component.update(context.Background())
+			require.NoError(t, err)
+		}
+		result := make(map[string]int)
+		for _, directory := range component.administrationDirectories {
+			result[directory.fhirBaseURL] = directory.depth
+		}
+		return result
+	}
+
+	t.Run("default depth of 1", func(t *testing.T) {
+		assert.Equal(t, map[string]int{rootURL: 0, level1URL: 1}, registeredDirectories(t, 1))
+	})
+	t.Run("depth of 2", func(t *testing.T) {
+		assert.Equal(t, map[string]int{rootURL: 0, level1URL: 1, level2URL: 2}, registeredDirectories(t, 2))
+	})
+}
+
+func TestComponent_rootDirectoryWithoutDirectoryEndpoints(t *testing.T) {
+	const expectedWarning = "root mCSD Directory contains 4 organization(s) with a URA identifier, but no mCSD Directory endpoints: no directories can be discovered"
+	update := func(t *testing.T, filesToServe map[string]string) DirectoryUpdateReport {
+		server := startMockServer(t, filesToServe)
+		t.Cleanup(server.Close)
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: server.URL + "/fhir"},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		return report[server.URL+"/fhir"]
+	}
+
+	t.Run("organizations without directory endpoints", func(t *testing.T) {
+		report := update(t, map[string]string{
+			"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+			"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+		})
+
+		assert.Contains(t, report.Warnings, expectedWarning)
+	})
+	t.Run("organizations with directory endpoints", func(t *testing.T) {
+		report := update(t, map[string]string{
+			"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+			"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+			"/fhir/Endpoint/_history":     "test/root_dir_endpoint_history_response.json",
+		})
+
+		assert.NotContains(t, report.Warnings, expectedWarning)
+	})
+}
+
+func TestComponent_updateFromDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("#233: no entry.Request in _history results", func(t *testing.T) {
+		t.Log("See https://github.com/nuts-foundation/nuts-knooppunt/issues/233")
+		server := startMockServer(t, map[string]string{
+			"/fhir/Organization/_history": "test/bugs/233-no-bundle-request/organization_response.json",
+		})
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization"}, false, "")
+		require.NoError(t, err)
+		require.NotNil(t, report)
+		require.Len(t, report.Warnings, 1)
+		assert.Equal(t, report.Warnings[0], "Skipping entry with no request: #0")
+		assert.Empty(t, report.Errors)
+		assert.Equal(t, 0, report.CountCreated)
+		assert.Equal(t, 0, report.CountUpdated)
+		assert.Equal(t, 0, report.CountDeleted)
+	})
+	t.Run("#233: entry.Request inferred when configured", func(t *testing.T) {
+		server := startMockServer(t, map[string]string{
+			"/fhir/Organization/_history": "test/bugs/233-no-bundle-request/organization_infer_request_response.json",
+			"/fhir/Organization":          "test/bugs/233-no-bundle-request/organization_infer_request_response.json",
+		})
+		defer server.Close()
+		config := DefaultConfig()
+		config.InferMissingRequest = true
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization"}, false, "1")
+
+		require.NoError(t, err)
+		assert.Empty(t, report.Warnings)
+		assert.Empty(t, report.Errors)
+		assert.Equal(t, 1, report.CountCreated)
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+	})
+
+	t.Run("prune dangling endpoint references", func(t *testing.T) {
+		server := startMockServer(t, map[string]string{
+			"/fhir/Organization/_history": "test/prune_dangling_endpoint_refs_history_response.json",
+			"/fhir/Organization":          "test/prune_dangling_endpoint_refs_history_response.json",
+		})
+		defer server.Close()
+		config := DefaultConfig()
+		config.PruneDanglingEndpointRefs = true
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization", "Endpoint"}, false, "1")
+
+		require.NoError(t, err)
+		assert.Empty(t, report.Errors)
+		syncedEndpointReference := "Endpoint?_source=" + url.QueryEscape(server.URL+"/fhir/Endpoint/ep-1")
+		danglingEndpointReference := "Endpoint?_source=" + url.QueryEscape(server.URL+"/fhir/Endpoint/ep-2")
+		assert.Contains(t, report.Warnings, "pruned reference from Organization (source="+server.URL+"/fhir/Organization/org-1) to Endpoint that isn't synchronized: "+danglingEndpointReference)
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		var organization fhir.Organization
+		require.NoError(t, json.Unmarshal(queryDirectory.CreatedResources["Organization"][0].(json.RawMessage), &organization))
+		require.Len(t, organization.Endpoint, 1)
+		assert.Equal(t, syncedEndpointReference, *organization.Endpoint[0].Reference)
+	})
+
+	t.Run("no duplicate resources in transaction bundle", func(t *testing.T) {
+		// This test verifies that when _history returns multiple versions of the same resource,
+		// the transaction bundle sent to the query directory contains no duplicates.
+		// This addresses the HAPI error: "Transaction bundle contains multiple resources with ID: urn:uuid:..."
+		server := startMockServer(t, map[string]string{
+			"/fhir/Organization/_history": "test/history_with_duplicates.json",
+		})
+		defer server.Close()
+
+		capturingClient := &test.StubFHIRClient{}
+		config := DefaultConfig()
+		config.QueryDirectory = DirectoryConfig{
+			FHIRBaseURL: "http://example.com/local/fhir",
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		component.fhirQueryClient = capturingClient
+		component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+			if baseURL.String() == server.URL+"/fhir" {
+				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+			}
+			if baseURL.String() == "http://example.com/local/fhir" {
+				return capturingClient
+			}
+			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		}
+
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization", "Endpoint"}, false, "")
+
+		require.NoError(t, err)
+		require.Empty(t, report.Errors, "Should not have errors after deduplication")
+
+		// Should have 0 Organizations because the DELETE operation is the most recent
+		orgs := capturingClient.CreatedResources["Organization"]
+		require.Len(t, orgs, 0, "Should have 0 Organizations after deduplication (DELETE is most recent operation)")
+	})
+
+	t.Run("handles DELETE operations for Endpoints and unregisters from administrationDirectories", func(t *testing.T) {
+		// This test verifies that when an Endpoint is deleted (DELETE operation in _history),
+		// it is properly removed from the query directory and unregistered from administrationDirectories.
+		// This fixes issue #241 where deleted Endpoints were cached indefinitely.
+
+		ctx := context.Background()
+
+		// Create test data with an Endpoint that will be deleted
+		initialBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": [{
+				"fullUrl": "http://test.example.org/fhir/Endpoint/test-endpoint",
+				"resource": {
+					"resourceType": "Endpoint",
+					"id": "test-endpoint",
+					"status": "active",
+					"payloadType": [{
+						"coding": [{
+							"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
+							"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
+						}]
+					}],
+					"address": "https://directory.example.org/fhir"
+				},
+				"request": {
+					"method": "POST",
+					"url": "Endpoint/test-endpoint"
+				}
+			}]
+		}`
+
+		// Create bundle with DELETE operation for the same Endpoint
+		deleteBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": [{
+				"fullUrl": "http://test.example.org/fhir/Endpoint/test-endpoint",
+				"request": {
+					"method": "DELETE",
+					"url": "Endpoint/test-endpoint"
+				}
+			}]
+		}`
+
+		orgBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": [{
+				"fullUrl": "http://test.example.org/fhir/Organization/org",
+				 "resource": {
+					"resourceType": "Organization",
+					"id": "org-4",
+					"meta": {
+					  "versionId": "1",
+					  "lastUpdated": "2025-08-01T14:31:31.987+00:00"
+					},
+					"identifier": [
+					  {
+						"use": "official",
+						"system": "http://fhir.nl/fhir/NamingSystem/ura",
+						"value": "444"
+					  }
+					],
+					"active": true,
+					"endpoint": [
+					  {
+						"reference": "Endpoint/test-endpoint"
+					  }
+					],
+					"name": "Organization 4"
+				 },
+				 "request": {
+					"method": "POST",
+					"url": "Organization/org"
+				 },
+				 "response": {
+					"status": "201 Created",
+					"etag": "W/\"1\""
+				 }
+			}]
+		}`
+
+		// Create a mock server that returns the initial bundle first, then the delete bundle
+		callCount := 0
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		mux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if callCount == 0 {
+				w.Write([]byte(initialBundle))
+			} else {
+				w.Write([]byte(deleteBundle))
+			}
+			callCount++
+		})
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(orgBundle))
+		})
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(orgBundle))
+		})
+		mux.HandleFunc("/fhir/Location/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
+		})
+		mux.HandleFunc("/fhir/HealthcareService/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
+		})
+		mux.HandleFunc("/fhir/PractitionerRole/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
+		})
+		mux.HandleFunc("/fhir/Practitioner/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
+		})
+
+		config := DefaultConfig()
+		config.QueryDirectory = DirectoryConfig{
+			FHIRBaseURL: "http://example.com/local/fhir",
+		}
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"test-dir": {
+				FHIRBaseURL: server.URL + "/fhir",
+			},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		// Mock FHIR client that tracks operations
+		capturingClient := &test.StubFHIRClient{}
+		component.fhirQueryClient = capturingClient
+		component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+			if baseURL.String() == server.URL+"/fhir" {
+				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+			}
+			if baseURL.String() == "http://example.com/local/fhir" {
+				return capturingClient
+			}
+			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		}
+
+		// First update - should discover and register the Endpoint
+		report1, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint", "Organization"}, true, "")
+		require.NoError(t, err)
+		require.Empty(t, report1.Errors)
+		require.Equal(t, 1, report1.CountCreated, "Should have created 1 Endpoint")
+
+		// Verify Endpoint was created in query directory
+		require.NotNil(t, capturingClient.CreatedResources)
+		require.Len(t, capturingClient.CreatedResources["Endpoint"], 1, "Endpoint should be created in query directory")
+
+		// Verify Endpoint was discovered and registered with correct fullUrl
+		initialAdminDirCount := len(component.administrationDirectories)
+		foundEndpoint := false
+		var registeredFullUrl string
+		for _, dir := range component.administrationDirectories {
+			if dir.fhirBaseURL == "https://directory.example.org/fhir" {
+				foundEndpoint = true
+				registeredFullUrl = dir.sourceURL
+				break
+			}
+		}
+		assert.True(t, foundEndpoint, "Endpoint should be registered as administration directory")
+		assert.Equal(t, "http://test.example.org/fhir/Endpoint/test-endpoint", registeredFullUrl, "Registered Endpoint should have fullUrl from Bundle entry")
+
+		// Second update - should process DELETE and unregister the Endpoint
+		report2, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint", "Organization"}, true, "")
+		require.NoError(t, err)
+		require.Empty(t, report2.Errors)
+
+		// Verify DELETE was processed and Endpoint was unregistered
+		afterDeleteCount := len(component.administrationDirectories)
+		assert.Less(t, afterDeleteCount, initialAdminDirCount, "Deleted Endpoint should be unregistered")
+
+		deletedEndpointStillExists := false
+		for _, dir := range component.administrationDirectories {
+			if dir.fhirBaseURL == "https://directory.example.org/fhir" {
+				deletedEndpointStillExists = true
+				break
+			}
+		}
+		assert.False(t, deletedEndpointStillExists, "Deleted Endpoint should not remain in administrationDirectories")
+
+		// Verify DELETE was sent to query directory
+		assert.Equal(t, 1, report2.CountDeleted, "Should have 1 deleted resource")
+	})
+
+	t.Run("respects allowedResourceTypes parameter and only queries specified resource types", func(t *testing.T) {
+		// This test verifies that updateFromDirectory only queries the resource types
+		// specified in the allowedResourceTypes parameter, not all resource types.
+		// This prevents 404 errors when the FHIR server doesn't support certain resource types.
+
+		ctx := context.Background()
+
+		// Track which resource type endpoints were called
+		calledEndpoints := make(map[string]bool)
+		var mu sync.Mutex
+
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		// Empty bundle response
+		emptyBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": []
+		}`
+
+		// Set up handlers that track which endpoints are called
+		resourceTypes := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole"}
+		for _, rt := range resourceTypes {
+			resourceType := rt // capture for closure
+			mux.HandleFunc("/fhir/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calledEndpoints[resourceType] = true
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(emptyBundle))
+			})
+		}
+
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(emptyBundle))
+		})
+
+		config := DefaultConfig()
+		config.QueryDirectory = DirectoryConfig{
+			FHIRBaseURL: "http://example.com/local/fhir",
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		capturingClient := &test.StubFHIRClient{}
+		component.fhirQueryClient = capturingClient
+		component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+			if baseURL.String() == server.URL+"/fhir" {
+				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+			}
+			if baseURL.String() == "http://example.com/local/fhir" {
+				return capturingClient
+			}
+			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		}
+
+		// Call updateFromDirectory with only Organization and Endpoint
+		allowedTypes := []string{"Organization", "Endpoint"}
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", allowedTypes, false, "")
+
+		require.NoError(t, err)
+		require.Empty(t, report.Errors)
+
+		// Verify only the allowed resource types were queried
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.True(t, calledEndpoints["Organization"], "Organization/_history should have been called")
+		assert.True(t, calledEndpoints["Endpoint"], "Endpoint/_history should have been called")
+		assert.False(t, calledEndpoints["Location"], "Location/_history should NOT have been called (not in allowedResourceTypes)")
+		assert.False(t, calledEndpoints["HealthcareService"], "HealthcareService/_history should NOT have been called (not in allowedResourceTypes)")
+		assert.False(t, calledEndpoints["PractitionerRole"], "PractitionerRole/_history should NOT have been called (not in allowedResourceTypes)")
+
+		// Verify exactly 2 resource types were queried
+		assert.Equal(t, 2, len(calledEndpoints), "Should have queried exactly 2 resource types")
+	})
+
+	t.Run("uses configured DirectoryResourceTypes for discovered endpoints", func(t *testing.T) {
+		// This test verifies that when DirectoryResourceTypes is configured,
+		// those resource types are used when discovering and registering new Endpoints.
+
+		ctx := context.Background()
+
+		// Track which resource type endpoints were called
+		calledEndpoints := make(map[string]bool)
+		var mu sync.Mutex
+
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		// Response with an Endpoint that should be discovered
+		// Must have the correct payloadType coding to be recognized as an mCSD directory
+		discoveredEndpointBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": [{
+				"fullUrl": "http://example.com/Endpoint/discovered-endpoint",
+				"resource": {
+					"resourceType": "Endpoint",
+					"id": "discovered-endpoint",
+					"status": "active",
+					"connectionType": {
+						"system": "http://terminology.hl7.org/CodeSystem/endpoint-connection-type",
+						"code": "hl7-fhir-rest"
+					},
+					"address": "` + server.URL + `/fhir/discovered",
+					"payloadType": [{
+						"coding": [{
+							"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
+							"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
+						}]
+					}]
+				},
+				"request": {
+					"method": "POST",
+					"url": "Endpoint"
+				}
+			}]
+		}`
+		discoveredOrganizationBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": [{
+				"fullUrl": "http://test.example.org/fhir/Organization/org",
+				 "resource": {
+					"resourceType": "Organization",
+					"id": "org-4",
+					"meta": {
+					  "versionId": "1",
+					  "lastUpdated": "2025-08-01T14:31:31.987+00:00"
+					},
+					"identifier": [
+					  {
+						"use": "official",
+						"system": "http://fhir.nl/fhir/NamingSystem/ura",
+						"value": "444"
+					  }
+					],
+					"active": true,
+					"endpoint": [
+					  {
+						"reference": "Endpoint/discovered-endpoint"
+					  }
+					],
+					"name": "Organization 4"
+				 },
+				 "request": {
+					"method": "POST",
+					"url": "Organization/org"
+				 },
+				 "response": {
+					"status": "201 Created",
+					"etag": "W/\"1\""
+				 }
+			}]
+		}`
+
+		emptyBundle := `{
+			"resourceType": "Bundle",
+			"type": "history",
+			"entry": []
+		}`
+
+		// Set up handlers that track which endpoints are called
+		// All potential resource types
+		allResourceTypes := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole", "Practitioner"}
+		for _, rt := range allResourceTypes {
+			resourceType := rt // capture for closure
+			mux.HandleFunc("/fhir/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calledEndpoints[resourceType] = true
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				// Return discovered endpoint only for Endpoint queries
+				if resourceType == "Endpoint" {
+					w.Write([]byte(discoveredEndpointBundle))
+				} else if resourceType == "Organization" {
+					w.Write([]byte(discoveredOrganizationBundle))
+				} else {
+					w.Write([]byte(emptyBundle))
+				}
+			})
+			// Handler for discovered directory
+			mux.HandleFunc("/fhir/discovered/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calledEndpoints["discovered/"+resourceType] = true
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(emptyBundle))
+			})
+		}
+
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(discoveredOrganizationBundle))
+		})
+
+		// Create component with custom DirectoryResourceTypes that includes Practitioner
+		customResourceTypes := []string{"Organization", "Endpoint", "Practitioner"}
+		config := DefaultConfig()
+		config.QueryDirectory = DirectoryConfig{
+			FHIRBaseURL: "http://example.com/local/fhir",
+		}
+		config.DirectoryResourceTypes = customResourceTypes
+		component, err := New(config)
+		require.NoError(t, err)
+
+		// Verify the component stored the custom resource types
+		assert.Equal(t, customResourceTypes, component.directoryResourceTypes)
+
+		capturingClient := &test.StubFHIRClient{}
+		component.fhirQueryClient = capturingClient
+		component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+			if strings.HasPrefix(baseURL.String(), server.URL) {
+				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
+			}
+			if baseURL.String() == "http://example.com/local/fhir" {
+				return capturingClient
+			}
+			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		}
+
+		// Register the root directory (which will query using rootDirectoryResourceTypes: Organization, Endpoint)
+		err = component.registerAdministrationDirectory(ctx, server.URL+"/fhir", rootDirectoryResourceTypes, 0, "", "")
+		require.NoError(t, err)
+
+		// First update should discover the endpoint from root directory and immediately query it
+		// because the update() loop processes newly discovered directories in the same iteration
+		_, err = component.update(ctx)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Verify root directory queries (uses rootDirectoryResourceTypes)
+		assert.True(t, calledEndpoints["Organization"], "Root directory should query Organization")
+		assert.True(t, calledEndpoints["Endpoint"], "Root directory should query Endpoint")
+
+		// Verify discovered directory queries (uses component.directoryResourceTypes which is customResourceTypes)
+		assert.True(t, calledEndpoints["discovered/Organization"], "Discovered directory should query Organization (in customResourceTypes)")
+		assert.True(t, calledEndpoints["discovered/Endpoint"], "Discovered directory should query Endpoint (in customResourceTypes)")
+		assert.True(t, calledEndpoints["discovered/Practitioner"], "Discovered directory should query Practitioner (in customResourceTypes)")
+
+		// Verify that resource types NOT in customResourceTypes were NOT queried for discovered directory
+		assert.False(t, calledEndpoints["discovered/Location"], "Discovered directory should NOT query Location (not in customResourceTypes)")
+		assert.False(t, calledEndpoints["discovered/HealthcareService"], "Discovered directory should NOT query HealthcareService (not in customResourceTypes)")
+		assert.False(t, calledEndpoints["discovered/PractitionerRole"], "Discovered directory should NOT query PractitionerRole (not in customResourceTypes)")
+	})
+
+	t.Run("pagination fails on a later page", func(t *testing.T) {
+		organizations, err := os.ReadFile("test/prune_dangling_endpoint_refs_history_response.json")
+		require.NoError(t, err)
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		var history map[string]any
+		require.NoError(t, json.Unmarshal(organizations, &history))
+		history["link"] = []map[string]any{{"relation": "next", "url": server.URL + "/fhir/Organization/_history_page2"}}
+		page1, err := json.Marshal(history)
+		require.NoError(t, err)
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(page1)
+		})
+		mux.HandleFunc("/fhir/Organization/_history_page2", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(organizations)
+		})
+		directoryURL := server.URL + "/fhir"
+
+		t.Run("applies partial results when enabled", func(t *testing.T) {
+			config := DefaultConfig()
+			config.ApplyPartialOnPaginationError = true
+			component, err := New(config)
+			require.NoError(t, err)
+			queryDirectory := &test.StubFHIRClient{}
+			component.fhirQueryClient = queryDirectory
+
+			report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+			require.NoError(t, err)
+			assert.Empty(t, report.Errors)
+			require.NotEmpty(t, report.Warnings)
+			assert.Contains(t, report.Warnings[0], "applied partial results, time of last update not advanced: failed to query Organization history: pagination of _history search failed")
+			assert.Equal(t, 1, report.CountCreated)
+			require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+			assert.Empty(t, component.lastUpdateTimes, "time of last update should not be advanced")
+		})
+		t.Run("fails when disabled", func(t *testing.T) {
+			component, err := New(DefaultConfig())
+			require.NoError(t, err)
+			queryDirectory := &test.StubFHIRClient{}
+			component.fhirQueryClient = queryDirectory
+
+			_, err = component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+			require.ErrorContains(t, err, "pagination of _history search failed")
+			assert.Empty(t, queryDirectory.CreatedResources)
+		})
+	})
+	t.Run("filters history by profile", func(t *testing.T) {
+		emptyBundle := `{"resourceType": "Bundle", "type": "history", "entry": []}`
+		newServer := func(t *testing.T, rejectProfile bool) (*httptest.Server, *[]url.Values) {
+			var queries []url.Values
+			var mu sync.Mutex
+			mux := http.NewServeMux()
+			mux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				queries = append(queries, r.URL.Query())
+				mu.Unlock()
+				if rejectProfile && r.URL.Query().Has("_profile") {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/fhir+json")
+				_, _ = w.Write([]byte(emptyBundle))
+			})
+			mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/fhir+json")
+				_, _ = w.Write([]byte(emptyBundle))
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+			return server, &queries
+		}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := extractResourceIDFromURL(tt.entry)
-			require.Equal(t, tt.expected, result)
+		t.Run("sends _profile parameter", func(t *testing.T) {
+			server, queries := newServer(t, false)
+			config := DefaultConfig()
+			config.FilterHistoryByProfile = true
+			component, err := New(config)
+			require.NoError(t, err)
+
+			report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint"}, false, "")
+
+			require.NoError(t, err)
+			assert.Empty(t, report.Errors)
+			require.Len(t, *queries, 1)
+			assert.Equal(t, "http://nuts-foundation.github.io/nl-generic-functions-ig/StructureDefinition/nl-gf-endpoint", (*queries)[0].Get("_profile"))
 		})
-	}
-}
+		t.Run("retries without _profile if server rejects it", func(t *testing.T) {
+			server, queries := newServer(t, true)
+			config := DefaultConfig()
+			config.FilterHistoryByProfile = true
+			component, err := New(config)
+			require.NoError(t, err)
+
+			report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint"}, false, "")
+
+			require.NoError(t, err)
+			assert.Empty(t, report.Errors)
+			require.Len(t, *queries, 2)
+			assert.False(t, (*queries)[1].Has("_profile"))
+		})
+		t.Run("not sent when disabled", func(t *testing.T) {
+			server, queries := newServer(t, false)
+			component, err := New(DefaultConfig())
+			require.NoError(t, err)
 
-func TestIsMoreRecent(t *testing.T) {
-	tests := []struct {
-		name     string
-		entry1   fhir.BundleEntry
-		entry2   fhir.BundleEntry
-		expected bool
-	}{
-		{
-			name: "entry1 is more recent with timestamps",
-			entry1: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`),
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			expected: true,
-		},
-		{
-			name: "entry2 is more recent with timestamps",
-			entry1: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T11:00:00.000+00:00"}}`),
-			},
-			expected: false,
-		},
-		{
-			name: "same timestamps",
-			entry1: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			expected: false,
-		},
-		{
-			name: "entry1 has no timestamp, entry2 has timestamp",
-			entry1: fhir.BundleEntry{
-				Resource: []byte(`{}`),
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			expected: false,
-		},
-		{
-			name: "both entries have no timestamps (fallback)",
-			entry1: fhir.BundleEntry{
-				Resource: []byte(`{}`),
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{}`),
-			},
-			expected: false,
-		},
-		{
-			name: "DELETE entry (no resource) vs entry with timestamp",
-			entry1: fhir.BundleEntry{
-				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE},
-			},
-			entry2: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			expected: false,
-		},
-	}
+			_, err = component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint"}, false, "")
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := isMoreRecent(tt.entry1, tt.entry2)
-			require.Equal(t, tt.expected, result)
+			require.NoError(t, err)
+			require.Len(t, *queries, 1)
+			assert.False(t, (*queries)[0].Has("_profile"))
 		})
-	}
+	})
+
+	t.Run("uses default DirectoryResourceTypes when not configured", func(t *testing.T) {
+		// This test verifies that when using DefaultConfig(),
+		// the default resource types are set.
+
+		config := DefaultConfig()
+		config.QueryDirectory = DirectoryConfig{
+			FHIRBaseURL: "http://example.com/local/fhir",
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		// Verify the component uses default resource types
+		expectedDefaults := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole", "Practitioner"}
+		assert.Equal(t, expectedDefaults, component.directoryResourceTypes)
+	})
 }
 
-func TestGetLastUpdated(t *testing.T) {
-	tests := []struct {
-		name     string
-		entry    fhir.BundleEntry
-		expected string // Using string for easier comparison, will parse to time.Time
-	}{
-		{
-			name: "valid lastUpdated timestamp",
-			entry: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"2025-08-01T10:00:00.000+00:00"}}`),
-			},
-			expected: "2025-08-01T10:00:00.000+00:00",
-		},
-		{
-			name: "no meta field",
-			entry: fhir.BundleEntry{
-				Resource: []byte(`{"resourceType":"Organization"}`),
-			},
-			expected: "",
-		},
-		{
-			name: "no lastUpdated field in meta",
-			entry: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"versionId":"1"}}`),
-			},
-			expected: "",
-		},
-		{
-			name: "invalid timestamp format",
-			entry: fhir.BundleEntry{
-				Resource: []byte(`{"meta":{"lastUpdated":"invalid-date"}}`),
-			},
-			expected: "",
-		},
-		{
-			name: "no resource (DELETE operation)",
-			entry: fhir.BundleEntry{
-				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE},
-			},
-			expected: "",
-		},
-		{
-			name: "invalid JSON resource",
-			entry: fhir.BundleEntry{
-				Resource: []byte(`{invalid json}`),
-			},
-			expected: "",
-		},
-	}
+func startMockServer(t *testing.T, filesToServe map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := getLastUpdated(tt.entry)
-			if tt.expected == "" {
-				require.True(t, result.IsZero(), "Expected zero time")
-			} else {
-				expectedTime, err := time.Parse(time.RFC3339, tt.expected)
-				require.NoError(t, err, "Test setup error parsing expected time")
-				require.Equal(t, expectedTime, result)
-			}
-		})
+	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
+	require.NoError(t, err)
+	emptyResponseStr := string(emptyBundleData)
+	pathsToServe := map[string]*string{
+		"/fhir/Endpoint/_history":          &emptyResponseStr,
+		"/fhir/Organization/_history":      &emptyResponseStr,
+		"/fhir/Organization":               &emptyResponseStr,
+		"/fhir/Location/_history":          &emptyResponseStr,
+		"/fhir/HealthcareService/_history": &emptyResponseStr,
+		"/fhir/PractitionerRole/_history":  &emptyResponseStr,
+		"/fhir/Practitioner/_history":      &emptyResponseStr,
+	}
+	for path, filename := range filesToServe {
+		data, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		dataStr := string(data)
+		pathsToServe[path] = &dataStr
 	}
+
+	mockEndpoints(mux, pathsToServe)
+	return server
 }
 
-func TestComponent_updateFromDirectory(t *testing.T) {
-	ctx := context.Background()
+func TestComponent_registerAdministrationDirectory(t *testing.T) {
+	t.Run("excludes administration directory by exact URL match", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{"http://example.com/fhir"}
+		component, err := New(config)
+		require.NoError(t, err)
 
-	t.Run("#233: no entry.Request in _history results", func(t *testing.T) {
-		t.Log("See https://github.com/nuts-foundation/nuts-knooppunt/issues/233")
-		server := startMockServer(t, map[string]string{
-			"/fhir/Organization/_history": "test/bugs/233-no-bundle-request/organization_response.json",
-		})
-		component, err := New(DefaultConfig())
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
+		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+	})
+
+	t.Run("excludes administration directory with trailing slash trimmed", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"http://example.com/fhir",
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		// Try to register with trailing slash - should still be excluded
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir/", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
+		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+	})
+
+	t.Run("matches exclusion list entries with trailing slashes", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"http://example.com/fhir/", // Exclusion list has trailing slash
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		// Try to register without trailing slash - should still be excluded due to trimming
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
+		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+	})
+
+	t.Run("matches with both having trailing slashes", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"http://example.com/fhir/", // Both have trailing slash
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir/", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
+		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+	})
+
+	t.Run("allows administration directory not in exclusion list", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"http://excluded.com/fhir",
+		}
+		component, err := New(config)
 		require.NoError(t, err)
-		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization"}, false, "")
+
+		err = component.registerAdministrationDirectory(context.Background(), "http://allowed.com/fhir", []string{"Organization"}, 1, "", "")
+
 		require.NoError(t, err)
-		require.NotNil(t, report)
-		require.Len(t, report.Warnings, 1)
-		assert.Equal(t, report.Warnings[0], "Skipping entry with no request: #0")
-		assert.Empty(t, report.Errors)
-		assert.Equal(t, 0, report.CountCreated)
-		assert.Equal(t, 0, report.CountUpdated)
-		assert.Equal(t, 0, report.CountDeleted)
+		assert.Len(t, component.administrationDirectories, 1, "Directory should be registered")
+		assert.Equal(t, "http://allowed.com/fhir", component.administrationDirectories[0].fhirBaseURL)
 	})
 
-	t.Run("no duplicate resources in transaction bundle", func(t *testing.T) {
-		// This test verifies that when _history returns multiple versions of the same resource,
-		// the transaction bundle sent to the query directory contains no duplicates.
-		// This addresses the HAPI error: "Transaction bundle contains multiple resources with ID: urn:uuid:..."
-		server := startMockServer(t, map[string]string{
-			"/fhir/Organization/_history": "test/history_with_duplicates.json",
-		})
-		defer server.Close()
-
-		capturingClient := &test.StubFHIRClient{}
+	t.Run("excludes own query directory from being registered as admin directory", func(t *testing.T) {
+		ownFHIRBaseURL := "http://localhost:8080/fhir"
 		config := DefaultConfig()
 		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: "http://example.com/local/fhir",
+			FHIRBaseURL: ownFHIRBaseURL,
+		}
+		config.ExcludeAdminDirectories = []string{
+			ownFHIRBaseURL,
 		}
 		component, err := New(config)
 		require.NoError(t, err)
 
-		component.fhirQueryClient = capturingClient
-		component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-			if baseURL.String() == server.URL+"/fhir" {
-				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
-			}
-			if baseURL.String() == "http://example.com/local/fhir" {
-				return capturingClient
-			}
-			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		// Try to register the same URL as admin directory - should be excluded
+		err = component.registerAdministrationDirectory(context.Background(), ownFHIRBaseURL, []string{"Organization"}, 0, "", "")
+
+		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
+		assert.Len(t, component.administrationDirectories, 0, "Own directory should not be registered as admin directory")
+	})
+
+	t.Run("excludes multiple directories", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"http://excluded1.com/fhir",
+			"http://excluded2.com/fhir",
+			"http://excluded3.com/fhir",
 		}
+		component, err := New(config)
+		require.NoError(t, err)
 
-		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization", "Endpoint"}, false, "")
+		// Try to register excluded directories
+		err1 := component.registerAdministrationDirectory(context.Background(), "http://excluded1.com/fhir", []string{"Organization"}, 1, "", "")
+		err2 := component.registerAdministrationDirectory(context.Background(), "http://excluded2.com/fhir", []string{"Organization"}, 1, "", "")
+		err3 := component.registerAdministrationDirectory(context.Background(), "http://excluded3.com/fhir", []string{"Organization"}, 1, "", "")
+
+		// Register an allowed directory
+		err4 := component.registerAdministrationDirectory(context.Background(), "http://allowed.com/fhir", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err1, "Should not error when URL is excluded, just skip registration")
+		require.NoError(t, err2, "Should not error when URL is excluded, just skip registration")
+		require.NoError(t, err3, "Should not error when URL is excluded, just skip registration")
+		require.NoError(t, err4)
+		assert.Len(t, component.administrationDirectories, 1, "Only the allowed directory should be registered")
+	})
 
+	t.Run("empty exclusion list allows all directories", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{}
+		component, err := New(config)
 		require.NoError(t, err)
-		require.Empty(t, report.Errors, "Should not have errors after deduplication")
 
-		// Should have 0 Organizations because the DELETE operation is the most recent
-		orgs := capturingClient.CreatedResources["Organization"]
-		require.Len(t, orgs, 0, "Should have 0 Organizations after deduplication (DELETE is most recent operation)")
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err)
+		assert.Len(t, component.administrationDirectories, 1, "Directory should be registered when exclusion list is empty")
 	})
 
-	t.Run("handles DELETE operations for Endpoints and unregisters from administrationDirectories", func(t *testing.T) {
-		// This test verifies that when an Endpoint is deleted (DELETE operation in _history),
-		// it is properly removed from the query directory and unregistered from administrationDirectories.
-		// This fixes issue #241 where deleted Endpoints were cached indefinitely.
+	t.Run("invalid URL returns error even if in exclusion list", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeAdminDirectories = []string{
+			"not-a-valid-url",
+		}
+		component, err := New(config)
+		require.NoError(t, err)
 
-		ctx := context.Background()
+		// Invalid URL should return error, not silently skip
+		err = component.registerAdministrationDirectory(context.Background(), "not-a-valid-url", []string{"Organization"}, 1, "", "")
 
-		// Create test data with an Endpoint that will be deleted
-		initialBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": [{
-				"fullUrl": "http://test.example.org/fhir/Endpoint/test-endpoint",
-				"resource": {
-					"resourceType": "Endpoint",
-					"id": "test-endpoint",
-					"status": "active",
-					"payloadType": [{
-						"coding": [{
-							"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
-							"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
-						}]
-					}],
-					"address": "https://directory.example.org/fhir"
-				},
-				"request": {
-					"method": "POST",
-					"url": "Endpoint/test-endpoint"
-				}
-			}]
-		}`
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid FHIR base URL")
+		assert.Len(t, component.administrationDirectories, 0, "Invalid URL should not be registered")
+	})
 
-		// Create bundle with DELETE operation for the same Endpoint
-		deleteBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": [{
-				"fullUrl": "http://test.example.org/fhir/Endpoint/test-endpoint",
-				"request": {
-					"method": "DELETE",
-					"url": "Endpoint/test-endpoint"
-				}
-			}]
-		}`
+	t.Run("rejects http discovered directory in strict mode", func(t *testing.T) {
+		config := DefaultConfig()
+		config.StrictMode = true
+		component, err := New(config)
+		require.NoError(t, err)
 
-		orgBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": [{
-				"fullUrl": "http://test.example.org/fhir/Organization/org",
-				 "resource": {
-					"resourceType": "Organization",
-					"id": "org-4",
-					"meta": {
-					  "versionId": "1",
-					  "lastUpdated": "2025-08-01T14:31:31.987+00:00"
-					},
-					"identifier": [
-					  {
-						"use": "official",
-						"system": "http://fhir.nl/fhir/NamingSystem/ura",
-						"value": "444"
-					  }
-					],
-					"active": true,
-					"endpoint": [
-					  {
-						"reference": "Endpoint/test-endpoint"
-					  }
-					],
-					"name": "Organization 4"
-				 },
-				 "request": {
-					"method": "POST",
-					"url": "Organization/org"
-				 },
-				 "response": {
-					"status": "201 Created",
-					"etag": "W/\"1\""
-				 }
-			}]
-		}`
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, 1, "", "")
 
-		// Create a mock server that returns the initial bundle first, then the delete bundle
-		callCount := 0
-		mux := http.NewServeMux()
-		server := httptest.NewServer(mux)
-		defer server.Close()
+		require.EqualError(t, err, "discovered FHIR base URL must use https in strict mode (url=http://example.com/fhir)")
+		assert.Empty(t, component.administrationDirectories)
+	})
 
-		mux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			if callCount == 0 {
-				w.Write([]byte(initialBundle))
-			} else {
-				w.Write([]byte(deleteBundle))
-			}
-			callCount++
-		})
-		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(orgBundle))
-		})
-		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(orgBundle))
-		})
-		mux.HandleFunc("/fhir/Location/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
-		})
-		mux.HandleFunc("/fhir/HealthcareService/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
-		})
-		mux.HandleFunc("/fhir/PractitionerRole/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
-		})
-		mux.HandleFunc("/fhir/Practitioner/_history", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"resourceType": "Bundle", "type": "history", "entry": []}`))
-		})
+	t.Run("allows https discovered directory in strict mode", func(t *testing.T) {
+		config := DefaultConfig()
+		config.StrictMode = true
+		component, err := New(config)
+		require.NoError(t, err)
 
+		err = component.registerAdministrationDirectory(context.Background(), "https://example.com/fhir", []string{"Organization"}, 1, "", "")
+
+		require.NoError(t, err)
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+
+	t.Run("allows http root directory in strict mode", func(t *testing.T) {
 		config := DefaultConfig()
-		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: "http://example.com/local/fhir",
-		}
+		config.StrictMode = true
 		config.AdministrationDirectories = map[string]DirectoryConfig{
-			"test-dir": {
-				FHIRBaseURL: server.URL + "/fhir",
-			},
+			"root": {FHIRBaseURL: "http://example.com/fhir"},
 		}
 		component, err := New(config)
 		require.NoError(t, err)
 
-		// Mock FHIR client that tracks operations
-		capturingClient := &test.StubFHIRClient{}
-		component.fhirQueryClient = capturingClient
-		component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-			if baseURL.String() == server.URL+"/fhir" {
-				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
-			}
-			if baseURL.String() == "http://example.com/local/fhir" {
-				return capturingClient
-			}
-			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
-		}
+		assert.Len(t, component.administrationDirectories, 1)
+	})
 
-		// First update - should discover and register the Endpoint
-		report1, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint", "Organization"}, true, "")
+	t.Run("allows http discovered directory in strict mode when not required", func(t *testing.T) {
+		config := DefaultConfig()
+		config.StrictMode = true
+		config.RequireHTTPSForDiscovered = false
+		component, err := New(config)
 		require.NoError(t, err)
-		require.Empty(t, report1.Errors)
-		require.Equal(t, 1, report1.CountCreated, "Should have created 1 Endpoint")
 
-		// Verify Endpoint was created in query directory
-		require.NotNil(t, capturingClient.CreatedResources)
-		require.Len(t, capturingClient.CreatedResources["Endpoint"], 1, "Endpoint should be created in query directory")
+		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, 1, "", "")
 
-		// Verify Endpoint was discovered and registered with correct fullUrl
-		initialAdminDirCount := len(component.administrationDirectories)
-		foundEndpoint := false
-		var registeredFullUrl string
-		for _, dir := range component.administrationDirectories {
-			if dir.fhirBaseURL == "https://directory.example.org/fhir" {
-				foundEndpoint = true
-				registeredFullUrl = dir.sourceURL
-				break
-			}
-		}
-		assert.True(t, foundEndpoint, "Endpoint should be registered as administration directory")
-		assert.Equal(t, "http://test.example.org/fhir/Endpoint/test-endpoint", registeredFullUrl, "Registered Endpoint should have fullUrl from Bundle entry")
+		require.NoError(t, err)
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+
+	t.Run("trailing slash is removed from base URL", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
 
-		// Second update - should process DELETE and unregister the Endpoint
-		report2, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint", "Organization"}, true, "")
+		err = component.registerAdministrationDirectory(context.Background(), "https://example.com/fhir/", []string{"Organization"}, 1, "", "")
+		require.NoError(t, err)
+		err = component.registerAdministrationDirectory(context.Background(), "https://example.com/fhir", []string{"Organization"}, 1, "", "")
 		require.NoError(t, err)
-		require.Empty(t, report2.Errors)
 
-		// Verify DELETE was processed and Endpoint was unregistered
-		afterDeleteCount := len(component.administrationDirectories)
-		assert.Less(t, afterDeleteCount, initialAdminDirCount, "Deleted Endpoint should be unregistered")
+		require.Len(t, component.administrationDirectories, 1, "the same directory shouldn't be registered twice")
+		assert.Equal(t, "https://example.com/fhir", component.administrationDirectories[0].fhirBaseURL)
+	})
+}
 
-		deletedEndpointStillExists := false
-		for _, dir := range component.administrationDirectories {
-			if dir.fhirBaseURL == "https://directory.example.org/fhir" {
-				deletedEndpointStillExists = true
-				break
-			}
+func TestComponent_excludeResourceTypes(t *testing.T) {
+	ctx := context.Background()
+	t.Run("root directory", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root":  {FHIRBaseURL: "https://root.example.com/fhir", ExcludeResourceTypes: []string{"endpoint"}},
+			"other": {FHIRBaseURL: "https://other.example.com/fhir"},
 		}
-		assert.False(t, deletedEndpointStillExists, "Deleted Endpoint should not remain in administrationDirectories")
-
-		// Verify DELETE was sent to query directory
-		assert.Equal(t, 1, report2.CountDeleted, "Should have 1 deleted resource")
-	})
 
-	t.Run("respects allowedResourceTypes parameter and only queries specified resource types", func(t *testing.T) {
-		// This test verifies that updateFromDirectory only queries the resource types
-		// specified in the allowedResourceTypes parameter, not all resource types.
-		// This prevents 404 errors when the FHIR server doesn't support certain resource types.
+		component, err := New(config)
 
-		ctx := context.Background()
+		require.NoError(t, err)
+		resourceTypes := make(map[string][]string)
+		for _, directory := range component.administrationDirectories {
+			resourceTypes[directory.fhirBaseURL] = directory.resourceTypes
+		}
+		assert.Equal(t, []string{"Organization"}, resourceTypes["https://root.example.com/fhir"])
+		assert.Equal(t, []string{"Organization", "Endpoint"}, resourceTypes["https://other.example.com/fhir"])
+	})
+	t.Run("discovered directory", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeResourceTypes = []string{"Location", "PractitionerRole"}
+		component, err := New(config)
+		require.NoError(t, err)
 
-		// Track which resource type endpoints were called
-		calledEndpoints := make(map[string]bool)
-		var mu sync.Mutex
+		require.NoError(t, component.registerAdministrationDirectory(ctx, "https://provider.example.com/fhir", defaultDirectoryResourceTypes, 1, "https://root.example.com/fhir/Endpoint/1", "1234"))
 
-		mux := http.NewServeMux()
-		server := httptest.NewServer(mux)
-		defer server.Close()
+		require.Len(t, component.administrationDirectories, 1)
+		assert.Equal(t, []string{"Organization", "Endpoint", "HealthcareService", "Practitioner"}, component.administrationDirectories[0].resourceTypes)
+	})
+	t.Run("unsupported resource type", func(t *testing.T) {
+		config := DefaultConfig()
+		config.ExcludeResourceTypes = []string{"Patient"}
 
-		// Empty bundle response
-		emptyBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": []
-		}`
+		_, err := New(config)
 
-		// Set up handlers that track which endpoints are called
-		resourceTypes := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole"}
-		for _, rt := range resourceTypes {
-			resourceType := rt // capture for closure
-			mux.HandleFunc("/fhir/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
-				mu.Lock()
-				calledEndpoints[resourceType] = true
-				mu.Unlock()
-				w.Header().Set("Content-Type", "application/json")
-				w.Write([]byte(emptyBundle))
-			})
+		assert.EqualError(t, err, "invalid excluded resource types: unsupported resource type: Patient")
+	})
+	t.Run("unsupported resource type of root directory", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: "https://root.example.com/fhir", ExcludeResourceTypes: []string{"Patient"}},
 		}
 
-		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
-			mu.Lock()
-			mu.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(emptyBundle))
-		})
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid excluded resource types of root administration directory (url=https://root.example.com/fhir): unsupported resource type: Patient")
+	})
+}
 
+func TestComponent_unregisterAdministrationDirectory(t *testing.T) {
+	ctx := context.Background()
+	const directoryURL = "https://example.com/fhir"
+	const endpointFullURL = "https://root.example.com/fhir/Endpoint/1"
+	directoryKey := makeDirectoryKey(directoryURL, "12345")
+	setup := func(t *testing.T) (*Component, *time.Time) {
 		config := DefaultConfig()
-		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: "http://example.com/local/fhir",
-		}
+		config.UnregisteredStateRetention = time.Hour
 		component, err := New(config)
 		require.NoError(t, err)
-
-		capturingClient := &test.StubFHIRClient{}
-		component.fhirQueryClient = capturingClient
-		component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-			if baseURL.String() == server.URL+"/fhir" {
-				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
-			}
-			if baseURL.String() == "http://example.com/local/fhir" {
-				return capturingClient
-			}
-			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
+		now := time.Now()
+		component.nowFunc = func() time.Time {
+			return now
 		}
+		require.NoError(t, component.registerAdministrationDirectory(ctx, directoryURL, defaultDirectoryResourceTypes, 1, endpointFullURL, "12345"))
+		component.lastUpdateTimes[directoryKey] = map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}
+		component.unregisterAdministrationDirectory(ctx, endpointFullURL)
+		require.Empty(t, component.administrationDirectories)
+		return component, &now
+	}
 
-		// Call updateFromDirectory with only Organization and Endpoint
-		allowedTypes := []string{"Organization", "Endpoint"}
-		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", allowedTypes, false, "")
+	t.Run("re-discovery within grace period resumes incremental sync", func(t *testing.T) {
+		component, now := setup(t)
+		*now = now.Add(30 * time.Minute)
+
+		require.NoError(t, component.registerAdministrationDirectory(ctx, directoryURL, defaultDirectoryResourceTypes, 1, endpointFullURL, "12345"))
+
+		assert.Len(t, component.administrationDirectories, 1)
+		assert.Equal(t, map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}, component.lastUpdateTimes[directoryKey])
+	})
+	t.Run("re-discovery after grace period causes full sync", func(t *testing.T) {
+		component, now := setup(t)
+		*now = now.Add(2 * time.Hour)
+
+		require.NoError(t, component.registerAdministrationDirectory(ctx, directoryURL, defaultDirectoryResourceTypes, 1, endpointFullURL, "12345"))
+
+		assert.Len(t, component.administrationDirectories, 1)
+		assert.NotContains(t, component.lastUpdateTimes, directoryKey)
+	})
+	t.Run("state is purged on update after grace period", func(t *testing.T) {
+		component, now := setup(t)
+		*now = now.Add(2 * time.Hour)
+
+		_, err := component.update(ctx)
 
 		require.NoError(t, err)
-		require.Empty(t, report.Errors)
+		assert.NotContains(t, component.lastUpdateTimes, directoryKey)
+		assert.Empty(t, component.unregisteredDirectories)
+	})
+}
 
-		// Verify only the allowed resource types were queried
-		mu.Lock()
-		defer mu.Unlock()
+func TestComponent_ensureParentOrganizationsMap(t *testing.T) {
+	ctx := context.Background()
 
-		assert.True(t, calledEndpoints["Organization"], "Organization/_history should have been called")
-		assert.True(t, calledEndpoints["Endpoint"], "Endpoint/_history should have been called")
-		assert.False(t, calledEndpoints["Location"], "Location/_history should NOT have been called (not in allowedResourceTypes)")
-		assert.False(t, calledEndpoints["HealthcareService"], "HealthcareService/_history should NOT have been called (not in allowedResourceTypes)")
-		assert.False(t, calledEndpoints["PractitionerRole"], "PractitionerRole/_history should NOT have been called (not in allowedResourceTypes)")
+	t.Run("uses dedicated page size for organization discovery query", func(t *testing.T) {
+		config := DefaultConfig()
+		config.OrgDiscoveryPageSize = 500
+		component, err := New(config)
+		require.NoError(t, err)
 
-		// Verify exactly 2 resource types were queried
-		assert.Equal(t, 2, len(calledEndpoints), "Should have queried exactly 2 resource types")
+		adminClient := &test.StubFHIRClient{}
+		_, err = component.ensureParentOrganizationsMap(ctx, "http://example.com/fhir", adminClient, "")
+
+		require.NoError(t, err)
+		require.Len(t, adminClient.Searches, 1)
+		assert.Equal(t, "?_count=500", adminClient.Searches[0])
 	})
+	t.Run("defaults to search page size", func(t *testing.T) {
+		config := DefaultConfig()
+		config.OrgDiscoveryPageSize = 0
+		component, err := New(config)
+		require.NoError(t, err)
 
-	t.Run("uses configured DirectoryResourceTypes for discovered endpoints", func(t *testing.T) {
-		// This test verifies that when DirectoryResourceTypes is configured,
-		// those resource types are used when discovering and registering new Endpoints.
+		adminClient := &test.StubFHIRClient{}
+		_, err = component.ensureParentOrganizationsMap(ctx, "http://example.com/fhir", adminClient, "")
 
-		ctx := context.Background()
+		require.NoError(t, err)
+		require.Len(t, adminClient.Searches, 1)
+		assert.Equal(t, fmt.Sprintf("?_count=%d", defaultSearchPageSize), adminClient.Searches[0])
+	})
+	t.Run("defaults to configured search page size", func(t *testing.T) {
+		config := DefaultConfig()
+		config.SearchPageSize = 25
+		component, err := New(config)
+		require.NoError(t, err)
 
-		// Track which resource type endpoints were called
-		calledEndpoints := make(map[string]bool)
-		var mu sync.Mutex
+		adminClient := &test.StubFHIRClient{}
+		_, err = component.ensureParentOrganizationsMap(ctx, "http://example.com/fhir", adminClient, "")
 
+		require.NoError(t, err)
+		require.Len(t, adminClient.Searches, 1)
+		assert.Equal(t, "?_count=25", adminClient.Searches[0])
+	})
+	t.Run("endpoint-only directory", func(t *testing.T) {
+		// Directory doesn't support Organization at all
 		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Endpoint/_history": to.Ptr(`{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Endpoint/ep","resource":{"resourceType":"Endpoint","id":"ep","status":"active","address":"https://example.com/fhir"},"request":{"method":"PUT","url":"Endpoint/ep"}}]}`),
+		})
 		server := httptest.NewServer(mux)
 		defer server.Close()
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
 
-		// Response with an Endpoint that should be discovered
-		// Must have the correct payloadType coding to be recognized as an mCSD directory
-		discoveredEndpointBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": [{
-				"fullUrl": "http://example.com/Endpoint/discovered-endpoint",
-				"resource": {
-					"resourceType": "Endpoint",
-					"id": "discovered-endpoint",
-					"status": "active",
-					"connectionType": {
-						"system": "http://terminology.hl7.org/CodeSystem/endpoint-connection-type",
-						"code": "hl7-fhir-rest"
-					},
-					"address": "` + server.URL + `/fhir/discovered",
-					"payloadType": [{
-						"coding": [{
-							"system": "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities",
-							"code": "http://nuts-foundation.github.io/nl-generic-functions-ig/CapabilityStatement/nl-gf-admin-directory-update-client"
-						}]
-					}]
-				},
-				"request": {
-					"method": "POST",
-					"url": "Endpoint"
-				}
-			}]
-		}`
-		discoveredOrganizationBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": [{
-				"fullUrl": "http://test.example.org/fhir/Organization/org",
-				 "resource": {
-					"resourceType": "Organization",
-					"id": "org-4",
-					"meta": {
-					  "versionId": "1",
-					  "lastUpdated": "2025-08-01T14:31:31.987+00:00"
-					},
-					"identifier": [
-					  {
-						"use": "official",
-						"system": "http://fhir.nl/fhir/NamingSystem/ura",
-						"value": "444"
-					  }
-					],
-					"active": true,
-					"endpoint": [
-					  {
-						"reference": "Endpoint/discovered-endpoint"
-					  }
-					],
-					"name": "Organization 4"
-				 },
-				 "request": {
-					"method": "POST",
-					"url": "Organization/org"
-				 },
-				 "response": {
-					"status": "201 Created",
-					"etag": "W/\"1\""
-				 }
-			}]
-		}`
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Endpoint"}, false, "")
 
-		emptyBundle := `{
-			"resourceType": "Bundle",
-			"type": "history",
-			"entry": []
-		}`
+		require.NoError(t, err, "a directory without organizations shouldn't fail")
+		assert.Len(t, report.Warnings, 1, "the endpoint can't be validated without organizations")
+	})
+}
 
-		// Set up handlers that track which endpoints are called
-		// All potential resource types
-		allResourceTypes := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole", "Practitioner"}
-		for _, rt := range allResourceTypes {
-			resourceType := rt // capture for closure
-			mux.HandleFunc("/fhir/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
-				mu.Lock()
-				calledEndpoints[resourceType] = true
-				mu.Unlock()
-				w.Header().Set("Content-Type", "application/json")
-				// Return discovered endpoint only for Endpoint queries
-				if resourceType == "Endpoint" {
-					w.Write([]byte(discoveredEndpointBundle))
-				} else if resourceType == "Organization" {
-					w.Write([]byte(discoveredOrganizationBundle))
-				} else {
-					w.Write([]byte(emptyBundle))
-				}
-			})
-			// Handler for discovered directory
-			mux.HandleFunc("/fhir/discovered/"+resourceType+"/_history", func(w http.ResponseWriter, r *http.Request) {
-				mu.Lock()
-				calledEndpoints["discovered/"+resourceType] = true
-				mu.Unlock()
-				w.Header().Set("Content-Type", "application/json")
-				w.Write([]byte(emptyBundle))
-			})
-		}
+func TestComponent_detectOrganizationCountDrop(t *testing.T) {
+	ctx := context.Background()
+	const directoryKey = "http://example.com/fhir"
 
-		mux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
-			mu.Lock()
-			mu.Unlock()
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(discoveredOrganizationBundle))
-		})
+	t.Run("no warning on first run", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		var report DirectoryUpdateReport
+
+		dropped := component.detectOrganizationCountDrop(ctx, directoryKey, 10, &report)
+
+		assert.False(t, dropped)
+		assert.Empty(t, report.Warnings)
+	})
+	t.Run("warns when count drops sharply", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		component.organizationCounts[directoryKey] = 10
+		var report DirectoryUpdateReport
+
+		dropped := component.detectOrganizationCountDrop(ctx, directoryKey, 2, &report)
+
+		assert.True(t, dropped)
+		require.Len(t, report.Warnings, 1)
+		assert.Equal(t, "organization count dropped by 80% (from 10 to 2) since previous run, which might indicate a problem with the directory", report.Warnings[0])
+	})
+	t.Run("no warning when drop is within threshold", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		component.organizationCounts[directoryKey] = 10
+		var report DirectoryUpdateReport
 
-		// Create component with custom DirectoryResourceTypes that includes Practitioner
-		customResourceTypes := []string{"Organization", "Endpoint", "Practitioner"}
+		dropped := component.detectOrganizationCountDrop(ctx, directoryKey, 6, &report)
+
+		assert.False(t, dropped)
+		assert.Empty(t, report.Warnings)
+	})
+	t.Run("disabled", func(t *testing.T) {
 		config := DefaultConfig()
-		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: "http://example.com/local/fhir",
-		}
-		config.DirectoryResourceTypes = customResourceTypes
+		config.OrgCountDropThreshold = 0
 		component, err := New(config)
 		require.NoError(t, err)
+		component.organizationCounts[directoryKey] = 10
+		var report DirectoryUpdateReport
 
-		// Verify the component stored the custom resource types
-		assert.Equal(t, customResourceTypes, component.directoryResourceTypes)
+		dropped := component.detectOrganizationCountDrop(ctx, directoryKey, 0, &report)
 
-		capturingClient := &test.StubFHIRClient{}
-		component.fhirQueryClient = capturingClient
-		component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
-			if strings.HasPrefix(baseURL.String(), server.URL) {
-				return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{UsePostSearch: false})
-			}
-			if baseURL.String() == "http://example.com/local/fhir" {
-				return capturingClient
-			}
-			return &test.StubFHIRClient{Error: errors.New("unknown URL")}
-		}
+		assert.False(t, dropped)
+		assert.Empty(t, report.Warnings)
+	})
+}
 
-		// Register the root directory (which will query using rootDirectoryResourceTypes: Organization, Endpoint)
-		err = component.registerAdministrationDirectory(ctx, server.URL+"/fhir", rootDirectoryResourceTypes, true, "", "")
+func TestComponent_detectURAConflicts(t *testing.T) {
+	ctx := context.Background()
+	const directoryA = "http://a.example.com/fhir"
+	const directoryB = "http://b.example.com/fhir"
+
+	t.Run("organization synced from two directories", func(t *testing.T) {
+		const organization = `{"resourceType":"Organization","id":"org-1","name":"Care Org","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"12345678"}]}`
+		startDirectory := func(t *testing.T) *httptest.Server {
+			mux := http.NewServeMux()
+			mockEndpoints(mux, map[string]*string{
+				"/fhir/Organization/_history": to.Ptr(`{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `,"request":{"method":"PUT","url":"Organization/org-1"}}]}`),
+				"/fhir/Organization":          to.Ptr(`{"resourceType":"Bundle","type":"searchset","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `}]}`),
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+			return server
+		}
+		serverA := startDirectory(t)
+		serverB := startDirectory(t)
+		component, err := New(DefaultConfig())
 		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
 
-		// First update should discover the endpoint from root directory and immediately query it
-		// because the update() loop processes newly discovered directories in the same iteration
-		_, err = component.update(ctx)
+		report, err := component.updateFromDirectory(ctx, serverA.URL+"/fhir", []string{"Organization"}, false, "")
 		require.NoError(t, err)
+		assert.Empty(t, report.Warnings)
+		report, err = component.updateFromDirectory(ctx, serverA.URL+"/fhir", []string{"Organization"}, false, "")
+		require.NoError(t, err)
+		assert.Empty(t, report.Warnings, "directory overwriting its own organization isn't a conflict")
 
-		mu.Lock()
-		defer mu.Unlock()
-
-		// Verify root directory queries (uses rootDirectoryResourceTypes)
-		assert.True(t, calledEndpoints["Organization"], "Root directory should query Organization")
-		assert.True(t, calledEndpoints["Endpoint"], "Root directory should query Endpoint")
-
-		// Verify discovered directory queries (uses component.directoryResourceTypes which is customResourceTypes)
-		assert.True(t, calledEndpoints["discovered/Organization"], "Discovered directory should query Organization (in customResourceTypes)")
-		assert.True(t, calledEndpoints["discovered/Endpoint"], "Discovered directory should query Endpoint (in customResourceTypes)")
-		assert.True(t, calledEndpoints["discovered/Practitioner"], "Discovered directory should query Practitioner (in customResourceTypes)")
+		report, err = component.updateFromDirectory(ctx, serverB.URL+"/fhir", []string{"Organization"}, false, "")
 
-		// Verify that resource types NOT in customResourceTypes were NOT queried for discovered directory
-		assert.False(t, calledEndpoints["discovered/Location"], "Discovered directory should NOT query Location (not in customResourceTypes)")
-		assert.False(t, calledEndpoints["discovered/HealthcareService"], "Discovered directory should NOT query HealthcareService (not in customResourceTypes)")
-		assert.False(t, calledEndpoints["discovered/PractitionerRole"], "Discovered directory should NOT query PractitionerRole (not in customResourceTypes)")
+		require.NoError(t, err)
+		require.Len(t, report.Warnings, 1)
+		assert.Equal(t, "organization with URA 12345678 was last written by mCSD Directory "+serverA.URL+"/fhir, and is now overwritten by "+serverB.URL+"/fhir", report.Warnings[0])
+		assert.Equal(t, serverB.URL+"/fhir", component.uraWriters["12345678"])
 	})
+	t.Run("no warning for URAs of the same directory", func(t *testing.T) {
+		component, err := New(DefaultConfig())
+		require.NoError(t, err)
+		component.setURAWriters(directoryA, []string{"12345678"})
+		var report DirectoryUpdateReport
 
-	t.Run("uses default DirectoryResourceTypes when not configured", func(t *testing.T) {
-		// This test verifies that when using DefaultConfig(),
-		// the default resource types are set.
+		component.detectURAConflicts(ctx, directoryA, []string{"12345678", "87654321"}, &report)
 
-		config := DefaultConfig()
-		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: "http://example.com/local/fhir",
-		}
-		component, err := New(config)
+		assert.Empty(t, report.Warnings)
+	})
+	t.Run("forgotten when directory state is purged", func(t *testing.T) {
+		component, err := New(DefaultConfig())
 		require.NoError(t, err)
+		component.setURAWriters(directoryA, []string{"12345678"})
+		component.setURAWriters(directoryB, []string{"87654321"})
 
-		// Verify the component uses default resource types
-		expectedDefaults := []string{"Organization", "Endpoint", "Location", "HealthcareService", "PractitionerRole", "Practitioner"}
-		assert.Equal(t, expectedDefaults, component.directoryResourceTypes)
+		component.purgeDirectoryState(directoryA)
+
+		assert.Equal(t, map[string]string{"87654321": directoryB}, component.uraWriters)
 	})
 }
 
-func startMockServer(t *testing.T, filesToServe map[string]string) *httptest.Server {
-	mux := http.NewServeMux()
-	server := httptest.NewServer(mux)
-
-	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
-	require.NoError(t, err)
-	emptyResponseStr := string(emptyBundleData)
-	pathsToServe := map[string]*string{
-		"/fhir/Endpoint/_history":          &emptyResponseStr,
-		"/fhir/Organization/_history":      &emptyResponseStr,
-		"/fhir/Organization":               &emptyResponseStr,
-		"/fhir/Location/_history":          &emptyResponseStr,
-		"/fhir/HealthcareService/_history": &emptyResponseStr,
-		"/fhir/PractitionerRole/_history":  &emptyResponseStr,
-		"/fhir/Practitioner/_history":      &emptyResponseStr,
+func TestComponent_multipleURAs(t *testing.T) {
+	ctx := context.Background()
+	const organization = `{"resourceType":"Organization","id":"org-1","name":"Care Org","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"87654321"},{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"12345678"}]}`
+	startDirectory := func(t *testing.T) *httptest.Server {
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization/_history": to.Ptr(`{"resourceType":"Bundle","type":"history","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `,"request":{"method":"PUT","url":"Organization/org-1"}}]}`),
+			"/fhir/Organization":          to.Ptr(`{"resourceType":"Bundle","type":"searchset","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `}]}`),
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
 	}
-	for path, filename := range filesToServe {
-		data, err := os.ReadFile(filename)
+
+	t.Run("skip (default)", func(t *testing.T) {
+		server := startDirectory(t)
+		component, err := New(DefaultConfig())
 		require.NoError(t, err)
-		dataStr := string(data)
-		pathsToServe[path] = &dataStr
-	}
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
 
-	mockEndpoints(mux, pathsToServe)
-	return server
-}
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization"}, false, "")
 
-func TestComponent_registerAdministrationDirectory(t *testing.T) {
-	t.Run("excludes administration directory by exact URL match", func(t *testing.T) {
+		require.NoError(t, err)
+		assert.Contains(t, report.Warnings, "organization org-1 has multiple URA identifiers (12345678, 87654321), skipping it")
+		assert.Empty(t, queryDirectory.CreatedResources)
+	})
+	t.Run("lowest", func(t *testing.T) {
+		server := startDirectory(t)
 		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{"http://example.com/fhir"}
+		config.MultipleURAs = MultipleURAsLowest
 		component, err := New(config)
 		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
 
-		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, false, "", "")
+		report, err := component.updateFromDirectory(ctx, server.URL+"/fhir", []string{"Organization"}, false, "")
 
-		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
-		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"organization org-1 has multiple URA identifiers (12345678, 87654321), using the lowest: 12345678"}, report.Warnings)
+		assert.Equal(t, 1, report.CountCreated)
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
 	})
-
-	t.Run("excludes administration directory with trailing slash trimmed", func(t *testing.T) {
+	t.Run("invalid option", func(t *testing.T) {
 		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"http://example.com/fhir",
-		}
-		component, err := New(config)
-		require.NoError(t, err)
+		config.MultipleURAs = "highest"
 
-		// Try to register with trailing slash - should still be excluded
-		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir/", []string{"Organization"}, false, "", "")
+		_, err := New(config)
 
-		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
-		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
+		assert.EqualError(t, err, "invalid multiple URAs handling: highest (valid options: skip, lowest)")
 	})
+}
 
-	t.Run("matches exclusion list entries with trailing slashes", func(t *testing.T) {
-		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"http://example.com/fhir/", // Exclusion list has trailing slash
-		}
-		component, err := New(config)
-		require.NoError(t, err)
+func TestKeepLowestURA(t *testing.T) {
+	const uraSystem = "http://fhir.nl/fhir/NamingSystem/ura"
+	org := &fhir.Organization{
+		Identifier: []fhir.Identifier{
+			{System: to.Ptr(uraSystem), Value: to.Ptr("87654321")},
+			{System: to.Ptr("http://example.com"), Value: to.Ptr("other")},
+			{System: to.Ptr(uraSystem), Value: to.Ptr("12345678")},
+		},
+	}
 
-		// Try to register without trailing slash - should still be excluded due to trimming
-		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, false, "", "")
+	keepLowestURA(org, uraSystem)
 
-		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
-		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
-	})
+	assert.Equal(t, []fhir.Identifier{
+		{System: to.Ptr("http://example.com"), Value: to.Ptr("other")},
+		{System: to.Ptr(uraSystem), Value: to.Ptr("12345678")},
+	}, org.Identifier)
+}
 
-	t.Run("matches with both having trailing slashes", func(t *testing.T) {
-		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"http://example.com/fhir/", // Both have trailing slash
-		}
-		component, err := New(config)
+func TestOrganizationURAs(t *testing.T) {
+	tx := fhir.Bundle{
+		Entry: []fhir.BundleEntry{
+			{
+				Resource: []byte(`{"resourceType":"Organization","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"12345678"},{"system":"http://example.com","value":"other"}]}`),
+				Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Organization?_source=a"},
+			},
+			{
+				Resource: []byte(`{"resourceType":"Location","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"11111111"}]}`),
+				Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Location?_source=b"},
+			},
+			{
+				Request: &fhir.BundleEntryRequest{Method: fhir.HTTPVerbDELETE, Url: "Organization?_source=c"},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"12345678"}, organizationURAs(tx, coding.URANamingSystem))
+}
+
+func TestComponent_submitTransaction(t *testing.T) {
+	ctx := context.Background()
+	tx := fhir.Bundle{
+		Type: fhir.BundleTypeTransaction,
+		Entry: []fhir.BundleEntry{
+			{
+				Resource: []byte(`{"resourceType":"Organization","id":"1"}`),
+				Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Organization?_source=x"},
+			},
+		},
+	}
+	const txResponse = `{"resourceType":"Bundle","type":"transaction-response","entry":[{"response":{"status":"201 Created"}}]}`
+	setup := func(t *testing.T, failures int, failureStatus int) (*Component, fhirclient.Client, *int) {
+		var calls int
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /fhir/", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if calls <= failures {
+				w.WriteHeader(failureStatus)
+				return
+			}
+			_, _ = w.Write([]byte(txResponse))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		component, err := New(DefaultConfig())
 		require.NoError(t, err)
+		component.conflictRetryBackoff = time.Millisecond
+		baseURL, _ := url.Parse(server.URL + "/fhir")
+		return component, fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{}), &calls
+	}
 
-		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir/", []string{"Organization"}, false, "", "")
+	t.Run("retries on conflict", func(t *testing.T) {
+		component, client, calls := setup(t, 1, http.StatusConflict)
+		var result fhir.Bundle
 
-		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
-		assert.Len(t, component.administrationDirectories, 0, "No directories should be registered")
-	})
+		err := component.submitTransaction(ctx, client, tx, &result)
 
-	t.Run("allows administration directory not in exclusion list", func(t *testing.T) {
-		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"http://excluded.com/fhir",
-		}
-		component, err := New(config)
 		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+		assert.Len(t, result.Entry, 1)
+	})
+	t.Run("retries on precondition failed", func(t *testing.T) {
+		component, client, calls := setup(t, 1, http.StatusPreconditionFailed)
+		var result fhir.Bundle
 
-		err = component.registerAdministrationDirectory(context.Background(), "http://allowed.com/fhir", []string{"Organization"}, false, "", "")
+		err := component.submitTransaction(ctx, client, tx, &result)
 
 		require.NoError(t, err)
-		assert.Len(t, component.administrationDirectories, 1, "Directory should be registered")
-		assert.Equal(t, "http://allowed.com/fhir", component.administrationDirectories[0].fhirBaseURL)
+		assert.Equal(t, 2, *calls)
 	})
+	t.Run("gives up after max retries", func(t *testing.T) {
+		component, client, calls := setup(t, 10, http.StatusConflict)
+		var result fhir.Bundle
+
+		err := component.submitTransaction(ctx, client, tx, &result)
+
+		require.Error(t, err)
+		assert.Equal(t, 4, *calls)
+	})
+	t.Run("retries on transient error", func(t *testing.T) {
+		component, client, calls := setup(t, 1, http.StatusServiceUnavailable)
+		component.config.RetryBaseDelay = time.Millisecond
+		var result fhir.Bundle
+
+		err := component.submitTransaction(ctx, client, tx, &result)
 
-	t.Run("excludes own query directory from being registered as admin directory", func(t *testing.T) {
-		ownFHIRBaseURL := "http://localhost:8080/fhir"
-		config := DefaultConfig()
-		config.QueryDirectory = DirectoryConfig{
-			FHIRBaseURL: ownFHIRBaseURL,
-		}
-		config.ExcludeAdminDirectories = []string{
-			ownFHIRBaseURL,
-		}
-		component, err := New(config)
 		require.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+	t.Run("does not retry other errors", func(t *testing.T) {
+		component, client, calls := setup(t, 1, http.StatusBadRequest)
+		var result fhir.Bundle
 
-		// Try to register the same URL as admin directory - should be excluded
-		err = component.registerAdministrationDirectory(context.Background(), ownFHIRBaseURL, []string{"Organization"}, true, "", "")
+		err := component.submitTransaction(ctx, client, tx, &result)
 
-		require.NoError(t, err, "Should not error when URL is excluded, just skip registration")
-		assert.Len(t, component.administrationDirectories, 0, "Own directory should not be registered as admin directory")
+		require.Error(t, err)
+		assert.Equal(t, 1, *calls)
 	})
+}
 
-	t.Run("excludes multiple directories", func(t *testing.T) {
+func TestComponent_submitTransactionInChunks(t *testing.T) {
+	ctx := context.Background()
+	tx := fhir.Bundle{Type: fhir.BundleTypeTransaction}
+	for i := 0; i < 5; i++ {
+		tx.Entry = append(tx.Entry, fhir.BundleEntry{
+			Resource: []byte(fmt.Sprintf(`{"resourceType":"Organization","id":"%d"}`, i)),
+			Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: fmt.Sprintf("Organization?_source=%d", i)},
+		})
+	}
+	setup := func(t *testing.T, failingTransaction int) (*Component, fhirclient.Client, *[]int) {
+		var transactionSizes []int
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /fhir/", func(w http.ResponseWriter, r *http.Request) {
+			var requestTx fhir.Bundle
+			_ = json.NewDecoder(r.Body).Decode(&requestTx)
+			transactionSizes = append(transactionSizes, len(requestTx.Entry))
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if len(transactionSizes) == failingTransaction {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			response := fhir.Bundle{Type: fhir.BundleTypeTransactionResponse}
+			for range requestTx.Entry {
+				response.Entry = append(response.Entry, fhir.BundleEntry{Response: &fhir.BundleEntryResponse{Status: "201 Created"}})
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
 		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"http://excluded1.com/fhir",
-			"http://excluded2.com/fhir",
-			"http://excluded3.com/fhir",
-		}
+		config.TransactionChunkSize = 2
 		component, err := New(config)
 		require.NoError(t, err)
+		baseURL, _ := url.Parse(server.URL + "/fhir")
+		return component, fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{}), &transactionSizes
+	}
 
-		// Try to register excluded directories
-		err1 := component.registerAdministrationDirectory(context.Background(), "http://excluded1.com/fhir", []string{"Organization"}, false, "", "")
-		err2 := component.registerAdministrationDirectory(context.Background(), "http://excluded2.com/fhir", []string{"Organization"}, false, "", "")
-		err3 := component.registerAdministrationDirectory(context.Background(), "http://excluded3.com/fhir", []string{"Organization"}, false, "", "")
+	t.Run("submits entries in chunks", func(t *testing.T) {
+		component, client, transactionSizes := setup(t, -1)
+		var report DirectoryUpdateReport
 
-		// Register an allowed directory
-		err4 := component.registerAdministrationDirectory(context.Background(), "http://allowed.com/fhir", []string{"Organization"}, false, "", "")
+		failedTx, err := component.submitTransactionInChunks(ctx, "dir", client, tx, &report)
 
-		require.NoError(t, err1, "Should not error when URL is excluded, just skip registration")
-		require.NoError(t, err2, "Should not error when URL is excluded, just skip registration")
-		require.NoError(t, err3, "Should not error when URL is excluded, just skip registration")
-		require.NoError(t, err4)
-		assert.Len(t, component.administrationDirectories, 1, "Only the allowed directory should be registered")
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 2, 1}, *transactionSizes)
+		assert.Equal(t, 5, report.CountCreated)
+		assert.Empty(t, failedTx.Entry)
 	})
+	t.Run("continues after a failing chunk", func(t *testing.T) {
+		component, client, transactionSizes := setup(t, 2)
+		var report DirectoryUpdateReport
 
-	t.Run("empty exclusion list allows all directories", func(t *testing.T) {
+		failedTx, err := component.submitTransactionInChunks(ctx, "dir", client, tx, &report)
+
+		require.ErrorContains(t, err, "transaction 2 of 3")
+		assert.Equal(t, []int{2, 2, 1}, *transactionSizes)
+		assert.Equal(t, 3, report.CountCreated)
+		assert.Equal(t, tx.Entry[2:4], failedTx.Entry)
+	})
+}
+
+func TestComponent_queryDirectoryFallback(t *testing.T) {
+	ctx := context.Background()
+	server := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/prune_dangling_endpoint_refs_history_response.json",
+		"/fhir/Organization":          "test/prune_dangling_endpoint_refs_history_response.json",
+	})
+	defer server.Close()
+	directoryURL := server.URL + "/fhir"
+	setup := func(t *testing.T, primaryStatus int) (*Component, *test.StubFHIRClient) {
+		primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(primaryStatus)
+		}))
+		t.Cleanup(primary.Close)
 		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{}
+		config.QueryDirectory = DirectoryConfig{FHIRBaseURL: primary.URL}
+		config.QueryDirectoryFallback = DirectoryConfig{FHIRBaseURL: "http://fallback.example.com/fhir"}
+		config.MaxRetries = 0
+		config.QueryDirectoryConflictRetries = 0
 		component, err := New(config)
 		require.NoError(t, err)
+		fallback := &test.StubFHIRClient{}
+		component.fhirQueryFallbackClient = fallback
+		return component, fallback
+	}
+
+	t.Run("primary unavailable", func(t *testing.T) {
+		component, fallback := setup(t, http.StatusServiceUnavailable)
 
-		err = component.registerAdministrationDirectory(context.Background(), "http://example.com/fhir", []string{"Organization"}, false, "", "")
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
 
 		require.NoError(t, err)
-		assert.Len(t, component.administrationDirectories, 1, "Directory should be registered when exclusion list is empty")
+		assert.Equal(t, QueryDirectoryTargetFallback, report.QueryDirectory)
+		require.NotEmpty(t, report.Warnings)
+		assert.Contains(t, report.Warnings[len(report.Warnings)-1], "applied transaction to fallback query directory, since the query directory is unavailable")
+		assert.Len(t, fallback.CreatedResources["Organization"], 1)
+		assert.NotEmpty(t, component.lastUpdateTimes[makeDirectoryKey(directoryURL, "1")])
 	})
+	t.Run("primary and fallback unavailable", func(t *testing.T) {
+		component, fallback := setup(t, http.StatusServiceUnavailable)
+		fallback.Error = errors.New("fallback unavailable")
 
-	t.Run("invalid URL returns error even if in exclusion list", func(t *testing.T) {
-		config := DefaultConfig()
-		config.ExcludeAdminDirectories = []string{
-			"not-a-valid-url",
-		}
-		component, err := New(config)
-		require.NoError(t, err)
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
 
-		// Invalid URL should return error, not silently skip
-		err = component.registerAdministrationDirectory(context.Background(), "not-a-valid-url", []string{"Organization"}, false, "", "")
+		require.ErrorContains(t, err, "fallback query directory: fallback unavailable")
+		assert.Empty(t, component.lastUpdateTimes, "time of last update should not be advanced")
+	})
+	t.Run("primary rejects transaction", func(t *testing.T) {
+		component, fallback := setup(t, http.StatusBadRequest)
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
 
 		require.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid FHIR base URL")
-		assert.Len(t, component.administrationDirectories, 0, "Invalid URL should not be registered")
+		assert.Empty(t, fallback.CreatedResources, "fallback should only be used when the primary is unavailable")
+	})
+}
+
+func TestComponent_submitTransaction_maxConcurrentWrites(t *testing.T) {
+	const maxConcurrentWrites = 2
+	var inFlight, maxInFlight atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /fhir/", func(w http.ResponseWriter, r *http.Request) {
+		curr := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			prev := maxInFlight.Load()
+			if curr <= prev || maxInFlight.CompareAndSwap(prev, curr) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"transaction-response"}`))
 	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	config := DefaultConfig()
+	config.MaxConcurrentQueryWrites = maxConcurrentWrites
+	component, err := New(config)
+	require.NoError(t, err)
+	baseURL, _ := url.Parse(server.URL + "/fhir")
+	client := fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{})
+
+	// Simulate multiple directories being synchronized in parallel
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Go(func() {
+			var result fhir.Bundle
+			errs <- component.submitTransaction(context.Background(), client, fhir.Bundle{Type: fhir.BundleTypeTransaction}, &result)
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(maxConcurrentWrites))
 }
 
 func TestFindParentOrganizationWithURA(t *testing.T) {
@@ -1948,7 +4481,7 @@ func TestFindParentOrganizationWithURA(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			parentOrgMap, err := createOrganizationTree(tt.entries)
+			parentOrgMap, err := createOrganizationTree(tt.entries, coding.URANamingSystem)
 
 			require.NoError(t, err, tt.description)
 
@@ -2034,7 +4567,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when URA identifier is consistent")
 	})
 
@@ -2068,7 +4601,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.True(t, result, "should return true when URA identifier changed")
 	})
 
@@ -2102,7 +4635,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when different organizations have different URAs")
 	})
 
@@ -2123,7 +4656,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when no URA identifiers present")
 	})
 
@@ -2152,7 +4685,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when no URA changes detected")
 	})
 
@@ -2163,7 +4696,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when entries have nil resources")
 	})
 
@@ -2184,7 +4717,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false when organization has nil ID")
 	})
 
@@ -2222,7 +4755,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.True(t, result, "should return true when URA identifier is added in a later version")
 	})
 
@@ -2256,7 +4789,7 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.True(t, result, "should return true when URA identifier is removed in a later version")
 	})
 
@@ -2303,14 +4836,14 @@ func TestCheckForURAIdentifierChanges(t *testing.T) {
 			},
 		}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.True(t, result, "should return true when multiple different URA values exist for same organization")
 	})
 
 	t.Run("empty entries - returns false", func(t *testing.T) {
 		entries := []fhir.BundleEntry{}
 
-		result := checkForURAIdentifierChanges(entries)
+		result := checkForURAIdentifierChanges(entries, coding.URANamingSystem)
 		assert.False(t, result, "should return false for empty entries")
 	})
 }
@@ -2439,7 +4972,7 @@ func TestComponent_authFlow(t *testing.T) {
 	})
 
 	// Override fhirAdminClientFn to use default client for admin directory
-	component.fhirAdminClientFn = func(baseURL *url.URL) fhirclient.Client {
+	component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
 		return fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{
 			UsePostSearch: false,
 		})
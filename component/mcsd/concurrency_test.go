@@ -0,0 +1,191 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestComponent_updateConcurrently(t *testing.T) {
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+
+	// Track the number of directories being queried at the same time
+	var inFlight, maxInFlight int
+	var mux sync.Mutex
+	directories := make(map[string]DirectoryConfig)
+	for i := 0; i < 4; i++ {
+		serverMux := http.NewServeMux()
+		serverMux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			mux.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mux.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mux.Lock()
+			inFlight--
+			mux.Unlock()
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(organizationHistory)
+		})
+		serverMux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(organizationHistory)
+		})
+		serverMux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(endpointHistory)
+		})
+		server := httptest.NewServer(serverMux)
+		t.Cleanup(server.Close)
+		directories[fmt.Sprintf("root%d", i)] = DirectoryConfig{FHIRBaseURL: server.URL + "/fhir"}
+	}
+	update := func(t *testing.T, concurrency int) UpdateReport {
+		maxInFlight = 0
+		config := DefaultConfig()
+		config.AdministrationDirectories = directories
+		config.Concurrency = concurrency
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		for _, directory := range directories {
+			assert.NotEmpty(t, component.status().LastUpdateTimes[directory.FHIRBaseURL])
+		}
+		return report
+	}
+
+	sequentialReport := update(t, 1)
+	assert.Equal(t, 1, maxInFlight)
+	concurrentReport := update(t, 2)
+	assert.Equal(t, 2, maxInFlight)
+
+	t.Run("report is the same as when updating sequentially", func(t *testing.T) {
+		// Directories discovered during the update are only updated in the next run when updating concurrently
+		require.Len(t, concurrentReport, len(directories))
+		for _, directory := range directories {
+			report := concurrentReport[directory.FHIRBaseURL]
+			assert.Equal(t, 4, report.CountCreated)
+			// Configuration differs, so does the config hash, and timing differs
+			report.ConfigHash = sequentialReport[directory.FHIRBaseURL].ConfigHash
+			report.DurationMillis = sequentialReport[directory.FHIRBaseURL].DurationMillis
+			assert.Equal(t, sequentialReport[directory.FHIRBaseURL], report)
+		}
+	})
+}
+
+// slowQueryClient is a query directory that takes some time to apply transactions, tracking the number of transactions in flight.
+type slowQueryClient struct {
+	*test.StubFHIRClient
+	inFlight, maxInFlight *atomic.Int32
+	mux                   *sync.Mutex
+}
+
+func (s slowQueryClient) CreateWithContext(ctx context.Context, resource any, result any, opts ...fhirclient.Option) error {
+	current := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		previous := s.maxInFlight.Load()
+		if current <= previous || s.maxInFlight.CompareAndSwap(previous, current) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	// The stub itself isn't safe for concurrent use
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.StubFHIRClient.CreateWithContext(ctx, resource, result, opts...)
+}
+
+func TestComponent_submitToQueryDirectories(t *testing.T) {
+	ctx := context.Background()
+	tx := fhir.Bundle{
+		Type: fhir.BundleTypeTransaction,
+		Entry: []fhir.BundleEntry{{
+			Resource: json.RawMessage(`{"resourceType":"Organization","id":"org-1"}`),
+			Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Organization/org-1"},
+		}},
+	}
+	inFlight, maxInFlight := &atomic.Int32{}, &atomic.Int32{}
+	newClient := func() slowQueryClient {
+		return slowQueryClient{StubFHIRClient: &test.StubFHIRClient{}, inFlight: inFlight, maxInFlight: maxInFlight, mux: &sync.Mutex{}}
+	}
+	setup := func(t *testing.T, targetConcurrency int, mirrors ...slowQueryClient) (*Component, slowQueryClient) {
+		inFlight.Store(0)
+		maxInFlight.Store(0)
+		config := DefaultConfig()
+		config.QueryTargetConcurrency = targetConcurrency
+		config.RetryBaseDelay = time.Millisecond
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := newClient()
+		component.fhirQueryClient = queryDirectory
+		for i, mirror := range mirrors {
+			component.queryMirrors = append(component.queryMirrors, newQueryMirror(string(rune('a'+i)), mirror, 1))
+		}
+		return component, queryDirectory
+	}
+
+	t.Run("applied to all query directories concurrently", func(t *testing.T) {
+		mirrorA, mirrorB := newClient(), newClient()
+		component, queryDirectory := setup(t, 0, mirrorA, mirrorB)
+		var report DirectoryUpdateReport
+
+		_, err := component.submitToQueryDirectories(ctx, "directory", tx, &report)
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), maxInFlight.Load())
+		assert.Equal(t, 1, report.CountCreated)
+		assert.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		assert.Len(t, mirrorA.CreatedResources["Organization"], 1)
+		assert.Len(t, mirrorB.CreatedResources["Organization"], 1)
+		assert.Equal(t, map[string]*QueryMirrorReport{
+			"a": {CountCreated: 1},
+			"b": {CountCreated: 1},
+		}, report.QueryMirrors)
+	})
+	t.Run("number of concurrent query directories is bounded", func(t *testing.T) {
+		component, _ := setup(t, 2, newClient(), newClient())
+		var report DirectoryUpdateReport
+
+		_, err := component.submitToQueryDirectories(ctx, "directory", tx, &report)
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), maxInFlight.Load())
+		assert.Len(t, report.QueryMirrors, 2)
+	})
+	t.Run("failing query directory doesn't cancel the others", func(t *testing.T) {
+		mirrorA, mirrorB := newClient(), newClient()
+		mirrorA.Error = errors.New("mirror unavailable")
+		component, queryDirectory := setup(t, 0, mirrorA, mirrorB)
+		queryDirectory.Error = errors.New("query directory unavailable")
+		var report DirectoryUpdateReport
+
+		failedTx, err := component.submitToQueryDirectories(ctx, "directory", tx, &report)
+
+		require.EqualError(t, err, "query directory unavailable")
+		assert.Len(t, failedTx.Entry, 1)
+		assert.Len(t, mirrorB.CreatedResources["Organization"], 1)
+		assert.Equal(t, &QueryMirrorReport{CountPending: 1, Error: "mirror unavailable"}, report.QueryMirrors["a"])
+		assert.Equal(t, &QueryMirrorReport{CountCreated: 1}, report.QueryMirrors["b"])
+	})
+}
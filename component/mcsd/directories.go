@@ -0,0 +1,97 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+// RegisterDirectoryRequest is the request body for registering a root mCSD Directory at runtime.
+type RegisterDirectoryRequest struct {
+	FHIRBaseURL string `json:"fhir_base_url"`
+	// ResourceTypes are the resource types to synchronize. If not set, the resource types of configured root directories are used.
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// Discover specifies whether other mCSD Directories are discovered from this directory. Defaults to true.
+	Discover *bool `json:"discover,omitempty"`
+}
+
+// handleRegisterDirectory registers a root mCSD Directory, as if it were configured. It responds with the registered directories.
+// Directories registered at runtime aren't persisted: they're lost on restart.
+func (c *Component) handleRegisterDirectory(w http.ResponseWriter, r *http.Request) {
+	var request RegisterDirectoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resourceTypes := rootDirectoryResourceTypes
+	if len(request.ResourceTypes) > 0 {
+		var err error
+		resourceTypes, err = parseResourceTypes(strings.Join(request.ResourceTypes, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.updateMux.Lock()
+	defer c.updateMux.Unlock()
+	if err := c.registerAdministrationDirectory(r.Context(), request.FHIRBaseURL, resourceTypes, 0, "", ""); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Discover != nil && !*request.Discover {
+		// The directory is registered by its normalized base URL
+		fhirBaseURL := normalizeBaseURL(request.FHIRBaseURL)
+		c.directoryMux.Lock()
+		index := slices.IndexFunc(c.administrationDirectories, func(directory administrationDirectory) bool {
+			return directory.fhirBaseURL == fhirBaseURL && directory.authoritativeUra == ""
+		})
+		if index != -1 {
+			c.administrationDirectories[index].discover = false
+		}
+		c.directoryMux.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(c.directoryStatuses())
+}
+
+// handleUnregisterDirectory unregisters all mCSD Directories with the given FHIR base URL (query parameter 'url'), and purges their sync state.
+// It responds with the remaining registered directories. Discovered directories are registered again when they're discovered again.
+func (c *Component) handleUnregisterDirectory(w http.ResponseWriter, r *http.Request) {
+	fhirBaseURL := normalizeBaseURL(r.URL.Query().Get("url"))
+	if fhirBaseURL == "" {
+		http.Error(w, "query parameter 'url' is required", http.StatusBadRequest)
+		return
+	}
+
+	c.updateMux.Lock()
+	defer c.updateMux.Unlock()
+	c.directoryMux.Lock()
+	initialCount := len(c.administrationDirectories)
+	c.administrationDirectories = slices.DeleteFunc(c.administrationDirectories, func(directory administrationDirectory) bool {
+		if directory.fhirBaseURL != fhirBaseURL {
+			return false
+		}
+		c.purgeDirectoryState(makeDirectoryKey(directory.fhirBaseURL, directory.authoritativeUra))
+		return true
+	})
+	removed := initialCount - len(c.administrationDirectories)
+	c.directoryMux.Unlock()
+	if removed == 0 {
+		http.Error(w, fmt.Sprintf("%s: %s", errUnknownDirectory, fhirBaseURL), http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(r.Context(), "Unregistered mCSD Directory", logging.FHIRServer(fhirBaseURL), slog.Int("count", removed))
+	if err := c.saveDiscoveryCache(); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save mCSD discovery cache", logging.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(c.directoryStatuses())
+}
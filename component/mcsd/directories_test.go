@@ -0,0 +1,131 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_handleDirectories(t *testing.T) {
+	const configuredURL = "https://configured.example.com/fhir"
+	setup := func(t *testing.T) (*Component, *http.ServeMux) {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: configuredURL},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		internalMux := http.NewServeMux()
+		component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+		return component, internalMux
+	}
+	invoke := func(internalMux *http.ServeMux, httpRequest *http.Request) *httptest.ResponseRecorder {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+	register := func(internalMux *http.ServeMux, body string) *httptest.ResponseRecorder {
+		return invoke(internalMux, httptest.NewRequest(http.MethodPost, "/mcsd/directories", strings.NewReader(body)))
+	}
+
+	t.Run("register", func(t *testing.T) {
+		_, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"https://new.example.com/fhir"}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var directories []DirectoryStatus
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &directories))
+		require.Len(t, directories, 2)
+		assert.Equal(t, DirectoryStatus{
+			FHIRBaseURL:   "https://new.example.com/fhir",
+			Discover:      true,
+			ResourceTypes: rootDirectoryResourceTypes,
+		}, directories[1])
+	})
+	t.Run("register without discovery", func(t *testing.T) {
+		_, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"https://new.example.com/fhir","resource_types":["organization","HealthcareService"],"discover":false}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var directories []DirectoryStatus
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &directories))
+		require.Len(t, directories, 2)
+		assert.Equal(t, DirectoryStatus{
+			FHIRBaseURL:   "https://new.example.com/fhir",
+			Discover:      false,
+			ResourceTypes: []string{"Organization", "HealthcareService"},
+		}, directories[1])
+	})
+	t.Run("register without discovery, URL with trailing slash", func(t *testing.T) {
+		_, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"https://new.example.com/fhir/","discover":false}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var directories []DirectoryStatus
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &directories))
+		require.Len(t, directories, 2)
+		assert.Equal(t, "https://new.example.com/fhir", directories[1].FHIRBaseURL)
+		assert.False(t, directories[1].Discover)
+	})
+	t.Run("register existing directory", func(t *testing.T) {
+		component, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"`+configuredURL+`"}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+	t.Run("register invalid URL", func(t *testing.T) {
+		component, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"ftp://new.example.com/fhir"}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "invalid FHIR base URL")
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+	t.Run("register unsupported resource type", func(t *testing.T) {
+		_, internalMux := setup(t)
+
+		httpResponse := register(internalMux, `{"fhir_base_url":"https://new.example.com/fhir","resource_types":["Patient"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "unsupported resource type: Patient")
+	})
+	t.Run("unregister", func(t *testing.T) {
+		component, internalMux := setup(t)
+		component.lastUpdateTimes[configuredURL] = map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}
+
+		httpResponse := invoke(internalMux, httptest.NewRequest(http.MethodDelete, "/mcsd/directories?url="+configuredURL, nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.JSONEq(t, `[]`, httpResponse.Body.String())
+		assert.Empty(t, component.administrationDirectories)
+		assert.Empty(t, component.lastUpdateTimes)
+	})
+	t.Run("unregister, URL with trailing slash", func(t *testing.T) {
+		component, internalMux := setup(t)
+
+		httpResponse := invoke(internalMux, httptest.NewRequest(http.MethodDelete, "/mcsd/directories?url="+configuredURL+"/", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Empty(t, component.administrationDirectories)
+	})
+	t.Run("unregister unknown directory", func(t *testing.T) {
+		component, internalMux := setup(t)
+
+		httpResponse := invoke(internalMux, httptest.NewRequest(http.MethodDelete, "/mcsd/directories?url=https://unknown.example.com/fhir", nil))
+
+		assert.Equal(t, http.StatusNotFound, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "unknown mCSD Directory: https://unknown.example.com/fhir")
+		assert.Len(t, component.administrationDirectories, 1)
+	})
+}
@@ -0,0 +1,95 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+// cachedDirectory is a discovered mCSD Directory as stored in the discovery cache file.
+type cachedDirectory struct {
+	FHIRBaseURL      string   `json:"fhir_base_url"`
+	ResourceTypes    []string `json:"resource_types"`
+	Depth            int      `json:"depth"`
+	SourceURL        string   `json:"source_url"`
+	AuthoritativeURA string   `json:"authoritative_ura"`
+}
+
+// loadDiscoveryCache registers the discovered directories from the discovery cache file, if configured.
+// This allows them to be synchronized right after startup, without waiting for them to be discovered again.
+// Directories that are no longer discovered are unregistered when their Endpoint is deleted, like any other discovered directory.
+func (c *Component) loadDiscoveryCache(ctx context.Context) error {
+	if c.config.DiscoveryCacheFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.config.DiscoveryCacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read discovery cache: %w", err)
+	}
+	var directories []cachedDirectory
+	if err := json.Unmarshal(data, &directories); err != nil {
+		return fmt.Errorf("failed to parse discovery cache: %w", err)
+	}
+	for _, directory := range directories {
+		if directory.Depth <= 0 || directory.Depth > c.config.MaxDiscoveryDepth {
+			// Not discoverable with the current configuration
+			continue
+		}
+		if err := c.registerAdministrationDirectory(ctx, directory.FHIRBaseURL, directory.ResourceTypes, directory.Depth, directory.SourceURL, directory.AuthoritativeURA); err != nil {
+			slog.WarnContext(ctx, "Failed to register mCSD Directory from discovery cache", logging.FHIRServer(directory.FHIRBaseURL), logging.Error(err))
+		}
+	}
+	slog.InfoContext(ctx, "Loaded discovered mCSD Directories from cache", slog.Int("count", len(directories)))
+	return nil
+}
+
+// saveDiscoveryCache writes the discovered directories to the discovery cache file, if configured.
+func (c *Component) saveDiscoveryCache() error {
+	if c.config.DiscoveryCacheFile == "" {
+		return nil
+	}
+	directories := make([]cachedDirectory, 0, len(c.administrationDirectories))
+	for _, directory := range c.administrationDirectories {
+		if directory.depth == 0 {
+			// Root directories are configured
+			continue
+		}
+		directories = append(directories, cachedDirectory{
+			FHIRBaseURL:      directory.fhirBaseURL,
+			ResourceTypes:    directory.resourceTypes,
+			Depth:            directory.depth,
+			SourceURL:        directory.sourceURL,
+			AuthoritativeURA: directory.authoritativeUra,
+		})
+	}
+	data, err := json.Marshal(directories)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so a crash never leaves a partially written cache behind
+	tempFile, err := os.CreateTemp(filepath.Dir(c.config.DiscoveryCacheFile), filepath.Base(c.config.DiscoveryCacheFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write discovery cache: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("failed to write discovery cache: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to write discovery cache: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), c.config.DiscoveryCacheFile); err != nil {
+		return fmt.Errorf("failed to write discovery cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package mcsd
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_discoveryCache(t *testing.T) {
+	ctx := context.Background()
+	const rootURL = "https://root.example.com/fhir"
+	const leafURL = "https://leaf.example.com/fhir"
+	cacheFile := filepath.Join(t.TempDir(), "discovery-cache.json")
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: rootURL},
+	}
+	config.DiscoveryCacheFile = cacheFile
+
+	var rootQueried bool
+	newComponent := func(t *testing.T) *Component {
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		component.fhirAdminClientFn = func(_ string, baseURL *url.URL) fhirclient.Client {
+			if baseURL.String() == rootURL {
+				rootQueried = true
+			}
+			return &test.StubFHIRClient{}
+		}
+		return component
+	}
+
+	// Discover a leaf directory, and synchronize to write the cache
+	component := newComponent(t)
+	require.NoError(t, component.registerAdministrationDirectory(ctx, leafURL, defaultDirectoryResourceTypes, 1, "https://root.example.com/fhir/Endpoint/leaf", "111"))
+	_, err := component.update(ctx)
+	require.NoError(t, err)
+	require.FileExists(t, cacheFile)
+
+	t.Run("leaf directories are registered on restart, before the root directory is scanned", func(t *testing.T) {
+		rootQueried = false
+
+		restarted := newComponent(t)
+
+		assert.False(t, rootQueried)
+		require.Len(t, restarted.administrationDirectories, 2)
+		leaf := restarted.administrationDirectories[1]
+		assert.Equal(t, leafURL, leaf.fhirBaseURL)
+		assert.Equal(t, defaultDirectoryResourceTypes, leaf.resourceTypes)
+		assert.Equal(t, 1, leaf.depth)
+		assert.False(t, leaf.discover)
+		assert.Equal(t, "https://root.example.com/fhir/Endpoint/leaf", leaf.sourceURL)
+		assert.Equal(t, "111", leaf.authoritativeUra)
+	})
+	t.Run("corrupt cache doesn't prevent startup", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cacheFile, []byte("not JSON"), 0600))
+
+		restarted := newComponent(t)
+
+		assert.Len(t, restarted.administrationDirectories, 1)
+	})
+}
@@ -0,0 +1,57 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// discoveryLogSize is the number of discovery events retained in the discovery log.
+const discoveryLogSize = 100
+
+const (
+	// DiscoveryActionRegistered is the action of a discovery event of a discovered mCSD Directory that was registered.
+	DiscoveryActionRegistered = "registered"
+	// DiscoveryActionUnregistered is the action of a discovery event of a discovered mCSD Directory that was unregistered,
+	// because its Endpoint was deleted.
+	DiscoveryActionUnregistered = "unregistered"
+)
+
+// DiscoveryEvent describes a discovered mCSD Directory being registered or unregistered.
+type DiscoveryEvent struct {
+	Time time.Time `json:"time"`
+	// FullURL is the fullUrl of the Endpoint the directory was discovered from.
+	FullURL string `json:"full_url"`
+	// Directory is the key of the directory.
+	Directory string `json:"directory"`
+	Action    string `json:"action"`
+}
+
+// recordDiscoveryEvent adds an event to the discovery log, evicting the oldest event if it's full.
+func (c *Component) recordDiscoveryEvent(action string, fullURL string, directoryKey string) {
+	c.discoveryLogMux.Lock()
+	defer c.discoveryLogMux.Unlock()
+	c.discoveryLog = append(c.discoveryLog, DiscoveryEvent{
+		Time:      c.nowFunc(),
+		FullURL:   fullURL,
+		Directory: directoryKey,
+		Action:    action,
+	})
+	if len(c.discoveryLog) > discoveryLogSize {
+		c.discoveryLog = slices.Delete(c.discoveryLog, 0, len(c.discoveryLog)-discoveryLogSize)
+	}
+}
+
+// handleDiscoveryLog responds with the discovery log (oldest event first).
+func (c *Component) handleDiscoveryLog(w http.ResponseWriter, _ *http.Request) {
+	c.discoveryLogMux.Lock()
+	events := slices.Clone(c.discoveryLog)
+	c.discoveryLogMux.Unlock()
+	if events == nil {
+		events = []DiscoveryEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,68 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_handleDiscoveryLog(t *testing.T) {
+	ctx := context.Background()
+	const endpointFullURL = "https://root.example.com/fhir/Endpoint/ep-1"
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	component.nowFunc = func() time.Time {
+		return now
+	}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+	invoke := func(t *testing.T) []DiscoveryEvent {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsd/discovery", nil))
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var events []DiscoveryEvent
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &events))
+		return events
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		events := invoke(t)
+
+		assert.NotNil(t, events)
+		assert.Empty(t, events)
+	})
+	t.Run("registered and unregistered", func(t *testing.T) {
+		require.NoError(t, component.registerAdministrationDirectory(ctx, "https://root.example.com/fhir", rootDirectoryResourceTypes, 0, "", ""))
+		require.NoError(t, component.registerAdministrationDirectory(ctx, "https://provider.example.com/fhir", defaultDirectoryResourceTypes, 1, endpointFullURL, "1234"))
+		// Registering an already registered directory isn't an event
+		require.NoError(t, component.registerAdministrationDirectory(ctx, "https://provider.example.com/fhir", defaultDirectoryResourceTypes, 1, endpointFullURL, "1234"))
+		now = now.Add(time.Hour)
+		component.unregisterAdministrationDirectory(ctx, endpointFullURL)
+
+		events := invoke(t)
+
+		assert.Equal(t, []DiscoveryEvent{
+			{Time: now.Add(-time.Hour), FullURL: endpointFullURL, Directory: "https://provider.example.com/fhir|1234", Action: DiscoveryActionRegistered},
+			{Time: now, FullURL: endpointFullURL, Directory: "https://provider.example.com/fhir|1234", Action: DiscoveryActionUnregistered},
+		}, events, "root directories shouldn't be logged")
+	})
+}
+
+func TestComponent_recordDiscoveryEvent(t *testing.T) {
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	for i := 0; i < discoveryLogSize+2; i++ {
+		component.recordDiscoveryEvent(DiscoveryActionRegistered, "https://example.com/fhir/Endpoint/"+string(rune('a'+i%26)), "https://example.com/fhir")
+	}
+
+	require.Len(t, component.discoveryLog, discoveryLogSize)
+	assert.Equal(t, "https://example.com/fhir/Endpoint/c", component.discoveryLog[0].FullURL, "oldest events should be evicted")
+}
@@ -0,0 +1,77 @@
+package mcsd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+// supportedFHIRVersions contains the valid values of the fhirVersion media type parameter,
+// see https://hl7.org/fhir/R4/http.html#version-parameter
+var supportedFHIRVersions = []string{"1.0", "3.0", "4.0", "4.3", "5.0"}
+
+func validateFHIRVersion(fhirVersion string) error {
+	if fhirVersion != "" && !slices.Contains(supportedFHIRVersions, fhirVersion) {
+		return fmt.Errorf("invalid FHIR version: %s (valid options: %s)", fhirVersion, strings.Join(supportedFHIRVersions, ", "))
+	}
+	return nil
+}
+
+// fhirClientConfig returns the configuration for FHIR clients, which sets the given FHIR version (if any) on requests.
+func fhirClientConfig(fhirVersion string) *fhirclient.Config {
+	result := &fhirclient.Config{
+		UsePostSearch: false,
+	}
+	if fhirVersion != "" {
+		result.DefaultOptions = []fhirclient.Option{fhirVersionOption(fhirVersion)}
+	}
+	return result
+}
+
+// fhirVersionOption sets the fhirVersion parameter on the Accept and (FHIR) Content-Type headers of requests.
+func fhirVersionOption(fhirVersion string) fhirclient.PreRequestOption {
+	mediaType := fhirclient.FhirJsonMediaType + "; fhirVersion=" + fhirVersion
+	return func(_ fhirclient.Client, httpRequest *http.Request) {
+		httpRequest.Header.Set("Accept", mediaType)
+		if strings.HasPrefix(httpRequest.Header.Get("Content-Type"), fhirclient.FhirJsonMediaType) {
+			httpRequest.Header.Set("Content-Type", mediaType)
+		}
+	}
+}
+
+// checkFHIRVersion probes the CapabilityStatement of the directory (once), and reports a warning if it advertises
+// a different FHIR version than the configured one. Failing to probe the CapabilityStatement is not considered an error.
+func (c *Component) checkFHIRVersion(ctx context.Context, directoryKey string, fhirBaseURL string, fhirClient fhirclient.Client, report *DirectoryUpdateReport) {
+	if c.config.FHIRVersion == "" {
+		return
+	}
+	c.directoryMux.Lock()
+	checked := c.fhirVersionChecked[directoryKey]
+	c.directoryMux.Unlock()
+	if checked {
+		return
+	}
+	var capabilityStatement struct {
+		FHIRVersion string `json:"fhirVersion"`
+	}
+	if err := fhirClient.ReadWithContext(ctx, "metadata", &capabilityStatement); err != nil {
+		slog.DebugContext(ctx, "Failed to read CapabilityStatement of mCSD Directory, can't check FHIR version", logging.FHIRServer(fhirBaseURL), logging.Error(err))
+		return
+	}
+	c.directoryMux.Lock()
+	c.fhirVersionChecked[directoryKey] = true
+	c.directoryMux.Unlock()
+	advertisedVersion := capabilityStatement.FHIRVersion
+	if advertisedVersion == "" || advertisedVersion == c.config.FHIRVersion || strings.HasPrefix(advertisedVersion, c.config.FHIRVersion+".") {
+		return
+	}
+	msg := fmt.Sprintf("mCSD Directory advertises FHIR version %s, which differs from the configured FHIR version %s", advertisedVersion, c.config.FHIRVersion)
+	slog.WarnContext(ctx, msg, logging.FHIRServer(fhirBaseURL))
+	report.Warnings = append(report.Warnings, msg)
+}
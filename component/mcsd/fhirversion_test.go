@@ -0,0 +1,88 @@
+package mcsd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_fhirVersion(t *testing.T) {
+	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
+	require.NoError(t, err)
+
+	var acceptHeaders []string
+	var metadataRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/", func(w http.ResponseWriter, r *http.Request) {
+		acceptHeaders = append(acceptHeaders, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(emptyBundleData)
+	})
+	mux.HandleFunc("/fhir/metadata", func(w http.ResponseWriter, r *http.Request) {
+		metadataRequests++
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(`{"resourceType":"CapabilityStatement","fhirVersion":"5.0.0"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	setup := func(t *testing.T, fhirVersion string) *Component {
+		acceptHeaders = nil
+		metadataRequests = 0
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: server.URL + "/fhir"},
+		}
+		config.FHIRVersion = fhirVersion
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		return component
+	}
+
+	t.Run("version parameter is sent on requests", func(t *testing.T) {
+		component := setup(t, "4.0")
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		require.NotEmpty(t, acceptHeaders)
+		for _, accept := range acceptHeaders {
+			assert.Equal(t, "application/fhir+json; fhirVersion=4.0", accept)
+		}
+		assert.Contains(t, report[server.URL+"/fhir"].Warnings, "mCSD Directory advertises FHIR version 5.0.0, which differs from the configured FHIR version 4.0")
+	})
+	t.Run("CapabilityStatement is probed once", func(t *testing.T) {
+		component := setup(t, "5.0")
+
+		for range 2 {
+			report, err := component.update(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, report[server.URL+"/fhir"].Warnings)
+		}
+		assert.Equal(t, 1, metadataRequests)
+	})
+	t.Run("not configured", func(t *testing.T) {
+		component := setup(t, "")
+
+		_, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, "application/fhir+json", acceptHeaders[0])
+		assert.Zero(t, metadataRequests)
+	})
+	t.Run("invalid version", func(t *testing.T) {
+		config := DefaultConfig()
+		config.FHIRVersion = "4.0.1"
+
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid FHIR version: 4.0.1 (valid options: 1.0, 3.0, 4.0, 4.3, 5.0)")
+	})
+}
@@ -0,0 +1,180 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"golang.org/x/oauth2"
+)
+
+// HealthCheckReport is the outcome of checking the connectivity of the registered mCSD Directories and the query directories,
+// returned by GET /mcsd/healthcheck.
+type HealthCheckReport struct {
+	// Healthy is true if all directories responded successfully.
+	Healthy bool `json:"healthy"`
+	// Directories contains the outcome of the registered mCSD Directories, in order of registration.
+	Directories    []DirectoryHealth `json:"directories"`
+	QueryDirectory DirectoryHealth   `json:"query_directory"`
+	// QueryFallback is the outcome of the fallback query directory, if configured.
+	QueryFallback *DirectoryHealth `json:"query_fallback,omitempty"`
+	// QueryMirrors contains the outcome of each query mirror (by key), if configured.
+	QueryMirrors map[string]DirectoryHealth `json:"query_mirrors,omitempty"`
+}
+
+// DirectoryHealth is the outcome of requesting the CapabilityStatement (GET [base]/metadata) of a FHIR server.
+type DirectoryHealth struct {
+	// Directory is the key of the mCSD Directory, not set for query directories.
+	Directory   string `json:"directory,omitempty"`
+	FHIRBaseURL string `json:"fhir_base_url"`
+	// Reachable is true if the FHIR server responded, regardless of the HTTP status.
+	Reachable bool `json:"reachable"`
+	// Status is the HTTP status of the response, if the FHIR server responded.
+	Status int `json:"status,omitempty"`
+	// Authenticated is false if acquiring an OAuth2 token failed or the FHIR server responded with 401 or 403.
+	// It's not set if the FHIR server couldn't be reached.
+	Authenticated *bool `json:"authenticated,omitempty"`
+	// AcceptsTransactions is set for query directories, and tells whether the CapabilityStatement lists the transaction interaction.
+	AcceptsTransactions *bool  `json:"accepts_transactions,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+func (h DirectoryHealth) healthy() bool {
+	return h.Reachable && h.Status >= 200 && h.Status < 300 && (h.AcceptsTransactions == nil || *h.AcceptsTransactions)
+}
+
+// capabilityStatement contains the elements of a CapabilityStatement that are used by the health check.
+type capabilityStatement struct {
+	Rest []struct {
+		Interaction []struct {
+			Code string `json:"code"`
+		} `json:"interaction"`
+	} `json:"rest"`
+}
+
+func (s capabilityStatement) supportsInteraction(code string) bool {
+	for _, rest := range s.Rest {
+		for _, interaction := range rest.Interaction {
+			if interaction.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// healthCheck requests the CapabilityStatement of all registered mCSD Directories and the query directories (concurrently),
+// without performing any synchronization.
+func (c *Component) healthCheck(ctx context.Context) HealthCheckReport {
+	c.directoryMux.Lock()
+	directories := slices.Clone(c.administrationDirectories)
+	rebasedURLs := maps.Clone(c.rebasedURLs)
+	c.directoryMux.Unlock()
+
+	report := HealthCheckReport{
+		Directories: make([]DirectoryHealth, len(directories)),
+	}
+	var fallbackHealth DirectoryHealth
+	mirrorHealth := make([]DirectoryHealth, len(c.queryMirrors))
+	wg := &sync.WaitGroup{}
+	for i, directory := range directories {
+		wg.Go(func() {
+			directoryKey := makeDirectoryKey(directory.fhirBaseURL, directory.authoritativeUra)
+			baseURL, err := url.Parse(directory.fhirBaseURL)
+			if rebasedURL, ok := rebasedURLs[directoryKey]; ok {
+				baseURL = rebasedURL
+			}
+			var health DirectoryHealth
+			if err != nil {
+				health.Error = err.Error()
+			} else {
+				health, _ = checkFHIRServer(ctx, c.fhirAdminClientFn(directory.fhirBaseURL, baseURL))
+			}
+			health.Directory = directoryKey
+			health.FHIRBaseURL = directory.fhirBaseURL
+			report.Directories[i] = health
+		})
+	}
+	wg.Go(func() {
+		report.QueryDirectory = checkQueryDirectory(ctx, c.fhirQueryClient, c.config.QueryDirectory.FHIRBaseURL)
+	})
+	if c.fhirQueryFallbackClient != nil {
+		wg.Go(func() {
+			fallbackHealth = checkQueryDirectory(ctx, c.fhirQueryFallbackClient, c.config.QueryDirectoryFallback.FHIRBaseURL)
+		})
+	}
+	for i, mirror := range c.queryMirrors {
+		wg.Go(func() {
+			mirrorHealth[i] = checkQueryDirectory(ctx, mirror.client, c.config.QueryMirrors[mirror.key].FHIRBaseURL)
+		})
+	}
+	wg.Wait()
+
+	report.Healthy = report.QueryDirectory.healthy()
+	for _, health := range report.Directories {
+		report.Healthy = report.Healthy && health.healthy()
+	}
+	if c.fhirQueryFallbackClient != nil {
+		report.QueryFallback = &fallbackHealth
+		report.Healthy = report.Healthy && fallbackHealth.healthy()
+	}
+	if len(c.queryMirrors) > 0 {
+		report.QueryMirrors = make(map[string]DirectoryHealth, len(c.queryMirrors))
+		for i, mirror := range c.queryMirrors {
+			report.QueryMirrors[mirror.key] = mirrorHealth[i]
+			report.Healthy = report.Healthy && mirrorHealth[i].healthy()
+		}
+	}
+	return report
+}
+
+// checkQueryDirectory checks the connectivity of a query directory, and whether it accepts transactions.
+func checkQueryDirectory(ctx context.Context, client fhirclient.Client, fhirBaseURL string) DirectoryHealth {
+	health, capabilities := checkFHIRServer(ctx, client)
+	health.FHIRBaseURL = fhirBaseURL
+	if health.Error == "" {
+		health.AcceptsTransactions = to.Ptr(capabilities.supportsInteraction("transaction"))
+		if !*health.AcceptsTransactions {
+			health.Error = "CapabilityStatement doesn't list the transaction interaction"
+		}
+	}
+	return health
+}
+
+// checkFHIRServer requests the CapabilityStatement of the FHIR server, and returns the outcome and the CapabilityStatement (if successful).
+func checkFHIRServer(ctx context.Context, client fhirclient.Client) (DirectoryHealth, capabilityStatement) {
+	var health DirectoryHealth
+	var result capabilityStatement
+	err := client.ReadWithContext(ctx, "metadata", &result, fhirclient.ResponseStatusCode(&health.Status))
+	if health.Status != 0 {
+		health.Reachable = true
+		health.Authenticated = to.Ptr(health.Status != http.StatusUnauthorized && health.Status != http.StatusForbidden)
+	} else if tokenErr := new(oauth2.RetrieveError); errors.As(err, &tokenErr) {
+		// The token endpoint rejected the credentials, so the FHIR server wasn't requested
+		health.Authenticated = to.Ptr(false)
+	}
+	if err != nil {
+		health.Error = err.Error()
+	}
+	return health, result
+}
+
+// handleHealthCheck responds with the outcome of checking the connectivity of the directories,
+// with status 200 if all of them are healthy, or 503 otherwise.
+func (c *Component) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	report := c.healthCheck(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
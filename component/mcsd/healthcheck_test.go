@@ -0,0 +1,136 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/httpauth"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_handleHealthCheck(t *testing.T) {
+	const capabilityStatementWithTransaction = `{"resourceType":"CapabilityStatement","rest":[{"mode":"server","interaction":[{"code":"transaction"}]}]}`
+	const capabilityStatementWithoutTransaction = `{"resourceType":"CapabilityStatement","rest":[{"mode":"server"}]}`
+	startServer := func(t *testing.T, status int, capabilityStatement string) string {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /fhir/metadata", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(capabilityStatement))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server.URL + "/fhir"
+	}
+	invoke := func(t *testing.T, config Config) (int, HealthCheckReport) {
+		component, err := New(config)
+		require.NoError(t, err)
+		internalMux := http.NewServeMux()
+		component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsd/healthcheck", nil))
+		var report HealthCheckReport
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &report))
+		return httpResponse.Code, report
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = startServer(t, http.StatusOK, capabilityStatementWithTransaction)
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: startServer(t, http.StatusOK, capabilityStatementWithoutTransaction)},
+		}
+
+		status, report := invoke(t, config)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.True(t, report.Healthy)
+		require.Len(t, report.Directories, 1)
+		assert.Equal(t, config.AdministrationDirectories["root"].FHIRBaseURL, report.Directories[0].Directory)
+		assert.True(t, report.Directories[0].Reachable)
+		assert.Equal(t, http.StatusOK, report.Directories[0].Status)
+		assert.Equal(t, to.Ptr(true), report.Directories[0].Authenticated)
+		assert.Nil(t, report.Directories[0].AcceptsTransactions, "only checked for query directories")
+		assert.Equal(t, to.Ptr(true), report.QueryDirectory.AcceptsTransactions)
+		assert.Empty(t, report.QueryDirectory.Error)
+	})
+	t.Run("directory responds with 401", func(t *testing.T) {
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = startServer(t, http.StatusOK, capabilityStatementWithTransaction)
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: startServer(t, http.StatusUnauthorized, `{}`)},
+		}
+
+		status, report := invoke(t, config)
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.False(t, report.Healthy)
+		require.Len(t, report.Directories, 1)
+		assert.True(t, report.Directories[0].Reachable)
+		assert.Equal(t, http.StatusUnauthorized, report.Directories[0].Status)
+		assert.Equal(t, to.Ptr(false), report.Directories[0].Authenticated)
+		assert.Contains(t, report.Directories[0].Error, "status=401")
+	})
+	t.Run("directory is unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = startServer(t, http.StatusOK, capabilityStatementWithTransaction)
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: server.URL + "/fhir"},
+		}
+
+		status, report := invoke(t, config)
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		require.Len(t, report.Directories, 1)
+		assert.False(t, report.Directories[0].Reachable)
+		assert.Zero(t, report.Directories[0].Status)
+		assert.Nil(t, report.Directories[0].Authenticated)
+		assert.NotEmpty(t, report.Directories[0].Error)
+	})
+	t.Run("token endpoint rejects credentials", func(t *testing.T) {
+		tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		}))
+		t.Cleanup(tokenServer.Close)
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = startServer(t, http.StatusOK, capabilityStatementWithTransaction)
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {
+				FHIRBaseURL: startServer(t, http.StatusOK, capabilityStatementWithoutTransaction),
+				Auth:        httpauth.OAuth2Config{TokenEndpoint: tokenServer.URL, ClientID: "root", ClientSecret: "secret"},
+			},
+		}
+
+		status, report := invoke(t, config)
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		require.Len(t, report.Directories, 1)
+		assert.False(t, report.Directories[0].Reachable)
+		assert.Equal(t, to.Ptr(false), report.Directories[0].Authenticated)
+		assert.Contains(t, report.Directories[0].Error, "invalid_client")
+	})
+	t.Run("query directory doesn't accept transactions", func(t *testing.T) {
+		config := DefaultConfig()
+		config.QueryDirectory.FHIRBaseURL = startServer(t, http.StatusOK, capabilityStatementWithoutTransaction)
+		config.QueryMirrors = map[string]DirectoryConfig{
+			"replica": {FHIRBaseURL: startServer(t, http.StatusOK, capabilityStatementWithTransaction)},
+		}
+
+		status, report := invoke(t, config)
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, to.Ptr(false), report.QueryDirectory.AcceptsTransactions)
+		assert.Equal(t, "CapabilityStatement doesn't list the transaction interaction", report.QueryDirectory.Error)
+		assert.Empty(t, report.Directories)
+		require.Contains(t, report.QueryMirrors, "replica")
+		assert.Equal(t, to.Ptr(true), report.QueryMirrors["replica"].AcceptsTransactions)
+	})
+}
@@ -0,0 +1,52 @@
+package mcsd
+
+import (
+	"context"
+	"time"
+)
+
+// idempotencyKeyRetention is how long the result of an update triggered with an idempotency key is retained.
+// Triggers with the same key within this period get the result of the earlier run, instead of starting a new one.
+const idempotencyKeyRetention = time.Minute
+
+// idempotentUpdate is an update run triggered with an idempotency key.
+type idempotentUpdate struct {
+	// done is closed when the update completed.
+	done        chan struct{}
+	report      UpdateReport
+	err         error
+	completedAt time.Time
+}
+
+// updateIdempotent performs an update, unless an update with the same idempotency key is in progress or completed recently.
+// In that case, it waits for that update and returns its result.
+func (c *Component) updateIdempotent(ctx context.Context, idempotencyKey string, options syncOptions) (UpdateReport, error) {
+	c.idempotentUpdateMux.Lock()
+	for key, update := range c.idempotentUpdates {
+		if !update.completedAt.IsZero() && c.nowFunc().Sub(update.completedAt) > idempotencyKeyRetention {
+			delete(c.idempotentUpdates, key)
+		}
+	}
+	update, exists := c.idempotentUpdates[idempotencyKey]
+	if !exists {
+		update = &idempotentUpdate{done: make(chan struct{})}
+		c.idempotentUpdates[idempotencyKey] = update
+	}
+	c.idempotentUpdateMux.Unlock()
+
+	if !exists {
+		// The run is shared with other callers, so it shouldn't be cancelled when this caller goes away.
+		report, err := c.updateWithOptions(context.WithoutCancel(ctx), options)
+		c.idempotentUpdateMux.Lock()
+		update.report, update.err, update.completedAt = report, err, c.nowFunc()
+		c.idempotentUpdateMux.Unlock()
+		close(update.done)
+	}
+
+	select {
+	case <-update.done:
+		return update.report, update.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
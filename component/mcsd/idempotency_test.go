@@ -0,0 +1,81 @@
+package mcsd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_updateIdempotent(t *testing.T) {
+	emptyBundleData, err := os.ReadFile("test/empty_bundle_response.json")
+	require.NoError(t, err)
+	emptyResponseStr := string(emptyBundleData)
+
+	var runs atomic.Int32
+	directoryMux := http.NewServeMux()
+	mockEndpoints(directoryMux, map[string]*string{
+		"/fhir/Organization":          &emptyResponseStr,
+		"/fhir/Organization/_history": &emptyResponseStr,
+	})
+	directoryMux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+		runs.Add(1)
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(emptyBundleData)
+	})
+	directoryServer := httptest.NewServer(directoryMux)
+	defer directoryServer.Close()
+
+	setup := func(t *testing.T) *http.ServeMux {
+		runs.Store(0)
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: directoryServer.URL + "/fhir"},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		internalMux := http.NewServeMux()
+		component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+		return internalMux
+	}
+	invoke := func(internalMux *http.ServeMux, idempotencyKey string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsd/update", nil)
+		httpRequest.Header.Set("Idempotency-Key", idempotencyKey)
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+
+	t.Run("same key results in a single run", func(t *testing.T) {
+		internalMux := setup(t)
+
+		responses := make([]*httptest.ResponseRecorder, 2)
+		wg := sync.WaitGroup{}
+		for i := range responses {
+			wg.Go(func() {
+				responses[i] = invoke(internalMux, "key-1")
+			})
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), runs.Load())
+		require.Equal(t, http.StatusOK, responses[0].Code)
+		require.Equal(t, http.StatusOK, responses[1].Code)
+		assert.Equal(t, responses[0].Body.String(), responses[1].Body.String())
+	})
+	t.Run("different keys result in separate runs", func(t *testing.T) {
+		internalMux := setup(t)
+
+		invoke(internalMux, "key-1")
+		invoke(internalMux, "key-2")
+
+		assert.Equal(t, int32(2), runs.Load())
+	})
+}
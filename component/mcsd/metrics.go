@@ -0,0 +1,96 @@
+package mcsd
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var syncLagDesc = prometheus.NewDesc(
+	"mcsd_sync_lag_seconds",
+	"Time in seconds since the last successful synchronization of a mCSD Directory.",
+	[]string{"directory"}, nil,
+)
+
+var _ prometheus.Collector = (*syncLagCollector)(nil)
+
+// syncLagCollector reports the sync lag of each mCSD Directory at the time of collection,
+// so the metric keeps increasing when a directory fails to synchronize.
+type syncLagCollector struct {
+	component *Component
+}
+
+func (s syncLagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- syncLagDesc
+}
+
+func (s syncLagCollector) Collect(ch chan<- prometheus.Metric) {
+	for directoryKey, state := range s.component.syncStates() {
+		if state.LagSeconds == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(syncLagDesc, prometheus.GaugeValue, *state.LagSeconds, directoryKey)
+	}
+}
+
+var _ prometheus.Collector = (*syncMetrics)(nil)
+
+// syncMetrics holds the counts and durations of mCSD Directory synchronizations, labeled by directory key.
+type syncMetrics struct {
+	resourcesCreated *prometheus.CounterVec
+	resourcesUpdated *prometheus.CounterVec
+	resourcesDeleted *prometheus.CounterVec
+	syncErrors       *prometheus.CounterVec
+	syncDuration     *prometheus.HistogramVec
+}
+
+func newSyncMetrics() *syncMetrics {
+	return &syncMetrics{
+		resourcesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcsd_resources_created_total",
+			Help: "Number of resources created in the query directory, synchronized from a mCSD Directory.",
+		}, []string{"directory"}),
+		resourcesUpdated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcsd_resources_updated_total",
+			Help: "Number of resources updated in the query directory, synchronized from a mCSD Directory.",
+		}, []string{"directory"}),
+		resourcesDeleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcsd_resources_deleted_total",
+			Help: "Number of resources deleted from the query directory, synchronized from a mCSD Directory.",
+		}, []string{"directory"}),
+		syncErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mcsd_sync_errors_total",
+			Help: "Number of errors that occurred while synchronizing a mCSD Directory.",
+		}, []string{"directory"}),
+		syncDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mcsd_sync_duration_seconds",
+			Help:    "Duration in seconds of the synchronization of a mCSD Directory.",
+			Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}, []string{"directory"}),
+	}
+}
+
+func (m *syncMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.resourcesCreated, m.resourcesUpdated, m.resourcesDeleted, m.syncErrors, m.syncDuration}
+}
+
+func (m *syncMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range m.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+func (m *syncMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range m.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// record updates the metrics with the result of the synchronization of a mCSD Directory.
+func (m *syncMetrics) record(directoryKey string, report DirectoryUpdateReport, duration time.Duration) {
+	m.resourcesCreated.WithLabelValues(directoryKey).Add(float64(report.CountCreated))
+	m.resourcesUpdated.WithLabelValues(directoryKey).Add(float64(report.CountUpdated))
+	m.resourcesDeleted.WithLabelValues(directoryKey).Add(float64(report.CountDeleted))
+	m.syncErrors.WithLabelValues(directoryKey).Add(float64(len(report.Errors)))
+	m.syncDuration.WithLabelValues(directoryKey).Observe(duration.Seconds())
+}
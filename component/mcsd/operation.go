@@ -0,0 +1,115 @@
+package mcsd
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/fhirapi"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// handleSyncOperation implements the $sync FHIR operation, which triggers an update like POST /mcsd/update.
+// It accepts a Parameters resource with the following (optional) parameters:
+//   - directory: FHIR base URL of the mCSD Directory to update. If not set, all directories are updated.
+//   - since: instant to use as last update time, instead of the time of the previous update.
+//   - dryRun: if true, the changes are reported but not applied to the query directory.
+//
+// It returns a Parameters resource with a result parameter for each updated directory.
+func (c *Component) handleSyncOperation(httpResponse http.ResponseWriter, httpRequest *http.Request) {
+	ctx := httpRequest.Context()
+	fhirRequest, err := fhirapi.ParseRequest[fhir.Parameters](httpRequest)
+	if err != nil {
+		fhirapi.SendErrorResponse(ctx, httpResponse, err)
+		return
+	}
+	options, err := parseSyncParameters(fhirRequest.Resource)
+	if err != nil {
+		fhirapi.SendErrorResponse(ctx, httpResponse, err)
+		return
+	}
+	result, err := c.updateWithOptions(ctx, options)
+	if errors.Is(err, errUnknownDirectory) {
+		fhirapi.SendErrorResponse(ctx, httpResponse, fhirapi.BadRequestError(err.Error(), nil))
+		return
+	} else if err != nil {
+		fhirapi.SendErrorResponse(ctx, httpResponse, err)
+		return
+	}
+	fhirapi.SendResponse(ctx, httpResponse, http.StatusOK, updateReportToParameters(result))
+}
+
+func parseSyncParameters(parameters fhir.Parameters) (syncOptions, error) {
+	var options syncOptions
+	for _, parameter := range parameters.Parameter {
+		switch parameter.Name {
+		case "directory":
+			value := firstNonNil(parameter.ValueUri, parameter.ValueUrl, parameter.ValueString)
+			if value == nil {
+				return syncOptions{}, fhirapi.BadRequestError("parameter 'directory' must be an uri", nil)
+			}
+			options.directory = normalizeBaseURL(*value)
+		case "since":
+			value := firstNonNil(parameter.ValueInstant, parameter.ValueDateTime, parameter.ValueString)
+			if value == nil {
+				return syncOptions{}, fhirapi.BadRequestError("parameter 'since' must be an instant", nil)
+			}
+			since, err := normalizeTimestamp(*value)
+			if err != nil {
+				return syncOptions{}, fhirapi.BadRequestError("parameter 'since' must be an instant", err)
+			}
+			options.since = since
+		case "dryRun":
+			if parameter.ValueBoolean == nil {
+				return syncOptions{}, fhirapi.BadRequestError("parameter 'dryRun' must be a boolean", nil)
+			}
+			options.dryRun = *parameter.ValueBoolean
+		default:
+			return syncOptions{}, fhirapi.BadRequestError("unsupported parameter: "+parameter.Name, nil)
+		}
+	}
+	return options, nil
+}
+
+func updateReportToParameters(report UpdateReport) fhir.Parameters {
+	result := fhir.Parameters{
+		Parameter: []fhir.ParametersParameter{},
+	}
+	directoryKeys := make([]string, 0, len(report))
+	for directoryKey := range report {
+		directoryKeys = append(directoryKeys, directoryKey)
+	}
+	slices.Sort(directoryKeys)
+	for _, directoryKey := range directoryKeys {
+		directoryReport := report[directoryKey]
+		parts := []fhir.ParametersParameter{
+			{Name: "directory", ValueString: &directoryKey},
+			{Name: "created", ValueInteger: &directoryReport.CountCreated},
+			{Name: "updated", ValueInteger: &directoryReport.CountUpdated},
+			{Name: "deleted", ValueInteger: &directoryReport.CountDeleted},
+			{Name: "planned", ValueInteger: &directoryReport.CountPlanned},
+			{Name: "plannedPut", ValueInteger: &directoryReport.CountPlannedPut},
+			{Name: "plannedDelete", ValueInteger: &directoryReport.CountPlannedDelete},
+		}
+		for _, warning := range directoryReport.Warnings {
+			parts = append(parts, fhir.ParametersParameter{Name: "warning", ValueString: &warning})
+		}
+		for _, err := range directoryReport.Errors {
+			parts = append(parts, fhir.ParametersParameter{Name: "error", ValueString: &err})
+		}
+		result.Parameter = append(result.Parameter, fhir.ParametersParameter{
+			Name: "result",
+			Part: parts,
+		})
+	}
+	return result
+}
+
+func firstNonNil(values ...*string) *string {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestComponent_handleSyncOperation(t *testing.T) {
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	endpointHistoryStr := string(endpointHistory)
+	organizationHistoryStr := string(organizationHistory)
+
+	var sinceParams []string
+	var mu sync.Mutex
+	rootDirMux := http.NewServeMux()
+	mockEndpoints(rootDirMux, map[string]*string{
+		"/fhir/Organization/_history": &organizationHistoryStr,
+		"/fhir/Organization":          &organizationHistoryStr,
+	})
+	rootDirMux.HandleFunc("/fhir/Endpoint/_history", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sinceParams = append(sinceParams, r.URL.Query().Get("_since"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(endpointHistoryStr))
+	})
+	rootDirServer := httptest.NewServer(rootDirMux)
+	defer rootDirServer.Close()
+	directoryURL := rootDirServer.URL + "/fhir"
+
+	setup := func(t *testing.T) (*Component, *test.StubFHIRClient, *http.ServeMux) {
+		sinceParams = nil
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: directoryURL},
+		}
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+		internalMux := http.NewServeMux()
+		component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+		return component, queryDirectory, internalMux
+	}
+	invoke := func(t *testing.T, internalMux *http.ServeMux, parameters string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsd/$sync", strings.NewReader(parameters))
+		httpRequest.Header.Set("Content-Type", "application/fhir+json")
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		component, queryDirectory, internalMux := setup(t)
+
+		httpResponse := invoke(t, internalMux, `{"resourceType":"Parameters","parameter":[
+			{"name":"directory","valueUri":"`+directoryURL+`"},
+			{"name":"dryRun","valueBoolean":true}
+		]}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var result fhir.Parameters
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &result))
+		require.Len(t, result.Parameter, 1)
+		assert.Equal(t, "result", result.Parameter[0].Name)
+		parts := make(map[string]fhir.ParametersParameter)
+		for _, part := range result.Parameter[0].Part {
+			parts[part.Name] = part
+		}
+		assert.Equal(t, directoryURL, *parts["directory"].ValueString)
+		assert.Greater(t, *parts["planned"].ValueInteger, 0)
+		assert.Equal(t, 0, *parts["created"].ValueInteger)
+		// Nothing should've been applied or changed
+		assert.Empty(t, queryDirectory.CreatedResources)
+		assert.Empty(t, component.lastUpdateTimes)
+		assert.Empty(t, component.syncStates()[directoryURL].LastSuccess)
+		assert.Len(t, component.administrationDirectories, 1, "discovered directories should not be registered")
+	})
+	t.Run("since", func(t *testing.T) {
+		component, _, internalMux := setup(t)
+		component.lastUpdateTimes[directoryURL] = map[string]string{"Endpoint": "2025-08-01T10:00:00Z"}
+
+		httpResponse := invoke(t, internalMux, `{"resourceType":"Parameters","parameter":[
+			{"name":"since","valueInstant":"2025-01-01T12:00:00+01:00"},
+			{"name":"dryRun","valueBoolean":true}
+		]}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Equal(t, []string{"2025-01-01T11:00:00Z"}, sinceParams)
+	})
+	t.Run("unknown directory", func(t *testing.T) {
+		_, _, internalMux := setup(t)
+
+		httpResponse := invoke(t, internalMux, `{"resourceType":"Parameters","parameter":[
+			{"name":"directory","valueUri":"https://example.com/fhir"}
+		]}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "unknown mCSD Directory: https://example.com/fhir")
+	})
+	t.Run("invalid since", func(t *testing.T) {
+		_, _, internalMux := setup(t)
+
+		httpResponse := invoke(t, internalMux, `{"resourceType":"Parameters","parameter":[
+			{"name":"since","valueString":"yesterday"}
+		]}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "parameter 'since' must be an instant")
+	})
+}
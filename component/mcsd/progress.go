@@ -0,0 +1,132 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+const (
+	progressDirectoryStarted   = "directory_started"
+	progressPageFetched        = "page_fetched"
+	progressTransactionApplied = "transaction_applied"
+	progressDirectoryFinished  = "directory_finished"
+)
+
+// progressSubscriberBufferSize is the number of events buffered for a subscriber. Events are dropped for subscribers that can't keep up.
+const progressSubscriberBufferSize = 100
+
+// ProgressEvent describes the progress of an update, streamed to clients of GET /mcsd/progress.
+type ProgressEvent struct {
+	Type      string `json:"type"`
+	Directory string `json:"directory"`
+	// ResourceType is the resource type of the fetched page, for page_fetched events.
+	ResourceType string `json:"resource_type,omitempty"`
+	// Count is the number of entries in the fetched page or applied transaction.
+	Count int `json:"count,omitempty"`
+	// Report is the result of the update of the directory, for directory_finished events.
+	Report *DirectoryUpdateReport `json:"report,omitempty"`
+}
+
+// progressBroker distributes progress events to subscribers.
+type progressBroker struct {
+	mux         sync.Mutex
+	subscribers map[chan ProgressEvent]struct{}
+	// closed is closed when the component stops, ending all subscriptions.
+	closed chan struct{}
+}
+
+func newProgressBroker() *progressBroker {
+	return &progressBroker{
+		subscribers: make(map[chan ProgressEvent]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (b *progressBroker) subscribe() chan ProgressEvent {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	events := make(chan ProgressEvent, progressSubscriberBufferSize)
+	b.subscribers[events] = struct{}{}
+	return events
+}
+
+func (b *progressBroker) unsubscribe(events chan ProgressEvent) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.subscribers, events)
+}
+
+func (b *progressBroker) publish(event ProgressEvent) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			// Subscriber can't keep up, don't block the update
+		}
+	}
+}
+
+func (b *progressBroker) close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+}
+
+type progressDirectoryContextKey struct{}
+
+// withProgressDirectory returns a context that attributes progress events (e.g. fetched pages) to the given directory.
+func withProgressDirectory(ctx context.Context, directoryKey string) context.Context {
+	return context.WithValue(ctx, progressDirectoryContextKey{}, directoryKey)
+}
+
+func progressDirectory(ctx context.Context) string {
+	directoryKey, _ := ctx.Value(progressDirectoryContextKey{}).(string)
+	return directoryKey
+}
+
+// handleProgress streams progress events of updates as Server-Sent Events, until the client disconnects.
+func (c *Component) handleProgress(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events := c.progress.subscribe()
+	defer c.progress.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.progress.closed:
+			return
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to marshal mCSD progress event", logging.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
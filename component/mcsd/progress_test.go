@@ -0,0 +1,107 @@
+package mcsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_handleProgress(t *testing.T) {
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	endpointHistoryStr := string(endpointHistory)
+	organizationHistoryStr := string(organizationHistory)
+	rootDirMux := http.NewServeMux()
+	mockEndpoints(rootDirMux, map[string]*string{
+		"/fhir/Organization/_history": &organizationHistoryStr,
+		"/fhir/Organization":          &organizationHistoryStr,
+		"/fhir/Endpoint/_history":     &endpointHistoryStr,
+	})
+	rootDirServer := httptest.NewServer(rootDirMux)
+	defer rootDirServer.Close()
+	directoryURL := rootDirServer.URL + "/fhir"
+
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: directoryURL},
+	}
+	component, err := New(config)
+	require.NoError(t, err)
+	component.fhirQueryClient = &test.StubFHIRClient{}
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+	internalServer := httptest.NewServer(internalMux)
+	defer internalServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, internalServer.URL+"/mcsd/progress", nil)
+	require.NoError(t, err)
+	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	require.NoError(t, err)
+	defer httpResponse.Body.Close()
+	require.Equal(t, http.StatusOK, httpResponse.StatusCode)
+	assert.Equal(t, "text/event-stream", httpResponse.Header.Get("Content-Type"))
+
+	events := make(chan ProgressEvent, progressSubscriberBufferSize)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(httpResponse.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event ProgressEvent
+			if json.Unmarshal([]byte(data), &event) == nil {
+				events <- event
+			}
+		}
+	}()
+
+	_, err = component.update(context.Background())
+	require.NoError(t, err)
+
+	var received []ProgressEvent
+	timeout := time.After(5 * time.Second)
+	for len(received) == 0 || received[len(received)-1].Type != progressDirectoryFinished {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-timeout:
+			t.Fatalf("timeout waiting for progress events, received: %v", received)
+		}
+	}
+	var types []string
+	for _, event := range received {
+		assert.Equal(t, directoryURL, event.Directory)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, progressDirectoryStarted, types[0])
+	assert.Contains(t, types, progressPageFetched)
+	assert.Contains(t, types, progressTransactionApplied)
+	finished := received[len(received)-1]
+	require.NotNil(t, finished.Report)
+	assert.Equal(t, 4, finished.Report.CountCreated)
+
+	t.Run("client disconnect ends subscription", func(t *testing.T) {
+		cancel()
+		assert.Eventually(t, func() bool {
+			component.progress.mux.Lock()
+			defer component.progress.mux.Unlock()
+			return len(component.progress.subscribers) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
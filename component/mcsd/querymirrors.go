@@ -0,0 +1,168 @@
+package mcsd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// queryMirror is an additional query directory the changes are applied to, next to the (primary) query directory.
+type queryMirror struct {
+	key    string
+	client fhirclient.Client
+	// writeSemaphore limits the number of concurrent transactions on the query mirror, like queryWriteSemaphore does for the query directory.
+	writeSemaphore chan struct{}
+}
+
+func newQueryMirror(key string, client fhirclient.Client, maxConcurrentWrites int) queryMirror {
+	return queryMirror{
+		key:            key,
+		client:         client,
+		writeSemaphore: make(chan struct{}, max(maxConcurrentWrites, 1)),
+	}
+}
+
+// QueryMirrorReport contains the outcome of applying the changes of a directory to a query mirror.
+type QueryMirrorReport struct {
+	CountCreated int `json:"created"`
+	CountUpdated int `json:"updated"`
+	CountDeleted int `json:"deleted"`
+	// CountPending is the number of entries that couldn't be applied to the query mirror yet, which are applied in the next update.
+	CountPending int `json:"pending,omitempty"`
+	// Error is set if (part of) the changes couldn't be applied to the query mirror.
+	Error string `json:"error,omitempty"`
+}
+
+// submitToQueryDirectories applies the transaction to the query directory and each query mirror concurrently, using a pool of (at most)
+// the configured number of workers. A failing query directory or mirror doesn't cancel or prevent applying the transaction to the others.
+// The outcome of the query directory is counted in the report, and that of each query mirror is added to the report per query mirror.
+// It returns the transaction containing the entries that couldn't be applied to the query directory, and the errors that occurred.
+func (c *Component) submitToQueryDirectories(ctx context.Context, directoryKey string, tx fhir.Bundle, report *DirectoryUpdateReport) (fhir.Bundle, error) {
+	workers := make(chan struct{}, c.queryTargetConcurrency())
+	wg := &sync.WaitGroup{}
+	var failedTx fhir.Bundle
+	var err error
+	// The query directory is the only target that writes to the report directly, query mirrors report their own outcome
+	var primaryReport DirectoryUpdateReport
+	if len(tx.Entry) > 0 {
+		wg.Go(func() {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			failedTx, err = c.submitTransactionInChunks(ctx, directoryKey, c.fhirQueryClient, tx, &primaryReport)
+		})
+	}
+	mirrorReports := make(map[string]*QueryMirrorReport, len(c.queryMirrors))
+	mirrorReportMux := &sync.Mutex{}
+	for _, mirror := range c.queryMirrors {
+		wg.Go(func() {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			if mirrorReport := c.submitToQueryMirror(ctx, mirror, directoryKey, tx); mirrorReport != nil {
+				mirrorReportMux.Lock()
+				mirrorReports[mirror.key] = mirrorReport
+				mirrorReportMux.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	report.merge(primaryReport)
+	report.Warnings = append(report.Warnings, primaryReport.Warnings...)
+	if primaryReport.QueryDirectory != "" {
+		report.QueryDirectory = primaryReport.QueryDirectory
+	}
+	// Sorted by key to keep the warnings deterministic
+	for _, key := range slices.Sorted(maps.Keys(mirrorReports)) {
+		mirrorReport := mirrorReports[key]
+		if mirrorReport.Error != "" {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("failed to apply mCSD update to query mirror %s (%d entries pending): %s", key, mirrorReport.CountPending, mirrorReport.Error))
+		}
+		if report.QueryMirrors == nil {
+			report.QueryMirrors = make(map[string]*QueryMirrorReport, len(c.queryMirrors))
+		}
+		report.QueryMirrors[key] = mirrorReport
+	}
+	return failedTx, err
+}
+
+// queryTargetConcurrency returns the maximum number of query directories (the query directory and query mirrors)
+// a transaction is applied to concurrently.
+func (c *Component) queryTargetConcurrency() int {
+	if c.config.QueryTargetConcurrency > 0 {
+		return c.config.QueryTargetConcurrency
+	}
+	return len(c.queryMirrors) + 1
+}
+
+// submitToQueryMirror applies the transaction to the query mirror, in chunks like the query directory, and returns its outcome
+// (nil if there was nothing to apply). The chunks that couldn't be applied are kept per query mirror and directory,
+// and applied (before newer changes) in the next update, so a failing query mirror doesn't hold back the time of the last update.
+func (c *Component) submitToQueryMirror(ctx context.Context, mirror queryMirror, directoryKey string, tx fhir.Bundle) *QueryMirrorReport {
+	// Chunks are applied in order, so changes that couldn't be applied yet don't overwrite newer ones
+	chunks := c.takePendingMirrorChunks(mirror.key, directoryKey)
+	for chunk := range slices.Chunk(tx.Entry, c.config.TransactionChunkSize) {
+		chunks = append(chunks, fhir.Bundle{Type: fhir.BundleTypeTransaction, Entry: chunk})
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	var mirrorReport DirectoryUpdateReport
+	var err error
+	for i, chunk := range chunks {
+		var txResult fhir.Bundle
+		// Query mirrors don't fall back to the fallback query directory: it only stands in for the primary query directory
+		if err = c.submitTransactionWithLimit(ctx, mirror.client, mirror.writeSemaphore, chunk, &txResult); err != nil {
+			chunks = chunks[i:]
+			break
+		}
+		countTransactionResult(chunk, txResult, &mirrorReport)
+	}
+	result := &QueryMirrorReport{
+		CountCreated: mirrorReport.CountCreated,
+		CountUpdated: mirrorReport.CountUpdated,
+		CountDeleted: mirrorReport.CountDeleted,
+	}
+	if err != nil {
+		c.setPendingMirrorChunks(mirror.key, directoryKey, chunks)
+		for _, chunk := range chunks {
+			result.CountPending += len(chunk.Entry)
+		}
+		slog.ErrorContext(ctx, "Failed to apply mCSD update to query mirror, it will be applied in the next update", slog.String("query_mirror", mirror.key), slog.String("directory", directoryKey), slog.Int("pending", result.CountPending), logging.Error(err))
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// takePendingMirrorChunks returns and removes the chunks of the given directory that couldn't be applied to the query mirror yet.
+func (c *Component) takePendingMirrorChunks(mirrorKey string, directoryKey string) []fhir.Bundle {
+	c.queryMirrorMux.Lock()
+	defer c.queryMirrorMux.Unlock()
+	chunks := c.pendingMirrorChunks[mirrorKey][directoryKey]
+	delete(c.pendingMirrorChunks[mirrorKey], directoryKey)
+	return chunks
+}
+
+func (c *Component) setPendingMirrorChunks(mirrorKey string, directoryKey string, chunks []fhir.Bundle) {
+	c.queryMirrorMux.Lock()
+	defer c.queryMirrorMux.Unlock()
+	if c.pendingMirrorChunks[mirrorKey] == nil {
+		c.pendingMirrorChunks[mirrorKey] = make(map[string][]fhir.Bundle)
+	}
+	c.pendingMirrorChunks[mirrorKey][directoryKey] = chunks
+}
+
+// removePendingMirrorChunks removes the chunks of the given directory that couldn't be applied to the query mirrors yet.
+func (c *Component) removePendingMirrorChunks(directoryKey string) {
+	c.queryMirrorMux.Lock()
+	defer c.queryMirrorMux.Unlock()
+	for _, pending := range c.pendingMirrorChunks {
+		delete(pending, directoryKey)
+	}
+}
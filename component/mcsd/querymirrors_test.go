@@ -0,0 +1,132 @@
+package mcsd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/caramel/to"
+)
+
+func TestComponent_queryMirrors(t *testing.T) {
+	ctx := context.Background()
+	const organization = `{"resourceType":"Organization","id":"org-1","name":"Care Org","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"12345678"}]}`
+	mux := http.NewServeMux()
+	mockEndpoints(mux, map[string]*string{
+		"/fhir/Organization/_history": to.Ptr(`{"resourceType":"Bundle","type":"history","meta":{"lastUpdated":"2025-01-01T12:00:00Z"},"entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `,"request":{"method":"PUT","url":"Organization/org-1"}}]}`),
+		"/fhir/Organization":          to.Ptr(`{"resourceType":"Bundle","type":"searchset","entry":[{"fullUrl":"Organization/org-1","resource":` + organization + `}]}`),
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	directoryURL := server.URL + "/fhir"
+	setup := func(t *testing.T, mirrors ...*test.StubFHIRClient) (*Component, *test.StubFHIRClient) {
+		config := DefaultConfig()
+		config.RetryBaseDelay = time.Millisecond
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+		for i, mirror := range mirrors {
+			component.queryMirrors = append(component.queryMirrors, newQueryMirror(string(rune('a'+i)), mirror, 1))
+		}
+		return component, queryDirectory
+	}
+
+	t.Run("changes are applied to all query directories", func(t *testing.T) {
+		mirrorA := &test.StubFHIRClient{}
+		mirrorB := &test.StubFHIRClient{}
+		component, queryDirectory := setup(t, mirrorA, mirrorB)
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		assert.Empty(t, report.Warnings)
+		assert.Equal(t, 1, report.CountCreated)
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		require.Len(t, mirrorA.CreatedResources["Organization"], 1)
+		require.Len(t, mirrorB.CreatedResources["Organization"], 1)
+		assert.Equal(t, map[string]*QueryMirrorReport{
+			"a": {CountCreated: 1},
+			"b": {CountCreated: 1},
+		}, report.QueryMirrors)
+		assert.NotEmpty(t, component.lastUpdateTimes[directoryURL])
+	})
+	t.Run("failing query mirror doesn't prevent applying to the others", func(t *testing.T) {
+		mirrorA := &test.StubFHIRClient{Error: errors.New("mirror unavailable")}
+		mirrorB := &test.StubFHIRClient{}
+		component, queryDirectory := setup(t, mirrorA, mirrorB)
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+		require.NoError(t, err)
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		require.Len(t, mirrorB.CreatedResources["Organization"], 1)
+		assert.Equal(t, &QueryMirrorReport{CountPending: 1, Error: "mirror unavailable"}, report.QueryMirrors["a"])
+		assert.Equal(t, &QueryMirrorReport{CountCreated: 1}, report.QueryMirrors["b"])
+		assert.Contains(t, report.Warnings, "failed to apply mCSD update to query mirror a (1 entries pending): mirror unavailable")
+	})
+	t.Run("failing query mirror doesn't hold back the time of the last update", func(t *testing.T) {
+		mirrorA := &test.StubFHIRClient{Error: errors.New("mirror unavailable")}
+		component, _ := setup(t, mirrorA)
+
+		for range 2 {
+			report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+			require.NoError(t, err)
+			assert.Equal(t, "2025-01-01T12:00:00Z", component.lastUpdateTimes[directoryURL]["Organization"])
+			assert.NotEmpty(t, report.QueryMirrors["a"].Error)
+		}
+		// The changes of both updates are pending
+		assert.Equal(t, 2, component.pendingMirrorChunkCount("a", directoryURL))
+
+		t.Run("pending changes are applied when the query mirror recovers", func(t *testing.T) {
+			mirrorA.Error = nil
+
+			report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+			require.NoError(t, err)
+			assert.Empty(t, report.QueryMirrors["a"].Error)
+			assert.Zero(t, report.QueryMirrors["a"].CountPending)
+			assert.Len(t, mirrorA.CreatedResources["Organization"], 3)
+			assert.Zero(t, component.pendingMirrorChunkCount("a", directoryURL))
+		})
+	})
+	t.Run("query mirrors are applied even if the query directory fails", func(t *testing.T) {
+		mirrorA := &test.StubFHIRClient{}
+		component, queryDirectory := setup(t, mirrorA)
+		queryDirectory.Error = errors.New("query directory unavailable")
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "")
+
+		require.EqualError(t, err, "failed to apply mCSD update to query directory: query directory unavailable")
+		require.Len(t, mirrorA.CreatedResources["Organization"], 1)
+		assert.Equal(t, &QueryMirrorReport{CountCreated: 1}, report.QueryMirrors["a"])
+	})
+}
+
+func TestComponent_New_queryMirrors(t *testing.T) {
+	config := DefaultConfig()
+	config.QueryMirrors = map[string]DirectoryConfig{
+		"replica": {FHIRBaseURL: "http://replica.example.com/fhir"},
+		"backup":  {FHIRBaseURL: "http://backup.example.com/fhir"},
+	}
+
+	component, err := New(config)
+
+	require.NoError(t, err)
+	require.Len(t, component.queryMirrors, 2)
+	assert.Equal(t, "backup", component.queryMirrors[0].key)
+	assert.Equal(t, "replica", component.queryMirrors[1].key)
+}
+
+func (c *Component) pendingMirrorChunkCount(mirrorKey string, directoryKey string) int {
+	c.queryMirrorMux.Lock()
+	defer c.queryMirrorMux.Unlock()
+	return len(c.pendingMirrorChunks[mirrorKey][directoryKey])
+}
@@ -0,0 +1,96 @@
+package mcsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+const (
+	// CrossHostRedirectsFollow follows redirects to other hosts, like any other redirect.
+	CrossHostRedirectsFollow = "follow"
+	// CrossHostRedirectsReject fails requests to a mCSD Directory that redirect to another host.
+	CrossHostRedirectsReject = "reject"
+	// CrossHostRedirectsRebase follows redirects to other hosts, and uses the redirect target as base URL of the mCSD Directory in subsequent updates.
+	CrossHostRedirectsRebase = "rebase"
+)
+
+// maxRedirects is the maximum number of redirects that are followed, the same as the default of http.Client.
+const maxRedirects = 10
+
+// errCrossHostRedirect is returned when a mCSD Directory redirects to another host, while that isn't allowed.
+var errCrossHostRedirect = errors.New("cross-host redirect not allowed")
+
+type redirectLogContextKey struct{}
+
+// redirectLog records the first cross-host redirect of a mCSD Directory during an update.
+type redirectLog struct {
+	baseURL     *url.URL
+	originalURL *url.URL
+	redirectURL *url.URL
+}
+
+// withRedirectLog returns a context in which cross-host redirects of requests to the given base URL are recorded in the returned redirectLog.
+func withRedirectLog(ctx context.Context, baseURL *url.URL) (context.Context, *redirectLog) {
+	log := &redirectLog{baseURL: baseURL}
+	return context.WithValue(ctx, redirectLogContextKey{}, log), log
+}
+
+// rebasedURL returns the base URL the directory redirected to.
+// It's derived by replacing the base URL of the original request with that of the redirect target,
+// which requires the path relative to the base URL to be retained. If it isn't, nil is returned.
+func (r *redirectLog) rebasedURL() *url.URL {
+	basePath := strings.TrimRight(r.baseURL.Path, "/")
+	relativePath, ok := strings.CutPrefix(r.originalURL.Path, basePath)
+	if !ok {
+		return nil
+	}
+	redirectBasePath, ok := strings.CutSuffix(r.redirectURL.Path, relativePath)
+	if !ok {
+		return nil
+	}
+	return &url.URL{Scheme: r.redirectURL.Scheme, Host: r.redirectURL.Host, Path: redirectBasePath}
+}
+
+// checkRedirect is used as http.Client.CheckRedirect for requests to mCSD Directories, applying the configured CrossHostRedirects behavior.
+func (c *Component) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	originalURL := via[0].URL
+	if strings.EqualFold(req.URL.Host, originalURL.Host) {
+		return nil
+	}
+	switch c.config.CrossHostRedirects {
+	case CrossHostRedirectsReject:
+		return fmt.Errorf("%w: %s redirected to %s", errCrossHostRedirect, originalURL.Host, req.URL.Host)
+	case CrossHostRedirectsRebase:
+		if log, ok := req.Context().Value(redirectLogContextKey{}).(*redirectLog); ok && log.redirectURL == nil {
+			log.originalURL, log.redirectURL = originalURL, req.URL
+		}
+	}
+	return nil
+}
+
+// rebaseDirectory makes subsequent updates query the directory at the base URL it redirected to.
+func (c *Component) rebaseDirectory(ctx context.Context, directoryKey string, fhirBaseURL string, redirects *redirectLog, report *DirectoryUpdateReport) {
+	rebasedURL := redirects.rebasedURL()
+	if rebasedURL == nil {
+		msg := fmt.Sprintf("mCSD Directory redirected to another host (%s), but its base URL can't be derived from it", redirects.redirectURL)
+		slog.WarnContext(ctx, msg, logging.FHIRServer(fhirBaseURL))
+		report.Warnings = append(report.Warnings, msg)
+		return
+	}
+	msg := fmt.Sprintf("mCSD Directory redirected to another host, using %s as its base URL from now on", rebasedURL)
+	slog.WarnContext(ctx, msg, logging.FHIRServer(fhirBaseURL))
+	report.Warnings = append(report.Warnings, msg)
+	c.directoryMux.Lock()
+	c.rebasedURLs[directoryKey] = rebasedURL
+	c.directoryMux.Unlock()
+}
@@ -0,0 +1,89 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestComponent_crossHostRedirects(t *testing.T) {
+	ctx := context.Background()
+	canonicalServer := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/prune_dangling_endpoint_refs_history_response.json",
+		"/fhir/Organization":          "test/prune_dangling_endpoint_refs_history_response.json",
+	})
+	defer canonicalServer.Close()
+	var redirected atomic.Int32
+	redirectingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+		http.Redirect(w, r, canonicalServer.URL+r.URL.RequestURI(), http.StatusFound)
+	}))
+	defer redirectingServer.Close()
+	directoryURL := redirectingServer.URL + "/fhir"
+
+	setup := func(t *testing.T, crossHostRedirects string) (*Component, *test.StubFHIRClient) {
+		redirected.Store(0)
+		config := DefaultConfig()
+		config.CrossHostRedirects = crossHostRedirects
+		config.MaxRetries = 0
+		component, err := New(config)
+		require.NoError(t, err)
+		queryDirectory := &test.StubFHIRClient{}
+		component.fhirQueryClient = queryDirectory
+		return component, queryDirectory
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		component, queryDirectory := setup(t, CrossHostRedirectsFollow)
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+		require.NoError(t, err)
+		assert.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		assert.NotContains(t, report.Warnings, "mCSD Directory redirected to another host, using "+canonicalServer.URL+"/fhir as its base URL from now on")
+	})
+	t.Run("reject", func(t *testing.T) {
+		component, queryDirectory := setup(t, CrossHostRedirectsReject)
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+		require.ErrorIs(t, err, errCrossHostRedirect)
+		assert.Equal(t, int32(1), redirected.Load(), "rejected redirects should not be retried")
+		assert.Empty(t, queryDirectory.CreatedResources)
+	})
+	t.Run("rebase", func(t *testing.T) {
+		component, queryDirectory := setup(t, CrossHostRedirectsRebase)
+
+		report, err := component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+		require.NoError(t, err)
+		assert.Contains(t, report.Warnings, "mCSD Directory redirected to another host, using "+canonicalServer.URL+"/fhir as its base URL from now on")
+		require.Len(t, queryDirectory.CreatedResources["Organization"], 1)
+		var organization fhir.Organization
+		require.NoError(t, json.Unmarshal(queryDirectory.CreatedResources["Organization"][0].(json.RawMessage), &organization))
+		assert.Equal(t, directoryURL+"/Organization/org-1", *organization.Meta.Source, "the directory should still be identified by its configured base URL")
+
+		// Subsequent updates query the directory at the host it redirected to
+		redirected.Store(0)
+		_, err = component.updateFromDirectory(ctx, directoryURL, []string{"Organization"}, false, "1")
+
+		require.NoError(t, err)
+		assert.Zero(t, redirected.Load())
+	})
+	t.Run("invalid option", func(t *testing.T) {
+		config := DefaultConfig()
+		config.CrossHostRedirects = "ignore"
+
+		_, err := New(config)
+
+		assert.EqualError(t, err, "invalid cross-host redirects behavior: ignore (valid options: follow, reject, rebase)")
+	})
+}
@@ -0,0 +1,112 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// reportHistorySize is the number of update reports retained in the report history.
+const reportHistorySize = 10
+
+// storedReport is an update report retained in the report history.
+type storedReport struct {
+	Time   time.Time
+	Report UpdateReport
+}
+
+// DirectoryReportDiff describes the differences between the update reports of a mCSD Directory of two runs.
+type DirectoryReportDiff struct {
+	// CountCreated, CountUpdated and CountDeleted contain the change in counts (to minus from).
+	CountCreated int `json:"created"`
+	CountUpdated int `json:"updated"`
+	CountDeleted int `json:"deleted"`
+	// NewWarnings contains the warnings that weren't reported in the earlier run.
+	NewWarnings []string `json:"new_warnings"`
+	// ResolvedWarnings contains the warnings that are no longer reported in the later run.
+	ResolvedWarnings []string `json:"resolved_warnings"`
+}
+
+// ReportDiff contains the differences between two update reports, by directory key.
+type ReportDiff map[string]DirectoryReportDiff
+
+// recordReport adds the report of an update to the report history, evicting the oldest report if it's full.
+func (c *Component) recordReport(report UpdateReport) {
+	c.reportHistoryMux.Lock()
+	defer c.reportHistoryMux.Unlock()
+	c.reportHistory = append(c.reportHistory, storedReport{Time: c.nowFunc(), Report: report})
+	if len(c.reportHistory) > reportHistorySize {
+		c.reportHistory = slices.Delete(c.reportHistory, 0, len(c.reportHistory)-reportHistorySize)
+	}
+}
+
+// handleReportDiff returns the differences between two reports in the report history, identified by their index
+// (0 being the oldest retained report).
+func (c *Component) handleReportDiff(w http.ResponseWriter, r *http.Request) {
+	c.reportHistoryMux.Lock()
+	history := slices.Clone(c.reportHistory)
+	c.reportHistoryMux.Unlock()
+
+	from, err := reportIndex(r, "from", len(history))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := reportIndex(r, "to", len(history))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(diffReports(history[from].Report, history[to].Report))
+}
+
+func reportIndex(r *http.Request, name string, historyLen int) (int, error) {
+	index, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return 0, fmt.Errorf("query parameter '%s' must be an integer", name)
+	}
+	if index < 0 || index >= historyLen {
+		return 0, fmt.Errorf("query parameter '%s' out of range: %d reports available", name, historyLen)
+	}
+	return index, nil
+}
+
+// diffReports returns the differences between two update reports. Directories missing from a report count as having no changes nor warnings.
+func diffReports(from, to UpdateReport) ReportDiff {
+	result := make(ReportDiff)
+	for directoryKey := range from {
+		result[directoryKey] = diffDirectoryReports(from[directoryKey], to[directoryKey])
+	}
+	for directoryKey := range to {
+		if _, ok := result[directoryKey]; !ok {
+			result[directoryKey] = diffDirectoryReports(from[directoryKey], to[directoryKey])
+		}
+	}
+	return result
+}
+
+func diffDirectoryReports(from, to DirectoryUpdateReport) DirectoryReportDiff {
+	return DirectoryReportDiff{
+		CountCreated:     to.CountCreated - from.CountCreated,
+		CountUpdated:     to.CountUpdated - from.CountUpdated,
+		CountDeleted:     to.CountDeleted - from.CountDeleted,
+		NewWarnings:      missingFrom(to.Warnings, from.Warnings),
+		ResolvedWarnings: missingFrom(from.Warnings, to.Warnings),
+	}
+}
+
+// missingFrom returns the (deduplicated) values of values that don't occur in other.
+func missingFrom(values []string, other []string) []string {
+	result := []string{}
+	for _, value := range values {
+		if !slices.Contains(other, value) && !slices.Contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package mcsd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_handleReportDiff(t *testing.T) {
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+	component.recordReport(UpdateReport{
+		"https://example.com/fhir": {CountCreated: 10, Warnings: []string{"resource skipped"}, Errors: []string{}},
+	})
+	component.recordReport(UpdateReport{
+		"https://example.com/fhir":       {CountCreated: 2, CountUpdated: 3, Warnings: []string{"organization count dropped"}, Errors: []string{}},
+		"https://other.example.com/fhir": {CountCreated: 1},
+	})
+	internalMux := http.NewServeMux()
+	component.RegisterHttpHandlers(http.NewServeMux(), internalMux)
+	invoke := func(query string) *httptest.ResponseRecorder {
+		httpResponse := httptest.NewRecorder()
+		internalMux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsd/reports/diff?"+query, nil))
+		return httpResponse
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		httpResponse := invoke("from=0&to=1")
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		var diff ReportDiff
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &diff))
+		assert.Equal(t, DirectoryReportDiff{
+			CountCreated:     -8,
+			CountUpdated:     3,
+			NewWarnings:      []string{"organization count dropped"},
+			ResolvedWarnings: []string{"resource skipped"},
+		}, diff["https://example.com/fhir"])
+		assert.Equal(t, 1, diff["https://other.example.com/fhir"].CountCreated)
+	})
+	t.Run("index out of range", func(t *testing.T) {
+		httpResponse := invoke("from=0&to=2")
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "query parameter 'to' out of range: 2 reports available")
+	})
+	t.Run("invalid index", func(t *testing.T) {
+		httpResponse := invoke("to=1")
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "query parameter 'from' must be an integer")
+	})
+}
+
+func TestComponent_recordReport(t *testing.T) {
+	component, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	for i := 0; i < reportHistorySize+2; i++ {
+		component.recordReport(UpdateReport{"https://example.com/fhir": {CountCreated: i}})
+	}
+
+	require.Len(t, component.reportHistory, reportHistorySize)
+	assert.Equal(t, 2, component.reportHistory[0].Report["https://example.com/fhir"].CountCreated, "oldest reports should be evicted")
+}
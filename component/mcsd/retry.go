@@ -0,0 +1,102 @@
+package mcsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+// retryTransient calls fn, retrying it with exponential backoff when it fails with a transient error (5xx or network error),
+// up to the configured maximum number of retries. fn must set statusCode to the HTTP response status code, if any.
+// Other errors (e.g. 404 Not Found or 410 Gone) are returned immediately.
+// If the call succeeds after retrying, a warning is recorded so flaky servers can be spotted in the update report.
+func (c *Component) retryTransient(ctx context.Context, operation string, statusCode *int, fn func() error) error {
+	backoff := c.config.RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		*statusCode = 0
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				recordRetry(ctx, fmt.Sprintf("%s succeeded after %d attempts", operation, attempt))
+			}
+			return nil
+		}
+		if !isTransientError(ctx, *statusCode, err) {
+			return err
+		}
+		if attempt > c.config.MaxRetries {
+			return transientError{err}
+		}
+		slog.WarnContext(ctx, "Request failed with transient error, retrying",
+			slog.String("operation", operation), slog.Int("status", *statusCode), slog.Int("attempt", attempt), slog.Duration("backoff", backoff), logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transientError wraps a transient error that persisted after retrying.
+type transientError struct {
+	error
+}
+
+func (e transientError) Unwrap() error {
+	return e.error
+}
+
+// isTransientError reports whether the failed request might succeed when retried.
+func isTransientError(ctx context.Context, statusCode int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if statusCode != 0 {
+		return statusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, errCrossHostRedirect) {
+		return false
+	}
+	// No response: only retry network errors, e.g. a connection that was reset, but not unknown hosts
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type retryLogContextKey struct{}
+
+// retryLog collects the warnings about requests that only succeeded after retrying.
+type retryLog struct {
+	warnings []string
+}
+
+// withRetryLog returns a context in which retried requests are recorded in the returned retryLog.
+func withRetryLog(ctx context.Context) (context.Context, *retryLog) {
+	log := &retryLog{}
+	return context.WithValue(ctx, retryLogContextKey{}, log), log
+}
+
+func recordRetry(ctx context.Context, warning string) {
+	if log, ok := ctx.Value(retryLogContextKey{}).(*retryLog); ok {
+		log.warnings = append(log.warnings, warning)
+	}
+}
+
+// take returns the recorded warnings and clears them.
+func (l *retryLog) take() []string {
+	warnings := l.warnings
+	l.warnings = nil
+	return warnings
+}
@@ -0,0 +1,113 @@
+package mcsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_retryTransient(t *testing.T) {
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	organizationHistoryStr := string(organizationHistory)
+	endpointHistoryStr := string(endpointHistory)
+
+	setup := func(t *testing.T, failures int, failureStatus int) (*Component, string, *int) {
+		var calls int
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization":      &organizationHistoryStr,
+			"/fhir/Endpoint/_history": &endpointHistoryStr,
+		})
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if calls <= failures {
+				w.WriteHeader(failureStatus)
+				return
+			}
+			_, _ = w.Write(organizationHistory)
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		config := DefaultConfig()
+		config.RetryBaseDelay = time.Millisecond
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		return component, server.URL + "/fhir", &calls
+	}
+
+	t.Run("retries on 5xx and reports the attempts", func(t *testing.T) {
+		component, directoryURL, calls := setup(t, 2, http.StatusServiceUnavailable)
+
+		report, err := component.updateFromDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+		assert.Contains(t, report.Warnings, "Organization/_history search succeeded after 3 attempts")
+		assert.Equal(t, 8, report.CountCreated)
+	})
+	t.Run("gives up after max retries", func(t *testing.T) {
+		component, directoryURL, calls := setup(t, 10, http.StatusBadGateway)
+
+		_, err := component.updateFromDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, false, "")
+
+		require.Error(t, err)
+		assert.Equal(t, 3, *calls)
+	})
+	t.Run("does not retry 404 or 410", func(t *testing.T) {
+		for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+			t.Run(fmt.Sprint(status), func(t *testing.T) {
+				component, directoryURL, calls := setup(t, 10, status)
+
+				report, err := component.updateFromDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, false, "")
+
+				require.NoError(t, err, "resource type should be skipped as unsupported")
+				assert.Equal(t, 1, *calls)
+				assert.NotContains(t, report.Warnings, "Organization/_history search succeeded after 2 attempts")
+			})
+		}
+	})
+}
+
+func TestIsTransientError(t *testing.T) {
+	ctx := context.Background()
+	requestErr := errors.New("FHIR request failed")
+	testCases := []struct {
+		name       string
+		statusCode int
+		err        error
+		expected   bool
+	}{
+		{name: "503", statusCode: http.StatusServiceUnavailable, err: requestErr, expected: true},
+		{name: "500", statusCode: http.StatusInternalServerError, err: requestErr, expected: true},
+		{name: "400", statusCode: http.StatusBadRequest, err: requestErr, expected: false},
+		{name: "410", statusCode: http.StatusGone, err: requestErr, expected: false},
+		{name: "network error", err: fmt.Errorf("FHIR request failed: %w", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}), expected: true},
+		{name: "unknown host", err: fmt.Errorf("FHIR request failed: %w", &net.DNSError{Err: "no such host", IsNotFound: true}), expected: false},
+		{name: "other error without response", err: requestErr, expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isTransientError(ctx, tc.statusCode, tc.err))
+		})
+	}
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.False(t, isTransientError(ctx, http.StatusServiceUnavailable, requestErr))
+	})
+}
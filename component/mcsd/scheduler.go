@@ -0,0 +1,66 @@
+package mcsd
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+// startScheduler starts a goroutine that updates all mCSD Directories every configured sync interval, until stopScheduler is called.
+func (c *Component) startScheduler() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.schedulerCancel = cancel
+	c.schedulerDone = make(chan struct{})
+	go func() {
+		defer close(c.schedulerDone)
+		ticker := time.NewTicker(c.config.SyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.scheduledUpdate(ctx)
+			}
+		}
+	}()
+}
+
+// stopScheduler stops the scheduler started by startScheduler, waiting for a running update to finish or ctx to expire.
+func (c *Component) stopScheduler(ctx context.Context) error {
+	if c.schedulerCancel == nil {
+		return nil
+	}
+	c.schedulerCancel()
+	select {
+	case <-c.schedulerDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// scheduledUpdate performs an update of all mCSD Directories and logs the summary.
+// It shares updateMux with manual updates, so they never overlap.
+func (c *Component) scheduledUpdate(ctx context.Context) {
+	report, err := c.update(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Scheduled mCSD update failed", logging.Error(err))
+		return
+	}
+	var created, updated, deleted, errs int
+	for _, directoryReport := range report {
+		created += directoryReport.CountCreated
+		updated += directoryReport.CountUpdated
+		deleted += directoryReport.CountDeleted
+		errs += len(directoryReport.Errors)
+	}
+	slog.InfoContext(ctx, "Scheduled mCSD update completed",
+		slog.Int("directories", len(report)),
+		slog.Int("created", created),
+		slog.Int("updated", updated),
+		slog.Int("deleted", deleted),
+		slog.Int("errors", errs))
+}
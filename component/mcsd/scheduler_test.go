@@ -0,0 +1,58 @@
+package mcsd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_scheduler(t *testing.T) {
+	server := startMockServer(t, map[string]string{
+		"/fhir/Organization/_history": "test/root_dir_organization_history_response.json",
+		"/fhir/Organization":          "test/root_dir_organization_history_response.json",
+		"/fhir/Endpoint/_history":     "test/root_dir_endpoint_history_response.json",
+	})
+	defer server.Close()
+	rootDirURL := server.URL + "/fhir"
+	newComponent := func(t *testing.T, syncInterval time.Duration) *Component {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: rootDirURL},
+		}
+		config.SyncInterval = syncInterval
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		return component
+	}
+
+	t.Run("updates periodically", func(t *testing.T) {
+		component := newComponent(t, 10*time.Millisecond)
+		require.NoError(t, component.Start())
+
+		assert.Eventually(t, func() bool {
+			return len(component.status().LastUpdateTimes[rootDirURL]) > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, component.Stop(context.Background()))
+		select {
+		case <-component.schedulerDone:
+		default:
+			t.Fatal("scheduler should have stopped")
+		}
+	})
+	t.Run("disabled when interval is zero", func(t *testing.T) {
+		component := newComponent(t, 0)
+		require.NoError(t, component.Start())
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Nil(t, component.schedulerCancel)
+		assert.Empty(t, component.status().LastUpdateTimes)
+		require.NoError(t, component.Stop(context.Background()))
+	})
+}
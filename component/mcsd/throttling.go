@@ -0,0 +1,108 @@
+package mcsd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// throttlingTransport retries requests to a mCSD Directory that are rate-limited (HTTP 429 Too Many Requests),
+// after waiting for the time indicated by the Retry-After header (capped at maxWait).
+// If the response has no (valid) Retry-After header, it backs off exponentially starting at baseDelay.
+type throttlingTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	baseDelay  time.Duration
+	maxWait    time.Duration
+	nowFunc    func() time.Time
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.baseDelay
+	for attempt := 1; ; attempt++ {
+		response, err := t.next.RoundTrip(req)
+		if err != nil || response.StatusCode != http.StatusTooManyRequests || attempt > t.maxRetries {
+			return response, err
+		}
+		// The request can only be sent again if its body can be
+		if req.Body != nil && req.GetBody == nil {
+			return response, nil
+		}
+		wait, ok := parseRetryAfter(response.Header.Get("Retry-After"), t.nowFunc())
+		if !ok {
+			wait = backoff
+			backoff *= 2
+		}
+		wait = min(wait, t.maxWait)
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+
+		slog.WarnContext(req.Context(), "Request was rate-limited by mCSD Directory, retrying",
+			slog.String("url", req.URL.String()), slog.Int("attempt", attempt), slog.Duration("wait", wait))
+		recordThrottling(req.Context(), wait)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
+
+type throttleLogContextKey struct{}
+
+// throttleLog records how often, and how long, requests were delayed because a mCSD Directory rate-limited them.
+type throttleLog struct {
+	count int
+	wait  time.Duration
+}
+
+// withThrottleLog returns a context in which rate-limited requests are recorded in the returned throttleLog.
+func withThrottleLog(ctx context.Context) (context.Context, *throttleLog) {
+	log := &throttleLog{}
+	return context.WithValue(ctx, throttleLogContextKey{}, log), log
+}
+
+func recordThrottling(ctx context.Context, wait time.Duration) {
+	if log, ok := ctx.Value(throttleLogContextKey{}).(*throttleLog); ok {
+		log.count++
+		log.wait += wait
+	}
+}
+
+// warning returns a warning for the update report if requests were rate-limited, or an empty string if they weren't.
+func (l *throttleLog) warning() string {
+	if l.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("mCSD Directory rate-limited %d request(s) (HTTP 429), waited %s in total", l.count, l.wait)
+}
@@ -0,0 +1,104 @@
+package mcsd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_throttling(t *testing.T) {
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	organizationHistoryStr := string(organizationHistory)
+	endpointHistoryStr := string(endpointHistory)
+
+	setup := func(t *testing.T, throttledCalls int, retryAfter string) (*Component, string, *int) {
+		var calls int
+		mux := http.NewServeMux()
+		mockEndpoints(mux, map[string]*string{
+			"/fhir/Organization":      &organizationHistoryStr,
+			"/fhir/Endpoint/_history": &endpointHistoryStr,
+		})
+		mux.HandleFunc("/fhir/Organization/_history", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= throttledCalls {
+				w.Header().Set("Retry-After", retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(organizationHistory)
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		config := DefaultConfig()
+		config.RetryBaseDelay = time.Millisecond
+		config.MaxRetryAfter = 10 * time.Millisecond
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		return component, server.URL + "/fhir", &calls
+	}
+
+	t.Run("waits for Retry-After (capped) and reports the throttling", func(t *testing.T) {
+		component, directoryURL, calls := setup(t, 2, "120")
+
+		report, err := component.updateFromDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+		assert.Contains(t, report.Warnings, "mCSD Directory rate-limited 2 request(s) (HTTP 429), waited 20ms in total")
+	})
+	t.Run("gives up after max retries", func(t *testing.T) {
+		component, directoryURL, calls := setup(t, 10, "0")
+
+		_, err := component.updateFromDirectory(context.Background(), directoryURL, rootDirectoryResourceTypes, false, "")
+
+		require.ErrorContains(t, err, "status=429")
+		assert.Equal(t, 3, *calls, "429 should be retried by the transport only")
+	})
+	t.Run("stops waiting when cancelled", func(t *testing.T) {
+		component, directoryURL, _ := setup(t, 10, "120")
+		component.config.MaxRetryAfter = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := component.updateFromDirectory(ctx, directoryURL, rootDirectoryResourceTypes, false, "")
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 8, 14, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "seconds", value: "5", expected: 5 * time.Second, ok: true},
+		{name: "HTTP-date", value: "Thu, 14 Aug 2025 10:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{name: "HTTP-date in the past", value: "Thu, 14 Aug 2025 09:00:00 GMT", expected: 0, ok: true},
+		{name: "empty", value: "", ok: false},
+		{name: "negative", value: "-1", ok: false},
+		{name: "invalid", value: "soon", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := parseRetryAfter(tt.value, now)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
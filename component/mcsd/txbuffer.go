@@ -0,0 +1,90 @@
+package mcsd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// bufferedTransaction is a transaction that couldn't be applied to the query directory (e.g. because it was unavailable),
+// stored so it can be applied on the next update without fetching and building it again.
+type bufferedTransaction struct {
+	Directory string `json:"directory"`
+	// NextSyncTimes are the times of the last update to store by resource type when the transaction has been applied.
+	// An empty time removes the time of the last update of the resource type.
+	NextSyncTimes map[string]string `json:"next_sync_times,omitempty"`
+	Transaction   fhir.Bundle       `json:"transaction"`
+}
+
+// transactionBufferFile returns the path of the file that holds the buffered transaction of the given directory.
+func (c *Component) transactionBufferFile(directoryKey string) string {
+	hash := sha256.Sum256([]byte(directoryKey))
+	return filepath.Join(c.config.TransactionBufferDir, hex.EncodeToString(hash[:8])+".json")
+}
+
+func (c *Component) bufferTransaction(directoryKey string, nextSyncTimes map[string]string, tx fhir.Bundle) error {
+	data, err := json.Marshal(bufferedTransaction{
+		Directory:     directoryKey,
+		NextSyncTimes: nextSyncTimes,
+		Transaction:   tx,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.config.TransactionBufferDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.transactionBufferFile(directoryKey), data, 0600)
+}
+
+// replayBufferedTransaction applies the buffered transaction of the given directory (if any) to the query directory,
+// and returns its outcome. The buffer is removed once the transaction has been applied.
+func (c *Component) replayBufferedTransaction(ctx context.Context, directoryKey string, fhirBaseURL string) (DirectoryUpdateReport, error) {
+	var report DirectoryUpdateReport
+	if c.config.TransactionBufferDir == "" {
+		return report, nil
+	}
+	bufferFile := c.transactionBufferFile(directoryKey)
+	data, err := os.ReadFile(bufferFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return report, nil
+	} else if err != nil {
+		return report, fmt.Errorf("failed to read buffered transaction: %w", err)
+	}
+	var buffered bufferedTransaction
+	if err := json.Unmarshal(data, &buffered); err != nil || buffered.Directory != directoryKey {
+		// Can't be applied, the changes will be fetched again since the time of the last update wasn't changed
+		slog.WarnContext(ctx, "Discarding invalid buffered mCSD update transaction", logging.FHIRServer(fhirBaseURL), slog.String("file", bufferFile))
+		return report, os.Remove(bufferFile)
+	}
+	slog.InfoContext(ctx, "Applying buffered mCSD update transaction", logging.FHIRServer(fhirBaseURL), slog.Int("count", len(buffered.Transaction.Entry)))
+	// Applied in chunks like any other update, since the buffered transaction can be larger than the query directory accepts
+	failedTx, err := c.submitTransactionInChunks(ctx, directoryKey, c.fhirQueryClient, buffered.Transaction, &report)
+	if err != nil {
+		// Only the entries of the failed chunks are kept, so the buffer drains even if some chunks keep failing
+		if len(failedTx.Entry) < len(buffered.Transaction.Entry) {
+			if bufferErr := c.bufferTransaction(directoryKey, buffered.NextSyncTimes, failedTx); bufferErr != nil {
+				slog.ErrorContext(ctx, "Failed to buffer remaining mCSD update transaction", logging.FHIRServer(fhirBaseURL), logging.Error(bufferErr))
+			}
+		}
+		return report, fmt.Errorf("failed to apply buffered mCSD update to query directory: %w", err)
+	}
+	if err := os.Remove(bufferFile); err != nil {
+		return report, fmt.Errorf("failed to remove buffered transaction: %w", err)
+	}
+	report.Warnings = append(report.Warnings, fmt.Sprintf("applied buffered transaction of a previous update (%d entries)", len(buffered.Transaction.Entry)))
+	if buffered.NextSyncTimes != nil {
+		c.setLastUpdateTimes(directoryKey, buffered.NextSyncTimes)
+	}
+	return report, nil
+}
@@ -0,0 +1,145 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	fhirclient "github.com/SanteonNL/go-fhir-client"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestComponent_transactionBuffer(t *testing.T) {
+	ctx := context.Background()
+	organizationHistory, err := os.ReadFile("test/root_dir_organization_history_response.json")
+	require.NoError(t, err)
+	organizationHistoryStr := string(organizationHistory)
+	endpointHistory, err := os.ReadFile("test/root_dir_endpoint_history_response.json")
+	require.NoError(t, err)
+	endpointHistoryStr := string(endpointHistory)
+
+	mux := http.NewServeMux()
+	mockEndpoints(mux, map[string]*string{
+		"/fhir/Organization":          &organizationHistoryStr,
+		"/fhir/Organization/_history": &organizationHistoryStr,
+		"/fhir/Endpoint/_history":     &endpointHistoryStr,
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	directoryURL := server.URL + "/fhir"
+
+	config := DefaultConfig()
+	config.AdministrationDirectories = map[string]DirectoryConfig{
+		"root": {FHIRBaseURL: directoryURL},
+	}
+	config.TransactionBufferDir = filepath.Join(t.TempDir(), "buffer")
+	config.QueryDirectoryConflictRetries = 0
+	config.RetryBaseDelay = time.Millisecond
+	component, err := New(config)
+	require.NoError(t, err)
+	queryDirectory := &test.StubFHIRClient{Error: errors.New("query directory unavailable")}
+	component.fhirQueryClient = queryDirectory
+
+	// Query directory fails: transaction is buffered, time of last update isn't changed
+	report, err := component.update(ctx)
+	require.NoError(t, err)
+	require.Len(t, report[directoryURL].Errors, 1)
+	assert.Contains(t, report[directoryURL].Errors[0], "query directory unavailable")
+	assert.Empty(t, component.lastUpdateTimes)
+	bufferFiles, err := os.ReadDir(config.TransactionBufferDir)
+	require.NoError(t, err)
+	require.Len(t, bufferFiles, 1)
+
+	// Query directory is available again, while the mCSD Directory is down: buffered transaction is applied
+	queryDirectory.Error = nil
+	server.Close()
+	report, err = component.update(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, report[directoryURL].Warnings, "applied buffered transaction of a previous update (4 entries)")
+	assert.Len(t, queryDirectory.CreatedResources["Endpoint"], 4)
+	assert.Equal(t, map[string]string{"Organization": "2025-08-14T10:00:00Z", "Endpoint": "2025-08-14T10:00:00Z"}, component.lastUpdateTimes[directoryURL])
+	bufferFiles, err = os.ReadDir(config.TransactionBufferDir)
+	require.NoError(t, err)
+	assert.Empty(t, bufferFiles)
+}
+
+func TestComponent_replayBufferedTransaction(t *testing.T) {
+	ctx := context.Background()
+	const directoryKey = "https://example.com/fhir"
+	tx := fhir.Bundle{Type: fhir.BundleTypeTransaction}
+	for i := range 5 {
+		id := "org-" + strconv.Itoa(i)
+		tx.Entry = append(tx.Entry, fhir.BundleEntry{
+			Resource: []byte(`{"resourceType":"Organization","id":"` + id + `"}`),
+			Request:  &fhir.BundleEntryRequest{Method: fhir.HTTPVerbPUT, Url: "Organization?_source=" + url.QueryEscape(directoryKey+"/Organization/"+id)},
+		})
+	}
+	// setup starts a query directory that rejects transactions larger than the chunk size, and the transaction with the given number
+	setup := func(t *testing.T, failingTransaction int) (*Component, *[]int) {
+		var transactionSizes []int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var requestTx fhir.Bundle
+			_ = json.NewDecoder(r.Body).Decode(&requestTx)
+			transactionSizes = append(transactionSizes, len(requestTx.Entry))
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if len(requestTx.Entry) > 2 || len(transactionSizes) == failingTransaction {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			response := fhir.Bundle{Type: fhir.BundleTypeTransactionResponse}
+			for range requestTx.Entry {
+				response.Entry = append(response.Entry, fhir.BundleEntry{Response: &fhir.BundleEntryResponse{Status: "201 Created"}})
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		}))
+		t.Cleanup(server.Close)
+		config := DefaultConfig()
+		config.TransactionBufferDir = t.TempDir()
+		config.TransactionChunkSize = 2
+		component, err := New(config)
+		require.NoError(t, err)
+		baseURL, _ := url.Parse(server.URL + "/fhir")
+		component.fhirQueryClient = fhirclient.New(baseURL, http.DefaultClient, &fhirclient.Config{})
+		require.NoError(t, component.bufferTransaction(directoryKey, map[string]string{"Organization": "2025-08-14T10:00:00Z"}, tx))
+		return component, &transactionSizes
+	}
+
+	t.Run("applied in chunks", func(t *testing.T) {
+		component, transactionSizes := setup(t, -1)
+
+		report, err := component.replayBufferedTransaction(ctx, directoryKey, directoryKey)
+
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 2, 1}, *transactionSizes)
+		assert.Equal(t, 5, report.CountCreated)
+		assert.Equal(t, map[string]string{"Organization": "2025-08-14T10:00:00Z"}, component.lastUpdateTimes[directoryKey])
+		assert.NoFileExists(t, component.transactionBufferFile(directoryKey))
+	})
+	t.Run("failing chunk stays buffered", func(t *testing.T) {
+		component, transactionSizes := setup(t, 2)
+
+		report, err := component.replayBufferedTransaction(ctx, directoryKey, directoryKey)
+
+		require.ErrorContains(t, err, "transaction 2 of 3")
+		assert.Equal(t, []int{2, 2, 1}, *transactionSizes)
+		assert.Equal(t, 3, report.CountCreated)
+		assert.Empty(t, component.lastUpdateTimes)
+		data, err := os.ReadFile(component.transactionBufferFile(directoryKey))
+		require.NoError(t, err)
+		var buffered bufferedTransaction
+		require.NoError(t, json.Unmarshal(data, &buffered))
+		assert.Equal(t, tx.Entry[2:4], buffered.Transaction.Entry)
+		assert.Equal(t, map[string]string{"Organization": "2025-08-14T10:00:00Z"}, buffered.NextSyncTimes)
+	})
+}
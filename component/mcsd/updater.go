@@ -11,12 +11,54 @@ import (
 
 	"log/slog"
 
-	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
 	libfhir "github.com/nuts-foundation/nuts-knooppunt/lib/fhirutil"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
 )
 
+// DirectoryTagSystem is the system of the meta.tag that identifies the mCSD Directory (by directory key) a resource was synchronized from.
+const DirectoryTagSystem = "http://nuts-foundation.github.io/nuts-knooppunt/CodeSystem/mcsd-directory"
+
+// SourceLastUpdatedExtensionURL is the URL of the extension (valueInstant) that holds the meta.lastUpdated of a resource
+// in the mCSD Directory it was synchronized from.
+const SourceLastUpdatedExtensionURL = "http://nuts-foundation.github.io/nuts-knooppunt/StructureDefinition/source-last-updated"
+
+// updateOptions holds settings that alter how entries from a mCSD Directory are converted into the update transaction.
+type updateOptions struct {
+	// skipResourcesWithoutID causes resources of which no ID can be determined to be skipped (logged as warning),
+	// instead of failing the entry.
+	skipResourcesWithoutID bool
+	// syncEnteredInError causes resources with status entered-in-error to be synced, instead of being skipped.
+	syncEnteredInError bool
+	// skipInactive causes inactive Organizations, HealthcareServices and Endpoints to be skipped, instead of being synced.
+	skipInactive bool
+	// directoryTag is the directory key to tag resources with (see DirectoryTagSystem). If empty, resources aren't tagged.
+	directoryTag string
+	// stripMetaLabels causes the security labels and tags (meta.security and meta.tag) of the source resource to be removed,
+	// instead of being synced.
+	stripMetaLabels bool
+	// preserveSourceLastUpdated causes the meta.lastUpdated of the source resource to be stored in the
+	// SourceLastUpdatedExtensionURL extension, instead of being discarded.
+	preserveSourceLastUpdated bool
+	// directoryEndpointCodings are the payloadType codings that identify mCSD Directory endpoints,
+	// which are synced even from discoverable directories.
+	directoryEndpointCodings []DirectoryEndpointCoding
+}
+
+// isInactive reports whether the resource is explicitly marked as inactive: Organizations and HealthcareServices with active=false,
+// and Endpoints with status off or suspended.
+func isInactive(resourceType string, resource map[string]any) bool {
+	switch resourceType {
+	case "Organization", "HealthcareService":
+		active, ok := resource["active"].(bool)
+		return ok && !active
+	case "Endpoint":
+		status := resourceStatus(resource)
+		return status == "off" || status == "suspended"
+	}
+	return false
+}
+
 // buildUpdateTransaction constructs a FHIR Bundle transaction for updating resources.
 // It filters entries based on allowed resource types and sets the source in the resource meta.
 // The function takes a context, a Bundle to populate, a Bundle entry,
@@ -25,7 +67,7 @@ import (
 //
 // Resources are only synced to the query directory if they come from non-discoverable directories.
 // Discoverable directories are for discovery only and their resources should not be synced.
-func buildUpdateTransaction(ctx context.Context, tx *fhir.Bundle, entry fhir.BundleEntry, validationRules ValidationRules, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, allHealthcareServices []fhir.HealthcareService, isDiscoverableDirectory bool, sourceBaseURL string) (string, error) {
+func buildUpdateTransaction(ctx context.Context, tx *fhir.Bundle, entry fhir.BundleEntry, validationRules ValidationRules, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, allHealthcareServices []fhir.HealthcareService, isDiscoverableDirectory bool, sourceBaseURL string, options updateOptions) (string, error) {
 	if entry.FullUrl == nil {
 		return "", errors.New("missing 'fullUrl' field")
 	}
@@ -84,6 +126,14 @@ func buildUpdateTransaction(ctx context.Context, tx *fhir.Bundle, entry fhir.Bun
 		return "", fmt.Errorf("not a valid resourceType (fullUrl=%s)", to.EmptyString(entry.FullUrl))
 	}
 
+	// Resources that were entered in error shouldn't end up in the query directory
+	if !options.syncEnteredInError && resourceStatus(resource) == "entered-in-error" {
+		return "", fmt.Errorf("%s has status entered-in-error, skipping (fullUrl=%s)", resourceType, to.EmptyString(entry.FullUrl))
+	}
+	if options.skipInactive && isInactive(resourceType, resource) {
+		return "", fmt.Errorf("%s is inactive, skipping (fullUrl=%s)", resourceType, to.EmptyString(entry.FullUrl))
+	}
+
 	if err := ValidateUpdate(ctx, validationRules, entry.Resource, parentOrganizationMap, allHealthcareServices); err != nil {
 		return "", err
 	}
@@ -101,23 +151,33 @@ func buildUpdateTransaction(ctx context.Context, tx *fhir.Bundle, entry fhir.Bun
 			}
 
 			// Import mCSD directory endpoints even from discoverable directories
-			doSync = coding.CodablesIncludesCode(endpoint.PayloadType, coding.PayloadCoding)
+			doSync = isDirectoryEndpoint(endpoint, options.directoryEndpointCodings)
 		}
 	}
 	if !doSync {
 		return resourceType, nil
 	}
 
-	// Extract resource ID for constructing source URL (searchset resources always have IDs)
-	resourceID, ok := resource["id"].(string)
-	if !ok {
+	// Extract resource ID for constructing source URL, falling back to the entry's request URL or fullUrl if the resource has none
+	resourceID, _ := resource["id"].(string)
+	if resourceID == "" {
+		resourceID = resourceIDFromEntryURL(entry, resourceType)
+	}
+	if resourceID == "" {
+		if options.skipResourcesWithoutID {
+			slog.WarnContext(ctx, "Skipping resource without ID", slog.String("resource_type", resourceType), slog.String("full_url", to.EmptyString(entry.FullUrl)))
+			return resourceType, nil
+		}
 		return "", fmt.Errorf("resource missing ID field (fullUrl=%s)", to.EmptyString(entry.FullUrl))
 	}
 	sourceURL, err := libfhir.BuildSourceURL(sourceBaseURL, resourceType, resourceID)
 	if err != nil {
 		return "", fmt.Errorf("failed to build source URL: %w", err)
 	}
-	updateResourceMeta(resource, sourceURL)
+	updateResourceMeta(resource, sourceURL, options)
+	if options.directoryTag != "" {
+		setDirectoryTag(resource, options.directoryTag)
+	}
 
 	// Remove resource ID - let FHIR server assign new IDs via conditional operations
 	delete(resource, "id")
@@ -146,6 +206,126 @@ func buildUpdateTransaction(ctx context.Context, tx *fhir.Bundle, entry fhir.Bun
 	return resourceType, nil
 }
 
+// resourceIDFromEntryURL derives the resource ID from the entry's request URL (e.g. "Organization/123")
+// or fullUrl (e.g. "http://example.org/fhir/Organization/123"), provided they refer to the given resource type.
+// It returns an empty string if no ID can be derived.
+func resourceIDFromEntryURL(entry fhir.BundleEntry, resourceType string) string {
+	if entry.Request != nil {
+		requestPath, _, _ := strings.Cut(entry.Request.Url, "?")
+		parts := strings.Split(requestPath, "/")
+		if len(parts) >= 2 && parts[0] == resourceType && parts[1] != "" {
+			return parts[1]
+		}
+	}
+	if entry.FullUrl != nil {
+		parts := strings.Split(*entry.FullUrl, "/")
+		if len(parts) >= 2 && parts[len(parts)-2] == resourceType {
+			return parts[len(parts)-1]
+		}
+	}
+	return ""
+}
+
+// inferEntryRequest synthesizes a PUT request for a _history entry that contains a resource, but no request.
+// It returns nil if the entry's resource type and ID can't be determined.
+func inferEntryRequest(entry fhir.BundleEntry) *fhir.BundleEntryRequest {
+	if len(entry.Resource) == 0 {
+		return nil
+	}
+	var resource struct {
+		ResourceType string `json:"resourceType"`
+		ID           string `json:"id"`
+	}
+	if err := json.Unmarshal(entry.Resource, &resource); err != nil || resource.ResourceType == "" {
+		return nil
+	}
+	resourceID := resource.ID
+	if resourceID == "" {
+		resourceID = resourceIDFromEntryURL(entry, resource.ResourceType)
+	}
+	if resourceID == "" {
+		return nil
+	}
+	return &fhir.BundleEntryRequest{
+		Method: fhir.HTTPVerbPUT,
+		Url:    resource.ResourceType + "/" + resourceID,
+	}
+}
+
+// endpointConditionalReference returns the conditional reference to the Endpoint of the given entry,
+// as it appears in resources converted by convertReferencesRecursive (e.g. "Endpoint?_source=...").
+// It returns an empty string if the entry isn't an Endpoint, or its ID can't be determined.
+func endpointConditionalReference(entry fhir.BundleEntry, sourceBaseURL string) string {
+	var resource struct {
+		ResourceType string `json:"resourceType"`
+		ID           string `json:"id"`
+	}
+	if len(entry.Resource) == 0 || json.Unmarshal(entry.Resource, &resource) != nil || resource.ResourceType != "Endpoint" {
+		return ""
+	}
+	resourceID := resource.ID
+	if resourceID == "" {
+		resourceID = resourceIDFromEntryURL(entry, resource.ResourceType)
+	}
+	if resourceID == "" {
+		return ""
+	}
+	sourceURL, err := libfhir.BuildSourceURL(sourceBaseURL, "Endpoint/"+resourceID)
+	if err != nil {
+		return ""
+	}
+	return "Endpoint?_source=" + url.QueryEscape(sourceURL)
+}
+
+// pruneDanglingEndpointReferences removes the endpoint references from Organization and HealthcareService resources in the transaction,
+// that refer to Endpoints that won't exist in the query directory. It returns a warning for each pruned reference.
+func pruneDanglingEndpointReferences(tx *fhir.Bundle, isDangling func(reference string) bool) []string {
+	var warnings []string
+	for i, entry := range tx.Entry {
+		if len(entry.Resource) == 0 {
+			continue
+		}
+		resource := make(map[string]any)
+		if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+			continue
+		}
+		resourceType, _ := resource["resourceType"].(string)
+		if resourceType != "Organization" && resourceType != "HealthcareService" {
+			continue
+		}
+		endpoints, ok := resource["endpoint"].([]any)
+		if !ok {
+			continue
+		}
+		var source string
+		if meta, ok := resource["meta"].(map[string]any); ok {
+			source, _ = meta["source"].(string)
+		}
+		retained := slices.DeleteFunc(slices.Clone(endpoints), func(endpoint any) bool {
+			reference, ok := endpoint.(map[string]any)["reference"].(string)
+			if !ok || !isDangling(reference) {
+				return false
+			}
+			warnings = append(warnings, fmt.Sprintf("pruned reference from %s (source=%s) to Endpoint that isn't synchronized: %s", resourceType, source, reference))
+			return true
+		})
+		if len(retained) == len(endpoints) {
+			continue
+		}
+		if len(retained) == 0 {
+			delete(resource, "endpoint")
+		} else {
+			resource["endpoint"] = retained
+		}
+		resourceJSON, err := json.Marshal(resource)
+		if err != nil {
+			continue
+		}
+		tx.Entry[i].Resource = resourceJSON
+	}
+	return warnings
+}
+
 func convertReferencesRecursive(obj any, sourceBaseURL string) error {
 	switch v := obj.(type) {
 	case map[string]any:
@@ -153,6 +333,11 @@ func convertReferencesRecursive(obj any, sourceBaseURL string) error {
 		if ref, ok := v["reference"].(string); ok {
 			// Convert relative references to conditional references with deterministic _source
 			parts := strings.Split(ref, "/")
+			if len(parts) == 4 && parts[2] == "_history" {
+				// Versioned reference (Type/id/_history/version): the query directory doesn't retain versions of the source, so refer to the resource itself
+				parts = parts[:2]
+				ref = strings.Join(parts, "/")
+			}
 			if len(parts) == 2 {
 				resourceType := parts[0]
 				// Construct the _source URL deterministically using utility function
@@ -180,13 +365,52 @@ func convertReferencesRecursive(obj any, sourceBaseURL string) error {
 	return nil
 }
 
-func updateResourceMeta(resource map[string]any, source string) {
+// setDirectoryTag sets the meta.tag identifying the mCSD Directory the resource was synchronized from,
+// replacing any existing tag of the same system. It must be called after updateResourceMeta, which ensures meta exists.
+func setDirectoryTag(resource map[string]any, directoryKey string) {
+	meta := resource["meta"].(map[string]any)
+	tags, _ := meta["tag"].([]any)
+	tags = slices.DeleteFunc(tags, func(tag any) bool {
+		tagMap, ok := tag.(map[string]any)
+		return ok && tagMap["system"] == DirectoryTagSystem
+	})
+	meta["tag"] = append(tags, map[string]any{
+		"system": DirectoryTagSystem,
+		"code":   directoryKey,
+	})
+}
+
+// setSourceLastUpdatedExtension sets the SourceLastUpdatedExtensionURL extension to the given instant,
+// replacing the extension if the resource already has it.
+func setSourceLastUpdatedExtension(resource map[string]any, lastUpdated string) {
+	extensions, _ := resource["extension"].([]any)
+	extensions = slices.DeleteFunc(extensions, func(extension any) bool {
+		extensionMap, ok := extension.(map[string]any)
+		return ok && extensionMap["url"] == SourceLastUpdatedExtensionURL
+	})
+	resource["extension"] = append(extensions, map[string]any{
+		"url":          SourceLastUpdatedExtensionURL,
+		"valueInstant": lastUpdated,
+	})
+}
+
+// updateResourceMeta sets meta.source to the source URL of the resource, and removes the version-specific elements
+// the query directory assigns itself. Other elements (e.g. profile) are retained, as are the security labels (meta.security)
+// and tags (meta.tag), since downstream access control may depend on them, unless options.stripMetaLabels is set.
+func updateResourceMeta(resource map[string]any, source string, options updateOptions) {
 	meta, exists := resource["meta"].(map[string]any)
 	if !exists {
 		meta = make(map[string]any)
 		resource["meta"] = meta
 	}
 	meta["source"] = source
+	if lastUpdated, ok := meta["lastUpdated"].(string); ok && options.preserveSourceLastUpdated {
+		setSourceLastUpdatedExtension(resource, lastUpdated)
+	}
 	delete(meta, "versionId")
 	delete(meta, "lastUpdated")
+	if options.stripMetaLabels {
+		delete(meta, "security")
+		delete(meta, "tag")
+	}
 }
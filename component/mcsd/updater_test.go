@@ -0,0 +1,391 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestBuildUpdateTransaction(t *testing.T) {
+	ctx := context.Background()
+	const sourceBaseURL = "http://example.com/fhir"
+	validationRules := ValidationRules{AllowedResourceTypes: []string{"Practitioner"}}
+
+	t.Run("resource without ID", func(t *testing.T) {
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr("urn:uuid:6b1b7d1e-8c0b-4d3a-9b7a-0d7c4e1f2a3b"),
+			Resource: []byte(`{"resourceType":"Practitioner","name":[{"family":"Doe"}]}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner",
+			},
+		}
+		t.Run("fails entry by default", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{})
+
+			require.EqualError(t, err, "resource missing ID field (fullUrl=urn:uuid:6b1b7d1e-8c0b-4d3a-9b7a-0d7c4e1f2a3b)")
+			assert.Empty(t, tx.Entry)
+		})
+		t.Run("skipped when configured", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			resourceType, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{skipResourcesWithoutID: true})
+
+			require.NoError(t, err)
+			assert.Equal(t, "Practitioner", resourceType)
+			assert.Empty(t, tx.Entry)
+		})
+	})
+	t.Run("resource with status entered-in-error", func(t *testing.T) {
+		validationRules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}}
+		parentOrganizationMap := map[*fhir.Organization][]*fhir.Organization{
+			{
+				Id:       to.Ptr("org-1"),
+				Endpoint: []fhir.Reference{{Reference: to.Ptr("Endpoint/endpoint-1")}},
+			}: {},
+		}
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Endpoint/endpoint-1"),
+			Resource: []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"entered-in-error","address":"https://example.com/fhir"}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Endpoint/endpoint-1",
+			},
+		}
+		t.Run("skipped by default", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, false, sourceBaseURL, updateOptions{})
+
+			require.EqualError(t, err, "Endpoint has status entered-in-error, skipping (fullUrl=http://example.com/fhir/Endpoint/endpoint-1)")
+			assert.Empty(t, tx.Entry)
+		})
+		t.Run("synced when configured", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, false, sourceBaseURL, updateOptions{syncEnteredInError: true})
+
+			require.NoError(t, err)
+			assert.Len(t, tx.Entry, 1)
+		})
+	})
+	t.Run("inactive resource", func(t *testing.T) {
+		t.Run("inactive organization skipped when configured", func(t *testing.T) {
+			validationRules := ValidationRules{AllowedResourceTypes: []string{"Organization"}}
+			entry := fhir.BundleEntry{
+				FullUrl:  to.Ptr(sourceBaseURL + "/Organization/org-1"),
+				Resource: []byte(`{"resourceType":"Organization","id":"org-1","active":false,"name":"Closed Hospital"}`),
+				Request: &fhir.BundleEntryRequest{
+					Method: fhir.HTTPVerbPUT,
+					Url:    "Organization/org-1",
+				},
+			}
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{skipInactive: true})
+
+			require.EqualError(t, err, "Organization is inactive, skipping (fullUrl=http://example.com/fhir/Organization/org-1)")
+			assert.Empty(t, tx.Entry)
+		})
+		validationRules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}}
+		parentOrganizationMap := map[*fhir.Organization][]*fhir.Organization{
+			{
+				Id:       to.Ptr("org-1"),
+				Endpoint: []fhir.Reference{{Reference: to.Ptr("Endpoint/endpoint-1")}},
+			}: {},
+		}
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Endpoint/endpoint-1"),
+			Resource: []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"off","address":"https://example.com/fhir"}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Endpoint/endpoint-1",
+			},
+		}
+		t.Run("inactive endpoint synced by default", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, false, sourceBaseURL, updateOptions{})
+
+			require.NoError(t, err)
+			assert.Len(t, tx.Entry, 1)
+		})
+		t.Run("inactive endpoint skipped when configured", func(t *testing.T) {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, false, sourceBaseURL, updateOptions{skipInactive: true})
+
+			require.EqualError(t, err, "Endpoint is inactive, skipping (fullUrl=http://example.com/fhir/Endpoint/endpoint-1)")
+			assert.Empty(t, tx.Entry)
+		})
+	})
+	t.Run("tagged with directory key", func(t *testing.T) {
+		const directoryKey = sourceBaseURL + "|12345678"
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Practitioner/123"),
+			Resource: []byte(`{"resourceType":"Practitioner","id":"123","meta":{"tag":[{"system":"http://example.com/tags","code":"other"},{"system":"` + DirectoryTagSystem + `","code":"stale"}]}}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner/123",
+			},
+		}
+		tx := fhir.Bundle{}
+
+		_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{directoryTag: directoryKey})
+
+		require.NoError(t, err)
+		require.Len(t, tx.Entry, 1)
+		var resource fhir.Practitioner
+		require.NoError(t, json.Unmarshal(tx.Entry[0].Resource, &resource))
+		require.Len(t, resource.Meta.Tag, 2)
+		assert.Equal(t, "other", *resource.Meta.Tag[0].Code, "other tags should be retained")
+		assert.Equal(t, DirectoryTagSystem, *resource.Meta.Tag[1].System)
+		assert.Equal(t, directoryKey, *resource.Meta.Tag[1].Code)
+	})
+	t.Run("not tagged by default", func(t *testing.T) {
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Practitioner/123"),
+			Resource: []byte(`{"resourceType":"Practitioner","id":"123"}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner/123",
+			},
+		}
+		tx := fhir.Bundle{}
+
+		_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{})
+
+		require.NoError(t, err)
+		require.Len(t, tx.Entry, 1)
+		var resource fhir.Practitioner
+		require.NoError(t, json.Unmarshal(tx.Entry[0].Resource, &resource))
+		assert.Empty(t, resource.Meta.Tag)
+	})
+	t.Run("security labels and tags", func(t *testing.T) {
+		const labeled = `{"resourceType":"Practitioner","id":"123","meta":{"versionId":"2","profile":["http://example.com/profile"],` +
+			`"security":[{"system":"http://terminology.hl7.org/CodeSystem/v3-Confidentiality","code":"R"}],` +
+			`"tag":[{"system":"http://example.com/tags","code":"other"}]}}`
+		build := func(t *testing.T, resourceJSON string, options updateOptions) fhir.Practitioner {
+			entry := fhir.BundleEntry{
+				FullUrl:  to.Ptr(sourceBaseURL + "/Practitioner/123"),
+				Resource: []byte(resourceJSON),
+				Request: &fhir.BundleEntryRequest{
+					Method: fhir.HTTPVerbPUT,
+					Url:    "Practitioner/123",
+				},
+			}
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, options)
+
+			require.NoError(t, err)
+			require.Len(t, tx.Entry, 1)
+			var resource fhir.Practitioner
+			require.NoError(t, json.Unmarshal(tx.Entry[0].Resource, &resource))
+			return resource
+		}
+		t.Run("retained by default", func(t *testing.T) {
+			resource := build(t, labeled, updateOptions{})
+
+			require.Len(t, resource.Meta.Security, 1)
+			assert.Equal(t, "R", *resource.Meta.Security[0].Code)
+			require.Len(t, resource.Meta.Tag, 1)
+			assert.Equal(t, "other", *resource.Meta.Tag[0].Code)
+			assert.Equal(t, []string{"http://example.com/profile"}, resource.Meta.Profile)
+			assert.Equal(t, sourceBaseURL+"/Practitioner/123", *resource.Meta.Source)
+			assert.Nil(t, resource.Meta.VersionId)
+		})
+		t.Run("stripped when configured", func(t *testing.T) {
+			resource := build(t, labeled, updateOptions{stripMetaLabels: true})
+
+			assert.Empty(t, resource.Meta.Security)
+			assert.Empty(t, resource.Meta.Tag)
+			assert.Equal(t, []string{"http://example.com/profile"}, resource.Meta.Profile)
+			assert.Equal(t, sourceBaseURL+"/Practitioner/123", *resource.Meta.Source)
+		})
+		t.Run("stripped, still tagged with directory key", func(t *testing.T) {
+			resource := build(t, labeled, updateOptions{stripMetaLabels: true, directoryTag: sourceBaseURL})
+
+			assert.Empty(t, resource.Meta.Security)
+			require.Len(t, resource.Meta.Tag, 1)
+			assert.Equal(t, DirectoryTagSystem, *resource.Meta.Tag[0].System)
+		})
+		t.Run("resource without security labels and tags", func(t *testing.T) {
+			resource := build(t, `{"resourceType":"Practitioner","id":"123"}`, updateOptions{})
+
+			assert.Empty(t, resource.Meta.Security)
+			assert.Empty(t, resource.Meta.Tag)
+			assert.Equal(t, sourceBaseURL+"/Practitioner/123", *resource.Meta.Source)
+		})
+	})
+	t.Run("source lastUpdated", func(t *testing.T) {
+		const lastUpdated = "2025-03-01T12:30:00.000+01:00"
+		entry := fhir.BundleEntry{
+			FullUrl: to.Ptr(sourceBaseURL + "/Practitioner/123"),
+			Resource: []byte(`{"resourceType":"Practitioner","id":"123","meta":{"versionId":"3","lastUpdated":"` + lastUpdated + `"},` +
+				`"extension":[{"url":"http://example.com/other","valueString":"x"},{"url":"` + SourceLastUpdatedExtensionURL + `","valueInstant":"2020-01-01T00:00:00Z"}]}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner/123",
+			},
+		}
+		build := func(t *testing.T, options updateOptions) fhir.Practitioner {
+			tx := fhir.Bundle{}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, options)
+
+			require.NoError(t, err)
+			require.Len(t, tx.Entry, 1)
+			var resource fhir.Practitioner
+			require.NoError(t, json.Unmarshal(tx.Entry[0].Resource, &resource))
+			return resource
+		}
+		t.Run("preserved in extension when configured", func(t *testing.T) {
+			resource := build(t, updateOptions{preserveSourceLastUpdated: true})
+
+			assert.Nil(t, resource.Meta.LastUpdated)
+			require.Len(t, resource.Extension, 2)
+			assert.Equal(t, "http://example.com/other", resource.Extension[0].Url, "other extensions should be retained")
+			assert.Equal(t, SourceLastUpdatedExtensionURL, resource.Extension[1].Url)
+			require.NotNil(t, resource.Extension[1].ValueInstant)
+			assert.Equal(t, lastUpdated, *resource.Extension[1].ValueInstant)
+		})
+		t.Run("discarded by default", func(t *testing.T) {
+			resource := build(t, updateOptions{})
+
+			assert.Nil(t, resource.Meta.LastUpdated)
+			require.Len(t, resource.Extension, 2, "extensions of the source resource are synced as-is")
+			assert.Equal(t, "2020-01-01T00:00:00Z", *resource.Extension[1].ValueInstant)
+		})
+	})
+	t.Run("base URL with and without trailing slash result in the same _source", func(t *testing.T) {
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Practitioner/123"),
+			Resource: []byte(`{"resourceType":"Practitioner","id":"123","qualification":[{"code":{"text":"GP"},"issuer":{"reference":"Organization/org-1"}}]}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner/123",
+			},
+		}
+		withoutSlash := fhir.Bundle{}
+		_, err := buildUpdateTransaction(ctx, &withoutSlash, entry, validationRules, nil, nil, false, "https://x/fhir", updateOptions{})
+		require.NoError(t, err)
+		withSlash := fhir.Bundle{}
+		_, err = buildUpdateTransaction(ctx, &withSlash, entry, validationRules, nil, nil, false, "https://x/fhir/", updateOptions{})
+		require.NoError(t, err)
+
+		require.Len(t, withoutSlash.Entry, 1)
+		require.Len(t, withSlash.Entry, 1)
+		assert.Equal(t, "Practitioner?_source=https%3A%2F%2Fx%2Ffhir%2FPractitioner%2F123", withoutSlash.Entry[0].Request.Url)
+		assert.Equal(t, withoutSlash.Entry[0].Request.Url, withSlash.Entry[0].Request.Url)
+		assert.JSONEq(t, string(withoutSlash.Entry[0].Resource), string(withSlash.Entry[0].Resource), "meta.source and references should be equal")
+	})
+	t.Run("directory endpoint from discoverable directory", func(t *testing.T) {
+		validationRules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}}
+		parentOrganizationMap := map[*fhir.Organization][]*fhir.Organization{
+			{
+				Id:       to.Ptr("org-1"),
+				Endpoint: []fhir.Reference{{Reference: to.Ptr("Endpoint/endpoint-1")}},
+			}: {},
+		}
+		entry := fhir.BundleEntry{
+			FullUrl: to.Ptr(sourceBaseURL + "/Endpoint/endpoint-1"),
+			Resource: []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"active","address":"https://example.com/fhir",` +
+				`"payloadType":[{"coding":[{"system":"http://example.com/CodeSystem/test","code":"directory"}]}]}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Endpoint/endpoint-1",
+			},
+		}
+		t.Run("synced if it has a configured coding", func(t *testing.T) {
+			tx := fhir.Bundle{}
+			options := updateOptions{
+				directoryEndpointCodings: []DirectoryEndpointCoding{{System: "http://example.com/CodeSystem/test", Code: "directory"}},
+			}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, true, sourceBaseURL, options)
+
+			require.NoError(t, err)
+			assert.Len(t, tx.Entry, 1)
+		})
+		t.Run("not synced otherwise", func(t *testing.T) {
+			tx := fhir.Bundle{}
+			options := updateOptions{
+				directoryEndpointCodings: []DirectoryEndpointCoding{defaultDirectoryEndpointCoding},
+			}
+
+			_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, parentOrganizationMap, nil, true, sourceBaseURL, options)
+
+			require.NoError(t, err)
+			assert.Empty(t, tx.Entry)
+		})
+	})
+	t.Run("resource without ID, derived from fullUrl", func(t *testing.T) {
+		entry := fhir.BundleEntry{
+			FullUrl:  to.Ptr(sourceBaseURL + "/Practitioner/123"),
+			Resource: []byte(`{"resourceType":"Practitioner"}`),
+			Request: &fhir.BundleEntryRequest{
+				Method: fhir.HTTPVerbPUT,
+				Url:    "Practitioner",
+			},
+		}
+		tx := fhir.Bundle{}
+
+		_, err := buildUpdateTransaction(ctx, &tx, entry, validationRules, nil, nil, false, sourceBaseURL, updateOptions{})
+
+		require.NoError(t, err)
+		require.Len(t, tx.Entry, 1)
+		assert.Equal(t, "Practitioner?_source=http%3A%2F%2Fexample.com%2Ffhir%2FPractitioner%2F123", tx.Entry[0].Request.Url)
+		var resource map[string]any
+		require.NoError(t, json.Unmarshal(tx.Entry[0].Resource, &resource))
+		assert.Equal(t, sourceBaseURL+"/Practitioner/123", resource["meta"].(map[string]any)["source"])
+	})
+}
+
+func TestConvertReferencesRecursive(t *testing.T) {
+	const sourceBaseURL = "http://example.com/fhir"
+	const expected = "Organization?_source=http%3A%2F%2Fexample.com%2Ffhir%2FOrganization%2F123"
+	testCases := []struct {
+		name      string
+		reference string
+		expected  string
+	}{
+		{name: "relative reference", reference: "Organization/123", expected: expected},
+		{name: "versioned reference", reference: "Organization/123/_history/2", expected: expected},
+		{name: "absolute reference is left untouched", reference: "https://other.example.com/fhir/Organization/123", expected: "https://other.example.com/fhir/Organization/123"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource := map[string]any{
+				"resourceType": "Endpoint",
+				"managingOrganization": map[string]any{
+					"reference": tc.reference,
+				},
+			}
+
+			err := convertReferencesRecursive(resource, sourceBaseURL)
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resource["managingOrganization"].(map[string]any)["reference"])
+		})
+	}
+	t.Run("logical reference is left untouched", func(t *testing.T) {
+		identifier := map[string]any{"system": "http://fhir.nl/fhir/NamingSystem/ura", "value": "1"}
+		resource := map[string]any{
+			"resourceType":         "Endpoint",
+			"managingOrganization": map[string]any{"identifier": identifier},
+		}
+
+		err := convertReferencesRecursive(resource, sourceBaseURL)
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"identifier": identifier}, resource["managingOrganization"])
+	})
+}
@@ -16,12 +16,99 @@ import (
 type ValidationRules struct {
 	// AllowedResourceTypes is a list of FHIR resource types that are allowed to be created/updated.
 	AllowedResourceTypes []string
+	// ResourceTypeRules contains additional rules per FHIR resource type.
+	ResourceTypeRules map[string]ResourceTypeRules
+	// Validator validates the contents of resources. If nil, resources aren't validated by it.
+	Validator ResourceValidator
+	// AuthoritativeIdentifierSystem is the identifier system of authoritative organizations. Defaults to the URA NamingSystem.
+	AuthoritativeIdentifierSystem string
+	// ValidatorWarnOnly causes resources that fail validation by Validator to be logged, instead of rejected.
+	ValidatorWarnOnly bool
+	// LowestURA causes Organizations with multiple authoritative identifiers to be validated using the one with the
+	// lowest value (see MultipleURAsLowest), instead of being rejected.
+	LowestURA bool
+}
+
+const (
+	// MultipleURAsSkip skips organizations with multiple authoritative identifiers (URAs), and reports them as warning.
+	MultipleURAsSkip = "skip"
+	// MultipleURAsLowest uses the authoritative identifier (URA) with the lowest value of organizations that have multiple,
+	// and reports them as warning.
+	MultipleURAsLowest = "lowest"
+)
+
+const (
+	// ResourceValidationOff doesn't validate the contents of resources.
+	ResourceValidationOff = "off"
+	// ResourceValidationWarn logs resources that fail validation, but still synchronizes them.
+	ResourceValidationWarn = "warn"
+	// ResourceValidationStrict doesn't synchronize resources that fail validation, and reports them as warning.
+	ResourceValidationStrict = "strict"
+)
+
+// ResourceValidator validates a resource from a mCSD Directory before it's written to the query directory.
+type ResourceValidator interface {
+	// Validate returns an error if the resource (as unmarshalled JSON) is invalid.
+	Validate(ctx context.Context, resourceType string, resource map[string]any) error
+}
+
+// RequiredElementsValidator is a ResourceValidator that checks that the elements required for each mCSD resource type are present.
+// Rules that span resources (e.g. an Organization needing a URA identifier or a partOf reference) are always validated by ValidateUpdate.
+type RequiredElementsValidator struct {
+	// RequiredElements maps a resource type to its (top-level) elements that must be present and non-empty.
+	RequiredElements map[string][]string
+}
+
+// NewRequiredElementsValidator returns a RequiredElementsValidator with the required elements of the mCSD resource types.
+func NewRequiredElementsValidator() RequiredElementsValidator {
+	return RequiredElementsValidator{
+		RequiredElements: map[string][]string{
+			"Endpoint": {"status", "connectionType", "payloadType", "address"},
+		},
+	}
+}
+
+func (v RequiredElementsValidator) Validate(_ context.Context, resourceType string, resource map[string]any) error {
+	for _, element := range v.RequiredElements[resourceType] {
+		if isEmptyField(resource[element]) {
+			return fmt.Errorf("%s is missing required element '%s'", resourceType, element)
+		}
+	}
+	return nil
+}
+
+// ResourceTypeRules contains validation rules that apply to resources of a specific FHIR resource type.
+type ResourceTypeRules struct {
+	// RequiredFields is a list of (top-level) fields that must be present and non-empty.
+	RequiredFields []string `koanf:"requiredfields"`
+	// ForbiddenStatuses is a list of values of the resource's status field that are not allowed.
+	ForbiddenStatuses []string `koanf:"forbiddenstatuses"`
+}
+
+// rulesForResourceType returns the rules for the given resource type.
+// Resource types are matched case-insensitively, since configuration keys might have been lowercased (e.g. when set through environment variables).
+func (r ValidationRules) rulesForResourceType(resourceType string) (ResourceTypeRules, bool) {
+	for configuredType, rules := range r.ResourceTypeRules {
+		if strings.EqualFold(configuredType, resourceType) {
+			return rules, true
+		}
+	}
+	return ResourceTypeRules{}, false
+}
+
+// authoritativeIdentifierSystem returns the identifier system of authoritative organizations.
+func (r ValidationRules) authoritativeIdentifierSystem() string {
+	if r.AuthoritativeIdentifierSystem == "" {
+		return coding.URANamingSystem
+	}
+	return r.AuthoritativeIdentifierSystem
 }
 
 // ValidateParentOrganizations validates all parent organizations in the map.
-func ValidateParentOrganizations(parentOrganizationMap map[*fhir.Organization][]*fhir.Organization) error {
+// Parent organizations are identified by an identifier with the given (authoritative) system.
+func ValidateParentOrganizations(parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, identifierSystem string) error {
 	for parentOrg := range parentOrganizationMap {
-		if err := validateOrganizationResource(parentOrg, parentOrganizationMap); err != nil {
+		if err := validateOrganizationResource(parentOrg, parentOrganizationMap, identifierSystem); err != nil {
 			return fmt.Errorf("parent organization failed to validate: %w", err)
 		}
 	}
@@ -44,10 +131,24 @@ func ValidateUpdate(ctx context.Context, rules ValidationRules, resourceJSON []b
 	if !slices.Contains(rules.AllowedResourceTypes, resourceType) {
 		return fmt.Errorf("resource type %s not allowed", resourceType)
 	}
+	if resourceTypeRules, ok := rules.rulesForResourceType(resourceType); ok {
+		if err := validateResourceTypeRules(resourceType, resourceAsMap, resourceTypeRules); err != nil {
+			slog.WarnContext(ctx, "Resource violates validation rules", slog.String("resource_type", resourceType), slog.String("error", err.Error()))
+			return err
+		}
+	}
+	if rules.Validator != nil {
+		if err := rules.Validator.Validate(ctx, resourceType, resourceAsMap); err != nil {
+			if !rules.ValidatorWarnOnly {
+				return err
+			}
+			slog.WarnContext(ctx, "Resource failed validation, synchronizing it anyway", slog.String("resource_type", resourceType), slog.String("error", err.Error()))
+		}
+	}
 
 	switch resourceType {
 	case "Organization":
-		return unmarshalAndVisitOrganizationResource(resourceJSON, parentOrganizationMap)
+		return unmarshalAndVisitOrganizationResource(resourceJSON, parentOrganizationMap, rules.authoritativeIdentifierSystem(), rules.LowestURA)
 	case "Location":
 		return unmarshalAndVisitResource[fhir.Location](ctx, resourceJSON, parentOrganizationMap, allHealthcareServices, validateLocationResource)
 	case "PractitionerRole":
@@ -60,6 +161,59 @@ func ValidateUpdate(ctx context.Context, rules ValidationRules, resourceJSON []b
 	return nil
 }
 
+// validateResourceTypeRules validates a resource against the configured rules for its resource type.
+func validateResourceTypeRules(resourceType string, resource map[string]any, rules ResourceTypeRules) error {
+	for _, field := range rules.RequiredFields {
+		if isEmptyField(resource[field]) {
+			return fmt.Errorf("%s is missing required field '%s'", resourceType, field)
+		}
+	}
+	if status := resourceStatus(resource); status != "" && slices.Contains(rules.ForbiddenStatuses, status) {
+		return fmt.Errorf("%s has forbidden status '%s'", resourceType, status)
+	}
+	return nil
+}
+
+// resourceStatus returns the status code of a resource, or an empty string if it has none.
+// Most resource types have a code (string) status, but it can also be a Coding or CodeableConcept.
+func resourceStatus(resource map[string]any) string {
+	switch status := resource["status"].(type) {
+	case string:
+		return status
+	case map[string]any:
+		// Coding
+		if code, ok := status["code"].(string); ok {
+			return code
+		}
+		// CodeableConcept
+		if codings, ok := status["coding"].([]any); ok {
+			for _, curr := range codings {
+				if codingMap, ok := curr.(map[string]any); ok {
+					if code, ok := codingMap["code"].(string); ok {
+						return code
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// isEmptyField returns true if the given JSON value is absent, null, an empty string, an empty array or an empty object.
+func isEmptyField(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
 func unmarshalAndVisitResource[ResType any](ctx context.Context, resourceJSON []byte, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, allHealthcareServices []fhir.HealthcareService, visitor func(ctx context.Context, resource *ResType, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, allHealthcareServices []fhir.HealthcareService) error) error {
 	resource := new(ResType)
 	if err := json.Unmarshal(resourceJSON, resource); err != nil {
@@ -68,31 +222,53 @@ func unmarshalAndVisitResource[ResType any](ctx context.Context, resourceJSON []
 	return visitor(ctx, resource, parentOrganizationMap, allHealthcareServices)
 }
 
-func unmarshalAndVisitOrganizationResource(resourceJSON []byte, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization) error {
+func unmarshalAndVisitOrganizationResource(resourceJSON []byte, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, identifierSystem string, lowestURA bool) error {
 	resource := new(fhir.Organization)
 	if err := json.Unmarshal(resourceJSON, resource); err != nil {
 		return fmt.Errorf("failed to unmarshal resource JSON: %w", err)
 	}
-	return validateOrganizationResource(resource, parentOrganizationMap)
+	if lowestURA {
+		keepLowestURA(resource, identifierSystem)
+	}
+	return validateOrganizationResource(resource, parentOrganizationMap, identifierSystem)
+}
+
+// keepLowestURA removes the identifiers with the given (authoritative) system from the organization,
+// except for the one with the lowest value.
+func keepLowestURA(org *fhir.Organization, identifierSystem string) {
+	var lowest *string
+	for _, identifier := range fhirutil.FilterIdentifiersBySystem(org.Identifier, identifierSystem) {
+		if identifier.Value != nil && (lowest == nil || *identifier.Value < *lowest) {
+			lowest = identifier.Value
+		}
+	}
+	if lowest == nil {
+		return
+	}
+	lowestValue := *lowest
+	org.Identifier = slices.DeleteFunc(slices.Clone(org.Identifier), func(identifier fhir.Identifier) bool {
+		return identifier.System != nil && *identifier.System == identifierSystem &&
+			(identifier.Value == nil || *identifier.Value != lowestValue)
+	})
 }
 
-func validateOrganizationResource(resource *fhir.Organization, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization) error {
+func validateOrganizationResource(resource *fhir.Organization, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, identifierSystem string) error {
 	if resource == nil {
 		return nil // No validation needed if resource is nil
 	}
 
-	uraIdentifiers := fhirutil.FilterIdentifiersBySystem(resource.Identifier, coding.URANamingSystem)
+	uraIdentifiers := fhirutil.FilterIdentifiersBySystem(resource.Identifier, identifierSystem)
 	if len(uraIdentifiers) > 1 {
 		// Only the authoritative organization should have a URA identifier, and only one
-		slog.Warn("Organization has multiple URA identifiers", slog.String("system", coding.URANamingSystem), slog.Int("count", len(uraIdentifiers)))
-		return fmt.Errorf("organization can't have multiple identifiers with system %s", coding.URANamingSystem)
+		slog.Warn("Organization has multiple URA identifiers", slog.String("system", identifierSystem), slog.Int("count", len(uraIdentifiers)))
+		return fmt.Errorf("organization can't have multiple identifiers with system %s", identifierSystem)
 	}
 
 	// Collect all URA identifiers from parent organizations
 	parentURAIdentifiers := make(map[string]bool)
 	for parentOrg := range parentOrganizationMap {
 		if parentOrg != nil {
-			parentURAs := fhirutil.FilterIdentifiersBySystem(parentOrg.Identifier, coding.URANamingSystem)
+			parentURAs := fhirutil.FilterIdentifiersBySystem(parentOrg.Identifier, identifierSystem)
 			for _, ura := range parentURAs {
 				if ura.Value != nil {
 					parentURAIdentifiers[*ura.Value] = true
@@ -115,12 +291,12 @@ func validateOrganizationResource(resource *fhir.Organization, parentOrganizatio
 
 	if len(uraIdentifiers) == 0 {
 		if resource.PartOf == nil {
-			slog.Warn("Organization missing URA identifier and partOf reference", slog.String("system", coding.URANamingSystem))
-			return fmt.Errorf("organization must have an identifier with system %s or refer to another organization through 'partOf'", coding.URANamingSystem)
+			slog.Warn("Organization missing URA identifier and partOf reference", slog.String("system", identifierSystem))
+			return fmt.Errorf("organization must have an identifier with system %s or refer to another organization through 'partOf'", identifierSystem)
 		}
 
 		// Validate that partOf references an authoritative organization (one with a URA identifier)
-		if err := validatePartOfReferencesAuthoritativeOrg(resource.PartOf, parentOrganizationMap); err != nil {
+		if err := validatePartOfReferencesAuthoritativeOrg(resource.PartOf, parentOrganizationMap, identifierSystem); err != nil {
 			return err
 		}
 	}
@@ -130,17 +306,17 @@ func validateOrganizationResource(resource *fhir.Organization, parentOrganizatio
 
 // validatePartOfReferencesAuthoritativeOrg validates that the partOf reference eventually points to an organization with a URA identifier
 // by recursively following the partOf chain up the organization tree
-func validatePartOfReferencesAuthoritativeOrg(partOfRef *fhir.Reference, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization) error {
+func validatePartOfReferencesAuthoritativeOrg(partOfRef *fhir.Reference, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, identifierSystem string) error {
 	if partOfRef == nil {
 		return nil
 	}
 
 	visited := make(map[string]bool)
-	return validatePartOfChain(partOfRef, parentOrganizationMap, visited)
+	return validatePartOfChain(partOfRef, parentOrganizationMap, visited, identifierSystem)
 }
 
 // validatePartOfChain recursively validates the partOf chain until it finds an organization with a URA identifier
-func validatePartOfChain(partOfRef *fhir.Reference, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, visited map[string]bool) error {
+func validatePartOfChain(partOfRef *fhir.Reference, parentOrganizationMap map[*fhir.Organization][]*fhir.Organization, visited map[string]bool, identifierSystem string) error {
 	if partOfRef == nil {
 		return fmt.Errorf("reached end of partOf chain without finding an authoritative organization")
 	}
@@ -160,12 +336,12 @@ func validatePartOfChain(partOfRef *fhir.Reference, parentOrganizationMap map[*f
 	for parentOrg := range parentOrganizationMap {
 		if parentOrg != nil && parentOrg.Id != nil && *parentOrg.Id == refID {
 			// Check if this organization has a URA identifier (is authoritative)
-			uraIdentifiers := fhirutil.FilterIdentifiersBySystem(parentOrg.Identifier, coding.URANamingSystem)
+			uraIdentifiers := fhirutil.FilterIdentifiersBySystem(parentOrg.Identifier, identifierSystem)
 			if len(uraIdentifiers) > 0 {
 				return nil // Found an authoritative organization
 			}
 			// No URA identifier, follow the partOf chain
-			return validatePartOfChain(parentOrg.PartOf, parentOrganizationMap, visited)
+			return validatePartOfChain(parentOrg.PartOf, parentOrganizationMap, visited, identifierSystem)
 		}
 
 		// Also check in the allOrganizations list
@@ -173,12 +349,12 @@ func validatePartOfChain(partOfRef *fhir.Reference, parentOrganizationMap map[*f
 		for _, org := range allOrganizations {
 			if org != nil && org.Id != nil && *org.Id == refID {
 				// Check if this organization has a URA identifier (is authoritative)
-				uraIdentifiers := fhirutil.FilterIdentifiersBySystem(org.Identifier, coding.URANamingSystem)
+				uraIdentifiers := fhirutil.FilterIdentifiersBySystem(org.Identifier, identifierSystem)
 				if len(uraIdentifiers) > 0 {
 					return nil // Found an authoritative organization
 				}
 				// No URA identifier, follow the partOf chain
-				return validatePartOfChain(org.PartOf, parentOrganizationMap, visited)
+				return validatePartOfChain(org.PartOf, parentOrganizationMap, visited, identifierSystem)
 			}
 		}
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
 	"github.com/stretchr/testify/require"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/caramel/to"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
@@ -96,7 +97,7 @@ func TestOrganizationValidator(t *testing.T) {
 				parentOrgMap[parentOrg] = []*fhir.Organization{}
 			}
 
-			err := validateOrganizationResource(&tt.organization, parentOrgMap)
+			err := validateOrganizationResource(&tt.organization, parentOrgMap, coding.URANamingSystem)
 
 			if tt.valid {
 				require.NoError(t, err)
@@ -223,7 +224,7 @@ func TestValidateOrganizationResource_URAValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateOrganizationResource(tt.organization, tt.parentOrgMap)
+			err := validateOrganizationResource(tt.organization, tt.parentOrgMap, coding.URANamingSystem)
 
 			if tt.shouldSucceed {
 				require.NoError(t, err, tt.description)
@@ -396,7 +397,7 @@ func TestValidateOrganizationResource_PartOfChainValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateOrganizationResource(tt.organization, tt.parentOrgMap)
+			err := validateOrganizationResource(tt.organization, tt.parentOrgMap, coding.URANamingSystem)
 
 			if tt.shouldSucceed {
 				require.NoError(t, err, tt.description)
@@ -583,7 +584,7 @@ func TestValidateOrganizationResource_ComplexTrees(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateOrganizationResource(tt.organization, tt.parentOrgMap)
+			err := validateOrganizationResource(tt.organization, tt.parentOrgMap, coding.URANamingSystem)
 
 			if tt.shouldSucceed {
 				require.NoError(t, err, tt.description)
@@ -700,7 +701,7 @@ func TestValidateOrganizationResource_EdgeCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateOrganizationResource(tt.organization, tt.parentOrgMap)
+			err := validateOrganizationResource(tt.organization, tt.parentOrgMap, coding.URANamingSystem)
 
 			if tt.shouldSucceed {
 				require.NoError(t, err, tt.description)
@@ -2276,3 +2277,173 @@ func TestAssertOrganizationHasEndpointReference(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateUpdate_ResourceTypeRules(t *testing.T) {
+	ctx := t.Context()
+	parentOrgMap := map[*fhir.Organization][]*fhir.Organization{
+		{
+			Id: to.Ptr("org-1"),
+			Identifier: []fhir.Identifier{
+				{System: to.Ptr("http://fhir.nl/fhir/NamingSystem/ura"), Value: to.Ptr("12345")},
+			},
+			Endpoint: []fhir.Reference{
+				{Reference: to.Ptr("Endpoint/endpoint-1")},
+			},
+		}: {},
+	}
+	rules := ValidationRules{
+		AllowedResourceTypes: []string{"Endpoint"},
+		ResourceTypeRules: map[string]ResourceTypeRules{
+			"Endpoint": {
+				RequiredFields:    []string{"connectionType", "address"},
+				ForbiddenStatuses: []string{"entered-in-error"},
+			},
+		},
+	}
+
+	t.Run("valid Endpoint", func(t *testing.T) {
+		resourceJSON := []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"active","connectionType":{"code":"hl7-fhir-rest"},"address":"https://example.com/fhir"}`)
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.NoError(t, err)
+	})
+	t.Run("Endpoint missing connectionType", func(t *testing.T) {
+		resourceJSON := []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"active","address":"https://example.com/fhir"}`)
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint is missing required field 'connectionType'")
+	})
+	t.Run("Endpoint with empty connectionType", func(t *testing.T) {
+		resourceJSON, _ := json.Marshal(fhir.Endpoint{Id: to.Ptr("endpoint-1"), Address: "https://example.com/fhir"})
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint is missing required field 'connectionType'")
+	})
+	t.Run("Endpoint with status entered-in-error", func(t *testing.T) {
+		resourceJSON := []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"entered-in-error","connectionType":{"code":"hl7-fhir-rest"},"address":"https://example.com/fhir"}`)
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint has forbidden status 'entered-in-error'")
+	})
+	t.Run("rules for lowercased resource type", func(t *testing.T) {
+		rules := ValidationRules{
+			AllowedResourceTypes: []string{"Endpoint"},
+			ResourceTypeRules: map[string]ResourceTypeRules{
+				"endpoint": {RequiredFields: []string{"address"}},
+			},
+		}
+		resourceJSON := []byte(`{"resourceType":"Endpoint","id":"endpoint-1"}`)
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint is missing required field 'address'")
+	})
+}
+
+func TestValidateUpdate_AuthoritativeIdentifierSystem(t *testing.T) {
+	const kvkSystem = "http://fhir.nl/fhir/NamingSystem/kvk"
+	parentOrg := &fhir.Organization{
+		Id:         to.Ptr("org-1"),
+		Identifier: []fhir.Identifier{{System: to.Ptr(kvkSystem), Value: to.Ptr("12345678")}},
+	}
+	parentOrgMap := map[*fhir.Organization][]*fhir.Organization{parentOrg: {}}
+	rules := ValidationRules{
+		AllowedResourceTypes:          []string{"Organization"},
+		AuthoritativeIdentifierSystem: kvkSystem,
+	}
+
+	t.Run("organization with configured identifier system", func(t *testing.T) {
+		resourceJSON, _ := json.Marshal(parentOrg)
+
+		err := ValidateUpdate(t.Context(), rules, resourceJSON, parentOrgMap, nil)
+
+		require.NoError(t, err)
+	})
+	t.Run("sub-organization of organization with configured identifier system", func(t *testing.T) {
+		resourceJSON := []byte(`{"resourceType":"Organization","id":"org-2","partOf":{"reference":"Organization/org-1"}}`)
+
+		err := ValidateUpdate(t.Context(), rules, resourceJSON, parentOrgMap, nil)
+
+		require.NoError(t, err)
+	})
+	t.Run("URA identifier isn't authoritative", func(t *testing.T) {
+		resourceJSON := []byte(`{"resourceType":"Organization","id":"org-3","identifier":[{"system":"` + coding.URANamingSystem + `","value":"1"}]}`)
+
+		err := ValidateUpdate(t.Context(), rules, resourceJSON, parentOrgMap, nil)
+
+		require.EqualError(t, err, "organization must have an identifier with system "+kvkSystem+" or refer to another organization through 'partOf'")
+	})
+}
+
+func TestValidateUpdate_Validator(t *testing.T) {
+	ctx := t.Context()
+	parentOrgMap := map[*fhir.Organization][]*fhir.Organization{
+		{
+			Id: to.Ptr("org-1"),
+			Identifier: []fhir.Identifier{
+				{System: to.Ptr("http://fhir.nl/fhir/NamingSystem/ura"), Value: to.Ptr("12345")},
+			},
+			Endpoint: []fhir.Reference{
+				{Reference: to.Ptr("Endpoint/endpoint-1")},
+			},
+		}: {},
+	}
+	invalidEndpoint := []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"active","connectionType":{"code":"hl7-fhir-rest"},"address":"https://example.com/fhir"}`)
+
+	t.Run("valid Endpoint", func(t *testing.T) {
+		rules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}, Validator: NewRequiredElementsValidator()}
+		resourceJSON := []byte(`{"resourceType":"Endpoint","id":"endpoint-1","status":"active","connectionType":{"code":"hl7-fhir-rest"},"payloadType":[{"text":"any"}],"address":"https://example.com/fhir"}`)
+
+		err := ValidateUpdate(ctx, rules, resourceJSON, parentOrgMap, nil)
+
+		require.NoError(t, err)
+	})
+	t.Run("Endpoint missing payloadType", func(t *testing.T) {
+		rules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}, Validator: NewRequiredElementsValidator()}
+
+		err := ValidateUpdate(ctx, rules, invalidEndpoint, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint is missing required element 'payloadType'")
+	})
+	t.Run("warn only", func(t *testing.T) {
+		rules := ValidationRules{AllowedResourceTypes: []string{"Endpoint"}, Validator: NewRequiredElementsValidator(), ValidatorWarnOnly: true}
+
+		err := ValidateUpdate(ctx, rules, invalidEndpoint, parentOrgMap, nil)
+
+		require.NoError(t, err)
+	})
+	t.Run("custom validator", func(t *testing.T) {
+		rules := ValidationRules{
+			AllowedResourceTypes: []string{"Endpoint"},
+			Validator:            RequiredElementsValidator{RequiredElements: map[string][]string{"Endpoint": {"name"}}},
+		}
+
+		err := ValidateUpdate(ctx, rules, invalidEndpoint, parentOrgMap, nil)
+
+		require.EqualError(t, err, "Endpoint is missing required element 'name'")
+	})
+}
+
+func TestResourceStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		expected string
+	}{
+		{name: "code", resource: `{"status":"entered-in-error"}`, expected: "entered-in-error"},
+		{name: "Coding", resource: `{"status":{"system":"http://example.com","code":"entered-in-error"}}`, expected: "entered-in-error"},
+		{name: "CodeableConcept", resource: `{"status":{"coding":[{"system":"http://example.com","code":"entered-in-error"}]}}`, expected: "entered-in-error"},
+		{name: "no status", resource: `{"active":true}`, expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resource map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tt.resource), &resource))
+			require.Equal(t, tt.expected, resourceStatus(resource))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package mcsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/component/tracing"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+)
+
+const (
+	// postSyncWebhookAttempts is the number of times the post-sync webhook is called before giving up.
+	postSyncWebhookAttempts = 3
+	// postSyncWebhookTimeout is the maximum duration of a single post-sync webhook call.
+	postSyncWebhookTimeout = 10 * time.Second
+)
+
+// callPostSyncWebhook POSTs the update report to the configured post-sync webhook, if any.
+// Failures are retried a few times, but never fail the update itself: they're only logged.
+func (c *Component) callPostSyncWebhook(ctx context.Context, report UpdateReport) {
+	if c.config.PostSyncWebhookURL == "" {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal mCSD update report for post-sync webhook", logging.Error(err))
+		return
+	}
+	backoff := c.webhookRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err = c.sendPostSyncWebhook(ctx, data)
+		if err == nil {
+			return
+		}
+		if attempt == postSyncWebhookAttempts {
+			break
+		}
+		slog.WarnContext(ctx, "Post-sync webhook failed, retrying", slog.Int("attempt", attempt), logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	slog.ErrorContext(ctx, "Post-sync webhook failed", slog.String("url", c.config.PostSyncWebhookURL), logging.Error(err))
+}
+
+func (c *Component) sendPostSyncWebhook(ctx context.Context, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, postSyncWebhookTimeout)
+	defer cancel()
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.PostSyncWebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if c.config.PostSyncWebhookAuthorization != "" {
+		httpRequest.Header.Set("Authorization", c.config.PostSyncWebhookAuthorization)
+	}
+	httpResponse, err := tracing.NewHTTPClient().Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		return fmt.Errorf("non-2xx status code: %d", httpResponse.StatusCode)
+	}
+	return nil
+}
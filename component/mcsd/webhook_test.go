@@ -0,0 +1,82 @@
+package mcsd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponent_callPostSyncWebhook(t *testing.T) {
+	directoryServer := startMockServer(t, nil)
+	defer directoryServer.Close()
+
+	setup := func(t *testing.T, webhookURL string) *Component {
+		config := DefaultConfig()
+		config.AdministrationDirectories = map[string]DirectoryConfig{
+			"root": {FHIRBaseURL: directoryServer.URL + "/fhir"},
+		}
+		config.PostSyncWebhookURL = webhookURL
+		config.PostSyncWebhookAuthorization = "Bearer secret"
+		component, err := New(config)
+		require.NoError(t, err)
+		component.fhirQueryClient = &test.StubFHIRClient{}
+		component.webhookRetryBackoff = time.Millisecond
+		return component
+	}
+
+	t.Run("receives report", func(t *testing.T) {
+		var requestBody []byte
+		var authorization string
+		webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			requestBody, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer webhookServer.Close()
+		component := setup(t, webhookServer.URL)
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer secret", authorization)
+		var received UpdateReport
+		require.NoError(t, json.Unmarshal(requestBody, &received))
+		assert.Equal(t, report, received)
+	})
+	t.Run("failure is retried, but doesn't fail the update", func(t *testing.T) {
+		var calls int
+		webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer webhookServer.Close()
+		component := setup(t, webhookServer.URL)
+
+		report, err := component.update(context.Background())
+
+		require.NoError(t, err)
+		assert.Len(t, report, 1)
+		assert.Equal(t, postSyncWebhookAttempts, calls)
+	})
+	t.Run("not called on dry run", func(t *testing.T) {
+		var calls int
+		webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		}))
+		defer webhookServer.Close()
+		component := setup(t, webhookServer.URL)
+
+		_, err := component.updateWithOptions(context.Background(), syncOptions{dryRun: true})
+
+		require.NoError(t, err)
+		assert.Zero(t, calls)
+	})
+}
@@ -0,0 +1,259 @@
+package mcsdadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/profile"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/caramel"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// registerAPIHandlers registers the JSON API, which offers the same operations as the HTML forms to programmatic clients
+// (e.g. for seeding a directory). Resources are sent and returned as FHIR JSON; errors are returned as {"error": "..."}.
+func registerAPIHandlers(mux *http.ServeMux) {
+	registerAPIResource(mux, "organization", prepareOrganization)
+	registerAPIResource(mux, "endpoint", prepareEndpoint)
+	registerAPIResource(mux, "location", prepareLocation)
+	registerAPIResource(mux, "healthcareservice", prepareHealthcareService)
+	registerAPIResource(mux, "practitionerrole", preparePractitionerRole)
+	mux.HandleFunc("POST /mcsdadmin/api/organization/{id}/endpoints", apiAssociateEndpoint(
+		func(org *fhir.Organization) (*[]fhir.Reference, *fhir.Meta) { return &org.Endpoint, org.Meta }))
+	mux.HandleFunc("POST /mcsdadmin/api/healthcareservice/{id}/endpoints", apiAssociateEndpoint(
+		func(service *fhir.HealthcareService) (*[]fhir.Reference, *fhir.Meta) {
+			return &service.Endpoint, service.Meta
+		}))
+}
+
+// registerAPIResource registers the list, create, read, update and delete operations for a resource type.
+// The prepare function is called on created and updated resources before they're stored,
+// to validate them and fill in the profile and reference displays.
+func registerAPIResource[T any](mux *http.ServeMux, name string, prepare func(resource *T) error) {
+	mux.HandleFunc("GET /mcsdadmin/api/"+name, apiList[T])
+	mux.HandleFunc("POST /mcsdadmin/api/"+name, apiCreate(prepare))
+	mux.HandleFunc("GET /mcsdadmin/api/"+name+"/{id}", apiRead[T])
+	mux.HandleFunc("PUT /mcsdadmin/api/"+name+"/{id}", apiUpdate(prepare))
+	mux.HandleFunc("DELETE /mcsdadmin/api/"+name+"/{id}", apiDelete[T])
+}
+
+func apiList[T any](w http.ResponseWriter, r *http.Request) {
+	resources, err := findAll[T](client)
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, "could not load resources", err)
+		return
+	}
+	if resources == nil {
+		resources = []T{}
+	}
+	respondJSON(w, http.StatusOK, resources)
+}
+
+func apiRead[T any](w http.ResponseWriter, r *http.Request) {
+	resource, err := findById[T](r.PathValue("id"))
+	if err != nil {
+		apiError(w, r, http.StatusNotFound, "could not read resource", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resource)
+}
+
+func apiCreate[T any](prepare func(resource *T) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resource, err := decodeAPIResource[T](r, "")
+		if err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = prepare(&resource); err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var result T
+		err = client.Create(resource, &result)
+		if err != nil {
+			apiError(w, r, http.StatusInternalServerError, "could not create FHIR resource", err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, result)
+	}
+}
+
+func apiUpdate[T any](prepare func(resource *T) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resourceId := r.PathValue("id")
+		resource, err := decodeAPIResource[T](r, resourceId)
+		if err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = prepare(&resource); err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var result T
+		err = client.Update(caramel.ResourceType(resource)+"/"+resourceId, resource, &result)
+		if err != nil {
+			apiError(w, r, http.StatusInternalServerError, "could not update FHIR resource", err)
+			return
+		}
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+func apiDelete[T any](w http.ResponseWriter, r *http.Request) {
+	var prototype T
+	err := client.Delete(caramel.ResourceType(prototype) + "/" + r.PathValue("id"))
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, "could not delete FHIR resource", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiAssociateEndpoint returns a handler that adds a reference to the Endpoint in the request body ({"endpoint": "<id>"})
+// to the resource, of which the references and meta are returned by endpointsOf.
+func apiAssociateEndpoint[T any](endpointsOf func(resource *T) (*[]fhir.Reference, *fhir.Meta)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Endpoint string `json:"endpoint"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Endpoint == "" {
+			apiError(w, r, http.StatusBadRequest, "request body must contain the ID of the endpoint")
+			return
+		}
+		if _, err := findById[fhir.Endpoint](body.Endpoint); err != nil {
+			apiError(w, r, http.StatusBadRequest, "could not find endpoint", err)
+			return
+		}
+
+		resourceId := r.PathValue("id")
+		resource, err := findById[T](resourceId)
+		if err != nil {
+			apiError(w, r, http.StatusNotFound, "could not read resource", err)
+			return
+		}
+		endpoints, meta := endpointsOf(&resource)
+		*endpoints, err = addEndpointReference(*endpoints, body.Endpoint)
+		if err != nil {
+			apiError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+
+		var result T
+		err = client.Update(caramel.ResourceType(resource)+"/"+resourceId, resource, &result, ifMatch(meta)...)
+		if errors.Is(err, errVersionConflict) {
+			apiError(w, r, http.StatusConflict, err.Error())
+			return
+		} else if err != nil {
+			apiError(w, r, http.StatusInternalServerError, "could not update FHIR resource", err)
+			return
+		}
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+func prepareOrganization(org *fhir.Organization) error {
+	org.Meta = withProfile(org.Meta, profile.NLGenericFunctionOrganization)
+	if err := validateOrganization(*org); err != nil {
+		return err
+	}
+	if err := resolveOrganizationReference(org.PartOf); err != nil {
+		return fmt.Errorf("could not find parent organization: %w", err)
+	}
+	return nil
+}
+
+func prepareEndpoint(endpoint *fhir.Endpoint) error {
+	endpoint.Meta = withProfile(endpoint.Meta, profile.NLGenericFunctionEndpoint)
+	return validateEndpoint(*endpoint)
+}
+
+func prepareLocation(location *fhir.Location) error {
+	location.Meta = withProfile(location.Meta, profile.NLGenericFunctionLocation)
+	if err := validateLocation(*location); err != nil {
+		return err
+	}
+	if err := resolveOrganizationReference(location.ManagingOrganization); err != nil {
+		return fmt.Errorf("could not find managing organization: %w", err)
+	}
+	return nil
+}
+
+func prepareHealthcareService(service *fhir.HealthcareService) error {
+	service.Meta = withProfile(service.Meta, profile.NLGenericFunctionHealthcareService)
+	if err := validateHealthcareService(*service); err != nil {
+		return err
+	}
+	if err := resolveOrganizationReference(service.ProvidedBy); err != nil {
+		return fmt.Errorf("failed to find referred organisation: %w", err)
+	}
+	return nil
+}
+
+func preparePractitionerRole(role *fhir.PractitionerRole) error {
+	if err := validatePractitionerRole(*role); err != nil {
+		return err
+	}
+	if err := resolveOrganizationReference(role.Organization); err != nil {
+		return fmt.Errorf("could not find organization: %w", err)
+	}
+	return nil
+}
+
+// withProfile returns the meta with the given profile added, if it isn't declared yet.
+func withProfile(meta *fhir.Meta, profileURL string) *fhir.Meta {
+	if meta == nil {
+		meta = &fhir.Meta{}
+	}
+	if !slices.Contains(meta.Profile, profileURL) {
+		meta.Profile = append(meta.Profile, profileURL)
+	}
+	return meta
+}
+
+// decodeAPIResource reads a FHIR resource of type T from the request body.
+// The resource type in the body, if any, must match T. The ID is set to the given ID, or removed when creating a resource.
+func decodeAPIResource[T any](r *http.Request, id string) (T, error) {
+	var resource T
+	resourceType := caramel.ResourceType(resource)
+
+	var fields map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return resource, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if actual, ok := fields["resourceType"]; ok && actual != resourceType {
+		return resource, fmt.Errorf("expected resource of type %s, got %v", resourceType, actual)
+	}
+	delete(fields, "id")
+	if id != "" {
+		fields["id"] = id
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return resource, err
+	}
+	if err = json.Unmarshal(data, &resource); err != nil {
+		return resource, fmt.Errorf("invalid %s: %w", resourceType, err)
+	}
+	return resource, nil
+}
+
+func respondJSON(w http.ResponseWriter, httpcode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpcode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func apiError(w http.ResponseWriter, r *http.Request, httpcode int, msg string, errs ...error) {
+	if len(errs) > 0 {
+		slog.WarnContext(r.Context(), msg, logging.Error(errs[0]))
+	}
+	respondJSON(w, httpcode, map[string]string{"error": msg})
+}
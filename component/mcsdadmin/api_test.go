@@ -0,0 +1,132 @@
+package mcsdadmin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestAPI(t *testing.T) {
+	const parent = `{"resourceType":"Organization","id":"1","name":"Parent","endpoint":[{"reference":"Endpoint/ep-1"}]}`
+	setup := func(t *testing.T) (*http.ServeMux, *fhir.Organization) {
+		var stored fhir.Organization
+		fhirMux := http.NewServeMux()
+		fhirMux.HandleFunc("GET /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(parent))
+		})
+		fhirMux.HandleFunc("GET /fhir/Endpoint/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Endpoint","id":"` + r.PathValue("id") + `"}`))
+		})
+		store := func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &stored)
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusCreated)
+			}
+			_, _ = w.Write(data)
+		}
+		fhirMux.HandleFunc("POST /fhir/Organization", store)
+		fhirMux.HandleFunc("PUT /fhir/Organization/{id}", store)
+		fhirMux.HandleFunc("POST /fhir/Organization/_search", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[{"resource":` + parent + `}]}`))
+		})
+		fhirServer := httptest.NewServer(fhirMux)
+		t.Cleanup(fhirServer.Close)
+		component := New(Config{FHIRBaseURL: fhirServer.URL + "/fhir"})
+		require.NotNil(t, component)
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+		return mux, &stored
+	}
+	do := func(mux *http.ServeMux, method, path, body string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(method, path, strings.NewReader(body))
+		httpRequest.Header.Set("Content-Type", "application/json")
+		withCSRFToken(httpRequest)
+		httpResponse := httptest.NewRecorder()
+		mux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+
+	t.Run("list", func(t *testing.T) {
+		mux, _ := setup(t)
+
+		httpResponse := do(mux, http.MethodGet, "/mcsdadmin/api/organization", "")
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		assert.Equal(t, "application/json", httpResponse.Header().Get("Content-Type"))
+		var organizations []fhir.Organization
+		require.NoError(t, json.Unmarshal(httpResponse.Body.Bytes(), &organizations))
+		require.Len(t, organizations, 1)
+		assert.Equal(t, "Parent", *organizations[0].Name)
+	})
+	t.Run("create", func(t *testing.T) {
+		mux, stored := setup(t)
+
+		httpResponse := do(mux, http.MethodPost, "/mcsdadmin/api/organization",
+			`{"resourceType":"Organization","id":"ignored","name":"Child","partOf":{"reference":"Organization/1"}}`)
+
+		require.Equal(t, http.StatusCreated, httpResponse.Code)
+		assert.Nil(t, stored.Id)
+		assert.Equal(t, "Child", *stored.Name)
+		assert.Equal(t, []string{profile.NLGenericFunctionOrganization}, stored.Meta.Profile)
+		require.NotNil(t, stored.PartOf)
+		assert.Equal(t, "Parent", *stored.PartOf.Display)
+	})
+	t.Run("create is validated like the form", func(t *testing.T) {
+		mux, stored := setup(t)
+
+		httpResponse := do(mux, http.MethodPost, "/mcsdadmin/api/organization", `{"name":"Orphan"}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.JSONEq(t, `{"error":"organization must have either a URA identifier or a parent organization (part-of)"}`, httpResponse.Body.String())
+		assert.Nil(t, stored.Name)
+	})
+	t.Run("create with other resource type", func(t *testing.T) {
+		mux, _ := setup(t)
+
+		httpResponse := do(mux, http.MethodPost, "/mcsdadmin/api/organization", `{"resourceType":"Endpoint"}`)
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "expected resource of type Organization, got Endpoint")
+	})
+	t.Run("update", func(t *testing.T) {
+		mux, stored := setup(t)
+
+		httpResponse := do(mux, http.MethodPut, "/mcsdadmin/api/organization/2",
+			`{"resourceType":"Organization","name":"Renamed","identifier":[{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"00000002"}]}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		require.NotNil(t, stored.Id)
+		assert.Equal(t, "2", *stored.Id)
+		assert.Equal(t, "Renamed", *stored.Name)
+	})
+	t.Run("associate endpoint", func(t *testing.T) {
+		mux, stored := setup(t)
+
+		httpResponse := do(mux, http.MethodPost, "/mcsdadmin/api/organization/1/endpoints", `{"endpoint":"ep-2"}`)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		require.Len(t, stored.Endpoint, 2)
+		assert.Equal(t, "Endpoint/ep-2", *stored.Endpoint[1].Reference)
+	})
+	t.Run("associate endpoint twice", func(t *testing.T) {
+		mux, _ := setup(t)
+
+		httpResponse := do(mux, http.MethodPost, "/mcsdadmin/api/organization/1/endpoints", `{"endpoint":"ep-1"}`)
+
+		assert.Equal(t, http.StatusConflict, httpResponse.Code)
+		assert.JSONEq(t, `{"error":"endpoint already associated"}`, httpResponse.Body.String())
+	})
+}
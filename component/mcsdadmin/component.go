@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 	"github.com/nuts-foundation/nuts-knooppunt/lib/fhirutil"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/httpauth"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/netutil"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/profile"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/caramel"
@@ -31,8 +33,33 @@ import (
 )
 
 type Config struct {
-	FHIRBaseURL string                `koanf:"fhirbaseurl"`
-	Auth        httpauth.OAuth2Config `koanf:"auth"`
+	FHIRBaseURL                      string                `koanf:"fhirbaseurl"`
+	Auth                             httpauth.OAuth2Config `koanf:"auth"`
+	Branding                         BrandingConfig        `koanf:"branding"`
+	AllowCustomPractitionerRoleCodes bool                  `koanf:"allowcustompractitionerrolecodes"`
+	// PageSize is the number of resources shown per page in list views, and requested per page when searching the FHIR server.
+	PageSize int `koanf:"pagesize"`
+}
+
+// BrandingConfig allows customizing the look of the web application, e.g. for different tenants.
+type BrandingConfig struct {
+	Title       string `koanf:"title"`
+	LogoURL     string `koanf:"logourl"`
+	AccentColor string `koanf:"accentcolor"`
+}
+
+// Validate checks the configuration, returning an error that names the offending keys.
+func (c Config) Validate() error {
+	var errs []error
+	if c.FHIRBaseURL != "" {
+		if err := netutil.ValidateHTTPURL(c.FHIRBaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("mcsdadmin.fhirbaseurl %w", err))
+		}
+	}
+	if err := c.Auth.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("mcsdadmin.auth: %w", err))
+	}
+	return errors.Join(errs...)
 }
 
 var _ component.Lifecycle = (*Component)(nil)
@@ -43,6 +70,8 @@ type Component struct {
 }
 
 var client fhirclient.Client
+var allowCustomPractitionerRoleCodes bool
+var configuredPageSize = defaultPageSize
 
 func New(config Config) *Component {
 	baseURL, err := url.Parse(config.FHIRBaseURL)
@@ -54,7 +83,7 @@ func New(config Config) *Component {
 	// Create HTTP client with optional OAuth2 authentication
 	var httpClient *http.Client
 	if config.Auth.IsConfigured() {
-		slog.Info("MCSD admin: OAuth2 authentication configured", slog.String("token_endpoint", config.Auth.TokenEndpoint))
+		slog.Info("MCSD admin: OAuth2 authentication configured", logging.Config("auth", config.Auth))
 		httpClient, err = httpauth.NewOAuth2HTTPClient(config.Auth, tracing.WrapTransport(nil))
 		if err != nil {
 			slog.Error("Failed to create OAuth2 HTTP client for MCSD admin", logging.Error(err))
@@ -65,6 +94,16 @@ func New(config Config) *Component {
 	}
 
 	client = fhirclient.New(baseURL, httpClient, fhirutil.ClientConfig())
+	allowCustomPractitionerRoleCodes = config.AllowCustomPractitionerRoleCodes
+	configuredPageSize = defaultPageSize
+	if config.PageSize > 0 {
+		configuredPageSize = config.PageSize
+	}
+	tmpls.SetBranding(tmpls.Branding{
+		Title:       config.Branding.Title,
+		LogoURL:     config.Branding.LogoURL,
+		AccentColor: config.Branding.AccentColor,
+	})
 
 	return &Component{
 		config:     config,
@@ -87,38 +126,55 @@ func (c Component) Stop(_ context.Context) error {
 var fileServer = http.FileServer(http.FS(static.FS))
 
 func (c Component) RegisterHttpHandlers(mux *http.ServeMux, _ *http.ServeMux) {
+	adminMux := http.NewServeMux()
 	// Static file serving for CSS and fonts
-	mux.Handle("GET /mcsdadmin/css/", http.StripPrefix("/mcsdadmin/", fileServer))
-	mux.Handle("GET /mcsdadmin/js/", http.StripPrefix("/mcsdadmin/", fileServer))
-	mux.Handle("GET /mcsdadmin/webfonts/", http.StripPrefix("/mcsdadmin/", fileServer))
-
-	mux.HandleFunc("GET /mcsdadmin/healthcareservice", listServices)
-	mux.HandleFunc("GET /mcsdadmin/healthcareservice/new", newService)
-	mux.HandleFunc("POST /mcsdadmin/healthcareservice/new", newServicePost)
-	mux.HandleFunc("GET /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpoints)
-	mux.HandleFunc("POST /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpointsPost)
-	mux.HandleFunc("DELETE /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpointsDelete)
-	mux.HandleFunc("GET /mcsdadmin/organization", listOrganizations)
-	mux.HandleFunc("GET /mcsdadmin/organization/new", newOrganization)
-	mux.HandleFunc("POST /mcsdadmin/organization/new", newOrganizationPost)
-	mux.HandleFunc("GET /mcsdadmin/organization/{id}/endpoints", associateEndpoints)
-	mux.HandleFunc("POST /mcsdadmin/organization/{id}/endpoints", associateEndpointsPost)
-	mux.HandleFunc("DELETE /mcsdadmin/organization/{id}/endpoints", associateEndpointsDelete)
-	mux.HandleFunc("GET /mcsdadmin/endpoint", listEndpoints)
-	mux.HandleFunc("GET /mcsdadmin/endpoint/new", newEndpoint)
-	mux.HandleFunc("POST /mcsdadmin/endpoint/new", newEndpointPost)
-	mux.HandleFunc("GET /mcsdadmin/location", listLocations)
-	mux.HandleFunc("GET /mcsdadmin/location/new", newLocation)
-	mux.HandleFunc("POST /mcsdadmin/location/new", newLocationPost)
-	mux.HandleFunc("DELETE /mcsdadmin/endpoint/{id}", deleteHandler("Endpoint"))
-	mux.HandleFunc("DELETE /mcsdadmin/location/{id}", deleteHandler("Location"))
-	mux.HandleFunc("DELETE /mcsdadmin/healthcareservice/{id}", deleteHandler("HealthcareService"))
-	mux.HandleFunc("DELETE /mcsdadmin/organization/{id}", deleteHandler("Organization"))
-	mux.HandleFunc("GET /mcsdadmin/practitionerrole", listPractitionerRole)
-	mux.HandleFunc("GET /mcsdadmin/practitionerrole/new", newPractitionerRole)
-	mux.HandleFunc("POST /mcsdadmin/practitionerrole/new", newPractitionerRolePost)
-	mux.HandleFunc("GET /mcsdadmin", homePage)
-	mux.HandleFunc("GET /mcsdadmin/", notFound)
+	adminMux.Handle("GET /mcsdadmin/css/", http.StripPrefix("/mcsdadmin/", fileServer))
+	adminMux.Handle("GET /mcsdadmin/js/", http.StripPrefix("/mcsdadmin/", fileServer))
+	adminMux.Handle("GET /mcsdadmin/webfonts/", http.StripPrefix("/mcsdadmin/", fileServer))
+
+	adminMux.HandleFunc("GET /mcsdadmin/healthcareservice", listServices)
+	adminMux.HandleFunc("GET /mcsdadmin/healthcareservice/new", newService)
+	adminMux.HandleFunc("POST /mcsdadmin/healthcareservice/new", newServicePost)
+	adminMux.HandleFunc("GET /mcsdadmin/healthcareservice/{id}/edit", editService)
+	adminMux.HandleFunc("POST /mcsdadmin/healthcareservice/{id}/edit", editServicePost)
+	adminMux.HandleFunc("GET /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpoints)
+	adminMux.HandleFunc("POST /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpointsPost)
+	adminMux.HandleFunc("DELETE /mcsdadmin/healthcareservice/{id}/endpoints", associateHealthcareServiceEndpointsDelete)
+	adminMux.HandleFunc("GET /mcsdadmin/organization", listOrganizations)
+	adminMux.HandleFunc("GET /mcsdadmin/organization/new", newOrganization)
+	adminMux.HandleFunc("POST /mcsdadmin/organization/new", newOrganizationPost)
+	adminMux.HandleFunc("GET /mcsdadmin/organization/{id}/edit", editOrganization)
+	adminMux.HandleFunc("POST /mcsdadmin/organization/{id}/edit", editOrganizationPost)
+	adminMux.HandleFunc("GET /mcsdadmin/organization/{id}/endpoints", associateEndpoints)
+	adminMux.HandleFunc("POST /mcsdadmin/organization/{id}/endpoints", associateEndpointsPost)
+	adminMux.HandleFunc("DELETE /mcsdadmin/organization/{id}/endpoints", associateEndpointsDelete)
+	adminMux.HandleFunc("GET /mcsdadmin/endpoint", listEndpoints)
+	adminMux.HandleFunc("GET /mcsdadmin/endpoint/new", newEndpoint)
+	adminMux.HandleFunc("POST /mcsdadmin/endpoint/new", newEndpointPost)
+	adminMux.HandleFunc("GET /mcsdadmin/endpoint/{id}/edit", editEndpoint)
+	adminMux.HandleFunc("POST /mcsdadmin/endpoint/{id}/edit", editEndpointPost)
+	adminMux.HandleFunc("GET /mcsdadmin/location", listLocations)
+	adminMux.HandleFunc("GET /mcsdadmin/location/new", newLocation)
+	adminMux.HandleFunc("POST /mcsdadmin/location/new", newLocationPost)
+	adminMux.HandleFunc("GET /mcsdadmin/location/{id}/edit", editLocation)
+	adminMux.HandleFunc("POST /mcsdadmin/location/{id}/edit", editLocationPost)
+	adminMux.HandleFunc("DELETE /mcsdadmin/endpoint/{id}", deleteHandler("Endpoint"))
+	adminMux.HandleFunc("DELETE /mcsdadmin/location/{id}", deleteHandler("Location"))
+	adminMux.HandleFunc("DELETE /mcsdadmin/healthcareservice/{id}", deleteHandler("HealthcareService"))
+	adminMux.HandleFunc("DELETE /mcsdadmin/organization/{id}", deleteHandler("Organization"))
+	adminMux.HandleFunc("GET /mcsdadmin/practitionerrole", listPractitionerRole)
+	adminMux.HandleFunc("GET /mcsdadmin/practitionerrole/new", newPractitionerRole)
+	adminMux.HandleFunc("POST /mcsdadmin/practitionerrole/new", newPractitionerRolePost)
+	adminMux.HandleFunc("GET /mcsdadmin/practitionerrole/{id}/edit", editPractitionerRole)
+	adminMux.HandleFunc("POST /mcsdadmin/practitionerrole/{id}/edit", editPractitionerRolePost)
+	registerAPIHandlers(adminMux)
+	adminMux.HandleFunc("GET /mcsdadmin", homePage)
+	adminMux.HandleFunc("GET /mcsdadmin/", notFound)
+
+	// All routes go through the CSRF protection, which checks every request that can change state.
+	handler := csrfProtect(adminMux)
+	mux.Handle("/mcsdadmin", handler)
+	mux.Handle("/mcsdadmin/", handler)
 }
 
 func listServices(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +183,19 @@ func listServices(w http.ResponseWriter, r *http.Request) {
 }
 
 func newService(w http.ResponseWriter, r *http.Request) {
+	renderServiceForm(w, r, fhir.HealthcareService{})
+}
+
+func editService(w http.ResponseWriter, r *http.Request) {
+	service, err := findById[fhir.HealthcareService](r.PathValue("id"))
+	if err != nil {
+		internalError(w, r, "could not read healthcare service resource", err)
+		return
+	}
+	renderServiceForm(w, r, service)
+}
+
+func renderServiceForm(w http.ResponseWriter, r *http.Request, service fhir.HealthcareService) {
 	organizations, err := findAll[fhir.Organization](client)
 	if err != nil {
 		internalError(w, r, "could not load organizations", err)
@@ -136,9 +205,11 @@ func newService(w http.ResponseWriter, r *http.Request) {
 	props := struct {
 		Types         []fhir.Coding
 		Organizations []fhir.Organization
+		Form          tmpls.ServiceFormProps
 	}{
 		Organizations: organizations,
 		Types:         valuesets.ServiceTypeCodings,
+		Form:          tmpls.MakeServiceFormProps(service),
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -146,17 +217,58 @@ func newService(w http.ResponseWriter, r *http.Request) {
 }
 
 func newServicePost(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		badRequest(w, r, "invalid form input", err)
-		return
-	}
-
 	service := fhir.HealthcareService{
 		Meta: &fhir.Meta{
 			Profile: []string{profile.NLGenericFunctionHealthcareService},
 		},
 	}
+	if !serviceFromForm(w, r, &service) {
+		return
+	}
+
+	var resSer fhir.HealthcareService
+	err := client.Create(service, &resSer)
+	if err != nil {
+		internalError(w, r, "could not create FHIR resource", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	renderList[fhir.HealthcareService, tmpls.ServiceListProps](client, w, tmpls.MakeServiceListXsProps)
+}
+
+func editServicePost(w http.ResponseWriter, r *http.Request) {
+	serviceId := r.PathValue("id")
+	service, err := findById[fhir.HealthcareService](serviceId)
+	if err != nil {
+		internalError(w, r, "could not read healthcare service resource", err)
+		return
+	}
+	if !serviceFromForm(w, r, &service) {
+		return
+	}
+
+	var resSer fhir.HealthcareService
+	err = client.Update("HealthcareService/"+serviceId, service, &resSer, ifMatch(service.Meta)...)
+	if err != nil {
+		updateError(w, r, "could not update FHIR resource", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	renderList[fhir.HealthcareService, tmpls.ServiceListProps](client, w, tmpls.MakeServiceListXsProps)
+}
+
+// serviceFromForm sets the fields of the HealthcareService from the submitted form, which are the same for new and existing resources.
+// If the form is invalid, it responds with an error and returns false.
+func serviceFromForm(w http.ResponseWriter, r *http.Request, service *fhir.HealthcareService) bool {
+	err := r.ParseForm()
+	if err != nil {
+		badRequest(w, r, "invalid form input", err)
+		return false
+	}
+
 	name := r.PostForm.Get("name")
 	service.Name = &name
 	active := r.PostForm.Get("active") == "true"
@@ -165,7 +277,7 @@ func newServicePost(w http.ResponseWriter, r *http.Request) {
 	codables, ok := formdata.CodablesFromForm(r.PostForm, valuesets.ServiceTypeCodings, "type")
 	if !ok {
 		badRequest(w, r, "Could not find type all type codes")
-		return
+		return false
 	}
 	service.Type = codables
 
@@ -174,25 +286,12 @@ func newServicePost(w http.ResponseWriter, r *http.Request) {
 		Reference: &reference,
 		Type:      to.Ptr("Organization"),
 	}
-
-	var providedByOrg fhir.Organization
-	err = client.Read(reference, &providedByOrg)
+	err = resolveOrganizationReference(service.ProvidedBy)
 	if err != nil {
 		badRequest(w, r, "failed to find referred organisation", err)
-		return
-	}
-	service.ProvidedBy.Display = providedByOrg.Name
-
-	var resSer fhir.HealthcareService
-	err = client.Create(service, &resSer)
-	if err != nil {
-		internalError(w, r, "could not create FHIR resource", err)
-		return
+		return false
 	}
-
-	w.WriteHeader(http.StatusCreated)
-
-	renderList[fhir.HealthcareService, tmpls.ServiceListProps](client, w, tmpls.MakeServiceListXsProps)
+	return true
 }
 
 func listOrganizations(w http.ResponseWriter, r *http.Request) {
@@ -201,23 +300,44 @@ func listOrganizations(w http.ResponseWriter, r *http.Request) {
 }
 
 func newOrganization(w http.ResponseWriter, r *http.Request) {
+	renderOrganizationForm(w, r, fhir.Organization{})
+}
+
+func editOrganization(w http.ResponseWriter, r *http.Request) {
+	org, err := findById[fhir.Organization](r.PathValue("id"))
+	if err != nil {
+		internalError(w, r, "could not read organization resource", err)
+		return
+	}
+	renderOrganizationForm(w, r, org)
+}
+
+func renderOrganizationForm(w http.ResponseWriter, r *http.Request, org fhir.Organization) {
 	organizations, err := findAll[fhir.Organization](client)
 	if err != nil {
 		internalError(w, r, "could not load organizations", err)
 		return
 	}
+	// An organization can't be part of itself
+	organizations = slices.DeleteFunc(organizations, func(other fhir.Organization) bool {
+		return org.Id != nil && other.Id != nil && *other.Id == *org.Id
+	})
 	orgsExists := len(organizations) > 0
 
 	w.WriteHeader(http.StatusOK)
 
 	props := struct {
-		Types         []fhir.Coding
-		Organizations []fhir.Organization
-		OrgsExist     bool
+		Types             []fhir.Coding
+		IdentifierSystems []fhir.Coding
+		Organizations     []fhir.Organization
+		OrgsExist         bool
+		Form              tmpls.OrgFormProps
 	}{
-		Types:         valuesets.OrganizationTypeCodings,
-		Organizations: organizations,
-		OrgsExist:     orgsExists,
+		Types:             valuesets.OrganizationTypeCodings,
+		IdentifierSystems: organizationIdentifierSystems,
+		Organizations:     organizations,
+		OrgsExist:         orgsExists,
+		Form:              tmpls.MakeOrgFormProps(org, organizationIdentifierSystems),
 	}
 
 	tmpls.RenderWithBase(w, "organization_edit.html", props)
@@ -226,69 +346,114 @@ func newOrganization(w http.ResponseWriter, r *http.Request) {
 func newOrganizationPost(w http.ResponseWriter, r *http.Request) {
 	slog.DebugContext(r.Context(), "New post for organization resource")
 
-	err := r.ParseForm()
-	if err != nil {
-		badRequest(w, r, "invalid form input", err)
-		return
-	}
-
 	org := fhir.Organization{
 		Meta: &fhir.Meta{
 			Profile: []string{profile.NLGenericFunctionOrganization},
 		},
 	}
-	name := r.PostForm.Get("name")
-	org.Name = &name
-	uraString := r.PostForm.Get("identifier")
-	partOf := r.PostForm.Get("part-of")
+	if !organizationFromForm(w, r, &org) {
+		return
+	}
 
-	// Validate: organization must have either URA identifier or partOf reference
-	if uraString == "" && partOf == "" {
-		badRequest(w, r, "organization must have either a URA identifier or a parent organization (part-of)")
+	var resOrg fhir.Organization
+	err := client.Create(org, &resOrg)
+	if err != nil {
+		internalError(w, r, "could not create FHIR resource", err)
 		return
 	}
 
-	// Set identifier if provided
-	if uraString != "" {
-		org.Identifier = []fhir.Identifier{
-			uraIdentifier(uraString),
+	w.WriteHeader(http.StatusCreated)
+	renderList[fhir.Organization, tmpls.OrgListProps](client, w, tmpls.MakeOrgListXsProps)
+}
+
+func editOrganizationPost(w http.ResponseWriter, r *http.Request) {
+	orgId := r.PathValue("id")
+	slog.DebugContext(r.Context(), "Edit post for organization resource", slog.String("id", orgId))
+
+	org, err := findById[fhir.Organization](orgId)
+	if err != nil {
+		internalError(w, r, "could not read organization resource", err)
+		return
+	}
+	if !organizationFromForm(w, r, &org) {
+		return
+	}
+
+	var resOrg fhir.Organization
+	err = client.Update("Organization/"+orgId, org, &resOrg, ifMatch(org.Meta)...)
+	if err != nil {
+		updateError(w, r, "could not update FHIR resource", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	renderList[fhir.Organization, tmpls.OrgListProps](client, w, tmpls.MakeOrgListXsProps)
+}
+
+// organizationFromForm sets the fields of the Organization from the submitted form, which are the same for new and existing resources.
+// Fields that aren't in the form (e.g. endpoints, or identifiers of other systems than organizationIdentifierSystems) are left as-is.
+// If the form is invalid, it responds with an error and returns false.
+func organizationFromForm(w http.ResponseWriter, r *http.Request, org *fhir.Organization) bool {
+	err := r.ParseForm()
+	if err != nil {
+		badRequest(w, r, "invalid form input", err)
+		return false
+	}
+
+	name := r.PostForm.Get("name")
+	org.Name = &name
+	partOf := r.PostForm.Get("part-of")
+
+	// Replace the identifiers of the systems in the form
+	org.Identifier = slices.DeleteFunc(org.Identifier, func(identifier fhir.Identifier) bool {
+		return identifier.System != nil && isOrganizationIdentifierSystem(*identifier.System)
+	})
+	for _, identifier := range formdata.ParseMaps(r.PostForm, "identifier") {
+		value := strings.TrimSpace(identifier["Value"])
+		if value == "" {
+			continue
 		}
+		system := identifier["System"]
+		if !isOrganizationIdentifierSystem(system) {
+			badRequest(w, r, "unknown identifier system: "+system)
+			return false
+		}
+		org.Identifier = append(org.Identifier, fhir.Identifier{
+			System: to.Ptr(system),
+			Value:  to.Ptr(value),
+		})
 	}
 
 	codables, ok := formdata.CodablesFromForm(r.PostForm, valuesets.OrganizationTypeCodings, "type")
 	if !ok {
 		badRequest(w, r, "could not find all type codes")
-		return
+		return false
 	}
 	org.Type = codables
 
 	active := r.PostForm.Get("active") == "true"
 	org.Active = &active
 
+	org.PartOf = nil
 	if len(partOf) > 0 {
 		reference := "Organization/" + partOf
 		org.PartOf = &fhir.Reference{
 			Reference: &reference,
 			Type:      to.Ptr("Organization"),
 		}
-		var parentOrg fhir.Organization
-		err = client.Read(reference, &parentOrg)
-		if err != nil {
-			internalError(w, r, "could not find organization", err)
-			return
-		}
-		org.PartOf.Display = parentOrg.Name
 	}
 
-	var resOrg fhir.Organization
-	err = client.Create(org, &resOrg)
+	err = validateOrganization(*org)
 	if err != nil {
-		internalError(w, r, "could not create FHIR resource", err)
-		return
+		badRequest(w, r, err.Error())
+		return false
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	renderList[fhir.Organization, tmpls.OrgListProps](client, w, tmpls.MakeOrgListXsProps)
+	err = resolveOrganizationReference(org.PartOf)
+	if err != nil {
+		internalError(w, r, "could not find organization", err)
+		return false
+	}
+	return true
 }
 
 func associateEndpoints(w http.ResponseWriter, req *http.Request) {
@@ -398,26 +563,17 @@ func associateEndpointsPost(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	foundIdx := slices.IndexFunc(organization.Endpoint, func(ref fhir.Reference) bool {
-		epId := idFromRef(ref)
-		return epId == selectedId
-	})
-	if foundIdx > -1 {
+	organization.Endpoint, err = addEndpointReference(organization.Endpoint, selectedId)
+	if err != nil {
 		http.Error(w, "endpoint already associated with organization", http.StatusBadRequest)
 		return
 	}
 
-	selectedPath := fmt.Sprintf("Endpoint/%s", selectedId)
-	ref := fhir.Reference{
-		Reference: &selectedPath,
-	}
-	organization.Endpoint = append(organization.Endpoint, ref)
-
 	orgPath := fmt.Sprintf("Organization/%s", orgId)
 	var resultOrg fhir.Organization
-	err = client.Update(orgPath, organization, &resultOrg)
+	err = client.Update(orgPath, organization, &resultOrg, ifMatch(organization.Meta)...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		updateError(w, req, "could not update organization", err)
 		return
 	}
 
@@ -450,26 +606,17 @@ func associateHealthcareServiceEndpointsPost(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	foundIdx := slices.IndexFunc(service.Endpoint, func(ref fhir.Reference) bool {
-		epId := idFromRef(ref)
-		return epId == selectedId
-	})
-	if foundIdx > -1 {
+	service.Endpoint, err = addEndpointReference(service.Endpoint, selectedId)
+	if err != nil {
 		http.Error(w, "endpoint already associated with healthcare service", http.StatusBadRequest)
 		return
 	}
 
-	selectedPath := fmt.Sprintf("Endpoint/%s", selectedId)
-	ref := fhir.Reference{
-		Reference: &selectedPath,
-	}
-	service.Endpoint = append(service.Endpoint, ref)
-
 	servicePath := fmt.Sprintf("HealthcareService/%s", serviceId)
 	var resultService fhir.HealthcareService
-	err = client.Update(servicePath, service, &resultService)
+	err = client.Update(servicePath, service, &resultService, ifMatch(service.Meta)...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		updateError(w, req, "could not update healthcare service", err)
 		return
 	}
 
@@ -511,9 +658,9 @@ func associateEndpointsDelete(w http.ResponseWriter, req *http.Request) {
 
 	orgPath := fmt.Sprintf("Organization/%s", orgId)
 	var orgResult fhir.Organization
-	err = client.Update(orgPath, organization, &orgResult)
+	err = client.Update(orgPath, organization, &orgResult, ifMatch(organization.Meta)...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		updateError(w, req, "could not update organization", err)
 		return
 	}
 
@@ -550,9 +697,9 @@ func associateHealthcareServiceEndpointsDelete(w http.ResponseWriter, req *http.
 
 	servicePath := fmt.Sprintf("HealthcareService/%s", serviceId)
 	var serviceResult fhir.HealthcareService
-	err = client.Update(servicePath, service, &serviceResult)
+	err = client.Update(servicePath, service, &serviceResult, ifMatch(service.Meta)...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		updateError(w, req, "could not update healthcare service", err)
 		return
 	}
 
@@ -564,7 +711,20 @@ func listEndpoints(w http.ResponseWriter, r *http.Request) {
 	renderPaginatedList[fhir.Endpoint, tmpls.EpListProps](client, w, r, tmpls.MakeEpListXsProps)
 }
 
-func newEndpoint(w http.ResponseWriter, _ *http.Request) {
+func newEndpoint(w http.ResponseWriter, r *http.Request) {
+	renderEndpointForm(w, r, fhir.Endpoint{})
+}
+
+func editEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, err := findById[fhir.Endpoint](r.PathValue("id"))
+	if err != nil {
+		internalError(w, r, "could not read endpoint resource", err)
+		return
+	}
+	renderEndpointForm(w, r, endpoint)
+}
+
+func renderEndpointForm(w http.ResponseWriter, _ *http.Request, endpoint fhir.Endpoint) {
 	organizations, err := findAll[fhir.Organization](client)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -584,6 +744,7 @@ func newEndpoint(w http.ResponseWriter, _ *http.Request) {
 		PayloadTypes       []fhir.Coding
 		PurposeOfUse       []fhir.Coding
 		Status             []fhir.Coding
+		Form               tmpls.EpFormProps
 	}{
 		ConnectionTypes:    valuesets.EndpointConnectionTypeCodings,
 		Organizations:      organizations,
@@ -591,6 +752,7 @@ func newEndpoint(w http.ResponseWriter, _ *http.Request) {
 		PayloadTypes:       valuesets.EndpointPayloadTypeCodings,
 		PurposeOfUse:       valuesets.PurposeOfUseCodings,
 		Status:             valuesets.EndpointStatusCodings,
+		Form:               tmpls.MakeEpFormProps(endpoint),
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -600,35 +762,121 @@ func newEndpoint(w http.ResponseWriter, _ *http.Request) {
 func newEndpointPost(w http.ResponseWriter, r *http.Request) {
 	slog.DebugContext(r.Context(), "New post for Endpoint resource")
 
-	err := r.ParseForm()
-	if err != nil {
-		badRequest(w, r, "invalid form input", err)
-		return
-	}
-
 	endpoint := fhir.Endpoint{
 		Meta: &fhir.Meta{
 			Profile: []string{profile.NLGenericFunctionEndpoint},
 		},
 	}
+	if !endpointFromForm(w, r, &endpoint) {
+		return
+	}
+
+	var resEp fhir.Endpoint
+	err := client.Create(endpoint, &resEp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var epRef fhir.Reference
+	epRef.Type = to.Ptr("Endpoint")
+	epRef.Reference = to.Ptr("Endpoint/" + *resEp.Id)
+
+	forResourceStr := r.PostForm.Get("endpoint-for")
+	if len(forResourceStr) > 0 {
+		// The value now contains the resource type prefix (e.g., "Organization/123" or "HealthcareService/456")
+		if strings.HasPrefix(forResourceStr, "Organization/") {
+			var owningOrg fhir.Organization
+			err = client.Read(forResourceStr, &owningOrg)
+			if err != nil {
+				http.Error(w, "bad request: could not find organization", http.StatusBadRequest)
+				return
+			}
+
+			owningOrg.Endpoint = append(owningOrg.Endpoint, epRef)
+
+			var updatedOrg fhir.Organization
+			err = client.Update("Organization/"+*owningOrg.Id, owningOrg, &updatedOrg, ifMatch(owningOrg.Meta)...)
+			if err != nil {
+				updateError(w, r, "could not update organization", err)
+				return
+			}
+		} else if strings.HasPrefix(forResourceStr, "HealthcareService/") {
+			var owningService fhir.HealthcareService
+			err = client.Read(forResourceStr, &owningService)
+			if err != nil {
+				http.Error(w, "bad request: could not find healthcare service", http.StatusBadRequest)
+				return
+			}
+
+			owningService.Endpoint = append(owningService.Endpoint, epRef)
+
+			var updatedService fhir.HealthcareService
+			err = client.Update("HealthcareService/"+*owningService.Id, owningService, &updatedService, ifMatch(owningService.Meta)...)
+			if err != nil {
+				updateError(w, r, "could not update healthcare service", err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	renderList[fhir.Endpoint, tmpls.EpListProps](client, w, tmpls.MakeEpListXsProps)
+}
+
+func editEndpointPost(w http.ResponseWriter, r *http.Request) {
+	endpointId := r.PathValue("id")
+	slog.DebugContext(r.Context(), "Edit post for Endpoint resource", slog.String("id", endpointId))
+
+	endpoint, err := findById[fhir.Endpoint](endpointId)
+	if err != nil {
+		internalError(w, r, "could not read endpoint resource", err)
+		return
+	}
+	if !endpointFromForm(w, r, &endpoint) {
+		return
+	}
+
+	var resEp fhir.Endpoint
+	err = client.Update("Endpoint/"+endpointId, endpoint, &resEp, ifMatch(endpoint.Meta)...)
+	if err != nil {
+		updateError(w, r, "could not update FHIR resource", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	renderList[fhir.Endpoint, tmpls.EpListProps](client, w, tmpls.MakeEpListXsProps)
+}
+
+// endpointFromForm sets the fields of the Endpoint from the submitted form, which are the same for new and existing resources.
+// The organization or healthcare service the Endpoint belongs to isn't part of it, since it's stored in the referring resource.
+// If the form is invalid, it responds with an error and returns false.
+func endpointFromForm(w http.ResponseWriter, r *http.Request, endpoint *fhir.Endpoint) bool {
+	err := r.ParseForm()
+	if err != nil {
+		badRequest(w, r, "invalid form input", err)
+		return false
+	}
+
 	address := r.PostForm.Get("address")
 	if address == "" {
 		http.Error(w, "bad request: missing address", http.StatusBadRequest)
-		return
+		return false
 	}
 	endpoint.Address = address
 
 	codables, ok := formdata.CodablesFromFormWithCustom(r.PostForm, valuesets.EndpointPayloadTypeCodings, "payload-type")
 	if !ok {
 		badRequest(w, r, "could not find all type codes")
-		return
+		return false
 	}
 	if len(codables) < 1 {
 		badRequest(w, r, "missing payload type")
-		return
+		return false
 	}
 	endpoint.PayloadType = codables
 
+	endpoint.Period = nil
 	periodStart := r.PostForm.Get("period-start")
 	periodEnd := r.PostForm.Get("period-end")
 	if (len(periodStart) > 0) && (len(periodEnd) > 0) {
@@ -638,6 +886,7 @@ func newEndpointPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	endpoint.Contact = nil
 	contactValue := r.PostForm.Get("contact")
 	if len(contactValue) > 0 {
 		contact := fhir.ContactPoint{
@@ -646,6 +895,7 @@ func newEndpointPost(w http.ResponseWriter, r *http.Request) {
 		endpoint.Contact = []fhir.ContactPoint{contact}
 	}
 
+	endpoint.ManagingOrganization = nil
 	kvkStr := r.PostForm.Get("managing-org")
 	if len(kvkStr) > 0 {
 		ref := fhir.Reference{
@@ -664,14 +914,17 @@ func newEndpointPost(w http.ResponseWriter, r *http.Request) {
 		endpoint.ConnectionType = connectionType
 	} else {
 		http.Error(w, "bad request: missing connection type", http.StatusBadRequest)
-		return
+		return false
 	}
 
+	endpoint.Extension = slices.DeleteFunc(endpoint.Extension, func(extension fhir.Extension) bool {
+		return extension.Url == valuesets.PurposeOfUseExtensionURL
+	})
 	purposeOfUseId := r.PostForm.Get("purpose-of-use")
 	purposeOfUse, ok := valuesets.CodableFrom(valuesets.PurposeOfUseCodings, purposeOfUseId)
 	if ok {
 		extension := fhir.Extension{
-			Url:                  "https://profiles.ihe.net/ITI/mCSD/StructureDefinition/IHE.mCSD.PurposeOfUse",
+			Url:                  valuesets.PurposeOfUseExtensionURL,
 			ValueCodeableConcept: &purposeOfUse,
 		}
 		endpoint.Extension = append(endpoint.Extension, extension)
@@ -681,63 +934,25 @@ func newEndpointPost(w http.ResponseWriter, r *http.Request) {
 	endpoint.Status, ok = valuesets.EndpointStatusFrom(status)
 	if !ok {
 		http.Error(w, "bad request: missing status", http.StatusBadRequest)
-		return
+		return false
 	}
+	return true
+}
 
-	var resEp fhir.Endpoint
-	err = client.Create(endpoint, &resEp)
+func newLocation(w http.ResponseWriter, r *http.Request) {
+	renderLocationForm(w, r, fhir.Location{})
+}
+
+func editLocation(w http.ResponseWriter, r *http.Request) {
+	location, err := findById[fhir.Location](r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, "could not read location resource", err)
 		return
 	}
-
-	var epRef fhir.Reference
-	epRef.Type = to.Ptr("Endpoint")
-	epRef.Reference = to.Ptr("Endpoint/" + *resEp.Id)
-
-	forResourceStr := r.PostForm.Get("endpoint-for")
-	if len(forResourceStr) > 0 {
-		// The value now contains the resource type prefix (e.g., "Organization/123" or "HealthcareService/456")
-		if strings.HasPrefix(forResourceStr, "Organization/") {
-			var owningOrg fhir.Organization
-			err = client.Read(forResourceStr, &owningOrg)
-			if err != nil {
-				http.Error(w, "bad request: could not find organization", http.StatusBadRequest)
-				return
-			}
-
-			owningOrg.Endpoint = append(owningOrg.Endpoint, epRef)
-
-			var updatedOrg fhir.Organization
-			err = client.Update("Organization/"+*owningOrg.Id, owningOrg, &updatedOrg)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else if strings.HasPrefix(forResourceStr, "HealthcareService/") {
-			var owningService fhir.HealthcareService
-			err = client.Read(forResourceStr, &owningService)
-			if err != nil {
-				http.Error(w, "bad request: could not find healthcare service", http.StatusBadRequest)
-				return
-			}
-
-			owningService.Endpoint = append(owningService.Endpoint, epRef)
-
-			var updatedService fhir.HealthcareService
-			err = client.Update("HealthcareService/"+*owningService.Id, owningService, &updatedService)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	renderList[fhir.Endpoint, tmpls.EpListProps](client, w, tmpls.MakeEpListXsProps)
+	renderLocationForm(w, r, location)
 }
 
-func newLocation(w http.ResponseWriter, _ *http.Request) {
+func renderLocationForm(w http.ResponseWriter, _ *http.Request, location fhir.Location) {
 	w.WriteHeader(http.StatusOK)
 
 	organizations, err := findAll[fhir.Organization](client)
@@ -751,31 +966,70 @@ func newLocation(w http.ResponseWriter, _ *http.Request) {
 		Status        []fhir.Coding
 		Types         []fhir.Coding
 		Organizations []fhir.Organization
+		Form          tmpls.LocationFormProps
 	}{
 		PhysicalTypes: valuesets.LocationPhysicalTypeCodings,
 		Status:        valuesets.LocationStatusCodings,
 		Types:         valuesets.LocationTypeCodings,
 		Organizations: organizations,
+		Form:          tmpls.MakeLocationFormProps(location),
 	}
 
 	tmpls.RenderWithBase(w, "location_edit.html", props)
 }
 
 func newLocationPost(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		badRequest(w, r, "invalid form input", err)
-		return
-	}
-
 	location := fhir.Location{
 		Meta: &fhir.Meta{
 			Profile: []string{profile.NLGenericFunctionLocation},
 		},
 	}
+	if !locationFromForm(w, r, &location) {
+		return
+	}
+
+	var resLoc fhir.Location
+	err := client.Create(location, &resLoc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderList[fhir.Location, tmpls.LocationListProps](client, w, tmpls.MakeLocationListXsProps)
+}
+
+func editLocationPost(w http.ResponseWriter, r *http.Request) {
+	locationId := r.PathValue("id")
+	location, err := findById[fhir.Location](locationId)
+	if err != nil {
+		internalError(w, r, "could not read location resource", err)
+		return
+	}
+	if !locationFromForm(w, r, &location) {
+		return
+	}
+
+	var resLoc fhir.Location
+	err = client.Update("Location/"+locationId, location, &resLoc, ifMatch(location.Meta)...)
+	if err != nil {
+		updateError(w, r, "could not update FHIR resource", err)
+		return
+	}
+	renderList[fhir.Location, tmpls.LocationListProps](client, w, tmpls.MakeLocationListXsProps)
+}
+
+// locationFromForm sets the fields of the Location from the submitted form, which are the same for new and existing resources.
+// If the form is invalid, it responds with an error and returns false.
+func locationFromForm(w http.ResponseWriter, r *http.Request, location *fhir.Location) bool {
+	err := r.ParseForm()
+	if err != nil {
+		badRequest(w, r, "invalid form input", err)
+		return false
+	}
+
 	name := r.PostForm.Get("name")
 	location.Name = &name
 
+	location.Type = nil
 	typeCode := r.PostForm.Get("type")
 	if len(typeCode) > 0 {
 		locType, ok := valuesets.CodableFrom(valuesets.LocationTypeCodings, typeCode)
@@ -791,6 +1045,7 @@ func newLocationPost(w http.ResponseWriter, r *http.Request) {
 	if ok {
 		location.Status = &status
 	} else {
+		location.Status = nil
 		slog.WarnContext(r.Context(), "Could not find location status")
 	}
 
@@ -798,7 +1053,7 @@ func newLocationPost(w http.ResponseWriter, r *http.Request) {
 	addressLine := r.PostForm.Get("address-line")
 	if addressLine == "" {
 		http.Error(w, "missing address line", http.StatusBadRequest)
-		return
+		return false
 	}
 	address.Line = []string{addressLine}
 
@@ -824,6 +1079,7 @@ func newLocationPost(w http.ResponseWriter, r *http.Request) {
 	}
 	location.Address = to.Ptr(address)
 
+	location.PhysicalType = nil
 	physicalCode := r.PostForm.Get("physicalType")
 	if len(physicalCode) > 0 {
 		physical, ok := valuesets.CodableFrom(valuesets.LocationPhysicalTypeCodings, physicalCode)
@@ -834,6 +1090,7 @@ func newLocationPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	location.ManagingOrganization = nil
 	orgStr := r.PostForm.Get("managing-org")
 	if orgStr != "" {
 		reference := "Organization/" + orgStr
@@ -842,37 +1099,66 @@ func newLocationPost(w http.ResponseWriter, r *http.Request) {
 			Reference: &reference,
 			Type:      &refType,
 		}
-		var managingOrg fhir.Organization
-		err = client.Read(reference, &managingOrg)
+		err = resolveOrganizationReference(location.ManagingOrganization)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return false
 		}
-		location.ManagingOrganization.Display = managingOrg.Name
 	}
+	return true
+}
 
-	var resLoc fhir.Location
-	err = client.Create(location, &resLoc)
+func listLocations(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	renderPaginatedList[fhir.Location, tmpls.LocationListProps](client, w, r, tmpls.MakeLocationListXsProps)
+}
+
+func newPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
+	var role fhir.PractitionerRole
+	if !practitionerRoleFromForm(w, r, &role) {
+		return
+	}
+
+	var resRole fhir.PractitionerRole
+	err := client.Create(role, &resRole)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, "could not create practitioner role", err)
 		return
 	}
-	renderList[fhir.Location, tmpls.LocationListProps](client, w, tmpls.MakeLocationListXsProps)
+	w.WriteHeader(http.StatusCreated)
+	renderList[fhir.PractitionerRole, tmpls.PractitionerRoleProps](client, w, tmpls.MakePractitionerRoleXsProps)
 }
 
-func listLocations(w http.ResponseWriter, r *http.Request) {
+func editPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
+	roleId := r.PathValue("id")
+	role, err := findById[fhir.PractitionerRole](roleId)
+	if err != nil {
+		internalError(w, r, "could not read practitioner role", err)
+		return
+	}
+	if !practitionerRoleFromForm(w, r, &role) {
+		return
+	}
+
+	var resRole fhir.PractitionerRole
+	err = client.Update("PractitionerRole/"+roleId, role, &resRole, ifMatch(role.Meta)...)
+	if err != nil {
+		updateError(w, r, "could not update practitioner role", err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	renderPaginatedList[fhir.Location, tmpls.LocationListProps](client, w, r, tmpls.MakeLocationListXsProps)
+	renderList[fhir.PractitionerRole, tmpls.PractitionerRoleProps](client, w, tmpls.MakePractitionerRoleXsProps)
 }
 
-func newPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
+// practitionerRoleFromForm sets the fields of the PractitionerRole from the submitted form, which are the same for new and existing resources.
+// If the form is invalid, it responds with an error and returns false.
+func practitionerRoleFromForm(w http.ResponseWriter, r *http.Request, role *fhir.PractitionerRole) bool {
 	err := r.ParseForm()
 	if err != nil {
 		badRequest(w, r, "failed to processes form data", err)
-		return
+		return false
 	}
 
-	var role fhir.PractitionerRole
 	uziNumber := r.PostForm.Get("uzi-number")
 	if uziNumber != "" {
 		identifier := fhir.Identifier{
@@ -885,14 +1171,14 @@ func newPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
 		role.Practitioner = to.Ptr(ref)
 	} else {
 		badRequest(w, r, "required field uzi-number missing", err)
-		return
+		return false
 	}
 
 	orgId := r.PostForm.Get("organization-id")
 	org, err := findById[fhir.Organization](orgId)
 	if err != nil {
 		badRequest(w, r, fmt.Sprintf("could not find organistion with id: %s", orgId))
-		return
+		return false
 	}
 	orgRef := fhir.Reference{
 		Reference: to.Ptr(fmt.Sprintf("Organization/%s", orgId)),
@@ -900,30 +1186,31 @@ func newPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
 	}
 	role.Organization = to.Ptr(orgRef)
 
-	codables, ok := formdata.CodablesFromForm(r.PostForm, valuesets.PractitionerRoleCodings, "codes")
-	if !ok {
-		badRequest(w, r, fmt.Sprintf("could not find all type codes"))
-		return
+	codables, err := formdata.CodablesFromFormStrict(r.PostForm, valuesets.PractitionerRoleCodings, "codes", allowCustomPractitionerRoleCodes)
+	if err != nil {
+		badRequest(w, r, "invalid practitioner role code: "+err.Error())
+		return false
 	}
 	role.Code = codables
 
+	role.Telecom = nil
 	telecomData := formdata.ParseMaps(r.PostForm, "telecom")
 	for _, tel := range telecomData {
 		const msg = "invalid telecom information provided"
 		system, ok := tel["System"]
 		if !ok {
 			badRequest(w, r, msg)
-			return
+			return false
 		}
 		value, ok := tel["Value"]
 		if !ok {
 			badRequest(w, r, msg)
-			return
+			return false
 		}
 		contactPointSystem, ok := valuesets.ContactPointSystemFrom(system)
 		if !ok {
 			badRequest(w, r, msg)
-			return
+			return false
 		}
 
 		contactPoint := fhir.ContactPoint{
@@ -933,18 +1220,23 @@ func newPractitionerRolePost(w http.ResponseWriter, r *http.Request) {
 
 		role.Telecom = append(role.Telecom, contactPoint)
 	}
+	return true
+}
 
-	var resRole fhir.PractitionerRole
-	err = client.Create(role, &resRole)
+func newPractitionerRole(w http.ResponseWriter, r *http.Request) {
+	renderPractitionerRoleForm(w, r, fhir.PractitionerRole{})
+}
+
+func editPractitionerRole(w http.ResponseWriter, r *http.Request) {
+	role, err := findById[fhir.PractitionerRole](r.PathValue("id"))
 	if err != nil {
-		internalError(w, r, "could not create practitioner role", err)
+		internalError(w, r, "could not read practitioner role", err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	renderList[fhir.PractitionerRole, tmpls.PractitionerRoleProps](client, w, tmpls.MakePractitionerRoleXsProps)
+	renderPractitionerRoleForm(w, r, role)
 }
 
-func newPractitionerRole(w http.ResponseWriter, r *http.Request) {
+func renderPractitionerRoleForm(w http.ResponseWriter, r *http.Request, role fhir.PractitionerRole) {
 	organizations, err := findAll[fhir.Organization](client)
 	if err != nil {
 		internalError(w, r, "failed to load organizations", err)
@@ -954,15 +1246,19 @@ func newPractitionerRole(w http.ResponseWriter, r *http.Request) {
 	orgsExist := len(organizations) > 0
 
 	props := struct {
-		Organizations []fhir.Organization
-		OrgsExist     bool
-		Codes         []fhir.Coding
-		TelecomCodes  []fhir.Coding
+		Organizations    []fhir.Organization
+		OrgsExist        bool
+		Codes            []fhir.Coding
+		AllowCustomCodes bool
+		TelecomCodes     []fhir.Coding
+		Form             tmpls.PractitionerRoleFormProps
 	}{
-		Organizations: organizations,
-		OrgsExist:     orgsExist,
-		Codes:         valuesets.PractitionerRoleCodings,
-		TelecomCodes:  valuesets.ContactPointSystem,
+		Organizations:    organizations,
+		OrgsExist:        orgsExist,
+		Codes:            valuesets.PractitionerRoleCodings,
+		AllowCustomCodes: allowCustomPractitionerRoleCodes,
+		TelecomCodes:     valuesets.ContactPointSystem,
+		Form:             tmpls.MakePractitionerRoleFormProps(role),
 	}
 	w.WriteHeader(http.StatusOK)
 	tmpls.RenderWithBase(w, "practitionerrole_edit.html", props)
@@ -1003,6 +1299,37 @@ func deleteHandler(resourceType string) func(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// errVersionConflict is returned by updates with ifMatch when the resource was changed since it was read.
+var errVersionConflict = errors.New("resource was changed concurrently")
+
+// ifMatch returns the options for an update that only succeeds if the resource still has the version it had when it was read
+// (optimistic locking), so concurrent changes aren't silently overwritten. If the version has moved on, the update fails with errVersionConflict.
+// If the resource has no version (e.g. because the FHIR server doesn't support versioning), the update is unconditional.
+func ifMatch(meta *fhir.Meta) []fhirclient.Option {
+	if meta == nil || meta.VersionId == nil {
+		return nil
+	}
+	return []fhirclient.Option{
+		fhirclient.RequestHeaders(http.Header{"If-Match": []string{fmt.Sprintf(`W/"%s"`, *meta.VersionId)}}),
+		fhirclient.PostRequestOption(func(_ fhirclient.Client, response *http.Response) error {
+			if response.StatusCode == http.StatusPreconditionFailed || response.StatusCode == http.StatusConflict {
+				return errVersionConflict
+			}
+			return nil
+		}),
+	}
+}
+
+// updateError responds to a failed update, with an alert asking to retry if the resource was changed concurrently.
+func updateError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if errors.Is(err, errVersionConflict) {
+		slog.WarnContext(r.Context(), msg, logging.Error(err))
+		respondErrorAlert(w, "The resource was changed by someone else in the meantime. Reload the page and try again.", http.StatusConflict)
+		return
+	}
+	internalError(w, r, msg, err)
+}
+
 func findById[T any](id string) (T, error) {
 	var prototype T
 	resourceType := caramel.ResourceType(prototype)
@@ -1039,24 +1366,39 @@ type PaginatedResult[T any] struct {
 
 const defaultPageSize = 20
 
+// findAllPageSize is the number of resources findAll requests per page.
+const findAllPageSize = 100
+
+// maxFindAllPages limits the number of pages findAll retrieves, to prevent endless loops due to a misbehaving FHIR server.
+const maxFindAllPages = 100
+
+// findAll retrieves all resources of the given type, following the pages of the search result.
 func findAll[T any](fhirClient fhirclient.Client) ([]T, error) {
 	var prototype T
 	resourceType := caramel.ResourceType(prototype)
 
+	searchParams := url.Values{}
+	searchParams.Set("_count", strconv.Itoa(findAllPageSize))
 	var searchResponse fhir.Bundle
-	err := fhirClient.Search(resourceType, url.Values{}, &searchResponse, nil)
+	err := fhirClient.Search(resourceType, searchParams, &searchResponse)
 	if err != nil {
 		return nil, fmt.Errorf("search for resource type %s failed: %w", resourceType, err)
 	}
 
 	var result []T
-	for i, entry := range searchResponse.Entry {
-		var item T
-		err := json.Unmarshal(entry.Resource, &item)
-		if err != nil {
-			return nil, fmt.Errorf("unmarshal of entry %d for resource type %s failed: %w", i, resourceType, err)
+	err = fhirclient.Paginate(context.Background(), fhirClient, searchResponse, func(searchSet *fhir.Bundle) (bool, error) {
+		for _, entry := range searchSet.Entry {
+			var item T
+			err := json.Unmarshal(entry.Resource, &item)
+			if err != nil {
+				return false, fmt.Errorf("unmarshal of entry %d for resource type %s failed: %w", len(result), resourceType, err)
+			}
+			result = append(result, item)
 		}
-		result = append(result, item)
+		return true, nil
+	}, fhirclient.WithMaxIterations(maxFindAllPages))
+	if err != nil {
+		return nil, fmt.Errorf("search for resource type %s failed: %w", resourceType, err)
 	}
 
 	return result, nil
@@ -1157,24 +1499,34 @@ func findPaginated[T any](fhirClient fhirclient.Client, page, pageSize int) (Pag
 	}, nil
 }
 
-func uraIdentifier(uraString string) fhir.Identifier {
-	var identifier fhir.Identifier
-	identifier.Value = to.Ptr(uraString)
-	identifier.System = to.Ptr(coding.URANamingSystem)
-	return identifier
+// organizationIdentifierSystems are the identifier systems that can be chosen for an Organization in the form.
+// The code of each coding is the identifier system.
+var organizationIdentifierSystems = []fhir.Coding{
+	{Code: to.Ptr(coding.URANamingSystem), Display: to.Ptr("URA")},
+	{Code: to.Ptr(coding.KVKNamingSystem), Display: to.Ptr("KVK")},
+	{Code: to.Ptr(coding.AGBNamingSystem), Display: to.Ptr("AGB")},
+}
+
+func isOrganizationIdentifierSystem(system string) bool {
+	return slices.ContainsFunc(organizationIdentifierSystems, func(c fhir.Coding) bool {
+		return *c.Code == system
+	})
 }
 
+// renderList renders the first page of the list of resources, e.g. after creating or updating a resource.
 func renderList[R any, DTO any](fhirClient fhirclient.Client, httpResponse http.ResponseWriter, dtoFunc func([]R) []DTO) {
 	resourceType := caramel.ResourceType(new(R))
-	items, err := findAll[R](fhirClient)
+	result, err := findPaginated[R](fhirClient, 1, configuredPageSize)
 	if err != nil {
 		http.Error(httpResponse, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	tmpls.RenderWithBase(httpResponse, strings.ToLower(resourceType)+"_list.html", struct {
-		Items []DTO
+		Items      []DTO
+		Pagination PaginationInfo
 	}{
-		Items: dtoFunc(items),
+		Items:      dtoFunc(result.Items),
+		Pagination: result.Pagination,
 	})
 }
 
@@ -1184,7 +1536,7 @@ func renderPaginatedList[R any, DTO any](fhirClient fhirclient.Client, httpRespo
 
 	// Parse pagination parameters from query string
 	page := 1
-	pageSize := defaultPageSize
+	pageSize := configuredPageSize
 
 	if pageStr := httpRequest.URL.Query().Get("page"); pageStr != "" {
 		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
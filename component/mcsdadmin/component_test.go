@@ -0,0 +1,339 @@
+package mcsdadmin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	tmpls "github.com/nuts-foundation/nuts-knooppunt/component/mcsdadmin/templates"
+	"github.com/nuts-foundation/nuts-knooppunt/component/mcsdadmin/valuesets"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/httpauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("empty config is valid", func(t *testing.T) {
+		assert.NoError(t, Config{}.Validate())
+	})
+	t.Run("invalid FHIR base URL and incomplete auth", func(t *testing.T) {
+		config := Config{
+			FHIRBaseURL: "localhost:8080/fhir",
+			Auth:        httpauth.OAuth2Config{TokenEndpoint: "https://example.com/token", ClientSecret: "secret"},
+		}
+
+		assert.EqualError(t, config.Validate(), `mcsdadmin.fhirbaseurl must be an absolute http or https URL (url=localhost:8080/fhir)
+mcsdadmin.auth: clientid is required`)
+	})
+}
+
+func TestComponent_Branding(t *testing.T) {
+	render := func(t *testing.T, config Config) string {
+		config.FHIRBaseURL = "http://example.com/fhir"
+		component := New(config)
+		require.NotNil(t, component)
+		t.Cleanup(func() {
+			tmpls.SetBranding(tmpls.Branding{})
+		})
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+
+		httpResponse := httptest.NewRecorder()
+		mux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsdadmin", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		return httpResponse.Body.String()
+	}
+
+	t.Run("configured", func(t *testing.T) {
+		body := render(t, Config{
+			Branding: BrandingConfig{
+				Title:       "Acme Admin",
+				LogoURL:     "https://example.com/logo.png",
+				AccentColor: "#ff0000",
+			},
+		})
+
+		assert.Contains(t, body, "<title>Acme Admin</title>")
+		assert.Contains(t, body, `<img src="https://example.com/logo.png"`)
+		assert.Contains(t, body, "background-color: #ff0000 !important")
+	})
+	t.Run("defaults", func(t *testing.T) {
+		body := render(t, Config{})
+
+		assert.Contains(t, body, "<title>mCSD Admin</title>")
+		assert.Contains(t, body, `<i class="fas fa-hospital-alt"></i>`)
+		assert.NotContains(t, body, "background-color")
+	})
+}
+
+func TestComponent_newPractitionerRolePost(t *testing.T) {
+	setup := func(t *testing.T, allowCustomCodes bool) (*http.ServeMux, *fhir.PractitionerRole) {
+		var created fhir.PractitionerRole
+		fhirMux := http.NewServeMux()
+		fhirMux.HandleFunc("GET /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Organization","id":"1","name":"Test Organization"}`))
+		})
+		fhirMux.HandleFunc("POST /fhir/PractitionerRole", func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &created)
+			w.Header().Set("Content-Type", "application/fhir+json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(data)
+		})
+		fhirMux.HandleFunc("/fhir/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[]}`))
+		})
+		fhirServer := httptest.NewServer(fhirMux)
+		t.Cleanup(fhirServer.Close)
+
+		component := New(Config{
+			FHIRBaseURL:                      fhirServer.URL + "/fhir",
+			AllowCustomPractitionerRoleCodes: allowCustomCodes,
+		})
+		require.NotNil(t, component)
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+		return mux, &created
+	}
+	post := func(mux *http.ServeMux, form url.Values) *httptest.ResponseRecorder {
+		form.Set("uzi-number", "123456")
+		form.Set("organization-id", "1")
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/practitionerrole/new", strings.NewReader(form.Encode()))
+		httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		withCSRFToken(httpRequest)
+		httpResponse := httptest.NewRecorder()
+		mux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+	validCode := valuesets.PractitionerRoleCodings[0]
+
+	t.Run("valid code", func(t *testing.T) {
+		mux, created := setup(t, false)
+
+		httpResponse := post(mux, url.Values{"codes": {*validCode.Code}})
+
+		require.Equal(t, http.StatusCreated, httpResponse.Code)
+		require.Len(t, created.Code, 1)
+		assert.Equal(t, validCode.Code, created.Code[0].Coding[0].Code)
+	})
+	t.Run("unknown code", func(t *testing.T) {
+		mux, created := setup(t, false)
+
+		httpResponse := post(mux, url.Values{"codes": {*validCode.Code, "does-not-exist"}})
+
+		assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "invalid practitioner role code: unknown code(s): does-not-exist")
+		assert.Empty(t, created.Code)
+	})
+	t.Run("custom code", func(t *testing.T) {
+		form := url.Values{
+			"codes":          {"other"},
+			"custom-system":  {"http://example.com/codes"},
+			"custom-code":    {"custom"},
+			"custom-display": {"Custom role"},
+		}
+		t.Run("enabled", func(t *testing.T) {
+			mux, created := setup(t, true)
+
+			httpResponse := post(mux, form)
+
+			require.Equal(t, http.StatusCreated, httpResponse.Code)
+			require.Len(t, created.Code, 1)
+			assert.Equal(t, "http://example.com/codes", *created.Code[0].Coding[0].System)
+			assert.Equal(t, "custom", *created.Code[0].Coding[0].Code)
+			assert.Equal(t, "Custom role", *created.Code[0].Text)
+		})
+		t.Run("disabled", func(t *testing.T) {
+			mux, _ := setup(t, false)
+
+			httpResponse := post(mux, form)
+
+			assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+			assert.Contains(t, httpResponse.Body.String(), "unknown code(s): other")
+		})
+		t.Run("missing system", func(t *testing.T) {
+			mux, _ := setup(t, true)
+
+			httpResponse := post(mux, url.Values{"codes": {"other"}, "custom-code": {"custom"}})
+
+			assert.Equal(t, http.StatusBadRequest, httpResponse.Code)
+			assert.Contains(t, httpResponse.Body.String(), "custom code requires both a system and a code")
+		})
+	})
+}
+
+func TestComponent_editOrganization(t *testing.T) {
+	const existing = `{"resourceType":"Organization","id":"1","name":"Old name","active":true,` +
+		`"identifier":[{"system":"http://example.com/other","value":"other-1"},{"system":"http://fhir.nl/fhir/NamingSystem/ura","value":"00000001"}],` +
+		`"type":[{"coding":[{"system":"http://terminology.hl7.org/CodeSystem/organization-type","code":"prov"}]}],` +
+		`"endpoint":[{"reference":"Endpoint/ep-1"}]}`
+	setup := func(t *testing.T) (*http.ServeMux, *fhir.Organization) {
+		var updated fhir.Organization
+		fhirMux := http.NewServeMux()
+		fhirMux.HandleFunc("GET /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(existing))
+		})
+		fhirMux.HandleFunc("PUT /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &updated)
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write(data)
+		})
+		fhirMux.HandleFunc("/fhir/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[{"resource":` + existing + `}]}`))
+		})
+		fhirServer := httptest.NewServer(fhirMux)
+		t.Cleanup(fhirServer.Close)
+		component := New(Config{FHIRBaseURL: fhirServer.URL + "/fhir"})
+		require.NotNil(t, component)
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+		return mux, &updated
+	}
+
+	t.Run("form is pre-filled", func(t *testing.T) {
+		mux, _ := setup(t)
+
+		httpResponse := httptest.NewRecorder()
+		mux.ServeHTTP(httpResponse, httptest.NewRequest(http.MethodGet, "/mcsdadmin/organization/1/edit", nil))
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		body := httpResponse.Body.String()
+		assert.Contains(t, body, `value="Old name"`)
+		assert.Contains(t, body, `value="00000001"`)
+		assert.Contains(t, body, `<option value="http://fhir.nl/fhir/NamingSystem/ura" selected>URA</option>`)
+		assert.NotContains(t, body, `value="other-1"`, "identifiers of other systems aren't in the form")
+		assert.Contains(t, body, `<option value="prov" selected>`)
+		assert.Regexp(t, `id="active"[^>]+checked`, body)
+		assert.NotContains(t, body, `<option value="1"`, "organization can't be part of itself")
+	})
+	t.Run("update keeps fields that aren't in the form", func(t *testing.T) {
+		mux, updated := setup(t)
+		form := url.Values{
+			"name":                  {"New name"},
+			"identifier[0][System]": {"http://fhir.nl/fhir/NamingSystem/ura"},
+			"identifier[0][Value]":  {"00000002"},
+			"identifier[1][System]": {"http://fhir.nl/fhir/NamingSystem/kvk"},
+			"identifier[1][Value]":  {"12345678"},
+			"identifier[2][System]": {"http://fhir.nl/fhir/NamingSystem/agb-z"},
+			"identifier[2][Value]":  {""},
+			"type":                  {"prov"},
+		}
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/organization/1/edit", strings.NewReader(form.Encode()))
+		httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		withCSRFToken(httpRequest)
+		httpResponse := httptest.NewRecorder()
+
+		mux.ServeHTTP(httpResponse, httpRequest)
+
+		require.Equal(t, http.StatusOK, httpResponse.Code)
+		require.NotNil(t, updated.Id)
+		assert.Equal(t, "1", *updated.Id)
+		assert.Equal(t, "New name", *updated.Name)
+		assert.False(t, *updated.Active)
+		require.Len(t, updated.Identifier, 3)
+		assert.Equal(t, "other-1", *updated.Identifier[0].Value)
+		assert.Equal(t, "http://fhir.nl/fhir/NamingSystem/ura", *updated.Identifier[1].System)
+		assert.Equal(t, "00000002", *updated.Identifier[1].Value)
+		assert.Equal(t, "http://fhir.nl/fhir/NamingSystem/kvk", *updated.Identifier[2].System)
+		assert.Equal(t, "12345678", *updated.Identifier[2].Value)
+		require.Len(t, updated.Endpoint, 1)
+		assert.Equal(t, "Endpoint/ep-1", *updated.Endpoint[0].Reference)
+	})
+}
+
+func TestFindAll(t *testing.T) {
+	fhirMux := http.NewServeMux()
+	var fhirServer *httptest.Server
+	fhirMux.HandleFunc("/fhir/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[{"resource":{"resourceType":"Organization","id":"2"}}]}`))
+	})
+	fhirMux.HandleFunc("POST /fhir/Organization/_search", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "100", r.FormValue("_count"))
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","link":[{"relation":"next","url":"` + fhirServer.URL + `/fhir/Organization?page=2"}],` +
+			`"entry":[{"resource":{"resourceType":"Organization","id":"1"}}]}`))
+	})
+	fhirServer = httptest.NewServer(fhirMux)
+	t.Cleanup(fhirServer.Close)
+	component := New(Config{FHIRBaseURL: fhirServer.URL + "/fhir"})
+	require.NotNil(t, component)
+
+	organizations, err := findAll[fhir.Organization](component.fhirClient)
+
+	require.NoError(t, err)
+	require.Len(t, organizations, 2)
+	assert.Equal(t, "1", *organizations[0].Id)
+	assert.Equal(t, "2", *organizations[1].Id)
+}
+
+func TestComponent_associateEndpointsPost(t *testing.T) {
+	setup := func(t *testing.T, currentVersion string) (*http.ServeMux, *string) {
+		var ifMatch string
+		fhirMux := http.NewServeMux()
+		fhirMux.HandleFunc("GET /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Organization","id":"1","meta":{"versionId":"3"},"name":"Test Organization"}`))
+		})
+		fhirMux.HandleFunc("GET /fhir/Endpoint/ep-1", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json")
+			_, _ = w.Write([]byte(`{"resourceType":"Endpoint","id":"ep-1","address":"https://example.com"}`))
+		})
+		fhirMux.HandleFunc("PUT /fhir/Organization/1", func(w http.ResponseWriter, r *http.Request) {
+			ifMatch = r.Header.Get("If-Match")
+			w.Header().Set("Content-Type", "application/fhir+json")
+			if ifMatch != `W/"`+currentVersion+`"` {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = w.Write([]byte(`{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"conflict"}]}`))
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(data)
+		})
+		fhirServer := httptest.NewServer(fhirMux)
+		t.Cleanup(fhirServer.Close)
+		component := New(Config{FHIRBaseURL: fhirServer.URL + "/fhir"})
+		require.NotNil(t, component)
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+		return mux, &ifMatch
+	}
+	post := func(mux *http.ServeMux) *httptest.ResponseRecorder {
+		form := url.Values{"selected-endpoint": {"ep-1"}}
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/organization/1/endpoints", strings.NewReader(form.Encode()))
+		httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		withCSRFToken(httpRequest)
+		httpRequest.Header.Set("HX-Request", "true")
+		httpResponse := httptest.NewRecorder()
+		mux.ServeHTTP(httpResponse, httpRequest)
+		return httpResponse
+	}
+
+	t.Run("update is conditional on the version that was read", func(t *testing.T) {
+		mux, ifMatch := setup(t, "3")
+
+		httpResponse := post(mux)
+
+		assert.Equal(t, http.StatusCreated, httpResponse.Code)
+		assert.Equal(t, `W/"3"`, *ifMatch)
+	})
+	t.Run("version has moved on", func(t *testing.T) {
+		mux, _ := setup(t, "4")
+
+		httpResponse := post(mux)
+
+		assert.Equal(t, http.StatusConflict, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "The resource was changed by someone else in the meantime.")
+	})
+}
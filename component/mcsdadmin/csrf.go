@@ -0,0 +1,85 @@
+package mcsdadmin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	csrfCookieName = "mcsdadmin_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// csrfProtect protects the handler against cross-site request forgery using the double-submit cookie pattern:
+// a random token is set in a cookie, and every request that isn't a GET, HEAD or OPTIONS must also carry that token,
+// in the X-CSRF-Token header (set by HTMX, or by JSON API clients) or the csrf_token form field (plain form posts).
+// A cross-site page can make the browser send the cookie, but can't read it to put it in the request.
+// The token is made available to the templates through the ResponseWriter.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if cookie, err := r.Cookie(csrfCookieName); err == nil {
+			token = cookie.Value
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			submitted := r.Header.Get(csrfHeaderName)
+			if submitted == "" {
+				submitted = r.PostFormValue(csrfFormField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) != 1 {
+				slog.WarnContext(r.Context(), "Rejected request with invalid CSRF token",
+					slog.String("method", r.Method), slog.String("path", r.URL.Path))
+				csrfError(w, r)
+				return
+			}
+		}
+
+		if token == "" {
+			token = newCSRFToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    token,
+				Path:     "/mcsdadmin",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(csrfResponseWriter{ResponseWriter: w, token: token}, r)
+	})
+}
+
+func csrfError(w http.ResponseWriter, r *http.Request) {
+	const msg = "Invalid or missing CSRF token. Reload the page and try again."
+	if strings.HasPrefix(r.URL.Path, "/mcsdadmin/api/") {
+		apiError(w, r, http.StatusForbidden, msg)
+	} else if r.Header.Get("HX-Request") == "true" {
+		respondErrorAlert(w, msg, http.StatusForbidden)
+	} else {
+		respondErrorPage(w, msg, http.StatusForbidden)
+	}
+}
+
+func newCSRFToken() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// csrfResponseWriter carries the CSRF token of the request, so the templates can include it in forms and HTMX requests.
+type csrfResponseWriter struct {
+	http.ResponseWriter
+	token string
+}
+
+func (w csrfResponseWriter) CSRFToken() string {
+	return w.token
+}
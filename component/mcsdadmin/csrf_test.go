@@ -0,0 +1,116 @@
+package mcsdadmin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withCSRFToken sets a matching CSRF cookie and header on the request, as a browser using the admin application would.
+func withCSRFToken(r *http.Request) {
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+	r.Header.Set(csrfHeaderName, "test-token")
+}
+
+func TestCSRFProtect(t *testing.T) {
+	var called bool
+	handler := csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		called = false
+		httpResponse := httptest.NewRecorder()
+		handler.ServeHTTP(httpResponse, r)
+		return httpResponse
+	}
+
+	t.Run("GET sets token cookie", func(t *testing.T) {
+		httpResponse := do(httptest.NewRequest(http.MethodGet, "/mcsdadmin", nil))
+
+		assert.True(t, called)
+		cookies := httpResponse.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, csrfCookieName, cookies[0].Name)
+		assert.NotEmpty(t, cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	})
+	t.Run("GET keeps existing token", func(t *testing.T) {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/mcsdadmin", nil)
+		httpRequest.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+
+		httpResponse := do(httpRequest)
+
+		assert.True(t, called)
+		assert.Empty(t, httpResponse.Result().Cookies())
+	})
+	t.Run("POST with token in header", func(t *testing.T) {
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/organization/new", nil)
+		withCSRFToken(httpRequest)
+
+		httpResponse := do(httpRequest)
+
+		assert.True(t, called)
+		assert.Equal(t, http.StatusOK, httpResponse.Code)
+	})
+	t.Run("POST with token in form", func(t *testing.T) {
+		form := url.Values{csrfFormField: {"test-token"}}
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/organization/new", strings.NewReader(form.Encode()))
+		httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		httpRequest.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+
+		do(httpRequest)
+
+		assert.True(t, called)
+	})
+	t.Run("DELETE without token", func(t *testing.T) {
+		httpRequest := httptest.NewRequest(http.MethodDelete, "/mcsdadmin/organization/1", nil)
+		httpRequest.Header.Set("HX-Request", "true")
+		httpRequest.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+
+		httpResponse := do(httpRequest)
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusForbidden, httpResponse.Code)
+		assert.Contains(t, httpResponse.Body.String(), "Invalid or missing CSRF token")
+	})
+	t.Run("POST with mismatching token", func(t *testing.T) {
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/organization/new", nil)
+		httpRequest.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+		httpRequest.Header.Set(csrfHeaderName, "other-token")
+
+		httpResponse := do(httpRequest)
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusForbidden, httpResponse.Code)
+	})
+	t.Run("POST without cookie", func(t *testing.T) {
+		httpRequest := httptest.NewRequest(http.MethodPost, "/mcsdadmin/api/organization", nil)
+		httpRequest.Header.Set(csrfHeaderName, "test-token")
+
+		httpResponse := do(httpRequest)
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusForbidden, httpResponse.Code)
+		assert.JSONEq(t, `{"error":"Invalid or missing CSRF token. Reload the page and try again."}`, httpResponse.Body.String())
+	})
+	t.Run("token is rendered in pages", func(t *testing.T) {
+		component := New(Config{FHIRBaseURL: "http://example.com/fhir"})
+		require.NotNil(t, component)
+		mux := http.NewServeMux()
+		component.RegisterHttpHandlers(mux, http.NewServeMux())
+		httpRequest := httptest.NewRequest(http.MethodGet, "/mcsdadmin", nil)
+		httpRequest.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "test-token"})
+		httpResponse := httptest.NewRecorder()
+
+		mux.ServeHTTP(httpResponse, httpRequest)
+
+		assert.Contains(t, httpResponse.Body.String(), `hx-headers='{"X-CSRF-Token": "test-token"}'`)
+	})
+}
@@ -1,9 +1,16 @@
 package formdata
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/nuts-foundation/nuts-knooppunt/component/mcsdadmin/valuesets"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
@@ -55,11 +62,16 @@ func ParseMaps(postform url.Values, fieldName string) []map[string]string {
 		partial[propKeyMatch] = val[0]
 	}
 
-	// Now let's construct the return value
-	partialsLen := len(partials)
-	out := make([]map[key]value, 0, partialsLen)
-	for _, part := range partials {
-		out = append(out, part)
+	// Now let's construct the return value, in the order of the indices
+	indices := slices.Collect(maps.Keys(partials))
+	slices.SortFunc(indices, func(a, b index) int {
+		ai, _ := strconv.Atoi(a)
+		bi, _ := strconv.Atoi(b)
+		return cmp.Compare(ai, bi)
+	})
+	out := make([]map[key]value, 0, len(partials))
+	for _, idx := range indices {
+		out = append(out, partials[idx])
 	}
 	return out
 }
@@ -102,29 +114,11 @@ func CodablesFromFormWithCustom(postform url.Values, set []fhir.Coding, key stri
 				customCodeKey := "custom-code[" + index + "]"
 				customDisplayKey := "custom-display[" + index + "]"
 
-				customSystem := postform.Get(customSystemKey)
-				customCode := postform.Get(customCodeKey)
-				customDisplay := postform.Get(customDisplayKey)
-
-				if customSystem == "" || customCode == "" {
+				codable, ok := customCodable(postform.Get(customSystemKey), postform.Get(customCodeKey), postform.Get(customDisplayKey))
+				if !ok {
 					allOk = false
 					continue
 				}
-
-				coding := fhir.Coding{
-					System: &customSystem,
-					Code:   &customCode,
-				}
-				if customDisplay != "" {
-					coding.Display = &customDisplay
-				}
-
-				codable := fhir.CodeableConcept{
-					Coding: []fhir.Coding{coding},
-				}
-				if customDisplay != "" {
-					codable.Text = &customDisplay
-				}
 				codables = append(codables, codable)
 			} else {
 				// Handle standard coding from valueset
@@ -141,6 +135,51 @@ func CodablesFromFormWithCustom(postform url.Values, set []fhir.Coding, key stri
 	return codables, allOk
 }
 
+// CodablesFromFormStrict is like CodablesFromForm, but returns an error that reports which codes aren't part of the set.
+// If allowCustom is true, the code "other" results in a custom coding, read from the "custom-system", "custom-code" and "custom-display" fields.
+func CodablesFromFormStrict(postform url.Values, set []fhir.Coding, key string, allowCustom bool) ([]fhir.CodeableConcept, error) {
+	var codables []fhir.CodeableConcept
+	var unknownCodes []string
+	for _, code := range filterEmpty(postform[key]) {
+		if code == "other" && allowCustom {
+			codable, ok := customCodable(postform.Get("custom-system"), postform.Get("custom-code"), postform.Get("custom-display"))
+			if !ok {
+				return nil, errors.New("custom code requires both a system and a code")
+			}
+			codables = append(codables, codable)
+			continue
+		}
+		codable, ok := valuesets.CodableFrom(set, code)
+		if !ok {
+			unknownCodes = append(unknownCodes, code)
+			continue
+		}
+		codables = append(codables, codable)
+	}
+	if len(unknownCodes) > 0 {
+		return nil, fmt.Errorf("unknown code(s): %s", strings.Join(unknownCodes, ", "))
+	}
+	return codables, nil
+}
+
+func customCodable(system string, code string, display string) (fhir.CodeableConcept, bool) {
+	if system == "" || code == "" {
+		return fhir.CodeableConcept{}, false
+	}
+	coding := fhir.Coding{
+		System: &system,
+		Code:   &code,
+	}
+	codable := fhir.CodeableConcept{
+		Coding: []fhir.Coding{coding},
+	}
+	if display != "" {
+		codable.Coding[0].Display = &display
+		codable.Text = &display
+	}
+	return codable, true
+}
+
 func filterEmpty(multiStrings []string) []string {
 	out := make([]string, 0, len(multiStrings))
 	for _, str := range multiStrings {
@@ -18,4 +18,21 @@ func TestPostForm(t *testing.T) {
 
 	result := ParseMaps(postform, "telecom")
 	require.Equal(t, 2, len(result), "Expected two telecom entries")
+	require.Equal(t, "phone", result[0]["System"])
+	require.Equal(t, "email", result[1]["System"])
+}
+
+func TestParseMaps_order(t *testing.T) {
+	postform := map[string][]string{
+		"identifier[10][Value]": {"c"},
+		"identifier[2][Value]":  {"b"},
+		"identifier[0][Value]":  {"a"},
+	}
+
+	result := ParseMaps(postform, "identifier")
+
+	require.Len(t, result, 3)
+	require.Equal(t, "a", result[0]["Value"])
+	require.Equal(t, "b", result[1]["Value"])
+	require.Equal(t, "c", result[2]["Value"])
 }
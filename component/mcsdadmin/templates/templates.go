@@ -6,7 +6,10 @@ import (
 	"html/template"
 	"io"
 	"log/slog"
+	"slices"
+	"strings"
 
+	"github.com/nuts-foundation/nuts-knooppunt/component/mcsdadmin/valuesets"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
 	"github.com/nuts-foundation/nuts-knooppunt/lib/logging"
 	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
@@ -32,6 +35,32 @@ func init() {
 	}
 }
 
+// Branding contains the customizable branding of the web application, rendered by the base template.
+type Branding struct {
+	Title string
+	// LogoURL is shown in the navigation bar instead of the default icon, if set.
+	LogoURL string
+	// AccentColor is used as background color of the navigation bar, if set.
+	AccentColor string
+}
+
+const defaultTitle = "mCSD Admin"
+
+var branding = Branding{Title: defaultTitle}
+
+// SetBranding sets the branding used by RenderWithBase. If no title is set, the default title is used.
+func SetBranding(b Branding) {
+	if b.Title == "" {
+		b.Title = defaultTitle
+	}
+	branding = b
+}
+
+// CSRFTokenProvider is implemented by writers that carry the CSRF token of the request being responded to.
+type CSRFTokenProvider interface {
+	CSRFToken() string
+}
+
 func RenderWithBase(w io.Writer, name string, data any) {
 	files := []string{
 		"base.html",
@@ -39,7 +68,16 @@ func RenderWithBase(w io.Writer, name string, data any) {
 	}
 	files = append(files, partialTemplates...)
 
-	ts, err := template.ParseFS(tmplFS, files...)
+	var csrfToken string
+	if provider, ok := w.(CSRFTokenProvider); ok {
+		csrfToken = provider.CSRFToken()
+	}
+
+	ts, err := template.New("").Funcs(template.FuncMap{
+		"branding":   func() Branding { return branding },
+		"csrfToken":  func() string { return csrfToken },
+		"isSelected": isSelected,
+	}).ParseFS(tmplFS, files...)
 	if err != nil {
 		slog.Error("Failed to parse template", logging.Error(err))
 		return
@@ -67,6 +105,11 @@ func RenderPartial(w io.Writer, name string, data any) {
 	}
 }
 
+// isSelected returns whether the code of a value set option is the selected code, used to pre-fill forms.
+func isSelected(code *string, selected string) bool {
+	return code != nil && *code == selected
+}
+
 const unknownStr = "N/A"
 
 type EpListProps struct {
@@ -100,6 +143,22 @@ func fmtCoding(cd fhir.Coding) string {
 	return unknownStr
 }
 
+// fmtContactPoints formats the contact points as a comma-separated list of "system: value".
+func fmtContactPoints(contactPoints []fhir.ContactPoint) string {
+	formatted := make([]string, 0, len(contactPoints))
+	for _, cp := range contactPoints {
+		value := unknownStr
+		if cp.Value != nil {
+			value = *cp.Value
+		}
+		if cp.System != nil {
+			value = cp.System.Display() + ": " + value
+		}
+		formatted = append(formatted, value)
+	}
+	return strings.Join(formatted, ", ")
+}
+
 func fmtPeriod(period fhir.Period) string {
 	return *period.Start + " - " + *period.End
 }
@@ -384,7 +443,11 @@ func MakePractitionerRoleProps(role fhir.PractitionerRole) PractitionerRoleProps
 		out.Code = unknownStr
 	}
 
-	out.Telecom = unknownStr
+	if len(role.Telecom) > 0 {
+		out.Telecom = fmtContactPoints(role.Telecom)
+	} else {
+		out.Telecom = unknownStr
+	}
 
 	return out
 }
@@ -396,3 +459,252 @@ func MakePractitionerRoleXsProps(roles []fhir.PractitionerRole) []PractitionerRo
 	}
 	return out
 }
+
+// CodingFormProps contains a selected code of a form. Codes that aren't part of the value set are selected as "other",
+// with the custom coding in System, CustomCode and Display.
+type CodingFormProps struct {
+	Code       string
+	System     string
+	CustomCode string
+	Display    string
+}
+
+func makeCodingFormProps(codable fhir.CodeableConcept, set []fhir.Coding) CodingFormProps {
+	if len(codable.Coding) == 0 || codable.Coding[0].Code == nil {
+		return CodingFormProps{}
+	}
+	cd := codable.Coding[0]
+	if known, ok := valuesets.CodingFrom(set, *cd.Code); ok && fmtOptional(known.System) == fmtOptional(cd.System) {
+		return CodingFormProps{Code: *cd.Code}
+	}
+	out := CodingFormProps{
+		Code:       "other",
+		System:     fmtOptional(cd.System),
+		CustomCode: *cd.Code,
+		Display:    fmtOptional(cd.Display),
+	}
+	if codable.Text != nil {
+		out.Display = *codable.Text
+	}
+	return out
+}
+
+// makeCodingsFormProps returns the selected codes of a form. If no codes are selected, it returns a single empty code,
+// since a form always shows at least one (empty) select.
+func makeCodingsFormProps(codables []fhir.CodeableConcept, set []fhir.Coding) []CodingFormProps {
+	out := make([]CodingFormProps, 0, len(codables))
+	for _, codable := range codables {
+		out = append(out, makeCodingFormProps(codable, set))
+	}
+	if len(out) == 0 {
+		out = append(out, CodingFormProps{})
+	}
+	return out
+}
+
+func fmtOptional(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// OrgFormProps contains the values of an Organization to pre-fill the form with. For a new Organization, it's empty.
+type OrgFormProps struct {
+	Id          string
+	Name        string
+	Identifiers []IdentifierFormProps
+	Active      bool
+	Types       []CodingFormProps
+	PartOf      string
+}
+
+// IdentifierFormProps contains an identifier of a form.
+type IdentifierFormProps struct {
+	System string
+	Value  string
+}
+
+// MakeOrgFormProps returns the form values of the Organization. Only identifiers of the given systems are included,
+// with at least one (empty) identifier so the form shows an identifier input.
+func MakeOrgFormProps(org fhir.Organization, identifierSystems []fhir.Coding) OrgFormProps {
+	out := OrgFormProps{
+		Id:     fmtOptional(org.Id),
+		Name:   fmtOptional(org.Name),
+		Active: org.Active != nil && *org.Active,
+		Types:  makeCodingsFormProps(org.Type, valuesets.OrganizationTypeCodings),
+	}
+	for _, identifier := range org.Identifier {
+		if identifier.System == nil || !slices.ContainsFunc(identifierSystems, func(system fhir.Coding) bool {
+			return system.Code != nil && *system.Code == *identifier.System
+		}) {
+			continue
+		}
+		out.Identifiers = append(out.Identifiers, IdentifierFormProps{
+			System: *identifier.System,
+			Value:  fmtOptional(identifier.Value),
+		})
+	}
+	if len(out.Identifiers) == 0 {
+		out.Identifiers = append(out.Identifiers, IdentifierFormProps{System: coding.URANamingSystem})
+	}
+	if org.PartOf != nil && org.PartOf.Reference != nil {
+		out.PartOf = strings.TrimPrefix(*org.PartOf.Reference, "Organization/")
+	}
+	return out
+}
+
+// ServiceFormProps contains the values of a HealthcareService to pre-fill the form with. For a new HealthcareService, it's empty.
+type ServiceFormProps struct {
+	Id         string
+	Name       string
+	Active     bool
+	Types      []CodingFormProps
+	ProvidedBy string
+}
+
+func MakeServiceFormProps(service fhir.HealthcareService) ServiceFormProps {
+	out := ServiceFormProps{
+		Id:     fmtOptional(service.Id),
+		Name:   fmtOptional(service.Name),
+		Active: service.Active != nil && *service.Active,
+		Types:  makeCodingsFormProps(service.Type, valuesets.ServiceTypeCodings),
+	}
+	if service.ProvidedBy != nil && service.ProvidedBy.Reference != nil {
+		out.ProvidedBy = strings.TrimPrefix(*service.ProvidedBy.Reference, "Organization/")
+	}
+	return out
+}
+
+// EpFormProps contains the values of an Endpoint to pre-fill the form with. For a new Endpoint, it's empty.
+type EpFormProps struct {
+	Id             string
+	Address        string
+	PayloadTypes   []CodingFormProps
+	PeriodStart    string
+	PeriodEnd      string
+	Contact        string
+	ManagingOrgKvK string
+	ConnectionType string
+	PurposeOfUse   string
+	Status         string
+}
+
+func MakeEpFormProps(ep fhir.Endpoint) EpFormProps {
+	out := EpFormProps{
+		Id:             fmtOptional(ep.Id),
+		Address:        ep.Address,
+		PayloadTypes:   makeCodingsFormProps(ep.PayloadType, valuesets.EndpointPayloadTypeCodings),
+		ConnectionType: fmtOptional(ep.ConnectionType.Code),
+	}
+	if out.Id != "" {
+		out.Status = ep.Status.Code()
+	}
+	if ep.Period != nil {
+		out.PeriodStart = fmtOptional(ep.Period.Start)
+		out.PeriodEnd = fmtOptional(ep.Period.End)
+	}
+	if len(ep.Contact) > 0 {
+		out.Contact = fmtOptional(ep.Contact[0].Value)
+	}
+	if ep.ManagingOrganization != nil && ep.ManagingOrganization.Identifier != nil {
+		out.ManagingOrgKvK = fmtOptional(ep.ManagingOrganization.Identifier.Value)
+	}
+	for _, extension := range ep.Extension {
+		if extension.Url == valuesets.PurposeOfUseExtensionURL && extension.ValueCodeableConcept != nil {
+			out.PurposeOfUse = makeCodingFormProps(*extension.ValueCodeableConcept, valuesets.PurposeOfUseCodings).Code
+		}
+	}
+	return out
+}
+
+// LocationFormProps contains the values of a Location to pre-fill the form with. For a new Location, it's empty.
+type LocationFormProps struct {
+	Id                string
+	Name              string
+	Type              string
+	Status            string
+	AddressLine       string
+	AddressCity       string
+	AddressDistrict   string
+	AddressState      string
+	AddressPostalCode string
+	AddressCountry    string
+	PhysicalType      string
+	ManagingOrg       string
+}
+
+func MakeLocationFormProps(location fhir.Location) LocationFormProps {
+	out := LocationFormProps{
+		Id:   fmtOptional(location.Id),
+		Name: fmtOptional(location.Name),
+	}
+	if len(location.Type) > 0 {
+		out.Type = makeCodingFormProps(location.Type[0], valuesets.LocationTypeCodings).Code
+	}
+	if location.Status != nil {
+		out.Status = location.Status.Code()
+	}
+	if location.Address != nil {
+		out.AddressLine = strings.Join(location.Address.Line, ", ")
+		out.AddressCity = fmtOptional(location.Address.City)
+		out.AddressDistrict = fmtOptional(location.Address.District)
+		out.AddressState = fmtOptional(location.Address.State)
+		out.AddressPostalCode = fmtOptional(location.Address.PostalCode)
+		out.AddressCountry = fmtOptional(location.Address.Country)
+	}
+	if location.PhysicalType != nil {
+		out.PhysicalType = makeCodingFormProps(*location.PhysicalType, valuesets.LocationPhysicalTypeCodings).Code
+	}
+	if location.ManagingOrganization != nil && location.ManagingOrganization.Reference != nil {
+		out.ManagingOrg = strings.TrimPrefix(*location.ManagingOrganization.Reference, "Organization/")
+	}
+	return out
+}
+
+// TelecomFormProps contains a contact point of a form.
+type TelecomFormProps struct {
+	System string
+	Value  string
+}
+
+// PractitionerRoleFormProps contains the values of a PractitionerRole to pre-fill the form with. For a new PractitionerRole, it's empty.
+type PractitionerRoleFormProps struct {
+	Id           string
+	Uzi          string
+	Organization string
+	Codes        []CodingFormProps
+	// CustomCode is the first selected code that isn't part of the value set, which is shown in the custom code fields.
+	CustomCode CodingFormProps
+	Telecom    []TelecomFormProps
+}
+
+func MakePractitionerRoleFormProps(role fhir.PractitionerRole) PractitionerRoleFormProps {
+	out := PractitionerRoleFormProps{
+		Id:    fmtOptional(role.Id),
+		Codes: makeCodingsFormProps(role.Code, valuesets.PractitionerRoleCodings),
+	}
+	if role.Practitioner != nil && role.Practitioner.Identifier != nil {
+		out.Uzi = fmtOptional(role.Practitioner.Identifier.Value)
+	}
+	if role.Organization != nil && role.Organization.Reference != nil {
+		out.Organization = strings.TrimPrefix(*role.Organization.Reference, "Organization/")
+	}
+	for _, code := range out.Codes {
+		if code.Code == "other" {
+			out.CustomCode = code
+			break
+		}
+	}
+	for _, contactPoint := range role.Telecom {
+		telecom := TelecomFormProps{Value: fmtOptional(contactPoint.Value)}
+		if contactPoint.System != nil {
+			telecom.System = contactPoint.System.Code()
+		}
+		out.Telecom = append(out.Telecom, telecom)
+	}
+	if len(out.Telecom) == 0 {
+		out.Telecom = append(out.Telecom, TelecomFormProps{})
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestMakePractitionerRoleProps(t *testing.T) {
+	t.Run("telecom", func(t *testing.T) {
+		role := fhir.PractitionerRole{
+			Telecom: []fhir.ContactPoint{
+				{System: to.Ptr(fhir.ContactPointSystemPhone), Value: to.Ptr("+31 20 1234567")},
+				{System: to.Ptr(fhir.ContactPointSystemEmail), Value: to.Ptr("doctor@example.com")},
+			},
+		}
+
+		props := MakePractitionerRoleProps(role)
+
+		assert.Equal(t, "Phone: +31 20 1234567, Email: doctor@example.com", props.Telecom)
+	})
+	t.Run("no telecom", func(t *testing.T) {
+		props := MakePractitionerRoleProps(fhir.PractitionerRole{})
+
+		assert.Equal(t, unknownStr, props.Telecom)
+	})
+}
@@ -0,0 +1,132 @@
+package mcsdadmin
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nuts-foundation/nuts-knooppunt/component/mcsdadmin/valuesets"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+// errEndpointAlreadyAssociated is returned when an Endpoint is associated with a resource that already references it.
+var errEndpointAlreadyAssociated = errors.New("endpoint already associated")
+
+// The validate functions check the rules the admin application enforces on resources, regardless of whether they were
+// submitted through a form or the JSON API.
+
+// validateOrganization checks that the Organization has either a URA identifier or a parent organization,
+// and that its URA identifiers are valid.
+func validateOrganization(org fhir.Organization) error {
+	hasURA := false
+	for _, identifier := range org.Identifier {
+		if identifier.System == nil || *identifier.System != coding.URANamingSystem {
+			continue
+		}
+		if err := validateURA(to.EmptyString(identifier.Value)); err != nil {
+			return err
+		}
+		hasURA = true
+	}
+	if !hasURA && (org.PartOf == nil || org.PartOf.Reference == nil) {
+		return errors.New("organization must have either a URA identifier or a parent organization (part-of)")
+	}
+	return nil
+}
+
+// validateURA checks that the value is a URA (UZI-register abonneenummer), which consists of exactly 8 digits.
+func validateURA(ura string) error {
+	if len(ura) != 8 || strings.ContainsFunc(ura, func(r rune) bool { return r < '0' || r > '9' }) {
+		return fmt.Errorf("invalid URA identifier %q: must consist of exactly 8 digits", ura)
+	}
+	return nil
+}
+
+// validateEndpoint checks that the Endpoint has an address, payload type and connection type.
+func validateEndpoint(endpoint fhir.Endpoint) error {
+	if endpoint.Address == "" {
+		return errors.New("missing address")
+	}
+	if len(endpoint.PayloadType) < 1 {
+		return errors.New("missing payload type")
+	}
+	if endpoint.ConnectionType.Code == nil {
+		return errors.New("missing connection type")
+	}
+	return nil
+}
+
+// validateLocation checks that the Location has an address line.
+func validateLocation(location fhir.Location) error {
+	if location.Address == nil || len(location.Address.Line) == 0 || location.Address.Line[0] == "" {
+		return errors.New("missing address line")
+	}
+	return nil
+}
+
+// validateHealthcareService checks that the HealthcareService references the organization providing it.
+func validateHealthcareService(service fhir.HealthcareService) error {
+	if service.ProvidedBy == nil || service.ProvidedBy.Reference == nil {
+		return errors.New("missing providing organization")
+	}
+	return nil
+}
+
+// validatePractitionerRole checks that the PractitionerRole references a practitioner by UZI number and an organization.
+// Codes must be in the practitioner role value set, unless custom codes are allowed.
+func validatePractitionerRole(role fhir.PractitionerRole) error {
+	if role.Practitioner == nil || role.Practitioner.Identifier == nil ||
+		role.Practitioner.Identifier.System == nil || *role.Practitioner.Identifier.System != coding.UZINamingSystem ||
+		role.Practitioner.Identifier.Value == nil || *role.Practitioner.Identifier.Value == "" {
+		return errors.New("required field uzi-number missing")
+	}
+	if role.Organization == nil || role.Organization.Reference == nil {
+		return errors.New("missing organization")
+	}
+	if allowCustomPractitionerRoleCodes {
+		return nil
+	}
+	var unknownCodes []string
+	for _, codable := range role.Code {
+		for _, c := range codable.Coding {
+			known, ok := valuesets.CodingFrom(valuesets.PractitionerRoleCodings, to.EmptyString(c.Code))
+			if !ok || to.EmptyString(known.System) != to.EmptyString(c.System) {
+				unknownCodes = append(unknownCodes, to.EmptyString(c.Code))
+			}
+		}
+	}
+	if len(unknownCodes) > 0 {
+		return fmt.Errorf("invalid practitioner role code: unknown code(s): %s", strings.Join(unknownCodes, ", "))
+	}
+	return nil
+}
+
+// resolveOrganizationReference sets the display of the reference to the name of the referenced Organization.
+// It returns an error if the Organization can't be read. A nil reference is left as-is.
+func resolveOrganizationReference(ref *fhir.Reference) error {
+	if ref == nil || ref.Reference == nil {
+		return nil
+	}
+	var org fhir.Organization
+	if err := client.Read(*ref.Reference, &org); err != nil {
+		return err
+	}
+	ref.Display = org.Name
+	return nil
+}
+
+// addEndpointReference adds a reference to the Endpoint to the given references,
+// returning errEndpointAlreadyAssociated if it's already in there.
+func addEndpointReference(refs []fhir.Reference, endpointId string) ([]fhir.Reference, error) {
+	if slices.ContainsFunc(refs, func(ref fhir.Reference) bool {
+		return idFromRef(ref) == endpointId
+	}) {
+		return nil, errEndpointAlreadyAssociated
+	}
+	return append(refs, fhir.Reference{
+		Reference: to.Ptr("Endpoint/" + endpointId),
+	}), nil
+}
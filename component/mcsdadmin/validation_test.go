@@ -0,0 +1,50 @@
+package mcsdadmin
+
+import (
+	"testing"
+
+	"github.com/nuts-foundation/nuts-knooppunt/lib/coding"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/zorgbijjou/golang-fhir-models/fhir-models/fhir"
+)
+
+func TestValidateURA(t *testing.T) {
+	for _, ura := range []string{"12345678", "00000001"} {
+		t.Run("valid "+ura, func(t *testing.T) {
+			assert.NoError(t, validateURA(ura))
+		})
+	}
+	for _, ura := range []string{"", "1234567", "123456789", "1234567a", "1234 567", " 12345678", "１２３４５６７８"} {
+		t.Run("invalid "+ura, func(t *testing.T) {
+			assert.EqualError(t, validateURA(ura), `invalid URA identifier "`+ura+`": must consist of exactly 8 digits`)
+		})
+	}
+}
+
+func TestValidateOrganization(t *testing.T) {
+	uraIdentifier := func(value string) fhir.Identifier {
+		return fhir.Identifier{System: to.Ptr(coding.URANamingSystem), Value: to.Ptr(value)}
+	}
+	t.Run("valid URA", func(t *testing.T) {
+		assert.NoError(t, validateOrganization(fhir.Organization{Identifier: []fhir.Identifier{uraIdentifier("12345678")}}))
+	})
+	t.Run("invalid URA", func(t *testing.T) {
+		err := validateOrganization(fhir.Organization{Identifier: []fhir.Identifier{uraIdentifier("1234567")}})
+		assert.EqualError(t, err, `invalid URA identifier "1234567": must consist of exactly 8 digits`)
+	})
+	t.Run("invalid URA with parent organization", func(t *testing.T) {
+		err := validateOrganization(fhir.Organization{
+			Identifier: []fhir.Identifier{uraIdentifier("abc")},
+			PartOf:     &fhir.Reference{Reference: to.Ptr("Organization/1")},
+		})
+		assert.Error(t, err)
+	})
+	t.Run("other identifiers aren't validated as URA", func(t *testing.T) {
+		err := validateOrganization(fhir.Organization{
+			Identifier: []fhir.Identifier{{System: to.Ptr(coding.KVKNamingSystem), Value: to.Ptr("kvk-1")}},
+			PartOf:     &fhir.Reference{Reference: to.Ptr("Organization/1")},
+		})
+		assert.NoError(t, err)
+	})
+}
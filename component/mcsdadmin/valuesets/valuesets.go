@@ -35,6 +35,9 @@ var OrganizationTypeCodings = mustGetValueSet("organization-type")
 // PurposeOfUseCodings contains the codings from https://terminology.hl7.org/6.3.0/ValueSet-v3-PurposeOfUse.html
 var PurposeOfUseCodings = mustGetValueSet("purpose-of-use")
 
+// PurposeOfUseExtensionURL is the URL of the extension that holds the purpose of use of an Endpoint.
+const PurposeOfUseExtensionURL = "https://profiles.ihe.net/ITI/mCSD/StructureDefinition/IHE.mCSD.PurposeOfUse"
+
 // ServiceTypeCodings contains the codings from https://hl7.org/fhir/R4/valueset-service-type.html
 var ServiceTypeCodings = mustGetValueSet("service-type")
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/nuts-foundation/nuts-knooppunt/component"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var _ component.Lifecycle = (*Component)(nil)
@@ -12,7 +13,7 @@ var _ component.Lifecycle = (*Component)(nil)
 type Component struct {
 }
 
-// New creates an instance of the status component, which provides a simple health check endpoint.
+// New creates an instance of the status component, which provides a simple health check endpoint and exposes the Prometheus metrics.
 func New() *Component {
 	return &Component{}
 }
@@ -36,4 +37,5 @@ func (c Component) RegisterHttpHandlers(publicMux *http.ServeMux, internalMux *h
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(BuildInfo()))
 	})
+	internalMux.Handle("GET /metrics", promhttp.Handler())
 }
@@ -8,6 +8,7 @@ import (
 const URANamingSystem = "http://fhir.nl/fhir/NamingSystem/ura"
 const UZINamingSystem = "http://fhir.nl/fhir/NamingSystem/uzi"
 const KVKNamingSystem = "http://fhir.nl/fhir/NamingSystem/kvk"
+const AGBNamingSystem = "http://fhir.nl/fhir/NamingSystem/agb-z"
 const BSNNamingSystem = "http://fhir.nl/fhir/NamingSystem/bsn"
 const BSNTransportTokenNamingSystem = "http://fhir.nl/fhir/NamingSystem/bsn-transport-token"
 const MCSDPayloadTypeSystem = "http://nuts-foundation.github.io/nl-generic-functions-ig/CodeSystem/nl-gf-data-exchange-capabilities"
@@ -27,6 +27,7 @@ type ResourceInfo struct {
 	ID           string
 	ResourceType string
 	LastUpdated  *time.Time
+	VersionID    string
 }
 
 // ExtractResourceInfo extracts common FHIR resource fields from JSON bytes.
@@ -57,6 +58,9 @@ func ExtractResourceInfo(resourceJSON []byte) (*ResourceInfo, error) {
 				info.LastUpdated = &t
 			}
 		}
+		if versionID, ok := meta["versionId"].(string); ok {
+			info.VersionID = versionID
+		}
 	}
 
 	return info, nil
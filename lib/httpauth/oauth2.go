@@ -2,24 +2,134 @@ package httpauth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/nuts-foundation/nuts-knooppunt/lib/netutil"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
+// ClientAssertionType is the client_assertion_type for authenticating with a signed JWT (private_key_jwt, RFC 7523).
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionValidity is how long a client assertion is valid after it's created.
+const clientAssertionValidity = time.Minute
+
+// Defaults for retrying token requests, used when they aren't configured.
+const (
+	DefaultTokenRetryAttempts = 3
+	DefaultTokenRetryBackoff  = 500 * time.Millisecond
+	DefaultTokenTimeout       = 30 * time.Second
+)
+
+// Supported values of OAuth2Config.AuthMethod.
+const (
+	// AuthMethodPost sends the client credentials in the token request body (client_secret_post).
+	AuthMethodPost = "post"
+	// AuthMethodBasic sends the client credentials using HTTP Basic authentication (client_secret_basic).
+	AuthMethodBasic = "basic"
+)
+
 // OAuth2Config holds the configuration for OAuth2 client credentials authentication.
+// The client authenticates with either a client secret (client_secret_post or client_secret_basic, see AuthMethod) or,
+// if PrivateKeyPEM is set, a JWT signed with its private key (private_key_jwt).
 type OAuth2Config struct {
 	TokenEndpoint string   `koanf:"tokenendpoint"`
-	ClientID     string   `koanf:"clientid"`
-	ClientSecret string   `koanf:"clientsecret"`
-	Scopes       []string `koanf:"scopes"`
+	ClientID      string   `koanf:"clientid"`
+	ClientSecret  string   `koanf:"clientsecret"`
+	Scopes        []string `koanf:"scopes"`
+	// ClientSecretFile is the path of a file containing the client secret (e.g. a mounted Kubernetes secret),
+	// as alternative to ClientSecret. Trailing whitespace is trimmed. It can't be combined with ClientSecret.
+	ClientSecretFile string `koanf:"clientsecretfile"`
+	// AuthMethod is how the client secret is sent to the token endpoint: AuthMethodPost (default) or AuthMethodBasic.
+	AuthMethod string `koanf:"authmethod"`
+	// Audience is sent as audience parameter in token requests, to scope the token to a specific resource server.
+	Audience string `koanf:"audience"`
+	// ExtraParams are added to the token requests as-is, for parameters specific to the authorization server (e.g. resource).
+	ExtraParams map[string]string `koanf:"extraparams"`
+	// PrivateKeyPEM is the PEM encoded private key (RSA or EC) to sign client assertions with.
+	PrivateKeyPEM string `koanf:"privatekeypem"`
+	// KeyID is set as kid header of client assertions, so the authorization server can find the public key.
+	KeyID string `koanf:"keyid"`
+	// SigningAlg is the JWS algorithm (e.g. RS256, PS256, ES256) to sign client assertions with.
+	// Defaults to RS256 for RSA keys, and ES256, ES384 or ES512 for EC keys depending on the curve.
+	SigningAlg string `koanf:"signingalg"`
+	// TokenRetryAttempts is the maximum number of attempts to acquire a token when the token endpoint
+	// can't be reached or responds with a server error. Defaults to DefaultTokenRetryAttempts.
+	TokenRetryAttempts int `koanf:"tokenretryattempts"`
+	// TokenRetryBackoff is the wait before the first retry, which doubles for every next retry. Defaults to DefaultTokenRetryBackoff.
+	TokenRetryBackoff time.Duration `koanf:"tokenretrybackoff"`
+	// TokenTimeout is the deadline for acquiring a token: it limits the duration of each token request,
+	// and no retry is made that would start after it has passed since the first attempt. Defaults to DefaultTokenTimeout.
+	TokenTimeout time.Duration `koanf:"tokentimeout"`
 }
 
 // IsConfigured returns true if the OAuth2 configuration has all required fields set.
 func (c OAuth2Config) IsConfigured() bool {
-	return c.TokenEndpoint != "" && c.ClientID != "" && c.ClientSecret != ""
+	return c.TokenEndpoint != "" && c.ClientID != "" && (c.ClientSecret != "" || c.ClientSecretFile != "" || c.PrivateKeyPEM != "")
+}
+
+// Validate checks the configuration for mistakes that would only surface when a token is requested.
+// An empty configuration (OAuth2 not used) is valid. The returned error names the offending keys.
+func (c OAuth2Config) Validate() error {
+	if c.TokenEndpoint == "" && c.ClientID == "" && c.ClientSecret == "" && c.ClientSecretFile == "" && c.PrivateKeyPEM == "" {
+		return nil
+	}
+	var problems []string
+	if c.TokenEndpoint == "" {
+		problems = append(problems, "tokenendpoint is required")
+	} else if err := netutil.ValidateHTTPURL(c.TokenEndpoint); err != nil {
+		problems = append(problems, "tokenendpoint "+err.Error())
+	}
+	if c.ClientID == "" {
+		problems = append(problems, "clientid is required")
+	}
+	if c.ClientSecret == "" && c.ClientSecretFile == "" && c.PrivateKeyPEM == "" {
+		problems = append(problems, "clientsecret, clientsecretfile or privatekeypem is required")
+	}
+	if c.ClientSecret != "" && c.ClientSecretFile != "" {
+		problems = append(problems, "clientsecret and clientsecretfile can't both be set")
+	}
+	switch c.AuthMethod {
+	case "", AuthMethodPost, AuthMethodBasic:
+	default:
+		problems = append(problems, fmt.Sprintf("authmethod %q is not supported, supported values are %q and %q", c.AuthMethod, AuthMethodPost, AuthMethodBasic))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// clientSecret returns the client secret, read from ClientSecretFile if set.
+func (c OAuth2Config) clientSecret() (string, error) {
+	if c.ClientSecretFile == "" {
+		return c.ClientSecret, nil
+	}
+	if c.ClientSecret != "" {
+		return "", errors.New("oauth2 clientsecret and clientsecretfile can't both be set")
+	}
+	data, err := os.ReadFile(c.ClientSecretFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read oauth2 client secret file: %w", err)
+	}
+	secret := strings.TrimRightFunc(string(data), unicode.IsSpace)
+	if secret == "" {
+		return "", fmt.Errorf("oauth2 client secret file %s is empty", c.ClientSecretFile)
+	}
+	return secret, nil
 }
 
 // NewOAuth2HTTPClient creates an http.Client that automatically handles OAuth2 client credentials authentication.
@@ -28,24 +138,223 @@ func (c OAuth2Config) IsConfigured() bool {
 // Pass nil to use http.DefaultTransport.
 func NewOAuth2HTTPClient(config OAuth2Config, baseTransport http.RoundTripper) (*http.Client, error) {
 	if !config.IsConfigured() {
-		return nil, fmt.Errorf("oauth2 configuration is incomplete: tokenendpoint, clientid, and clientsecret are required")
+		return nil, fmt.Errorf("oauth2 configuration is incomplete: tokenendpoint, clientid, and clientsecret, clientsecretfile or privatekeypem are required")
 	}
 
-	conf := &clientcredentials.Config{
-		ClientID:     config.ClientID,
-		ClientSecret: config.ClientSecret,
-		TokenURL:     config.TokenEndpoint,
-		Scopes:       config.Scopes,
-		AuthStyle:    oauth2.AuthStyleInParams,
+	var authStyle oauth2.AuthStyle
+	switch config.AuthMethod {
+	case "", AuthMethodPost:
+		authStyle = oauth2.AuthStyleInParams
+	case AuthMethodBasic:
+		authStyle = oauth2.AuthStyleInHeader
+	default:
+		return nil, fmt.Errorf("oauth2 authmethod %q is not supported, supported values are %q and %q", config.AuthMethod, AuthMethodPost, AuthMethodBasic)
 	}
 
 	if baseTransport == nil {
 		baseTransport = http.DefaultTransport
 	}
 
+	retrying := retryingTokenSource{
+		attempts: config.TokenRetryAttempts,
+		backoff:  config.TokenRetryBackoff,
+		timeout:  config.TokenTimeout,
+	}
+	if retrying.attempts <= 0 {
+		retrying.attempts = DefaultTokenRetryAttempts
+	}
+	if retrying.backoff <= 0 {
+		retrying.backoff = DefaultTokenRetryBackoff
+	}
+	if retrying.timeout <= 0 {
+		retrying.timeout = DefaultTokenTimeout
+	}
+
 	// Inject the base transport via context so x/oauth2 uses it for both
 	// token requests and the returned client's underlying transport.
-	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: baseTransport})
+	// The timeout only applies to token requests, since x/oauth2 only takes the transport for the returned client.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Transport: baseTransport,
+		Timeout:   retrying.timeout,
+	})
+	retrying.ctx = ctx
+
+	if config.PrivateKeyPEM != "" {
+		source, err := newClientAssertionTokenSource(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		retrying.source = source
+	} else {
+		clientSecret, err := config.clientSecret()
+		if err != nil {
+			return nil, err
+		}
+		conf := &clientcredentials.Config{
+			ClientID:       config.ClientID,
+			ClientSecret:   clientSecret,
+			TokenURL:       config.TokenEndpoint,
+			Scopes:         config.Scopes,
+			EndpointParams: config.endpointParams(),
+			AuthStyle:      authStyle,
+		}
+		retrying.source = conf.TokenSource(ctx)
+	}
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, retrying)), nil
+}
+
+// retryingTokenSource retries acquiring a token with exponential backoff when the token endpoint can't be reached
+// or responds with a server error (5xx), as long as the retry would start before the timeout has passed.
+// Other errors (e.g. invalid_client) are returned immediately, since retrying won't help.
+type retryingTokenSource struct {
+	// ctx is the context of the token source, waiting for a retry stops when it's done.
+	ctx      context.Context
+	source   oauth2.TokenSource
+	attempts int
+	backoff  time.Duration
+	timeout  time.Duration
+}
+
+func (s retryingTokenSource) Token() (*oauth2.Token, error) {
+	deadline := time.Now().Add(s.timeout)
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		token, err := s.source.Token()
+		if err == nil {
+			return token, nil
+		}
+		if !isRetryableTokenError(err) || attempt >= s.attempts || time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (not retried: %w)", err, s.ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func isRetryableTokenError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return retrieveErr.Response != nil && retrieveErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	// Timeouts and connection errors (e.g. connection refused or reset), but not other errors that occur before
+	// the token endpoint is reached (e.g. an invalid URL) or that won't be solved by retrying (e.g. an untrusted certificate)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
 
-	return conf.Client(ctx), nil
-}
\ No newline at end of file
+// clientAssertionTokenSource acquires tokens using the client credentials grant,
+// authenticating with a client assertion that is signed for every token request (private_key_jwt).
+type clientAssertionTokenSource struct {
+	ctx    context.Context
+	config OAuth2Config
+	key    jwk.Key
+	alg    jwa.SignatureAlgorithm
+}
+
+func newClientAssertionTokenSource(ctx context.Context, config OAuth2Config) (*clientAssertionTokenSource, error) {
+	key, err := jwk.ParseKey([]byte(config.PrivateKeyPEM), jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 private key is invalid: %w", err)
+	}
+	if config.KeyID != "" {
+		if err := key.Set(jwk.KeyIDKey, config.KeyID); err != nil {
+			return nil, fmt.Errorf("set kid: %w", err)
+		}
+	}
+	alg, err := signingAlgorithm(key, config.SigningAlg)
+	if err != nil {
+		return nil, err
+	}
+	return &clientAssertionTokenSource{
+		ctx:    ctx,
+		config: config,
+		key:    key,
+		alg:    alg,
+	}, nil
+}
+
+func (s *clientAssertionTokenSource) Token() (*oauth2.Token, error) {
+	assertion, err := s.clientAssertion()
+	if err != nil {
+		return nil, err
+	}
+	params := s.config.endpointParams()
+	params.Set("client_assertion_type", ClientAssertionType)
+	params.Set("client_assertion", assertion)
+	conf := &clientcredentials.Config{
+		ClientID:       s.config.ClientID,
+		TokenURL:       s.config.TokenEndpoint,
+		Scopes:         s.config.Scopes,
+		AuthStyle:      oauth2.AuthStyleInParams,
+		EndpointParams: params,
+	}
+	return conf.Token(s.ctx)
+}
+
+// endpointParams returns the additional parameters of token requests: the audience and the extra parameters.
+func (c OAuth2Config) endpointParams() url.Values {
+	params := url.Values{}
+	for key, value := range c.ExtraParams {
+		params.Set(key, value)
+	}
+	if c.Audience != "" {
+		params.Set("audience", c.Audience)
+	}
+	return params
+}
+
+// clientAssertion returns a signed JWT that authenticates the client at the token endpoint (RFC 7523, section 3).
+func (s *clientAssertionTokenSource) clientAssertion() (string, error) {
+	now := time.Now()
+	token, err := jwt.NewBuilder().
+		Issuer(s.config.ClientID).
+		Subject(s.config.ClientID).
+		Audience([]string{s.config.TokenEndpoint}).
+		IssuedAt(now).
+		Expiration(now.Add(clientAssertionValidity)).
+		JwtID(uuid.NewString()).
+		Build()
+	if err != nil {
+		return "", fmt.Errorf("build client assertion: %w", err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(s.alg, s.key))
+	if err != nil {
+		return "", fmt.Errorf("sign client assertion: %w", err)
+	}
+	return string(signed), nil
+}
+
+// signingAlgorithm returns the configured signing algorithm, or the default for the type of key if none is configured.
+func signingAlgorithm(key jwk.Key, configured string) (jwa.SignatureAlgorithm, error) {
+	if configured != "" {
+		var alg jwa.SignatureAlgorithm
+		if err := alg.Accept(configured); err != nil {
+			return "", fmt.Errorf("oauth2 signing algorithm is invalid: %w", err)
+		}
+		return alg, nil
+	}
+	switch k := key.(type) {
+	case jwk.RSAPrivateKey:
+		return jwa.RS256, nil
+	case jwk.ECDSAPrivateKey:
+		switch k.Crv() {
+		case jwa.P256:
+			return jwa.ES256, nil
+		case jwa.P384:
+			return jwa.ES384, nil
+		case jwa.P521:
+			return jwa.ES512, nil
+		}
+	}
+	return "", fmt.Errorf("oauth2 private key of type %s is not supported, configure signingalg", key.KeyType())
+}
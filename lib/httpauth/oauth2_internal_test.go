@@ -0,0 +1,47 @@
+package httpauth
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+func TestRetryingTokenSource_Token(t *testing.T) {
+	t.Run("stops waiting for a retry when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var attempts atomic.Int32
+		source := retryingTokenSource{
+			ctx: ctx,
+			source: tokenSourceFunc(func() (*oauth2.Token, error) {
+				attempts.Add(1)
+				cancel()
+				return nil, &url.Error{Op: "Post", URL: "https://auth.example.com/token", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+			}),
+			attempts: 3,
+			backoff:  time.Hour,
+			timeout:  2 * time.Hour,
+		}
+
+		start := time.Now()
+		_, err := source.Token()
+
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, err, syscall.ECONNREFUSED)
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, int32(1), attempts.Load())
+	})
+}
@@ -1,8 +1,10 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 )
 
 // Error returns a slog attribute for errors.
@@ -24,3 +26,52 @@ func TypeOf(key string, v any) slog.Attr {
 func Component(v any) slog.Attr {
 	return TypeOf("component", v)
 }
+
+// Config returns a slog attribute for a configuration struct, with the values of sensitive fields
+// (e.g. client secrets, passwords, tokens and private keys) redacted.
+func Config(key string, config any) slog.Attr {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return slog.String(key, "<invalid configuration>")
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return slog.String(key, "<invalid configuration>")
+	}
+	return slog.Any(key, redact(value))
+}
+
+// redactedValue replaces the values of sensitive fields in logged configuration.
+const redactedValue = "<redacted>"
+
+func redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, fieldValue := range v {
+			if isSensitiveField(name) {
+				if fieldValue != nil && fieldValue != "" {
+					v[name] = redactedValue
+				}
+			} else {
+				v[name] = redact(fieldValue)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return value
+}
+
+// isSensitiveField returns whether the configuration field with the given name holds a secret.
+func isSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range []string{"secret", "password", "privatekey", "private_key", "authorization", "apikey", "api_key"} {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	// Token endpoints are fine to log, the tokens themselves aren't
+	return strings.HasSuffix(name, "token")
+}
@@ -1,6 +1,11 @@
 package netutil
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
 
 // FreeTCPPort asks the kernel for a free open port that is ready to use.
 // Taken from https://gist.github.com/sevkin/96bdae9274465b2d09191384f86ef39d
@@ -16,3 +21,16 @@ func FreeTCPPort() (port int, err error) {
 	defer l.Close()
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
+
+// ValidateHTTPURL checks that the value is an absolute URL with the http or https scheme.
+func ValidateHTTPURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if (scheme != "http" && scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL (url=%s)", value)
+	}
+	return nil
+}
@@ -15,3 +15,12 @@ func TestFreeTCPPort(t *testing.T) {
 		assert.NotEqual(t, port1, port2)
 	})
 }
+
+func TestValidateHTTPURL(t *testing.T) {
+	for _, value := range []string{"http://localhost:8080/fhir", "https://example.com", "HTTPS://example.com/fhir"} {
+		assert.NoError(t, ValidateHTTPURL(value), value)
+	}
+	for _, value := range []string{"", "localhost:8080/fhir", "ftp://example.com", "https:///fhir", "http://[::1"} {
+		assert.Error(t, ValidateHTTPURL(value), value)
+	}
+}
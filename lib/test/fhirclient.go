@@ -278,6 +278,11 @@ func (s *StubFHIRClient) SearchWithContext(ctx context.Context, resourceType str
 			filterCandidates(func(candidate BaseResource) bool {
 				return candidate.Meta != nil && candidate.Meta.Source != nil && *candidate.Meta.Source == value
 			})
+		case "_source:below":
+			filterCandidates(func(candidate BaseResource) bool {
+				return candidate.Meta != nil && candidate.Meta.Source != nil &&
+					(*candidate.Meta.Source == value || strings.HasPrefix(*candidate.Meta.Source, value+"/"))
+			})
 		case "status":
 			filterCandidates(func(candidate BaseResource) bool {
 				return candidate.asMap()["status"] == value